@@ -0,0 +1,85 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"github.com/pigeonlab/notifier/internal/detached"
+	"github.com/pigeonlab/notifier/interr"
+)
+
+// Acknowledger is implemented by the sources that settle their messages once processed, e.g. the SQS, Kafka
+// or AMQP consumers. The engine acknowledges a message once it is delivered to all its sinks, or dropped,
+// and negatively acknowledges it otherwise, once the attempts of its deliveries are spent.
+// The message passed back is the one returned by Next, with its Handle.
+type Acknowledger interface {
+	// Ack tells that the message was processed: it must not be delivered again, e.g. it is deleted from the queue
+	// or its offset is committed.
+	Ack(ctx context.Context, message Message) error
+	// Nack tells that the message was not processed. The source redelivers the retryable ones, e.g. with a visibility
+	// timeout or a requeue, and sends the other ones to its dead letter queue, see Nack.
+	Nack(ctx context.Context, message Message, nack Nack) error
+}
+
+// Nack is the negative acknowledgement of a message.
+// Retryable tells whether delivering the message again may succeed: it is true only when all its failed
+// deliveries are retryable, see Delivery.Retryable. Otherwise the failure is permanent, e.g. a 400 response,
+// a transform failure or an unknown sink, and redelivering the message would fail the same way.
+// The message may have been delivered to some of its sinks: the redelivery sends it to all of them again.
+type Nack struct {
+	Retryable  bool
+	Deliveries []Delivery
+}
+
+// newNack returns the negative acknowledgement of the failed deliveries of a message.
+func newNack(failures []Delivery) Nack {
+	nack := Nack{Retryable: len(failures) > 0, Deliveries: failures}
+	for _, delivery := range failures {
+		nack.Retryable = nack.Retryable && delivery.Retryable()
+	}
+
+	return nack
+}
+
+// Retryable reports whether the failed delivery may succeed if made again, e.g. after a timeout, a 429 or 503 response
+// or a cancellation, as opposed to a permanent failure, e.g. a 400 response, see interr.IsRetryable.
+func (d Delivery) Retryable() bool {
+	if d.Err != nil {
+		return interr.IsRetryable(d.Err)
+	}
+	if d.Response == nil {
+		return false
+	}
+
+	return (&interr.StatusError{Code: d.Response.StatusCode}).Retryable()
+}
+
+// settle acknowledges the message, or negatively acknowledges it when it has failed deliveries,
+// if the source is an Acknowledger.
+func (e *Engine) settle(ctx context.Context, message Message, failures []Delivery) error {
+	acknowledger, ok := e.source.(Acknowledger)
+	if !ok {
+		return nil
+	}
+
+	var err error
+	if len(failures) == 0 {
+		err = acknowledger.Ack(ackContext(ctx), message)
+	} else {
+		err = acknowledger.Nack(ackContext(ctx), message, newNack(failures))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to acknowledge the message: %v", err)
+	}
+
+	return nil
+}
+
+// ackContext returns the context of the acknowledgements: the one of the run, unless it is done,
+// so that the messages interrupted by a shutdown are still negatively acknowledged and promptly redelivered.
+func ackContext(ctx context.Context) context.Context {
+	if ctx.Err() == nil {
+		return ctx
+	}
+
+	return detached.Context(ctx)
+}
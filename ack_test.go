@@ -0,0 +1,121 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// queueSource is a Source acknowledging its messages, like a queue consumer.
+type queueSource struct {
+	messages []string
+	acked    []interface{}
+	nacked   map[interface{}]Nack
+	ctxErrs  []error
+}
+
+// Next implements the Source interface.
+func (s *queueSource) Next(context.Context) (Message, error) {
+	if len(s.messages) == 0 {
+		return Message{}, io.EOF
+	}
+
+	body := s.messages[0]
+	s.messages = s.messages[1:]
+	return Message{Body: []byte(body), Handle: "receipt-" + body}, nil
+}
+
+// Ack implements the Acknowledger interface.
+func (s *queueSource) Ack(ctx context.Context, message Message) error {
+	s.ctxErrs = append(s.ctxErrs, ctx.Err())
+	s.acked = append(s.acked, message.Handle)
+	return nil
+}
+
+// Nack implements the Acknowledger interface.
+func (s *queueSource) Nack(ctx context.Context, message Message, nack Nack) error {
+	s.ctxErrs = append(s.ctxErrs, ctx.Err())
+	if s.nacked == nil {
+		s.nacked = map[interface{}]Nack{}
+	}
+	s.nacked[message.Handle] = nack
+	return nil
+}
+
+func TestTheEngineSettlesTheMessagesOfAnAcknowledger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case string(body) == "bad":
+			w.WriteHeader(http.StatusBadRequest)
+		case string(body) == "busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case string(body) == "split" && req.URL.Path == "/audit":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+	}))
+	defer server.Close()
+
+	source := &queueSource{messages: []string{"ok", "bad", "busy", "skip", "broken", "split"}}
+	engine := NewEngine(source,
+		WithSink("main", Sink{URL: server.URL + "/main"}),
+		WithSink("audit", Sink{URL: server.URL + "/audit"}),
+		WithTransform(func(message Message) (Message, error) {
+			switch string(message.Body) {
+			case "skip":
+				return message, ErrDrop
+			case "broken":
+				return Message{}, errors.New("invalid message")
+			}
+			return message, nil
+		}),
+	)
+
+	_, err := engine.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []interface{}{"receipt-ok", "receipt-skip"}, source.acked)
+	require.Len(t, source.nacked, 4)
+	assert.False(t, source.nacked["receipt-bad"].Retryable)
+	assert.Len(t, source.nacked["receipt-bad"].Deliveries, 2)
+	assert.True(t, source.nacked["receipt-busy"].Retryable)
+	assert.False(t, source.nacked["receipt-broken"].Retryable)
+	assert.False(t, source.nacked["receipt-split"].Retryable)
+	require.Len(t, source.nacked["receipt-split"].Deliveries, 1)
+	assert.Equal(t, "audit", source.nacked["receipt-split"].Deliveries[0].Sink)
+}
+
+func TestTheEngineNacksTheInterruptedMessagesForRedelivery(t *testing.T) {
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-blocked
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	source := &queueSource{messages: []string{"hello"}}
+	engine := NewEngine(source, WithSink("main", Sink{URL: server.URL}))
+
+	_, err := engine.Run(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, source.nacked, 1)
+	assert.True(t, source.nacked["receipt-hello"].Retryable)
+	assert.Equal(t, []error{nil}, source.ctxErrs)
+}
+
+func TestDeliveryRetryable(t *testing.T) {
+	assert.True(t, Delivery{Response: &http.Response{StatusCode: http.StatusTooManyRequests}}.Retryable())
+	assert.False(t, Delivery{Response: &http.Response{StatusCode: http.StatusNotFound}}.Retryable())
+	assert.False(t, Delivery{Err: ErrNoSink}.Retryable())
+	assert.False(t, Delivery{}.Retryable())
+}
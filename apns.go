@@ -0,0 +1,388 @@
+package notifier
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/pigeonlab/notifier/pkg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apnsTokenKey is the metadata key holding the device token of the messages sent by an APNs sink.
+const apnsTokenKey = "apns.token"
+
+// apnsTokenLifetime is how long a provider token is used: APNs rejects the tokens older than an hour,
+// and the ones renewed more than once every 20 minutes.
+const apnsTokenLifetime = 50 * time.Minute
+
+// apnsMaxCollapseID is the maximum size of a collapse ID, in bytes.
+const apnsMaxCollapseID = 64
+
+// apnsMaxStreams is the amount of concurrent streams per connection accepted by APNs.
+const apnsMaxStreams = 1000
+
+// APNsError is the error of the push notifications rejected by APNs, with the status code and the reason
+// of the response, e.g. 400 and BadCollapseId. The ones answered 429 or 503 are retryable.
+type APNsError struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *APNsError) Error() string {
+	return fmt.Sprintf("APNs rejected the notification with status code %d: %s", e.StatusCode, e.Reason)
+}
+
+// Retryable reports whether the notification can be sent again.
+func (e *APNsError) Retryable() bool {
+	return (&interr.StatusError{Code: e.StatusCode}).Retryable()
+}
+
+// Temporary returns the same as Retryable.
+func (e *APNsError) Temporary() bool {
+	return e.Retryable()
+}
+
+// APNs configures a sink sending push notifications with the Apple Push Notification service, see APNsSink.
+// The requests are authenticated with a provider token signed with the .p8 key of the given key ID and team ID,
+// and the topic is the bundle ID of the app. The device token of a message is the one returned by Token, by default
+// its "token" metadata, and its collapse ID the one returned by CollapseID, by default its "collapse-id" metadata:
+// the notifications with the same collapse ID replace each other on the device. The push type defaults to alert.
+// The URL defaults to the production environment, https://api.push.apple.com, or to the development one with Sandbox.
+// The unregistered device tokens are written line by line to the feedback writer, if any.
+// The connections, one by default, and the streams per connection, 1000 by default, are the ones of APNsClient.
+type APNs struct {
+	KeyID       string
+	TeamID      string
+	Key         []byte
+	Topic       string
+	Token       func(Message) string
+	CollapseID  func(Message) string
+	PushType    string
+	Sandbox     bool
+	URL         string
+	Feedback    io.Writer
+	Connections int
+	MaxStreams  int
+}
+
+// APNsSink returns a sink sending each message as a push notification to an Apple device with APNs, e.g. for a push
+// delivery worker: the first line of the body is the title of the alert, the other lines its body, and the metadata
+// of the message, but the device token and the collapse ID, are custom keys of the payload. The background
+// notifications have no alert and are sent with a low priority. The provider token is renewed every 50 minutes,
+// or once APNs answered that it expired. The notifications sent to an unregistered device token fail
+// with ErrUnregisteredToken and the token is written to the feedback writer, so that it can be removed.
+// The other rejected notifications fail with an APNsError. APNs requires HTTP/2: send them with APNsClient.
+func APNsSink(config APNs) Sink {
+	key, keyErr := parseAPNsKey(config.Key)
+	tokens := &providerTokens{keyID: config.KeyID, teamID: config.TeamID, key: key}
+	feedback := &apnsFeedback{w: config.Feedback, tokens: tokens}
+	apiURL := apnsURL(config)
+
+	pushType := config.PushType
+	if pushType == "" {
+		pushType = "alert"
+	}
+	header := http.Header{"Apns-Topic": {config.Topic}, "Apns-Push-Type": {pushType}}
+	if pushType == "background" {
+		header.Set("Apns-Priority", "5")
+	}
+
+	return Sink{
+		URL:    apiURL,
+		Method: http.MethodPost,
+		Header: header,
+		Transform: func(message Message) (Message, error) {
+			if keyErr != nil {
+				return message, keyErr
+			}
+
+			token := apnsToken(config, message)
+			if token == "" {
+				return message, errors.New("the message has no device token")
+			}
+			collapseID := apnsCollapseID(config, message)
+			if len(collapseID) > apnsMaxCollapseID {
+				return message, fmt.Errorf("the collapse ID exceeds %d bytes: %s", apnsMaxCollapseID, collapseID)
+			}
+			providerToken, err := tokens.get()
+			if err != nil {
+				return message, err
+			}
+
+			return apnsMessage(message, pushType, token, collapseID, providerToken)
+		},
+		Endpoint: func(message Message) string {
+			return apiURL + "/3/device/" + url.PathEscape(message.Metadata[apnsTokenKey])
+		},
+		Check: feedback.check,
+	}
+}
+
+// APNsClient returns the HTTP client of the engines sending push notifications with an APNs sink,
+// see WithHTTPClient. It speaks HTTP/2 with APNs, over the configured amount of connections, and holds the requests
+// beyond the streams of those connections until a stream is available, instead of opening more connections.
+// The requests to the other hosts are sent as usual. Add pkg.WithMultiplexing to the client options of the engine
+// so that the first requests share a connection rather than racing to open one each.
+func APNsClient(config APNs) *http.Client {
+	connections := config.Connections
+	if connections < 1 {
+		connections = 1
+	}
+	streams := config.MaxStreams
+	if streams < 1 {
+		streams = apnsMaxStreams
+	}
+
+	apiURL, _ := url.Parse(apnsURL(config))
+	transport := pkg.NewTransport(pkg.TransportHTTP2(true), pkg.TransportMaxConnsPerHost(connections))
+
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &streamLimit{next: transport, host: apiURL.Host, streams: make(chan struct{}, connections*streams)},
+	}
+}
+
+// apnsURL returns the URL of the APNs environment of the configuration.
+func apnsURL(config APNs) string {
+	switch {
+	case config.URL != "":
+		return strings.TrimRight(config.URL, "/")
+	case config.Sandbox:
+		return "https://api.sandbox.push.apple.com"
+	default:
+		return "https://api.push.apple.com"
+	}
+}
+
+// apnsToken returns the device token of the message.
+func apnsToken(config APNs, message Message) string {
+	if config.Token != nil {
+		return config.Token(message)
+	}
+
+	return message.Metadata["token"]
+}
+
+// apnsCollapseID returns the collapse ID of the message, if any.
+func apnsCollapseID(config APNs, message Message) string {
+	if config.CollapseID != nil {
+		return config.CollapseID(message)
+	}
+
+	return message.Metadata["collapse-id"]
+}
+
+// apnsMessage returns the message with the APNs payload of the push notification as body, and the provider token
+// as authorization. The device token is kept in its metadata for the endpoint of the sink.
+func apnsMessage(message Message, pushType string, token string, collapseID string, providerToken string) (Message, error) {
+	payload := map[string]interface{}{}
+	metadata := map[string]string{apnsTokenKey: token}
+	for key, value := range message.Metadata {
+		if key != "token" && key != "collapse-id" && key != apnsTokenKey && key != "aps" {
+			payload[key] = value
+			metadata[key] = value
+		}
+	}
+
+	if pushType == "background" {
+		payload["aps"] = map[string]interface{}{"content-available": 1}
+	} else {
+		text := strings.TrimSpace(string(message.Body))
+		alert := map[string]string{"body": text}
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			alert["title"] = strings.TrimSpace(text[:i])
+			alert["body"] = strings.TrimSpace(text[i+1:])
+		}
+		payload["aps"] = map[string]interface{}{"alert": alert}
+	}
+
+	message, err := jsonMessage(message, payload)
+	if err != nil {
+		return message, err
+	}
+
+	header := http.Header{}
+	for key, values := range message.Header {
+		header[key] = values
+	}
+	header.Set("Authorization", "bearer "+providerToken)
+	if collapseID != "" {
+		header.Set("Apns-Collapse-Id", collapseID)
+	}
+	message.Header = header
+	message.Metadata = metadata
+	return message, nil
+}
+
+// apnsFeedback writes the unregistered device tokens to the feedback writer, if any,
+// and renews the provider token once APNs answered that it expired.
+type apnsFeedback struct {
+	mu     sync.Mutex
+	w      io.Writer
+	tokens *providerTokens
+}
+
+// check fails the responses rejecting a notification with an APNsError carrying the reason of the rejection,
+// or with ErrUnregisteredToken when the device token is not valid anymore, in which case the token is written
+// to the feedback writer.
+func (f *apnsFeedback) check(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil
+	}
+
+	var failure struct {
+		Reason string `json:"reason"`
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if json.Unmarshal(body, &failure) != nil || failure.Reason == "" {
+		return nil
+	}
+
+	switch failure.Reason {
+	case "Unregistered", "BadDeviceToken":
+		if token := MessageMetadata(res.Request.Context())[apnsTokenKey]; f.w != nil && token != "" {
+			f.mu.Lock()
+			_, _ = fmt.Fprintln(f.w, token)
+			f.mu.Unlock()
+		}
+		return ErrUnregisteredToken
+	case "ExpiredProviderToken":
+		f.tokens.expire(strings.TrimPrefix(res.Request.Header.Get("Authorization"), "bearer "))
+	}
+
+	return &APNsError{StatusCode: res.StatusCode, Reason: failure.Reason}
+}
+
+// parseAPNsKey parses the .p8 signing key of the provider tokens: a PKCS #8 PEM encoded P-256 key.
+func parseAPNsKey(p8 []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(p8)
+	if block == nil {
+		return nil, errors.New("invalid APNs signing key: no PEM private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs signing key: %v", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, errors.New("invalid APNs signing key: not a P-256 key")
+	}
+
+	return ecKey, nil
+}
+
+// providerTokens signs the provider tokens of APNs, JWT signed with ES256, and reuses them until they are about
+// to expire, since APNs throttles the providers renewing their token too often.
+type providerTokens struct {
+	mu       sync.Mutex
+	keyID    string
+	teamID   string
+	key      *ecdsa.PrivateKey
+	token    string
+	issuedAt time.Time
+}
+
+// get returns the current provider token, or a new one once it is about to expire.
+func (p *providerTokens) get() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Since(p.issuedAt) < apnsTokenLifetime {
+		return p.token, nil
+	}
+
+	now := time.Now()
+	token, err := p.sign(now)
+	if err != nil {
+		return "", err
+	}
+
+	p.token, p.issuedAt = token, now
+	return token, nil
+}
+
+// expire forgets the given provider token, if it is the current one, so that the next notifications get a new one.
+func (p *providerTokens) expire(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token == token {
+		p.token = ""
+	}
+}
+
+// sign returns a provider token issued at the given time, signed with the key.
+func (p *providerTokens) sign(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": p.keyID})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": p.teamID, "iat": now.Unix()})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, p.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign the APNs provider token: %v", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// streamLimit is a http.RoundTripper holding the requests to a host beyond the given amount of streams.
+// A stream is released once the response body is closed.
+type streamLimit struct {
+	next    http.RoundTripper
+	host    string
+	streams chan struct{}
+}
+
+// RoundTrip sends the request once a stream is available, or right away for the other hosts.
+func (l *streamLimit) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != l.host {
+		return l.next.RoundTrip(req)
+	}
+
+	select {
+	case l.streams <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	res, err := l.next.RoundTrip(req)
+	if err != nil {
+		<-l.streams
+		return nil, err
+	}
+
+	res.Body = &streamBody{ReadCloser: res.Body, release: func() { <-l.streams }}
+	return res, nil
+}
+
+// streamBody releases the stream of a response once its body is closed.
+type streamBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the body and releases its stream.
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
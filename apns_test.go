@@ -0,0 +1,248 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// apnsRequest is a push notification received by the APNs test server.
+type apnsRequest struct {
+	path       string
+	header     http.Header
+	payload    map[string]interface{}
+	jwtHeader  map[string]interface{}
+	jwtClaims  map[string]interface{}
+	validToken bool
+}
+
+// newAPNsKey returns a .p8 signing key and its public key.
+func newAPNsKey(t *testing.T) ([]byte, *ecdsa.PublicKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	encoded, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded}), &key.PublicKey
+}
+
+// newAPNsServer returns an APNs test server answering the notifications with the given function.
+func newAPNsServer(publicKey *ecdsa.PublicKey, requests *[]apnsRequest, answer func(apnsRequest, http.ResponseWriter)) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		request := apnsRequest{path: req.URL.Path, header: req.Header}
+		_ = json.NewDecoder(req.Body).Decode(&request.payload)
+
+		parts := strings.Split(strings.TrimPrefix(req.Header.Get("Authorization"), "bearer "), ".")
+		if len(parts) == 3 {
+			header, _ := base64.RawURLEncoding.DecodeString(parts[0])
+			claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			_ = json.Unmarshal(header, &request.jwtHeader)
+			_ = json.Unmarshal(claims, &request.jwtClaims)
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			request.validToken = len(signature) == 64 && ecdsa.Verify(publicKey, digest[:],
+				new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		*requests = append(*requests, request)
+		answer(request, w)
+	}))
+}
+
+func TestTheAPNsSinkSendsPushNotifications(t *testing.T) {
+	key, publicKey := newAPNsKey(t)
+	var requests []apnsRequest
+	server := newAPNsServer(publicKey, &requests, func(request apnsRequest, w http.ResponseWriter) {
+		if request.path == "/3/device/stale" {
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write([]byte(`{"reason": "Unregistered", "timestamp": 1609459200000}`))
+		}
+	})
+	defer server.Close()
+
+	var feedback bytes.Buffer
+	var failures []Delivery
+	engine := NewEngine(
+		SourceFunc(messages(
+			Message{Body: []byte("Goal!\nAda scored"), Metadata: map[string]string{"token": "device-1", "collapse-id": "match-42", "match": "42"}},
+			Message{Body: []byte("Hello"), Metadata: map[string]string{"token": "stale"}},
+			Message{Body: []byte("Hello"), Metadata: map[string]string{"token": "device-2", "collapse-id": strings.Repeat("x", 65)}},
+			Message{Body: []byte("Hello")},
+		)),
+		WithSink("apns", APNsSink(APNs{KeyID: "ABC123DEFG", TeamID: "DEF123GHIJ", Key: key, Topic: "com.example.app", Feedback: &feedback, URL: server.URL})),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery) })),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered)
+	require.Len(t, requests, 2)
+	for _, request := range requests {
+		assert.True(t, request.validToken, "signed provider token")
+		assert.Equal(t, map[string]interface{}{"alg": "ES256", "kid": "ABC123DEFG"}, request.jwtHeader)
+		assert.Equal(t, "DEF123GHIJ", request.jwtClaims["iss"])
+		assert.Equal(t, "com.example.app", request.header.Get("Apns-Topic"))
+		assert.Equal(t, "alert", request.header.Get("Apns-Push-Type"))
+		assert.Equal(t, "application/json", request.header.Get("Content-Type"))
+	}
+	assert.Equal(t, requests[0].header.Get("Authorization"), requests[1].header.Get("Authorization"), "the provider token is reused")
+	for _, request := range requests {
+		if request.path == "/3/device/device-1" {
+			assert.Equal(t, "match-42", request.header.Get("Apns-Collapse-Id"))
+			assert.Equal(t, map[string]interface{}{
+				"aps":   map[string]interface{}{"alert": map[string]interface{}{"title": "Goal!", "body": "Ada scored"}},
+				"match": "42",
+			}, request.payload)
+		}
+	}
+
+	assert.Equal(t, "stale\n", feedback.String())
+	require.Len(t, failures, 3)
+	failed := map[string]error{}
+	for _, failure := range failures {
+		failed[failure.Message.Metadata["token"]] = failure.Err
+	}
+	assert.Equal(t, ErrUnregisteredToken, failed["stale"])
+	assert.Contains(t, failed["device-2"].Error(), "the collapse ID exceeds 64 bytes")
+	assert.Contains(t, failed[""].Error(), "the message has no device token")
+}
+
+func TestTheAPNsSinkRenewsTheExpiredProviderToken(t *testing.T) {
+	key, publicKey := newAPNsKey(t)
+	var requests []apnsRequest
+	server := newAPNsServer(publicKey, &requests, func(request apnsRequest, w http.ResponseWriter) {
+		if request.path == "/3/device/device-1" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"reason": "ExpiredProviderToken"}`))
+		}
+	})
+	defer server.Close()
+
+	var failures []Delivery
+	engine := NewEngine(
+		SourceFunc(messages(
+			Message{Body: []byte("Hello"), Metadata: map[string]string{"token": "device-1"}},
+			Message{Body: []byte("Hello"), Metadata: map[string]string{"token": "device-2"}},
+		)),
+		WithSink("apns", APNsSink(APNs{KeyID: "ABC123DEFG", TeamID: "DEF123GHIJ", Key: key, Topic: "com.example.app", PushType: "background", URL: server.URL})),
+		WithChunks(1, 0),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery) })),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered)
+	require.Len(t, failures, 1)
+	assert.Equal(t, &APNsError{StatusCode: http.StatusForbidden, Reason: "ExpiredProviderToken"}, failures[0].Err)
+	assert.False(t, failures[0].Retryable())
+	require.Len(t, requests, 2)
+	assert.NotEqual(t, requests[0].header.Get("Authorization"), requests[1].header.Get("Authorization"), "a new provider token")
+	assert.Equal(t, "5", requests[1].header.Get("Apns-Priority"))
+	assert.Equal(t, map[string]interface{}{"aps": map[string]interface{}{"content-available": float64(1)}}, requests[1].payload)
+}
+
+func TestTheAPNsClientSpeaksHTTP2WithAPNs(t *testing.T) {
+	client := APNsClient(APNs{Sandbox: true, Connections: 2, MaxStreams: 100})
+
+	limit := client.Transport.(*streamLimit)
+	assert.Equal(t, "api.sandbox.push.apple.com", limit.host)
+	assert.Equal(t, 200, cap(limit.streams))
+	transport := limit.next.(*http.Transport)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.Equal(t, 2, transport.MaxConnsPerHost)
+}
+
+func TestTheAPNsClientHoldsTheRequestsBeyondTheStreams(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			previous := atomic.LoadInt32(&maxInFlight)
+			if current <= previous || atomic.CompareAndSwapInt32(&maxInFlight, previous, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &streamLimit{
+		next:    http.DefaultTransport,
+		host:    strings.TrimPrefix(server.URL, "http://"),
+		streams: make(chan struct{}, 2),
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Post(server.URL+"/3/device/device-1", "application/json", strings.NewReader("{}"))
+			if assert.NoError(t, err, "no errors") {
+				_ = res.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestTheThrottledAPNsNotificationsAreNackedAsRetryable(t *testing.T) {
+	key, publicKey := newAPNsKey(t)
+	var requests []apnsRequest
+	server := newAPNsServer(publicKey, &requests, func(request apnsRequest, w http.ResponseWriter) {
+		switch request.path {
+		case "/3/device/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"reason": "TooManyRequests"}`))
+		case "/3/device/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"reason": "ServiceUnavailable"}`))
+		}
+	})
+	defer server.Close()
+
+	source := &queueSource{messages: []string{"busy", "down"}}
+	engine := NewEngine(source,
+		WithSink("apns", APNsSink(APNs{
+			KeyID:  "ABC123DEFG",
+			TeamID: "DEF123GHIJ",
+			Key:    key,
+			Topic:  "com.example.app",
+			Token:  func(message Message) string { return string(message.Body) },
+			URL:    server.URL,
+		})),
+	)
+	_, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, source.nacked, 2)
+	for _, handle := range []string{"receipt-busy", "receipt-down"} {
+		nack := source.nacked[handle]
+		assert.True(t, nack.Retryable, handle)
+		require.Len(t, nack.Deliveries, 1)
+		assert.True(t, interr.IsRetryable(nack.Deliveries[0].Err), handle)
+	}
+}
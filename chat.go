@@ -0,0 +1,231 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// teamsCardType is the content type of the Adaptive Card attachments of the Teams messages.
+const teamsCardType = "application/vnd.microsoft.card.adaptive"
+
+// CardData is the data of the card templates of the chat sinks, see Teams and GoogleChat.
+// The title is the first line of the message body and the text the whole body.
+type CardData struct {
+	Title    string
+	Text     string
+	Tenant   string
+	Metadata map[string]string
+}
+
+// newCardData returns the card data of the message.
+func newCardData(message Message) CardData {
+	text := strings.TrimSpace(string(message.Body))
+	return CardData{
+		Title:    firstLine(text),
+		Text:     text,
+		Tenant:   message.Tenant,
+		Metadata: message.Metadata,
+	}
+}
+
+// cardTemplate parses the card template of a chat sink. The json function of the template writes a value as JSON,
+// e.g. {{json .Title}} for a quoted and escaped string.
+func cardTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	card, err := template.New("card").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid card template: %v", err)
+	}
+
+	return card, nil
+}
+
+// renderCard renders the card template with the data of the message. The card must be a JSON object.
+func renderCard(card *template.Template, message Message) (json.RawMessage, error) {
+	var rendered bytes.Buffer
+	if err := card.Execute(&rendered, newCardData(message)); err != nil {
+		return nil, fmt.Errorf("unable to render the card: %v", err)
+	}
+	if !json.Valid(rendered.Bytes()) {
+		return nil, fmt.Errorf("the rendered card is not valid JSON: %s", rendered.String())
+	}
+
+	return rendered.Bytes(), nil
+}
+
+// Teams configures a sink posting Microsoft Teams messages to an incoming webhook, see TeamsSink.
+// The card, if any, is a text/template rendering the Adaptive Card of each message from its CardData.
+type Teams struct {
+	WebhookURL string
+	Card       string
+}
+
+// TeamsSink returns a sink posting an Adaptive Card to a Microsoft Teams webhook for each message. By default,
+// the card shows the first line of the body as title, the whole body and the metadata of the message as facts.
+// The legacy connectors answer 200 even when the message is rejected, with the error in the body instead of "1":
+// those deliveries fail, with a retryable 429 status error when Teams throttled the webhook.
+func TeamsSink(config Teams) Sink {
+	card, cardErr := cardTemplate(config.Card)
+
+	return Sink{
+		URL:    config.WebhookURL,
+		Method: http.MethodPost,
+		Transform: func(message Message) (Message, error) {
+			if cardErr != nil {
+				return message, cardErr
+			}
+
+			content := defaultTeamsCard(message)
+			if card != nil {
+				var err error
+				if content, err = renderCard(card, message); err != nil {
+					return message, err
+				}
+			}
+
+			return jsonMessage(message, map[string]interface{}{
+				"type": "message",
+				"attachments": []map[string]interface{}{
+					{"contentType": teamsCardType, "content": content},
+				},
+			})
+		},
+		Check: checkTeamsResponse,
+	}
+}
+
+// defaultTeamsCard returns the default Adaptive Card of the message.
+func defaultTeamsCard(message Message) json.RawMessage {
+	data := newCardData(message)
+	body := []map[string]interface{}{
+		{"type": "TextBlock", "text": data.Title, "weight": "Bolder", "size": "Medium", "wrap": true},
+	}
+	if data.Text != data.Title {
+		body = append(body, map[string]interface{}{"type": "TextBlock", "text": data.Text, "wrap": true})
+	}
+	if len(data.Metadata) > 0 {
+		var facts []map[string]string
+		for _, key := range sortedKeys(data.Metadata) {
+			facts = append(facts, map[string]string{"title": key, "value": data.Metadata[key]})
+		}
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	}
+
+	card, _ := json.Marshal(map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	})
+	return card
+}
+
+// checkTeamsResponse fails the successful responses of the legacy Teams connectors carrying an error,
+// i.e. with a body which is neither empty nor "1".
+func checkTeamsResponse(res *http.Response) error {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read the Teams response: %v", err)
+	}
+
+	message := strings.TrimSpace(string(body))
+	if message == "" || message == "1" {
+		return nil
+	}
+	if strings.Contains(message, "429") {
+		return &interr.StatusError{Method: res.Request.Method, URL: res.Request.URL.String(), Code: http.StatusTooManyRequests}
+	}
+
+	return fmt.Errorf("the Teams webhook rejected the message: %s", message)
+}
+
+// GoogleChat configures a sink posting Google Chat messages to an incoming webhook, see GoogleChatSink.
+// The card, if any, is a text/template rendering the card of each message from its CardData, sent as its only cardsV2.
+// The thread key, if any, groups the messages with the same key in a single thread of the space.
+type GoogleChat struct {
+	WebhookURL string
+	Card       string
+	Thread     IncidentKey
+}
+
+// GoogleChatSink returns a sink posting a message to a Google Chat webhook for each message, with the message body
+// as text by default. Google Chat accepts one message per second and per space, and answers 429 beyond:
+// the deliveries are retried with WithRetry, and a rate limit, see pkg.WithRateLimit, avoids the throttling.
+func GoogleChatSink(config GoogleChat) Sink {
+	card, cardErr := cardTemplate(config.Card)
+
+	webhookURL := config.WebhookURL
+	if config.Thread != nil {
+		webhookURL = withQuery(webhookURL, "messageReplyOption", "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD")
+	}
+
+	return Sink{
+		URL:    webhookURL,
+		Method: http.MethodPost,
+		Transform: func(message Message) (Message, error) {
+			if cardErr != nil {
+				return message, cardErr
+			}
+
+			payload := map[string]interface{}{}
+			if card != nil {
+				content, err := renderCard(card, message)
+				if err != nil {
+					return message, err
+				}
+				payload["cardsV2"] = []map[string]interface{}{{"cardId": "notification", "card": content}}
+			} else {
+				payload["text"] = newCardData(message).Text
+			}
+			if config.Thread != nil {
+				payload["thread"] = map[string]string{"threadKey": incidentKey(config.Thread, message)}
+			}
+
+			return jsonMessage(message, payload)
+		},
+	}
+}
+
+// withQuery adds the query parameter to the URL. The invalid URLs are returned as they are and fail when sent.
+func withQuery(rawURL string, key, value string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := parsed.Query()
+	query.Set(key, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// sortedKeys returns the keys of the map in alphabetical order.
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
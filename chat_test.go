@@ -0,0 +1,132 @@
+package notifier
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTheTeamsSinkPostsAdaptiveCards(t *testing.T) {
+	var requests []incidentRequest
+	server := newIncidentServer(&requests)
+	defer server.Close()
+
+	engine := NewEngine(
+		SourceFunc(messages(Message{Body: []byte("deploy done\nversion 1.2"), Metadata: map[string]string{"env": "prod"}})),
+		WithSink("teams", TeamsSink(Teams{WebhookURL: server.URL + "/webhook"})),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "application/json", requests[0].contentType)
+	attachment := requests[0].payload["attachments"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, teamsCardType, attachment["contentType"])
+	body := attachment["content"].(map[string]interface{})["body"].([]interface{})
+	require.Len(t, body, 3)
+	assert.Equal(t, "deploy done", body[0].(map[string]interface{})["text"])
+	assert.Equal(t, "deploy done\nversion 1.2", body[1].(map[string]interface{})["text"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"title": "env", "value": "prod"}}, body[2].(map[string]interface{})["facts"])
+}
+
+func TestTheTeamsSinkFailsTheRejectedMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/throttled":
+			_, _ = w.Write([]byte("Webhook message delivery failed with error: Microsoft Teams endpoint returned HTTP error 429"))
+		case "/invalid":
+			_, _ = w.Write([]byte("Summary or Text is required."))
+		default:
+			_, _ = w.Write([]byte("1"))
+		}
+	}))
+	defer server.Close()
+
+	var failures []Delivery
+	engine := NewEngine(
+		SourceFunc(messages(Message{Body: []byte("deploy done")})),
+		WithSink("ok", TeamsSink(Teams{WebhookURL: server.URL + "/ok", Card: `{"type": "AdaptiveCard", "body": [{"type": "TextBlock", "text": {{json .Title}}}]}`})),
+		WithSink("throttled", TeamsSink(Teams{WebhookURL: server.URL + "/throttled"})),
+		WithSink("invalid", TeamsSink(Teams{WebhookURL: server.URL + "/invalid"})),
+		WithSink("template", TeamsSink(Teams{WebhookURL: server.URL + "/ok", Card: `{"text": {{.Title}}}`})),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery) })),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered)
+	require.Len(t, failures, 3)
+	sinks := map[string]Delivery{}
+	for _, delivery := range failures {
+		sinks[delivery.Sink] = delivery
+	}
+	assert.True(t, sinks["throttled"].Retryable())
+	assert.Equal(t, http.StatusTooManyRequests, sinks["throttled"].Err.(*interr.StatusError).Code)
+	assert.False(t, sinks["invalid"].Retryable())
+	assert.EqualError(t, sinks["invalid"].Err, "the Teams webhook rejected the message: Summary or Text is required.")
+	assert.Contains(t, sinks["template"].Err.Error(), "not valid JSON")
+}
+
+func TestTheGoogleChatSinkPostsThreadedMessages(t *testing.T) {
+	var requests []incidentRequest
+	var queries []string
+	server := newIncidentServer(&requests)
+	defer server.Close()
+	recorder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		queries = append(queries, req.URL.RawQuery)
+		server.Config.Handler.ServeHTTP(w, req)
+	}))
+	defer recorder.Close()
+
+	engine := NewEngine(
+		SourceFunc(messages(
+			Message{Body: []byte("disk full"), Metadata: map[string]string{"host": "db-1"}},
+			Message{Body: []byte("disk full"), Metadata: map[string]string{"host": "db-1"}},
+		)),
+		WithSink("text", GoogleChatSink(GoogleChat{
+			WebhookURL: recorder.URL + "/v1/spaces/space/messages?key=k&token=t",
+			Thread:     func(message Message) string { return message.Metadata["host"] },
+		})),
+		WithSink("card", GoogleChatSink(GoogleChat{
+			WebhookURL: recorder.URL + "/v1/spaces/space/messages?key=k&token=t",
+			Card:       `{"header": {"title": {{json .Title}}, "subtitle": {{json (index .Metadata "host")}}}}`,
+		})),
+		WithChunks(1, 0),
+		WithWorkers(1, 1),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.Delivered)
+	require.Len(t, requests, 4)
+	for i, request := range requests {
+		if _, ok := request.payload["text"]; ok {
+			assert.Equal(t, "disk full", request.payload["text"])
+			assert.Equal(t, map[string]interface{}{"threadKey": "db-1"}, request.payload["thread"])
+			assert.Equal(t, "key=k&messageReplyOption=REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD&token=t", queries[i])
+			continue
+		}
+		card := request.payload["cardsV2"].([]interface{})[0].(map[string]interface{})["card"]
+		assert.Equal(t, map[string]interface{}{"title": "disk full", "subtitle": "db-1"}, card.(map[string]interface{})["header"])
+		assert.Equal(t, "key=k&token=t", queries[i])
+	}
+}
+
+func TestTheInvalidCardTemplatesFailTheDeliveries(t *testing.T) {
+	var failures []error
+	engine := NewEngine(
+		SourceFunc(messages(Message{Body: []byte("deploy done")})),
+		WithSink("chat", GoogleChatSink(GoogleChat{WebhookURL: "http://localhost", Card: "{{"})),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery.Err) })),
+	)
+	_, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, failures, 1)
+	assert.Contains(t, failures[0].Error(), "invalid card template")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxAdaptiveFailureRate is the share of failed notifications in a chunk above which the chunk size is halved.
+const maxAdaptiveFailureRate = 0.05
+
+// nextChunkSize returns the size of the next chunk with an additive-increase/multiplicative-decrease policy.
+// The chunk size grows by one while the chunks complete within the interval without failures,
+// and it is halved as soon as a chunk is too slow or too many notifications fail.
+func nextChunkSize(conf configuration, res result, elapsed time.Duration) int {
+	size := conf.chunkSize
+	if elapsed > conf.interval || failureRate(res) > maxAdaptiveFailureRate {
+		size = size / 2
+		if size < 1 {
+			size = 1
+		}
+	} else if size < conf.maxChunkSize {
+		size++
+	}
+
+	if size != conf.chunkSize {
+		log.Printf("Adapting the chunk size from %d to %d (round-trip %v).", conf.chunkSize, size, elapsed)
+	}
+
+	return size
+}
+
+// failureRate returns the share of notifications that failed or were rejected by an overloaded target.
+func failureRate(res result) float64 {
+	if len(res.errors) == 0 {
+		return 0
+	}
+
+	failed := 0
+	for i, err := range res.errors {
+		if isStruggling(res.responses[i], err) {
+			failed++
+		}
+	}
+
+	return float64(failed) / float64(len(res.errors))
+}
+
+// isStruggling reports whether the notification failed because the target can't keep up:
+// the request failed or the target responded with 429 or 5xx.
+func isStruggling(res *http.Response, err error) bool {
+	return err != nil || (res != nil && (res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500))
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// stdinInput is the path recorded in the audit manifest for the messages read from STDIN.
+const stdinInput = "-"
+
+// auditManifest describes an executed notify run: its settings, the hashes of its inputs and the result
+// of every message. Signed with an ed25519, ECDSA or RSA key, it lets an auditor verify that the run was executed
+// with these inputs and that the manifest was not tampered with.
+type auditManifest struct {
+	Target      string              `json:"target"`
+	Flags       map[string][]string `json:"flags"`
+	Inputs      []auditInput        `json:"inputs"`
+	Messages    int                 `json:"messages"`
+	Succeeded   int                 `json:"succeeded"`
+	Failed      int                 `json:"failed"`
+	Results     []jobResult         `json:"results"`
+	StartedAt   time.Time           `json:"startedAt"`
+	CompletedAt time.Time           `json:"completedAt"`
+	Algorithm   string              `json:"algorithm,omitempty"`
+	PublicKey   string              `json:"publicKey,omitempty"`
+	Signature   string              `json:"signature,omitempty"`
+}
+
+// auditInput is the SHA-256 hash of an input of the run.
+type auditInput struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// auditTrail writes the audit manifest of a notify run once it completes.
+// A nil *auditTrail writes nothing.
+type auditTrail struct {
+	path      string
+	key       crypto.Signer
+	crypto    cryptoProvider
+	conf      configuration
+	flags     map[string][]string
+	first     int
+	startedAt time.Time
+	stdin     hash.Hash
+	files     []*auditFile
+}
+
+// auditFile is the hash of an input file, fed with the bytes of the file as they are read.
+type auditFile struct {
+	path   string
+	hash   hash.Hash
+	hashed int64
+}
+
+// newAuditTrail returns a new instance of auditTrail. It returns nil when no manifest is requested.
+// The results of a resumed job are numbered from the given first message.
+func newAuditTrail(conf configuration, flags *flag.FlagSet, first int) (*auditTrail, error) {
+	if conf.auditManifest == "" {
+		return nil, nil
+	}
+
+	provider, err := newCryptoProvider(conf.crypto)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &auditTrail{
+		path:      conf.auditManifest,
+		crypto:    provider,
+		conf:      conf,
+		flags:     snapshotFlags(flags),
+		first:     first,
+		startedAt: time.Now().UTC(),
+	}
+	if conf.signingKey != "" {
+		key, err := readPrivateKey(conf.signingKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the signing key: %v", err)
+		}
+		if err := provider.supports(key.Public()); err != nil {
+			return nil, fmt.Errorf("unable to sign with the signing key: %v", err)
+		}
+		a.key = key
+	}
+
+	return a, nil
+}
+
+// watch returns the input to read the messages from. The messages read from STDIN are hashed as they are read,
+// the input files by watchFile.
+func (a *auditTrail) watch(input io.Reader) io.Reader {
+	if a == nil || len(a.conf.inputFiles) > 0 {
+		return input
+	}
+
+	a.stdin = a.crypto.newHash()
+	return io.TeeReader(input, a.stdin)
+}
+
+// watchFile returns the reader of the input file, after the bytes skipped by a resumed job:
+// the file is hashed as it is read. The skipped bytes are hashed at once, and the bytes not read once the run
+// completes are hashed when the manifest is written, so that the hash covers the whole file.
+func (a *auditTrail) watchFile(file *os.File, skipped int64) (io.Reader, error) {
+	if a == nil {
+		return file, nil
+	}
+
+	f := &auditFile{path: file.Name(), hash: a.crypto.newHash()}
+	if _, err := io.Copy(f, io.NewSectionReader(file, 0, skipped)); err != nil {
+		return nil, err
+	}
+	a.files = append(a.files, f)
+
+	return io.TeeReader(file, f), nil
+}
+
+// Write adds the bytes read from the file to its hash.
+func (f *auditFile) Write(p []byte) (int, error) {
+	f.hashed += int64(len(p))
+	return f.hash.Write(p)
+}
+
+// sum returns the hex-encoded hash of the file, after hashing the bytes that were not read.
+func (f *auditFile) sum() (string, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(f.hashed, io.SeekStart); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(f.hash.Sum(nil)), nil
+}
+
+// write writes the manifest of the completed run, signed if a signing key is set.
+func (a *auditTrail) write(finalResult result) error {
+	if a == nil {
+		return nil
+	}
+
+	failed := countFailures(a.conf, finalResult)
+	manifest := auditManifest{
+		Target:      a.conf.targetUrl,
+		Flags:       a.flags,
+		Messages:    len(finalResult.errors),
+		Succeeded:   len(finalResult.errors) - failed,
+		Failed:      failed,
+		Results:     messageResults(a.first, finalResult),
+		StartedAt:   a.startedAt,
+		CompletedAt: time.Now().UTC(),
+	}
+
+	if a.stdin != nil {
+		manifest.Inputs = append(manifest.Inputs, auditInput{Path: stdinInput, SHA256: hex.EncodeToString(a.stdin.Sum(nil))})
+	}
+	for _, file := range a.files {
+		sum, err := file.sum()
+		if err != nil {
+			return err
+		}
+		manifest.Inputs = append(manifest.Inputs, auditInput{Path: file.path, SHA256: sum})
+	}
+
+	if a.key != nil {
+		publicKey, err := encodePublicKey(a.key.Public())
+		if err != nil {
+			return err
+		}
+		manifest.PublicKey = publicKey
+		manifest.Algorithm = algorithmOf(a.key.Public())
+		payload, err := manifest.payload()
+		if err != nil {
+			return err
+		}
+		signature, err := a.crypto.sign(a.key, payload)
+		if err != nil {
+			return fmt.Errorf("unable to sign the audit manifest: %v", err)
+		}
+		manifest.Signature = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	bs, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(a.path, bs, 0644)
+}
+
+// payload returns the signed bytes of the manifest: its JSON encoding without the signature.
+func (m auditManifest) payload() ([]byte, error) {
+	m.Signature = ""
+	return json.Marshal(m)
+}
+
+// verify checks the signature of the manifest with the given public key and crypto provider.
+func (m auditManifest) verify(provider cryptoProvider, key crypto.PublicKey) error {
+	if m.Signature == "" {
+		return errors.New("the manifest is not signed")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+
+	payload, err := m.payload()
+	if err != nil {
+		return err
+	}
+
+	return provider.verify(key, m.Algorithm, payload, signature)
+}
+
+// encodePublicKey returns the base64 encoding of the public key recorded in the manifest:
+// the raw ed25519 key, as in the manifests written before the ECDSA and RSA keys were supported,
+// or the PKIX encoding of the other keys.
+func encodePublicKey(key crypto.PublicKey) (string, error) {
+	if edKey, ok := key.(ed25519.PublicKey); ok {
+		return base64.StdEncoding.EncodeToString(edKey), nil
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// hashFile returns the hex-encoded hash of the file at the given path, computed by the given crypto provider.
+func hashFile(provider cryptoProvider, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := provider.newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readPrivateKey reads an ed25519, ECDSA or RSA private key from a PKCS #8 PEM file,
+// e.g. generated with openssl genpkey -algorithm ed25519.
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("not a signing key")
+	}
+
+	return signer, nil
+}
+
+// readPublicKey reads a public key from a PKIX PEM file, e.g. generated with openssl pkey -pubout.
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// readPEM reads the first PEM block of the file at the given path.
+func readPEM(path string) (*pem.Block, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	return block, nil
+}
+
+// newVerifyCommand returns the command that verifies a signed audit manifest.
+func newVerifyCommand() *command {
+	cmd := newCommand(
+		"verify",
+		"Verify the signature and the inputs of an audit manifest.",
+		"Verifies the signature of the audit manifest written with notify --auditManifest --signingKey,\n"+
+			"then hashes the input files it lists again to make sure they were not modified since the run.",
+	)
+	cmd.args = []string{"<manifest>"}
+
+	publicKey := cmd.flags.String("publicKey", "", "The PEM file of the public key matching the signing key. (Mandatory)")
+	cryptoName := cmd.flags.String("crypto", defaultCrypto, `The implementation of the hashing and signing primitives: "standard" or "fips", which only accepts ECDSA and RSA keys.`)
+
+	cmd.run = func(args []string) error {
+		if len(args) != 1 {
+			return usageError("You must specify the audit manifest to verify.")
+		}
+		if *publicKey == "" {
+			return usageError("The --publicKey flag is mandatory.")
+		}
+		if err := validateCrypto(*cryptoName); err != nil {
+			return err
+		}
+		provider, _ := newCryptoProvider(*cryptoName)
+
+		key, err := readPublicKey(*publicKey)
+		if err != nil {
+			return fmt.Errorf("unable to read the public key: %v", err)
+		}
+
+		bs, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		var manifest auditManifest
+		decoder := json.NewDecoder(bytes.NewReader(bs))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&manifest); err != nil {
+			return fmt.Errorf("invalid audit manifest: %v", err)
+		}
+
+		if err := manifest.verify(provider, key); err != nil {
+			return err
+		}
+		fmt.Printf("Signature: valid\n")
+
+		for _, input := range manifest.Inputs {
+			if input.Path == stdinInput {
+				fmt.Printf("Input STDIN: %s (can't be verified)\n", input.SHA256)
+				continue
+			}
+
+			sum, err := hashFile(provider, input.Path)
+			if err != nil {
+				fmt.Printf("Input %s: unable to hash it: %v\n", input.Path, err)
+				continue
+			}
+			if sum != input.SHA256 {
+				return fmt.Errorf("the input %s was modified since the run", input.Path)
+			}
+			fmt.Printf("Input %s: unchanged\n", input.Path)
+		}
+
+		fmt.Printf("Messages: %d - Succeeded %d - Failed %d\n", manifest.Messages, manifest.Succeeded, manifest.Failed)
+		return nil
+	}
+
+	return cmd
+}
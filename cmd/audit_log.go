@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// The prefix of the --auditLog values sending the audit records to syslog.
+const syslogTarget = "syslog"
+
+// auditRecord is the record of the final delivery outcome of a message in the audit log.
+// It holds the hash of the payload rather than its content.
+type auditRecord struct {
+	Time          time.Time `json:"time"`
+	Message       int       `json:"message"`
+	Target        string    `json:"target"`
+	PayloadSHA256 string    `json:"payloadSha256"`
+	PayloadBytes  int       `json:"payloadBytes"`
+	StatusCode    int       `json:"statusCode,omitempty"`
+	Outcome       string    `json:"outcome"`
+	Reason        string    `json:"reason,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// The outcomes of the audit records.
+const (
+	outcomeDelivered = "delivered"
+	outcomeFailed    = "failed"
+	outcomeParked    = "parked"
+	outcomeExpired   = "expired"
+)
+
+// auditLog appends a record per final delivery outcome to the audit log, a file or syslog,
+// apart from the operational logs. A nil *auditLog records nothing.
+type auditLog struct {
+	conf    configuration
+	writer  io.WriteCloser
+	message int
+}
+
+// newAuditLog opens the audit log of the --auditLog target: "syslog" for the local syslog,
+// "syslog://host:port" for a remote one, or the path of a file the records are appended to.
+// It returns nil when no audit log is requested. The records are numbered from the given first message.
+func newAuditLog(conf configuration, first int) (*auditLog, error) {
+	if conf.auditLog == "" {
+		return nil, nil
+	}
+
+	var writer io.WriteCloser
+	var err error
+	if conf.auditLog == syslogTarget || strings.HasPrefix(conf.auditLog, syslogTarget+"://") {
+		writer, err = openSyslog(strings.TrimPrefix(strings.TrimPrefix(conf.auditLog, syslogTarget), "://"))
+	} else {
+		writer, err = os.OpenFile(conf.auditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditLog{conf: conf, writer: writer, message: first}, nil
+}
+
+// record appends the final delivery outcome of each delivered message to the audit log.
+// The parked messages get a record for each delivery, until the final one.
+func (a *auditLog) record(messages []string, res result) error {
+	if a == nil {
+		return nil
+	}
+
+	err := a.recordFrom(a.message, messages, res)
+	a.message += len(res.errors)
+	return err
+}
+
+// recordFrom appends the delivery outcome of each message to the audit log, numbered from the given message.
+func (a *auditLog) recordFrom(first int, messages []string, res result) error {
+	if a == nil {
+		return nil
+	}
+
+	for i := range res.errors {
+		body := ""
+		if i < len(messages) {
+			body, _ = notificationBody(a.conf, messages[i])
+		}
+		sum := sha256.Sum256([]byte(body))
+
+		record := auditRecord{
+			Time:          time.Now().UTC(),
+			Message:       first + i,
+			PayloadSHA256: hex.EncodeToString(sum[:]),
+			PayloadBytes:  len(body),
+			Outcome:       outcomeDelivered,
+		}
+		if i < len(res.targets) {
+			record.Target = res.targets[i]
+		}
+		if res.responses[i] != nil {
+			record.StatusCode = res.responses[i].StatusCode
+		}
+		switch reason := failureReason(a.conf, res.responses[i], res.errors[i]); reason {
+		case "":
+		case reasonParked:
+			record.Outcome = outcomeParked
+		case reasonExpired:
+			record.Outcome = outcomeExpired
+		default:
+			record.Outcome, record.Reason = outcomeFailed, reason
+		}
+		if res.errors[i] != nil {
+			record.Error = res.errors[i].Error()
+		}
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		// A single write per record, so that the records of concurrent writers are not interleaved.
+		if _, err := a.writer.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close closes the audit log.
+func (a *auditLog) close() error {
+	if a == nil {
+		return nil
+	}
+
+	return a.writer.Close()
+}
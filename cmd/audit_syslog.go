@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// openSyslog connects to the syslog daemon at the given address over UDP, or to the local one when it's empty.
+// The audit records are sent with the LOG_AUTHPRIV facility.
+func openSyslog(address string) (io.WriteCloser, error) {
+	network := ""
+	if address != "" {
+		network = "udp"
+	}
+
+	return syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_AUTHPRIV, "notifier")
+}
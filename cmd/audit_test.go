@@ -0,0 +1,32 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestTheInputFilesAreHashedAsTheyAreRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.txt")
+	require.NoError(t, ioutil.WriteFile(path, []byte("one\ntwo\n"), 0600), "no errors")
+
+	audit := &auditTrail{crypto: standardCrypto{}}
+	input, err := openInputs([]string{path}, 4, audit.watchFile)
+	require.NoError(t, err, "no errors")
+	defer input.Close()
+
+	bs, err := ioutil.ReadAll(input)
+	require.NoError(t, err, "no errors")
+	assert.Equal(t, "two\n", string(bs))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("two\n"), 0600), "no errors")
+
+	sum, err := audit.files[0].sum()
+	require.NoError(t, err, "no errors")
+	expected := sha256.Sum256([]byte("one\ntwo\n"))
+	assert.Equal(t, hex.EncodeToString(expected[:]), sum)
+}
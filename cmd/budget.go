@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// maxSlowdown is the maximum amount of times the sending rate can be halved.
+const maxSlowdown = 6
+
+// errorBudget tracks the rolling failure rate of every target and slows down
+// the sending rate when a target exceeds the budget. A nil *errorBudget never slows down.
+type errorBudget struct {
+	threshold float64
+	window    int
+	outcomes  map[string][]bool
+	slowdown  int
+}
+
+// newErrorBudget returns a new instance of errorBudget. It returns nil when the threshold is zero.
+func newErrorBudget(threshold float64, window int) *errorBudget {
+	if threshold == 0 {
+		return nil
+	}
+
+	return &errorBudget{
+		threshold: threshold,
+		window:    window,
+		outcomes:  make(map[string][]bool),
+	}
+}
+
+// record adds the outcome of a chunk to the rolling windows and adjusts the slowdown.
+// The sending rate is halved when a target exceeds the budget and the chunk had failures for it,
+// and it is doubled back, one step per chunk, once every target is within the budget.
+func (b *errorBudget) record(res result) {
+	chunkFailures := make(map[string]bool)
+	for i, target := range res.targets {
+		failed := isStruggling(res.responses[i], res.errors[i])
+		chunkFailures[target] = chunkFailures[target] || failed
+
+		outcomes := append(b.outcomes[target], failed)
+		if len(outcomes) > b.window {
+			outcomes = outcomes[len(outcomes)-b.window:]
+		}
+		b.outcomes[target] = outcomes
+	}
+
+	exceeded := false
+	for target, outcomes := range b.outcomes {
+		if rollingFailureRate(outcomes) > b.threshold {
+			exceeded = true
+			if chunkFailures[target] && b.slowdown < maxSlowdown {
+				b.slowdown++
+				log.Printf("The target %s exceeded the error budget: halving the sending rate.", target)
+				return
+			}
+		}
+	}
+
+	if !exceeded && b.slowdown > 0 {
+		b.slowdown--
+		log.Println("The targets are within the error budget: doubling the sending rate.")
+	}
+}
+
+// interval returns the interval between each chunk for the current slowdown.
+func (b *errorBudget) interval(base time.Duration) time.Duration {
+	return base << uint(b.slowdown)
+}
+
+// rollingFailureRate returns the share of failed outcomes.
+func rollingFailureRate(outcomes []bool) float64 {
+	if len(outcomes) == 0 {
+		return 0
+	}
+
+	failed := 0
+	for _, outcome := range outcomes {
+		if outcome {
+			failed++
+		}
+	}
+
+	return float64(failed) / float64(len(outcomes))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// targetStats collects the outcome of the notifications sent to a single target.
+type targetStats struct {
+	sent      int
+	succeeded int
+	failed    int
+}
+
+// validateCanary makes sure the canary flags are valid.
+func validateCanary(conf configuration) error {
+	if conf.canaryURL == "" {
+		return nil
+	}
+
+	err := validateTargetURL(conf.canaryURL)
+	if err != nil {
+		return usageError("The --canaryUrl value is invalid.")
+	}
+
+	if conf.canaryPercent < 0 || conf.canaryPercent > 100 {
+		return usageError("The --canaryPercent value must be between 0 and 100.")
+	}
+
+	return nil
+}
+
+// canaryRandom picks the messages sent to the canary target. It is seeded explicitly,
+// since the global source of math/rand is not seeded before Go 1.20.
+var canaryRandom = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// chooseTargets returns the target URL of each message.
+// When a canary target is set, every message has a canaryPercent chance to be sent to it.
+func chooseTargets(conf configuration, messages int) []string {
+	canaryRandom.Lock()
+	defer canaryRandom.Unlock()
+
+	targets := make([]string, messages)
+	for i := range targets {
+		targets[i] = conf.targetUrl
+		if conf.canaryURL != "" && canaryRandom.Intn(100) < conf.canaryPercent {
+			targets[i] = conf.canaryURL
+		}
+	}
+
+	return targets
+}
+
+// hasMultipleTargets reports whether the notifications have been split between several targets.
+func hasMultipleTargets(finalResult result) bool {
+	for _, target := range finalResult.targets {
+		if target != finalResult.targets[0] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printTargetBreakdown pretty prints the outcome of the notifications for each target.
+// A notification succeeded when the target returned a 2xx status code or one of the --successStatus ones.
+func printTargetBreakdown(w io.Writer, conf configuration, finalResult result) {
+	var order []string
+	stats := make(map[string]*targetStats)
+	for i, target := range finalResult.targets {
+		if stats[target] == nil {
+			stats[target] = &targetStats{}
+			order = append(order, target)
+		}
+
+		stats[target].sent++
+		if failureReason(conf, finalResult.responses[i], finalResult.errors[i]) == "" {
+			stats[target].succeeded++
+		} else {
+			stats[target].failed++
+		}
+	}
+
+	_, _ = fmt.Fprint(w, "\nTARGETS ...\n")
+	for _, target := range order {
+		s := stats[target]
+		_, _ = fmt.Fprintf(w, "%s - Sent %d - Succeeded %d - Failed %d\n", target, s.sent, s.succeeded, s.failed)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"time"
+)
+
+// checkReport collects the diagnostic information of a test notification.
+type checkReport struct {
+	targetURL    string
+	response     *http.Response
+	err          error
+	dnsDuration  time.Duration
+	connDuration time.Duration
+	tlsDuration  time.Duration
+	firstByte    time.Duration
+	total        time.Duration
+	reusedConn   bool
+}
+
+// newCheckCommand returns the command that sends a single test notification to the target.
+func newCheckCommand() *command {
+	cmd := newCommand(
+		"check",
+		"Send a test notification and print a diagnostic report.",
+		"Sends a single test notification to the target URL, verifies the TLS connection and measures the latency.",
+	)
+
+	targetURL := cmd.flags.String("url", "", "The target URL that will receive the test notification. (Mandatory)")
+	body := cmd.flags.String("body", "notifier test notification", "The body of the test notification.")
+	requestTimeout := cmd.flags.Duration("requestTimeout", 5*time.Second, "The timeout for the HTTP request.")
+	var successStatuses statusCodesFlag
+	cmd.flags.Var(&successStatuses, "successStatus", "Consider the given status code as a success in addition to the 2xx ones. It can be repeated or hold comma-separated codes.")
+
+	cmd.run = func(args []string) error {
+		err := validateTargetURL(*targetURL)
+		if err != nil {
+			return err
+		}
+
+		HTTPClient := &http.Client{Timeout: *requestTimeout}
+		report := sendTestNotification(HTTPClient, *targetURL, *body)
+		report.print(os.Stdout)
+
+		if report.err != nil {
+			return fmt.Errorf("the test notification failed: %v", report.err)
+		}
+		code := report.response.StatusCode
+		if (code < 200 || code > 299) && !successStatuses.contains(code) {
+			return fmt.Errorf("the target returned status code %d", report.response.StatusCode)
+		}
+
+		return nil
+	}
+
+	return cmd
+}
+
+// sendTestNotification sends the given body to the target URL and traces every phase of the request.
+func sendTestNotification(HTTPClient *http.Client, targetURL string, body string) checkReport {
+	report := checkReport{targetURL: targetURL}
+
+	req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewBuffer([]byte(body)))
+	if err != nil {
+		report.err = err
+		return report
+	}
+
+	var start, dnsStart, connStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { report.dnsDuration = time.Since(dnsStart) },
+		ConnectStart:      func(string, string) { connStart = time.Now() },
+		ConnectDone:       func(string, string, error) { report.connDuration = time.Since(connStart) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			report.tlsDuration = time.Since(tlsStart)
+		},
+		GotConn:              func(info httptrace.GotConnInfo) { report.reusedConn = info.Reused },
+		GotFirstResponseByte: func() { report.firstByte = time.Since(start) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start = time.Now()
+	res, err := HTTPClient.Do(req)
+	if err != nil {
+		report.err = err
+		report.total = time.Since(start)
+		return report
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	report.total = time.Since(start)
+	report.response = res
+
+	return report
+}
+
+// print pretty prints the diagnostic report.
+func (r checkReport) print(w io.Writer) {
+	_, _ = fmt.Fprint(w, "\nCHECK REPORT ...\n")
+	_, _ = fmt.Fprintf(w, "Target:          %s\n", r.targetURL)
+	if r.response != nil {
+		_, _ = fmt.Fprintf(w, "Status:          %s\n", r.response.Status)
+		_, _ = fmt.Fprintf(w, "Protocol:        %s\n", r.response.Proto)
+	}
+	if r.err != nil {
+		_, _ = fmt.Fprintf(w, "Error:           %v\n", r.err)
+	}
+
+	_, _ = fmt.Fprintf(w, "DNS lookup:      %v\n", r.dnsDuration)
+	_, _ = fmt.Fprintf(w, "TCP connect:     %v\n", r.connDuration)
+	_, _ = fmt.Fprintf(w, "TLS handshake:   %v\n", r.tlsDuration)
+	_, _ = fmt.Fprintf(w, "First byte:      %v\n", r.firstByte)
+	_, _ = fmt.Fprintf(w, "Total:           %v\n", r.total)
+	_, _ = fmt.Fprintf(w, "Reused conn:     %t\n", r.reusedConn)
+
+	if r.response == nil {
+		return
+	}
+
+	state := r.response.TLS
+	if state == nil {
+		_, _ = fmt.Fprint(w, "TLS:             not used\n")
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "TLS version:     %s\n", tlsVersionName(state.Version))
+	_, _ = fmt.Fprintf(w, "Cipher suite:    %s\n", tls.CipherSuiteName(state.CipherSuite))
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		_, _ = fmt.Fprintf(w, "Certificate:     %s\n", cert.Subject)
+		_, _ = fmt.Fprintf(w, "Issuer:          %s\n", cert.Issuer)
+		_, _ = fmt.Fprintf(w, "Expires:         %s\n", cert.NotAfter.Format(time.RFC3339))
+		_, _ = fmt.Fprintf(w, "DNS names:       %s\n", strings.Join(cert.DNSNames, ", "))
+	}
+}
+
+// tlsVersionName returns the name of the TLS version, like tls.VersionName of Go 1.21.
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04X", version)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// command represents a notifier command.
+// Every command describes its flags and arguments so that the usage,
+// the shell completions and the man page can be generated from it.
+type command struct {
+	name        string
+	synopsis    string
+	description string
+	args        []string
+	flags       *flag.FlagSet
+	run         func(args []string) error
+}
+
+// usageError is returned by a command when it has been invoked incorrectly.
+// The command's flags are printed along with the error.
+type usageError string
+
+// Error implements the error interface.
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// stringsFlag is a flag value that collects the values of a repeated flag.
+type stringsFlag []string
+
+// String implements the flag.Value interface.
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set implements the flag.Value interface.
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// newCommand returns a new instance of command with an empty flag set.
+func newCommand(name, synopsis, description string) *command {
+	cmd := &command{
+		name:        name,
+		synopsis:    synopsis,
+		description: description,
+		flags:       flag.NewFlagSet(name, flag.ExitOnError),
+	}
+	cmd.flags.Usage = func() {
+		cmd.printUsage(cmd.flags.Output())
+	}
+
+	return cmd
+}
+
+// commands returns all the commands supported by the program.
+func commands() []*command {
+	return []*command{
+		newNotifyCommand(),
+		newResumeCommand(),
+		newFeedCommand(),
+		newVerifyCommand(),
+		newCheckCommand(),
+		newProbeCommand(),
+		newReplayTapeCommand(),
+		newCompletionCommand(),
+		newDocsCommand(),
+		newVersionCommand(),
+	}
+}
+
+// findCommand returns the command with the given name or nil if it does not exist.
+func findCommand(cmds []*command, name string) *command {
+	for _, cmd := range cmds {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+// commandNames returns the quoted names of the given commands.
+func commandNames(cmds []*command) string {
+	var names []string
+	for _, cmd := range cmds {
+		names = append(names, fmt.Sprintf("%q", cmd.name))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// execute parses the command's flags and runs the command with the remaining arguments.
+// Flags are accepted both before and after the positional arguments.
+func (c *command) execute(args []string) error {
+	var positional []string
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			return err
+		}
+
+		args = c.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	return c.run(positional)
+}
+
+// usageLine returns the one-line invocation of the command.
+func (c *command) usageLine() string {
+	line := "notifier " + c.name
+	if len(c.args) > 0 {
+		line += " " + strings.Join(c.args, "|")
+	}
+	if c.hasFlags() {
+		line += " [flags]"
+	}
+
+	return line
+}
+
+// hasFlags reports whether the command defines at least one flag.
+func (c *command) hasFlags() bool {
+	found := false
+	c.flags.VisitAll(func(*flag.Flag) {
+		found = true
+	})
+
+	return found
+}
+
+// printUsage prints the command's usage and flags.
+func (c *command) printUsage(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "Usage: %s\n\n%s\n", c.usageLine(), c.description)
+	if c.hasFlags() {
+		_, _ = fmt.Fprint(w, "\nFlags:\n")
+		c.flags.SetOutput(w)
+		c.flags.PrintDefaults()
+	}
+}
+
+// printUsage prints the program's usage with the list of available commands.
+func printUsage(w io.Writer, cmds []*command) {
+	_, _ = fmt.Fprint(w, "Usage: notifier [command] [flags]\n\nCommands:\n")
+	for _, cmd := range cmds {
+		_, _ = fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.synopsis)
+	}
+}
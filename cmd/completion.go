@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// newCompletionCommand returns the command that generates the shell completion scripts.
+func newCompletionCommand() *command {
+	cmd := newCommand(
+		"completion",
+		"Generate the shell completion script.",
+		"Prints the completion script for the given shell to STDOUT.",
+	)
+	cmd.args = []string{"bash", "zsh", "fish"}
+
+	cmd.run = func(args []string) error {
+		if len(args) != 1 {
+			return usageError(`You must specify a shell: "bash", "zsh" or "fish".`)
+		}
+
+		switch args[0] {
+		case "bash":
+			return writeBashCompletion(os.Stdout, commands())
+		case "zsh":
+			return writeZshCompletion(os.Stdout, commands())
+		case "fish":
+			return writeFishCompletion(os.Stdout, commands())
+		default:
+			return usageError(fmt.Sprintf("Unsupported shell %q.", args[0]))
+		}
+	}
+
+	return cmd
+}
+
+// flagNames returns the names of the command's flags prefixed with a double dash.
+func flagNames(cmd *command) []string {
+	var names []string
+	cmd.flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, "--"+f.Name)
+	})
+
+	return names
+}
+
+// completionArgs returns the command's argument values that can be completed.
+// Placeholders such as <tape> are skipped.
+func completionArgs(cmd *command) []string {
+	var args []string
+	for _, arg := range cmd.args {
+		if !strings.HasPrefix(arg, "<") {
+			args = append(args, arg)
+		}
+	}
+
+	return args
+}
+
+// writeBashCompletion writes the bash completion script.
+func writeBashCompletion(w io.Writer, cmds []*command) error {
+	var b strings.Builder
+	var names []string
+	for _, cmd := range cmds {
+		names = append(names, cmd.name)
+	}
+
+	b.WriteString("# bash completion for notifier\n")
+	b.WriteString("_notifier() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    if [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(names, " "))
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    case \"${COMP_WORDS[1]}\" in\n")
+	for _, cmd := range cmds {
+		words := append(completionArgs(cmd), flagNames(cmd)...)
+		fmt.Fprintf(&b, "        %s)\n", cmd.name)
+		fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(words, " "))
+		b.WriteString("            ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -F _notifier notifier\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeZshCompletion writes the zsh completion script.
+func writeZshCompletion(w io.Writer, cmds []*command) error {
+	var b strings.Builder
+	b.WriteString("#compdef notifier\n\n")
+	b.WriteString("_notifier() {\n")
+	b.WriteString("    local -a commands\n")
+	b.WriteString("    commands=(\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "        '%s:%s'\n", cmd.name, zshQuote(cmd.synopsis))
+	}
+	b.WriteString("    )\n\n")
+	b.WriteString("    if (( CURRENT == 2 )); then\n")
+	b.WriteString("        _describe 'command' commands\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n\n")
+	b.WriteString("    case $words[2] in\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "        %s)\n", cmd.name)
+		b.WriteString("            _arguments")
+		cmd.flags.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(&b, " \\\n                '--%s[%s]%s'", f.Name, zshQuote(f.Usage), zshFlagValue(f))
+		})
+		if args := completionArgs(cmd); len(args) > 0 {
+			fmt.Fprintf(&b, " \\\n                '1:%s:(%s)'", cmd.name, strings.Join(args, " "))
+		}
+		b.WriteString("\n            ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("_notifier \"$@\"\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// zshQuote escapes the characters that have a special meaning in a zsh completion spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer(
+		"'", `'\''`,
+		"[", `\[`,
+		"]", `\]`,
+		":", `\:`,
+	).Replace(s)
+}
+
+// zshFlagValue returns the value spec of a flag. Boolean flags do not take a value.
+func zshFlagValue(f *flag.Flag) string {
+	if isBoolFlag(f) {
+		return ""
+	}
+
+	name, _ := flag.UnquoteUsage(f)
+	return ":" + name + ":"
+}
+
+// writeFishCompletion writes the fish completion script.
+func writeFishCompletion(w io.Writer, cmds []*command) error {
+	var b strings.Builder
+	b.WriteString("# fish completion for notifier\n")
+	b.WriteString("complete -c notifier -f\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "complete -c notifier -n '__fish_use_subcommand' -a %s -d %s\n", cmd.name, fishQuote(cmd.synopsis))
+	}
+	for _, cmd := range cmds {
+		condition := fmt.Sprintf("'__fish_seen_subcommand_from %s'", cmd.name)
+		if args := completionArgs(cmd); len(args) > 0 {
+			fmt.Fprintf(&b, "complete -c notifier -n %s -a '%s'\n", condition, strings.Join(args, " "))
+		}
+		cmd.flags.VisitAll(func(f *flag.Flag) {
+			requiresValue := ""
+			if !isBoolFlag(f) {
+				requiresValue = " -r"
+			}
+			fmt.Fprintf(&b, "complete -c notifier -n %s -l %s -d %s%s\n", condition, f.Name, fishQuote(f.Usage), requiresValue)
+		})
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishQuote quotes the given string for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// isBoolFlag reports whether the flag does not need a value.
+func isBoolFlag(f *flag.Flag) bool {
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// connStats gathers the statistics of the connections to the targets with httptrace,
+// e.g. to tell whether a slow run opened a new connection for every notification. A nil *connStats gathers nothing.
+type connStats struct {
+	requests      int64
+	opened        int64
+	reused        int64
+	dnsLookups    int64
+	dnsFailures   int64
+	dnsTime       int64
+	connects      int64
+	connectTime   int64
+	tlsHandshakes int64
+	tlsResumed    int64
+	tlsFailures   int64
+	tlsTime       int64
+	http2         int64
+}
+
+// newConnStats returns a new instance of connStats with --connectionStats, nil otherwise.
+func newConnStats(conf configuration) *connStats {
+	if !conf.connectionStats {
+		return nil
+	}
+
+	return &connStats{}
+}
+
+// wrap returns the given transport tracing the connections of its requests. A nil *connStats returns it as is.
+func (s *connStats) wrap(transport http.RoundTripper) http.RoundTripper {
+	if s == nil {
+		return transport
+	}
+
+	return tracedTransport{next: transport, stats: s}
+}
+
+// tracedTransport is a http.RoundTripper gathering the connection statistics of the requests it sends.
+type tracedTransport struct {
+	next  http.RoundTripper
+	stats *connStats
+}
+
+// RoundTrip sends the request with a trace recording its DNS lookup, connection and TLS handshake,
+// and counts the responses received over HTTP/2.
+func (t tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := t.stats
+	atomic.AddInt64(&s.requests, 1)
+
+	var dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			atomic.AddInt64(&s.dnsLookups, 1)
+			atomic.AddInt64(&s.dnsTime, int64(time.Since(dnsStart)))
+			if info.Err != nil {
+				atomic.AddInt64(&s.dnsFailures, 1)
+			}
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(string, string, error) {
+			atomic.AddInt64(&s.connects, 1)
+			atomic.AddInt64(&s.connectTime, int64(time.Since(connectStart)))
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			atomic.AddInt64(&s.tlsHandshakes, 1)
+			atomic.AddInt64(&s.tlsTime, int64(time.Since(tlsStart)))
+			switch {
+			case err != nil:
+				atomic.AddInt64(&s.tlsFailures, 1)
+			case state.DidResume:
+				atomic.AddInt64(&s.tlsResumed, 1)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&s.reused, 1)
+			} else {
+				atomic.AddInt64(&s.opened, 1)
+			}
+		},
+	}
+
+	res, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil && res.ProtoMajor == 2 {
+		atomic.AddInt64(&s.http2, 1)
+	}
+	return res, err
+}
+
+// average returns the average of the given total duration, in nanoseconds, over the given amount.
+func average(total int64, count int64) time.Duration {
+	if count == 0 {
+		return 0
+	}
+
+	return time.Duration(total / count).Round(time.Microsecond)
+}
+
+// print pretty prints the connection statistics. A nil *connStats prints nothing.
+func (s *connStats) print(w io.Writer) {
+	if s == nil {
+		return
+	}
+
+	requests := atomic.LoadInt64(&s.requests)
+	opened, reused := atomic.LoadInt64(&s.opened), atomic.LoadInt64(&s.reused)
+	dnsLookups, connects := atomic.LoadInt64(&s.dnsLookups), atomic.LoadInt64(&s.connects)
+	tlsHandshakes := atomic.LoadInt64(&s.tlsHandshakes)
+
+	_, _ = fmt.Fprint(w, "\nCONNECTIONS ...\n")
+	_, _ = fmt.Fprintf(w, "Requests: %d\n", requests)
+	_, _ = fmt.Fprintf(w, "Connections opened: %d - Reused: %d\n", opened, reused)
+	_, _ = fmt.Fprintf(w, "HTTP/2 responses: %d\n", atomic.LoadInt64(&s.http2))
+	_, _ = fmt.Fprintf(w, "DNS lookups: %d - Failed: %d - Average: %v\n", dnsLookups, atomic.LoadInt64(&s.dnsFailures), average(atomic.LoadInt64(&s.dnsTime), dnsLookups))
+	_, _ = fmt.Fprintf(w, "Dials: %d - Average: %v\n", connects, average(atomic.LoadInt64(&s.connectTime), connects))
+	_, _ = fmt.Fprintf(w, "TLS handshakes: %d - Resumed: %d - Failed: %d - Average: %v\n", tlsHandshakes, atomic.LoadInt64(&s.tlsResumed), atomic.LoadInt64(&s.tlsFailures), average(atomic.LoadInt64(&s.tlsTime), tlsHandshakes))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/pigeonlab/notifier/pkg"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The input formats.
+const (
+	// inputLines considers each line as the body of a notification.
+	inputLines = "lines"
+	// inputJSONL considers each line as a JSON envelope holding the body and, optionally, its content type.
+	inputJSONL = "jsonl"
+	// inputURLs considers each line as the URL, or the part of the URL, pinged without body, see pingURL.
+	inputURLs = "urls"
+)
+
+// contentTypeAuto detects the content type of each message.
+const contentTypeAuto = "auto"
+
+// envelope represents a message read in the JSONL input format.
+// The body is either a JSON string, sent as is, or any other JSON value, sent as JSON.
+type envelope struct {
+	Body        json.RawMessage `json:"body"`
+	ContentType string          `json:"contentType"`
+}
+
+// validateMessageFormat makes sure the input format flags are valid.
+func validateMessageFormat(conf configuration) error {
+	if conf.inputFormat != inputLines && conf.inputFormat != inputJSONL && conf.inputFormat != inputURLs {
+		return usageError(fmt.Sprintf("The --input format %q is invalid.", conf.inputFormat))
+	}
+
+	if conf.contentType == "" {
+		return usageError("The --contentType value can't be empty.")
+	}
+
+	return nil
+}
+
+// newNotificationRequest returns the request sending the message to the given URL, see notificationBody.
+// The messages of the urls input format are pings, see pingURL.
+func newNotificationRequest(conf configuration, URL string, message string) (*http.Request, error) {
+	if conf.inputFormat == inputURLs {
+		return http.NewRequest(conf.pingMethod, pingURL(URL, message), nil)
+	}
+
+	body, contentType := notificationBody(conf, message)
+	req, err := http.NewRequest(http.MethodPost, URL, bytes.NewBuffer([]byte(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if len(conf.queryParams) > 0 {
+		req.URL.RawQuery = queryParams(conf, body, req.URL.Query()).Encode()
+	}
+
+	return req, nil
+}
+
+// addNotification adds the body sending the message to the given URL to the bulk request builder,
+// with the query parameters mapped to the message fields, its tenant and its expiry, see notificationBody.
+// The messages of the urls input format are pings, see addPing.
+func addNotification(conf configuration, builder *pkg.BulkRequestBuilder, URL string, message string) {
+	if conf.inputFormat == inputURLs {
+		addPing(conf, builder, URL, message)
+		return
+	}
+
+	body, contentType := notificationBody(conf, message)
+	opts := []pkg.BodyOption{pkg.BodyURL(URL), pkg.BodyHeader("Content-Type", contentType)}
+	for name, values := range queryParams(conf, body, url.Values{}) {
+		for _, value := range values {
+			opts = append(opts, pkg.BodyQuery(name, value))
+		}
+	}
+	if conf.tenantField != "" {
+		opts = append(opts, pkg.BodyTenant(tenantOf(conf, message)))
+	}
+	if expiresAt := messageExpiry(conf, message); !expiresAt.IsZero() {
+		opts = append(opts, pkg.BodyExpiry(expiresAt))
+	}
+
+	builder.AddBody(strings.NewReader(body), opts...)
+}
+
+// notificationBody returns the body of the message and its content type: the one of the envelope, if any,
+// otherwise the one of the --contentType flag, detected from the body when it is "auto".
+func notificationBody(conf configuration, message string) (string, string) {
+	body, contentType := message, ""
+	if conf.inputFormat == inputJSONL {
+		body, contentType = openEnvelope(message)
+	}
+
+	if contentType == "" && conf.contentType != contentTypeAuto && conf.contentType != "" {
+		contentType = conf.contentType
+	}
+	if contentType == "" {
+		contentType = detectContentType(body)
+	}
+
+	return body, contentType
+}
+
+// openEnvelope returns the body and the content type of a JSONL message.
+// A line that is not a valid envelope is sent as is.
+func openEnvelope(message string) (string, string) {
+	var env envelope
+	if err := json.Unmarshal([]byte(message), &env); err != nil || len(env.Body) == 0 {
+		return message, ""
+	}
+
+	var text string
+	if err := json.Unmarshal(env.Body, &text); err == nil {
+		return text, env.ContentType
+	}
+
+	return string(env.Body), env.ContentType
+}
+
+// detectContentType returns the content type of a JSON, XML or plain text body.
+func detectContentType(body string) string {
+	trimmed := strings.TrimSpace(body)
+	switch {
+	case trimmed != "" && json.Valid([]byte(trimmed)):
+		return "application/json"
+	case strings.HasPrefix(trimmed, "<") && isXML(trimmed):
+		return "application/xml"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// isXML reports whether the body is a well-formed XML document.
+func isXML(body string) bool {
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	elements := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return elements > 0
+		}
+		if err != nil {
+			return false
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			elements++
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// The crypto providers.
+const (
+	cryptoStandard = "standard"
+	cryptoFIPS     = "fips"
+)
+
+// The signature algorithms of the audit manifests.
+const (
+	algorithmEd25519     = "ed25519"
+	algorithmECDSASHA256 = "ecdsa-sha256"
+	algorithmRSAPSS      = "rsa-pss-sha256"
+)
+
+// minFIPSRSABits is the minimum size of the RSA keys accepted by the FIPS crypto provider.
+const minFIPSRSABits = 2048
+
+// cryptoProvider gates the hashing and signing primitives of the audit manifests, so that a FIPS 140 compatible
+// implementation can be selected at build time, with the fips build tag, or with the --crypto flag.
+type cryptoProvider interface {
+	// newHash returns the hash of the inputs.
+	newHash() hash.Hash
+	// supports returns an error when the provider doesn't sign with the given public key.
+	supports(key crypto.PublicKey) error
+	// sign signs the payload with the given key, with the algorithm matching the key, see algorithmOf.
+	sign(key crypto.Signer, payload []byte) ([]byte, error)
+	// verify checks the signature of the payload made with the given algorithm.
+	verify(key crypto.PublicKey, algorithm string, payload []byte, signature []byte) error
+}
+
+// validateCrypto makes sure the --crypto value names a crypto provider.
+func validateCrypto(name string) error {
+	if _, err := newCryptoProvider(name); err != nil {
+		return usageError(fmt.Sprintf("The --crypto value %q is invalid.", name))
+	}
+
+	return nil
+}
+
+// newCryptoProvider returns the crypto provider of the given name.
+func newCryptoProvider(name string) (cryptoProvider, error) {
+	switch name {
+	case cryptoStandard:
+		return standardCrypto{}, nil
+	case cryptoFIPS:
+		return fipsCrypto{}, nil
+	default:
+		return nil, fmt.Errorf("unknown crypto provider %q", name)
+	}
+}
+
+// standardCrypto hashes with SHA-256 and signs with ed25519, ECDSA or RSA keys.
+type standardCrypto struct{}
+
+func (standardCrypto) newHash() hash.Hash {
+	return sha256.New()
+}
+
+func (standardCrypto) supports(key crypto.PublicKey) error {
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func (c standardCrypto) sign(key crypto.Signer, payload []byte) ([]byte, error) {
+	if err := c.supports(key.Public()); err != nil {
+		return nil, err
+	}
+
+	return signPayload(key, payload)
+}
+
+func (c standardCrypto) verify(key crypto.PublicKey, algorithm string, payload []byte, signature []byte) error {
+	if err := c.supports(key); err != nil {
+		return err
+	}
+
+	return verifyPayload(key, algorithm, payload, signature)
+}
+
+// fipsCrypto only uses FIPS 140 approved primitives: it hashes with SHA-256 and signs with ECDSA keys
+// on the NIST curves or RSA keys of at least 2048 bits. Built with a FIPS validated module, e.g. with
+// GOEXPERIMENT=boringcrypto, the primitives are the ones of the module.
+type fipsCrypto struct{}
+
+func (fipsCrypto) newHash() hash.Hash {
+	return sha256.New()
+}
+
+func (fipsCrypto) supports(key crypto.PublicKey) error {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().Name {
+		case "P-256", "P-384", "P-521":
+			return nil
+		default:
+			return fmt.Errorf("the ECDSA curve %s is not FIPS approved", key.Curve.Params().Name)
+		}
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minFIPSRSABits {
+			return fmt.Errorf("the RSA keys must have at least %d bits", minFIPSRSABits)
+		}
+		return nil
+	case ed25519.PublicKey:
+		return errors.New("the ed25519 keys are not supported in FIPS mode: use an ECDSA or an RSA key")
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func (c fipsCrypto) sign(key crypto.Signer, payload []byte) ([]byte, error) {
+	if err := c.supports(key.Public()); err != nil {
+		return nil, err
+	}
+
+	return signPayload(key, payload)
+}
+
+func (c fipsCrypto) verify(key crypto.PublicKey, algorithm string, payload []byte, signature []byte) error {
+	if err := c.supports(key); err != nil {
+		return err
+	}
+
+	return verifyPayload(key, algorithm, payload, signature)
+}
+
+// signPayload signs the payload with the algorithm matching the key: ed25519, ECDSA with SHA-256 or RSA-PSS with SHA-256.
+func signPayload(key crypto.Signer, payload []byte) ([]byte, error) {
+	digest := sha256.Sum256(payload)
+	switch algorithmOf(key.Public()) {
+	case algorithmEd25519:
+		return key.Sign(rand.Reader, payload, crypto.Hash(0))
+	case algorithmECDSASHA256:
+		return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case algorithmRSAPSS:
+		return key.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.Public())
+	}
+}
+
+// algorithmOf returns the signature algorithm used with the given public key, or an empty string for an unsupported key.
+func algorithmOf(key crypto.PublicKey) string {
+	switch key.(type) {
+	case ed25519.PublicKey:
+		return algorithmEd25519
+	case *ecdsa.PublicKey:
+		return algorithmECDSASHA256
+	case *rsa.PublicKey:
+		return algorithmRSAPSS
+	default:
+		return ""
+	}
+}
+
+// verifyPayload checks the signature of the payload made with the given algorithm.
+// An empty algorithm is ed25519, the only one of the manifests written before the algorithm was recorded.
+func verifyPayload(key crypto.PublicKey, algorithm string, payload []byte, signature []byte) error {
+	if algorithm == "" {
+		algorithm = algorithmEd25519
+	}
+
+	valid := false
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		valid = algorithm == algorithmEd25519 && ed25519.Verify(key, payload, signature)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(payload)
+		valid = algorithm == algorithmECDSASHA256 && ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(payload)
+		valid = algorithm == algorithmRSAPSS &&
+			rsa.VerifyPSS(key, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+
+	if !valid {
+		return errors.New("the signature doesn't match the manifest: it was tampered with or signed with another key")
+	}
+
+	return nil
+}
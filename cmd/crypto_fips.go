@@ -0,0 +1,6 @@
+//go:build fips
+
+package main
+
+// defaultCrypto is the crypto provider used unless set otherwise with the --crypto flag.
+const defaultCrypto = cryptoFIPS
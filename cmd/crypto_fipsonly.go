@@ -0,0 +1,7 @@
+//go:build fips && boringcrypto
+
+package main
+
+// Built with the fips tag and GOEXPERIMENT=boringcrypto, the TLS connections are restricted
+// to the FIPS approved settings too.
+import _ "crypto/tls/fipsonly"
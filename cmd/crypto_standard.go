@@ -0,0 +1,7 @@
+//go:build !fips
+
+package main
+
+// defaultCrypto is the crypto provider used unless set otherwise with the --crypto flag.
+// Build with the fips tag to use the FIPS crypto provider by default.
+const defaultCrypto = cryptoStandard
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// smtpPasswordEnv is the environment variable holding the SMTP password.
+// It is not a flag so that it never shows up in the process list or in a job manifest.
+const smtpPasswordEnv = "NOTIFIER_SMTP_PASSWORD"
+
+// digest emails a summary of the run when it completes and an alert when the failures are sustained,
+// as an alerting path for the teams without a metrics stack. A nil *digest emails nothing.
+type digest struct {
+	conf      configuration
+	auth      smtp.Auth
+	startedAt time.Time
+	failing   int
+	alerted   bool
+	wg        sync.WaitGroup
+}
+
+// validateDigest makes sure the digest flags are valid.
+func validateDigest(conf configuration) error {
+	if len(conf.digestTo) == 0 {
+		if conf.alertFailureRate > 0 {
+			return usageError("The --alertFailureRate flag requires --digestTo.")
+		}
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(conf.smtpAddr); err != nil {
+		return usageError("The --smtpAddr value must be a host:port address.")
+	}
+
+	if conf.smtpFrom == "" {
+		return usageError("The --smtpFrom flag is mandatory with --digestTo.")
+	}
+
+	if conf.alertFailureRate < 0 || conf.alertFailureRate > 1 || conf.alertChunks < 1 {
+		return usageError("The --alertFailureRate value must be between 0 and 1 and the --alertChunks value greater than zero.")
+	}
+
+	return nil
+}
+
+// newDigest returns a new instance of digest. It returns nil when there are no recipients.
+func newDigest(conf configuration) *digest {
+	if len(conf.digestTo) == 0 {
+		return nil
+	}
+
+	d := &digest{conf: conf, startedAt: time.Now()}
+	if conf.smtpUser != "" {
+		host, _, _ := net.SplitHostPort(conf.smtpAddr)
+		d.auth = smtp.PlainAuth("", conf.smtpUser, os.Getenv(smtpPasswordEnv), host)
+	}
+
+	return d
+}
+
+// record adds the outcome of a chunk. Once the failure rate exceeded --alertFailureRate for --alertChunks
+// chunks in a row, an alert is emailed in the background. No other alert is sent until a chunk is back
+// under the threshold.
+func (d *digest) record(res result) {
+	if d == nil || d.conf.alertFailureRate == 0 || len(res.errors) == 0 {
+		return
+	}
+
+	failed := countFailures(d.conf, res)
+	if float64(failed)/float64(len(res.errors)) <= d.conf.alertFailureRate {
+		d.failing = 0
+		d.alerted = false
+		return
+	}
+
+	d.failing++
+	if d.failing < d.conf.alertChunks || d.alerted {
+		return
+	}
+	d.alerted = true
+
+	subject := fmt.Sprintf("notifier: sustained failures on %s", d.conf.targetUrl)
+	var body bytes.Buffer
+	_, _ = fmt.Fprintf(&body, "More than %.0f%% of the notifications failed for %d chunks in a row.\n",
+		d.conf.alertFailureRate*100, d.failing)
+	_, _ = fmt.Fprintf(&body, "Last chunk: %d of %d notifications failed.\n", failed, len(res.errors))
+	printFailureReasons(&body, d.conf, res)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.send(subject, body.String())
+	}()
+}
+
+// report emails the summary of the completed run. It waits for the alerts still being sent.
+func (d *digest) report(finalResult result) {
+	if d == nil {
+		return
+	}
+
+	failed := countFailures(d.conf, finalResult)
+	subject := fmt.Sprintf("notifier: run completed on %s - %d of %d notifications failed",
+		d.conf.targetUrl, failed, len(finalResult.errors))
+
+	var body bytes.Buffer
+	_, _ = fmt.Fprintf(&body, "Target: %s\n", d.conf.targetUrl)
+	_, _ = fmt.Fprintf(&body, "Started: %s\n", d.startedAt.Format(time.RFC1123Z))
+	_, _ = fmt.Fprintf(&body, "Duration: %s\n", time.Since(d.startedAt).Round(time.Second))
+	_, _ = fmt.Fprintf(&body, "Notifications: %d\nSucceeded: %d\nFailed: %d\n",
+		len(finalResult.errors), len(finalResult.errors)-failed, failed)
+	printFailureReasons(&body, d.conf, finalResult)
+	if hasMultipleTargets(finalResult) {
+		printTargetBreakdown(&body, d.conf, finalResult)
+	}
+
+	d.send(subject, body.String())
+	d.wg.Wait()
+}
+
+// send emails the message to the recipients. The failures are logged: the digest never fails the run.
+func (d *digest) send(subject string, body string) {
+	var message bytes.Buffer
+	_, _ = fmt.Fprintf(&message, "From: %s\r\n", d.conf.smtpFrom)
+	_, _ = fmt.Fprintf(&message, "To: %s\r\n", strings.Join(d.conf.digestTo, ", "))
+	_, _ = fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	_, _ = fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	_, _ = fmt.Fprint(&message, "MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	_, _ = fmt.Fprint(&message, strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(d.conf.smtpAddr, d.auth, d.conf.smtpFrom, d.conf.digestTo, message.Bytes()); err != nil {
+		log.Printf("Unable to email the digest: %v", err)
+	}
+}
+
+// countFailures returns the amount of failed notifications of the result.
+func countFailures(conf configuration, res result) int {
+	failed := 0
+	for i := range res.errors {
+		if failureReason(conf, res.responses[i], res.errors[i]) != "" {
+			failed++
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/pkg"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// newDNSCache returns the DNS cache of the targets with --dnsCache, nil otherwise.
+func newDNSCache(conf configuration) *pkg.DNSCache {
+	if conf.dnsCache <= 0 {
+		return nil
+	}
+
+	return pkg.NewDNSCache(conf.dnsCache)
+}
+
+// flushOnHangup flushes the DNS cache whenever the program receives a SIGHUP, e.g. after moving a target
+// to new addresses, until the context is done. A nil cache is never flushed.
+func flushOnHangup(ctx context.Context, cache *pkg.DNSCache) {
+	if cache == nil {
+		return
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	for {
+		select {
+		case <-c:
+			cache.Flush()
+			log.Println("The DNS cache was flushed.")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// newDocsCommand returns the command that generates the program's documentation.
+func newDocsCommand() *command {
+	cmd := newCommand(
+		"docs",
+		"Generate the documentation.",
+		"Prints the documentation in the given format to STDOUT.",
+	)
+	cmd.args = []string{"man"}
+
+	cmd.run = func(args []string) error {
+		if len(args) != 1 || args[0] != "man" {
+			return usageError(`You must specify a format: "man".`)
+		}
+
+		return writeManPage(os.Stdout, commands())
+	}
+
+	return cmd
+}
+
+// writeManPage writes the notifier(1) man page in roff format.
+func writeManPage(w io.Writer, cmds []*command) error {
+	var b strings.Builder
+	b.WriteString(".TH NOTIFIER 1\n")
+	b.WriteString(".SH NAME\n")
+	b.WriteString("notifier \\- send notifications over HTTP in bulk\n")
+	b.WriteString(".SH SYNOPSIS\n")
+	b.WriteString(".B notifier\n")
+	b.WriteString("\\fIcommand\\fR [\\fIflags\\fR]\n")
+	b.WriteString(".SH DESCRIPTION\n")
+	b.WriteString("Notifier sends a large number of HTTP requests at scale. ")
+	b.WriteString("The requests are processed by a configurable number of workers.\n")
+	b.WriteString(".SH COMMANDS\n")
+	for _, cmd := range cmds {
+		b.WriteString(".TP\n")
+		fmt.Fprintf(&b, ".B %s\n", roffEscape(strings.TrimPrefix(cmd.usageLine(), "notifier ")))
+		fmt.Fprintf(&b, "%s\n", roffEscape(cmd.description))
+		if !cmd.hasFlags() {
+			continue
+		}
+
+		b.WriteString(".RS\n")
+		cmd.flags.VisitAll(func(f *flag.Flag) {
+			name, usage := flag.UnquoteUsage(f)
+			b.WriteString(".TP\n")
+			fmt.Fprintf(&b, "\\fB\\-\\-%s\\fR \\fI%s\\fR\n", roffEscape(f.Name), roffEscape(name))
+			if f.DefValue != "" && f.DefValue != "0" && f.DefValue != "false" {
+				usage += fmt.Sprintf(" (default %s)", f.DefValue)
+			}
+			fmt.Fprintf(&b, "%s\n", roffEscape(usage))
+		})
+		b.WriteString(".RE\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// roffEscape escapes the characters that have a special meaning in roff.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+
+	return s
+}
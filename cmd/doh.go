@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The DNS record types resolved with DNS over HTTPS.
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// dohContentType is the media type of the DNS messages exchanged with a DoH resolver, see RFC 8484.
+const dohContentType = "application/dns-message"
+
+// dohResolver resolves the target hosts with a DNS over HTTPS resolver, for the environments where
+// the system DNS is unreliable or filtered. The answers are cached for their TTL.
+type dohResolver struct {
+	URL        string
+	HTTPClient *http.Client
+
+	mu       sync.Mutex
+	cache    map[string]dohAnswer
+	fallback sync.Once
+}
+
+// dohAnswer is a cached answer of the DoH resolver.
+type dohAnswer struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// validateDoHResolver makes sure the --dohResolver value is an HTTPS URL.
+func validateDoHResolver(conf configuration) error {
+	if conf.dohResolver == "" {
+		return nil
+	}
+
+	resolverURL, err := url.ParseRequestURI(conf.dohResolver)
+	if err != nil || resolverURL.Scheme != "https" {
+		return usageError("The --dohResolver value must be an HTTPS URL, e.g. https://1.1.1.1/dns-query.")
+	}
+
+	return nil
+}
+
+// newDoHResolver returns a new instance of dohResolver. It returns nil when no DoH resolver is set.
+// The resolver is reached through the system resolver, unless its URL holds an IP address.
+func newDoHResolver(conf configuration) *dohResolver {
+	if conf.dohResolver == "" {
+		return nil
+	}
+
+	return &dohResolver{
+		URL:        conf.dohResolver,
+		HTTPClient: &http.Client{Timeout: conf.connectTimeout},
+		cache:      make(map[string]dohAnswer),
+	}
+}
+
+// dial wraps the dial function to connect to the addresses resolved by the DoH resolver, one after the other.
+// It falls back to the given dial function, i.e. to the system resolver, when the DoH resolution fails.
+// A nil *dohResolver returns the dial function as is.
+func (r *dohResolver) dial(dial dialContext) dialContext {
+	if r == nil {
+		return dial
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+
+		ips, err := r.resolve(ctx, network, host)
+		if err != nil {
+			r.fallback.Do(func() {
+				log.Printf("The DoH resolution of %s failed, falling back to the system resolver: %v", host, err)
+			})
+			return dial(ctx, network, address)
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		return nil, lastErr
+	}
+}
+
+// resolve returns the addresses of the host matching the network: the IPv4 ones for tcp4, the IPv6 ones for tcp6
+// and both, IPv4 first, otherwise.
+func (r *dohResolver) resolve(ctx context.Context, network string, host string) ([]net.IP, error) {
+	var types []uint16
+	switch network {
+	case "tcp4":
+		types = []uint16{dnsTypeA}
+	case "tcp6":
+		types = []uint16{dnsTypeAAAA}
+	default:
+		types = []uint16{dnsTypeA, dnsTypeAAAA}
+	}
+
+	var ips []net.IP
+	var lastErr error
+	for _, qtype := range types {
+		answer, err := r.lookup(ctx, host, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips = append(ips, answer...)
+	}
+
+	if len(ips) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no address found for %s", host)
+		}
+		return nil, lastErr
+	}
+
+	return ips, nil
+}
+
+// lookup returns the addresses of the given type of the host, from the cache if they are still valid.
+func (r *dohResolver) lookup(ctx context.Context, host string, qtype uint16) ([]net.IP, error) {
+	key := fmt.Sprintf("%s/%d", host, qtype)
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.ips, nil
+	}
+
+	query, err := newDNSQuery(host, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	res, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		return nil, fmt.Errorf("the DoH resolver returned status code %d", res.StatusCode)
+	}
+
+	message, err := ioutil.ReadAll(io.LimitReader(res.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+
+	ips, ttl, err := parseDNSAnswer(message, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = dohAnswer{ips: ips, expires: time.Now().Add(ttl)}
+	r.mu.Unlock()
+
+	return ips, nil
+}
+
+// newDNSQuery returns the DNS message querying the records of the given type of the host, with recursion desired.
+// Its ID is 0, as recommended for the caching of DoH requests.
+func newDNSQuery(host string, qtype uint16) ([]byte, error) {
+	// Header: ID, flags (RD), QDCOUNT, ANCOUNT, NSCOUNT, ARCOUNT.
+	query := []byte{0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid host %q", host)
+		}
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	// End of the name, QTYPE and QCLASS (IN).
+	query = append(query, 0, byte(qtype>>8), byte(qtype), 0, 1)
+
+	return query, nil
+}
+
+// parseDNSAnswer returns the addresses of the given type found in the answer section of the DNS message,
+// and the lowest TTL among them. The other records, e.g. the CNAME ones, are skipped.
+func parseDNSAnswer(message []byte, qtype uint16) ([]net.IP, time.Duration, error) {
+	errMalformed := errors.New("malformed DNS answer")
+	if len(message) < 12 {
+		return nil, 0, errMalformed
+	}
+
+	if rcode := message[3] & 0x0f; rcode != 0 {
+		return nil, 0, fmt.Errorf("the DNS query failed with rcode %d", rcode)
+	}
+
+	questions := binary.BigEndian.Uint16(message[4:6])
+	answers := binary.BigEndian.Uint16(message[6:8])
+	offset := 12
+	for i := 0; i < int(questions); i++ {
+		offset = skipDNSName(message, offset)
+		offset += 4
+		if offset > len(message) {
+			return nil, 0, errMalformed
+		}
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	for i := 0; i < int(answers); i++ {
+		offset = skipDNSName(message, offset)
+		if offset+10 > len(message) {
+			return nil, 0, errMalformed
+		}
+		rtype := binary.BigEndian.Uint16(message[offset : offset+2])
+		rttl := binary.BigEndian.Uint32(message[offset+4 : offset+8])
+		length := int(binary.BigEndian.Uint16(message[offset+8 : offset+10]))
+		offset += 10
+		if offset+length > len(message) {
+			return nil, 0, errMalformed
+		}
+
+		data := message[offset : offset+length]
+		offset += length
+		if rtype != qtype || (rtype == dnsTypeA && length != net.IPv4len) || (rtype == dnsTypeAAAA && length != net.IPv6len) {
+			continue
+		}
+
+		ips = append(ips, net.IP(append([]byte{}, data...)))
+		if len(ips) == 1 || rttl < ttl {
+			ttl = rttl
+		}
+	}
+
+	return ips, time.Duration(ttl) * time.Second, nil
+}
+
+// skipDNSName returns the offset following the domain name at the given offset of the DNS message.
+// The name ends with an empty label or a compression pointer.
+func skipDNSName(message []byte, offset int) int {
+	for offset < len(message) {
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			return offset + 1
+		case length&0xc0 == 0xc0:
+			return offset + 2
+		default:
+			offset += 1 + length
+		}
+	}
+
+	return len(message) + 1
+}
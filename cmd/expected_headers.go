@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pigeonlab/notifier/pkg"
+	"net/textproto"
+	"strings"
+)
+
+// validateExpectedHeaders makes sure each --expectHeader value holds a header name.
+func validateExpectedHeaders(conf configuration) error {
+	for _, header := range conf.expectedHeaders {
+		if name, _ := splitExpectedHeader(header); name == "" || strings.ContainsAny(name, " \t") {
+			return usageError(fmt.Sprintf("The --expectHeader value %q is invalid, it must be name: value or name.", header))
+		}
+	}
+
+	return nil
+}
+
+// splitExpectedHeader splits a "name: value" expected header. A header without value only has to be present.
+func splitExpectedHeader(header string) (string, string) {
+	parts := strings.SplitN(header, ":", 2)
+	name := textproto.TrimString(parts[0])
+	if len(parts) == 1 {
+		return name, ""
+	}
+
+	return name, textproto.TrimString(parts[1])
+}
+
+// expectedHeaderOptions returns the client options expecting the --expectHeader headers.
+func expectedHeaderOptions(conf configuration) []pkg.Option {
+	var opts []pkg.Option
+	for _, header := range conf.expectedHeaders {
+		opts = append(opts, pkg.WithExpectedHeader(splitExpectedHeader(header)))
+	}
+
+	return opts
+}
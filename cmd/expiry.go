@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// expiryEnvelope holds the expiry of a message read in the JSONL input format: an RFC 3339 "expiresAt" time
+// or a "ttl" duration, e.g. "5m", counted from the time the message is read.
+type expiryEnvelope struct {
+	ExpiresAt string `json:"expiresAt"`
+	TTL       string `json:"ttl"`
+}
+
+// messageExpiry returns the time after which the message is dropped rather than delivered late:
+// the one of its envelope, if any, otherwise the --ttl one counted from now. It returns the zero time
+// when the message doesn't expire. The invalid expiry values of an envelope are ignored.
+func messageExpiry(conf configuration, message string) time.Time {
+	if conf.inputFormat == inputJSONL {
+		var env expiryEnvelope
+		if err := json.Unmarshal([]byte(message), &env); err == nil {
+			if expiresAt, err := time.Parse(time.RFC3339, env.ExpiresAt); err == nil {
+				return expiresAt
+			}
+			if ttl, err := time.ParseDuration(env.TTL); err == nil && ttl > 0 {
+				return time.Now().Add(ttl)
+			}
+		}
+	}
+
+	if conf.ttl > 0 {
+		return time.Now().Add(conf.ttl)
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+)
+
+// validateFailFast makes sure the --maxFailures and --maxFailureRate values are valid.
+func validateFailFast(conf configuration) error {
+	if conf.maxFailures < 0 || conf.maxFailureRate < 0 || conf.maxFailureRate > 1 {
+		return usageError("The --maxFailures value can't be negative and the --maxFailureRate value must be between 0 and 1.")
+	}
+
+	return nil
+}
+
+// abortReason returns why the run must be aborted given the results so far, or an empty string when it must go on:
+// the amount of failed notifications reached --maxFailures, or their share reached --maxFailureRate, either
+// in the whole run or in the last chunk, which the bulk client aborted. The notifications cancelled, aborted,
+// expired or parked are not failures of the target.
+func abortReason(conf configuration, finalResult result, last result) string {
+	if conf.maxFailures <= 0 && conf.maxFailureRate <= 0 {
+		return ""
+	}
+
+	failed := 0
+	for i := range finalResult.errors {
+		switch failureReason(conf, finalResult.responses[i], finalResult.errors[i]) {
+		case "", reasonCancelled, reasonAborted, reasonExpired, reasonParked:
+		default:
+			failed++
+		}
+	}
+
+	switch {
+	case conf.maxFailures > 0 && failed >= conf.maxFailures:
+		return fmt.Sprintf("%d notifications failed", failed)
+	case conf.maxFailureRate > 0 && float64(failed) >= conf.maxFailureRate*float64(len(finalResult.errors)):
+		return fmt.Sprintf("%d of %d notifications failed", failed, len(finalResult.errors))
+	}
+
+	for _, err := range last.errors {
+		if errors.Is(err, interr.ErrAborted) {
+			return "the last chunk was aborted after too many failures"
+		}
+	}
+
+	return ""
+}
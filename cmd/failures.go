@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/pigeonlab/notifier/pkg"
+	"io"
+	"net/http"
+)
+
+// The failure reasons, in the order they are reported.
+const (
+	reasonTimeout      = "timeout"
+	reasonRefused      = "refused"
+	reasonDNS          = "dns"
+	reasonTLS          = "tls"
+	reasonClientError  = "4xx"
+	reasonServerError  = "5xx"
+	reasonHeader       = "header"
+	reasonCancelled    = "cancelled"
+	reasonAborted      = "aborted"
+	reasonExpired      = "expired"
+	reasonBodyTooLarge = "body-too-large"
+	reasonParked       = "parked"
+	reasonOther        = "other"
+)
+
+// failureReasons lists the failure reasons in the order they are reported.
+var failureReasons = []string{
+	reasonTimeout,
+	reasonRefused,
+	reasonDNS,
+	reasonTLS,
+	reasonClientError,
+	reasonServerError,
+	reasonHeader,
+	reasonCancelled,
+	reasonAborted,
+	reasonExpired,
+	reasonBodyTooLarge,
+	reasonParked,
+	reasonOther,
+}
+
+// failureReason classifies the outcome of a notification.
+// It returns an empty string when the notification did not fail, i.e. when the target returned a 2xx status code
+// or one of the --successStatus ones.
+func failureReason(conf configuration, res *http.Response, err error) string {
+	if err != nil {
+		return errorReason(err)
+	}
+
+	if res == nil {
+		return reasonOther
+	}
+	if conf.successStatuses.contains(res.StatusCode) {
+		return ""
+	}
+
+	return statusReason(res.StatusCode)
+}
+
+// statusReason classifies a status code returned by the target.
+// It returns an empty string for the status codes that are not failures.
+func statusReason(code int) string {
+	switch {
+	case code == http.StatusRequestEntityTooLarge:
+		return reasonBodyTooLarge
+	case code >= 500:
+		return reasonServerError
+	case code >= 400:
+		return reasonClientError
+	default:
+		return ""
+	}
+}
+
+// errorReason classifies an error returned by the bulk client like pkg.ClassifyError does.
+// The classes without a failure reason of their own, e.g. the skipped requests, are reported as other.
+func errorReason(err error) string {
+	if errors.Is(err, errParked) {
+		return reasonParked
+	}
+	if errors.Is(err, interr.ErrResponseTooLarge) {
+		return reasonBodyTooLarge
+	}
+
+	var statusErr *interr.StatusError
+	if errors.As(err, &statusErr) {
+		return statusReason(statusErr.Code)
+	}
+
+	switch pkg.ClassifyError(err) {
+	case pkg.FailureTimeout:
+		return reasonTimeout
+	case pkg.FailureRefused:
+		return reasonRefused
+	case pkg.FailureDNS:
+		return reasonDNS
+	case pkg.FailureTLS:
+		return reasonTLS
+	case pkg.FailureHeader:
+		return reasonHeader
+	case pkg.FailureCancelled:
+		return reasonCancelled
+	case pkg.FailureAborted:
+		return reasonAborted
+	case pkg.FailureExpired:
+		return reasonExpired
+	default:
+		return reasonOther
+	}
+}
+
+// printFailureReasons pretty prints the amount of failed notifications for each reason.
+func printFailureReasons(w io.Writer, conf configuration, finalResult result) {
+	counts := make(map[string]int)
+	total := 0
+	for i := range finalResult.responses {
+		if reason := failureReason(conf, finalResult.responses[i], finalResult.errors[i]); reason != "" {
+			counts[reason]++
+			total++
+		}
+	}
+
+	if total == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprint(w, "\nFAILURES ...\n")
+	for _, reason := range failureReasons {
+		if counts[reason] > 0 {
+			_, _ = fmt.Fprintf(w, "%s: %d\n", reason, counts[reason])
+		}
+	}
+	_, _ = fmt.Fprintf(w, "Failed notifications: %d of %d\n", total, len(finalResult.responses))
+}
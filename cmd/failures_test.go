@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTheFailureReasonsFollowTheClassesOfTheClient(t *testing.T) {
+	for name, test := range map[string]struct {
+		err    error
+		reason string
+	}{
+		"timeout":        {&interr.TimeoutError{Err: context.DeadlineExceeded}, reasonTimeout},
+		"cancelled":      {fmt.Errorf("sending: %w", context.Canceled), reasonCancelled},
+		"status":         {&interr.StatusError{Code: 503}, reasonServerError},
+		"body too large": {interr.ErrResponseTooLarge, reasonBodyTooLarge},
+		"parked":         {errParked, reasonParked},
+		"skipped":        {interr.ErrBarrierNotPassed, reasonOther},
+		"untyped":        {errors.New("lookup timeout: connection refused"), reasonOther},
+	} {
+		assert.Equal(t, test.reason, errorReason(test.err), name)
+	}
+}
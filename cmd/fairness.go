@@ -0,0 +1,22 @@
+package main
+
+// tenantOf returns the tenant of the message, i.e. the value of its --tenantField field.
+// The messages without the field share the empty tenant.
+func tenantOf(conf configuration, message string) string {
+	if conf.tenantField == "" {
+		return ""
+	}
+
+	body := message
+	if conf.inputFormat == inputJSONL {
+		body, _ = openEnvelope(message)
+	}
+
+	fields, ok := decodeFields(body)
+	if !ok {
+		return ""
+	}
+
+	tenant, _ := lookupField(fields, conf.tenantField)
+	return tenant
+}
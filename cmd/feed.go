@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// feedMessage is a message served by the feed. Its ID is its position in the input.
+type feedMessage struct {
+	ID   int    `json:"id"`
+	Body string `json:"body"`
+}
+
+// feedPage is a page of pending messages. The cursor is the one to request the next page with.
+type feedPage struct {
+	Messages []feedMessage `json:"messages"`
+	Cursor   int           `json:"cursor"`
+}
+
+// feedAck lists the IDs of the messages acknowledged by a receiver.
+type feedAck struct {
+	IDs []int `json:"ids"`
+}
+
+// feedQueue holds the messages read from the input until the receivers acknowledge them.
+type feedQueue struct {
+	mu        sync.Mutex
+	messages  []string
+	delivered []bool
+	pending   int
+	ended     bool
+	done      chan struct{}
+}
+
+// newFeedQueue returns a new instance of feedQueue.
+func newFeedQueue() *feedQueue {
+	return &feedQueue{done: make(chan struct{})}
+}
+
+// push adds a message read from the input.
+func (q *feedQueue) push(message string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.messages = append(q.messages, message)
+	q.delivered = append(q.delivered, false)
+	q.pending++
+}
+
+// close marks the end of the input. The queue is done once every message is delivered.
+func (q *feedQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.ended = true
+	q.checkDone()
+}
+
+// page returns up to limit pending messages starting at the cursor.
+func (q *feedQueue) page(cursor int, limit int) feedPage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	page := feedPage{Messages: []feedMessage{}, Cursor: cursor}
+	for id := cursor; id < len(q.messages) && len(page.Messages) < limit; id++ {
+		page.Cursor = id + 1
+		if !q.delivered[id] {
+			page.Messages = append(page.Messages, feedMessage{ID: id, Body: q.messages[id]})
+		}
+	}
+
+	return page
+}
+
+// ack marks the given messages as delivered. It fails without marking any message when an ID is unknown.
+func (q *feedQueue) ack(IDs []int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, id := range IDs {
+		if id < 0 || id >= len(q.messages) {
+			return fmt.Errorf("unknown message %d", id)
+		}
+	}
+
+	for _, id := range IDs {
+		if !q.delivered[id] {
+			q.delivered[id] = true
+			q.pending--
+		}
+	}
+	q.checkDone()
+
+	return nil
+}
+
+// checkDone closes the done channel once the input is over and every message is delivered.
+// It must be called with the lock held.
+func (q *feedQueue) checkDone() {
+	if q.ended && q.pending == 0 {
+		select {
+		case <-q.done:
+		default:
+			close(q.done)
+		}
+	}
+}
+
+// stats returns the amount of messages read and the amount of messages delivered.
+func (q *feedQueue) stats() (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.messages), len(q.messages) - q.pending
+}
+
+// readFeed pushes every line of the input to the queue, then closes it, even when the input fails:
+// the messages read until then are still served.
+func readFeed(input io.Reader, queue *feedQueue) error {
+	defer queue.close()
+
+	reader := bufio.NewReader(input)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			queue.push(strings.TrimSuffix(text, "\n"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// feedHandler serves the pending messages of the queue on GET /feed and acknowledges them on POST /ack.
+// With a token, the receivers must send it as a bearer token.
+func feedHandler(queue *feedQueue, pageSize int, token string) http.Handler {
+	authorized := func(req *http.Request) bool {
+		return token == "" || subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(req) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		cursor, limit := 0, pageSize
+		var err error
+		if value := req.URL.Query().Get("cursor"); value != "" {
+			cursor, err = strconv.Atoi(value)
+		}
+		if value := req.URL.Query().Get("limit"); err == nil && value != "" {
+			limit, err = strconv.Atoi(value)
+		}
+		if err != nil || cursor < 0 || limit < 1 {
+			http.Error(w, "invalid cursor or limit", http.StatusBadRequest)
+			return
+		}
+		if limit > pageSize {
+			limit = pageSize
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(queue.page(cursor, limit))
+	})
+
+	mux.HandleFunc("/ack", func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(req) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var ack feedAck
+		if err := json.NewDecoder(req.Body).Decode(&ack); err != nil {
+			http.Error(w, "invalid acknowledgement", http.StatusBadRequest)
+			return
+		}
+		if err := queue.ack(ack.IDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+// newFeedCommand returns the command that serves the messages to the receivers polling them.
+func newFeedCommand() *command {
+	cmd := newCommand(
+		"feed",
+		"Serve the messages read from STDIN as a feed polled by the receivers.",
+		"Serves the messages read from STDIN, or from the --inputFile files, to the receivers that can't receive webhooks.\n"+
+			"The receivers poll GET /feed?cursor=<cursor>&limit=<limit> for the pending messages and the next cursor,\n"+
+			"then acknowledge the messages with POST /ack {\"ids\": [...]}. The acknowledged messages are delivered and\n"+
+			"are no longer served: polling again from cursor 0 returns the messages not acknowledged yet.\n"+
+			"The command ends once every message is delivered.",
+	)
+
+	var inputFiles stringsFlag
+	listen := cmd.flags.String("listen", ":8080", "The address the feed listens on.")
+	pageSize := cmd.flags.Int("pageSize", 100, "The maximum amount of messages of a page.")
+	token := cmd.flags.String("token", "", "The bearer token the receivers must send. Empty means no authentication.")
+	cmd.flags.Var(&inputFiles, "inputFile", "Read the messages from the given file instead of STDIN. It can be repeated: the files are read one after the other.")
+
+	cmd.run = func(args []string) error {
+		if *pageSize < 1 {
+			return usageError("The --pageSize value must be greater than zero.")
+		}
+
+		input, err := openInputs(inputFiles, 0, nil)
+		if err != nil {
+			return err
+		}
+		defer input.Close()
+
+		queue := newFeedQueue()
+		readErr := make(chan error, 1)
+		go func() {
+			readErr <- readFeed(input, queue)
+		}()
+
+		server := &http.Server{Addr: *listen, Handler: feedHandler(queue, *pageSize, *token)}
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- server.ListenAndServe()
+		}()
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		log.Printf("Serving the feed on %s...", *listen)
+		select {
+		case err := <-serverErr:
+			return fmt.Errorf("unable to serve the feed: %v", err)
+		case <-ctx.Done():
+		case <-queue.done:
+		}
+
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+
+		read, delivered := queue.stats()
+		fmt.Printf("\nRESULTS ...\nDelivered messages: %d of %d\n", delivered, read)
+
+		select {
+		case err := <-readErr:
+			if err != nil {
+				return fmt.Errorf("unable to read the messages: %v", err)
+			}
+		default:
+		}
+		return nil
+	}
+
+	return cmd
+}
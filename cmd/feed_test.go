@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTheFeedIsClosedWhenTheInputFails(t *testing.T) {
+	failure := errors.New("input failure")
+	queue := newFeedQueue()
+
+	err := readFeed(io.MultiReader(strings.NewReader("first\n"), iotest.ErrReader(failure)), queue)
+	assert.Equal(t, failure, err)
+
+	require.NoError(t, queue.ack([]int{0}), "no errors")
+	select {
+	case <-queue.done:
+	default:
+		t.Fatal("the queue is not done")
+	}
+}
+
+func TestTheFeedRequiresTheToken(t *testing.T) {
+	handler := feedHandler(newFeedQueue(), 10, "secret")
+
+	for header, status := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, status, recorder.Code, header)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+)
+
+// lineReader reads the messages of the input, one line at a time.
+type lineReader interface {
+	ReadString(delim byte) (string, error)
+}
+
+// chunkReader reads the chunks of messages sent in bulk from the input.
+type chunkReader interface {
+	lineReader
+	readChunk(ctx context.Context, conf configuration) (messages []string, EOF bool, err error)
+}
+
+// newChunkReader returns the chunk reader of the input. With --maxWait, the input is read in the background
+// so that a partially filled chunk can be sent without waiting for the next messages.
+func newChunkReader(ctx context.Context, conf configuration, reader lineReader) chunkReader {
+	if conf.maxWait <= 0 {
+		return fullChunkReader{reader}
+	}
+
+	return newChunkFlusher(ctx, reader)
+}
+
+// validateFlush makes sure the --maxWait and --minBatch values are valid.
+func validateFlush(conf configuration) error {
+	if conf.maxWait < 0 || conf.minBatch < 0 {
+		return usageError("The --maxWait and --minBatch values can't be negative.")
+	}
+
+	if conf.minBatch > 0 && conf.maxWait == 0 {
+		return usageError("The --minBatch flag requires --maxWait: without it, the chunks are always filled.")
+	}
+
+	if conf.minBatch > conf.chunkSize {
+		return usageError("The --minBatch value must be lower than or equal to --chunkSize.")
+	}
+
+	return nil
+}
+
+// fullChunkReader reads chunks of --chunkSize messages, waiting for them as long as the input is open.
+type fullChunkReader struct {
+	lineReader
+}
+
+// readChunk reads the next --chunkSize messages, or the ones left before the end of the input.
+func (r fullChunkReader) readChunk(_ context.Context, conf configuration) (messages []string, EOF bool, err error) {
+	for i := 0; i < conf.chunkSize; i++ {
+		text, err := r.ReadString('\n')
+		switch err {
+		case nil:
+			log.Printf("Processing message: %s", text)
+		case io.EOF:
+			log.Printf("Processing message: %s", text)
+			EOF = true
+			break
+		default:
+			return nil, false, err
+		}
+
+		messages = append(messages, text)
+	}
+
+	return messages, EOF, nil
+}
+
+// readLine is a line read from the input, with the error that ended the input, if any.
+type readLine struct {
+	text string
+	err  error
+}
+
+// chunkFlusher reads the input in the background, so that a chunk is sent once it holds --chunkSize messages
+// or once --maxWait elapsed since its first message, provided that it holds at least --minBatch messages.
+type chunkFlusher struct {
+	lines chan readLine
+	err   error
+}
+
+// newChunkFlusher returns a new instance of chunkFlusher reading the given input until the context is cancelled.
+func newChunkFlusher(ctx context.Context, reader lineReader) *chunkFlusher {
+	f := &chunkFlusher{lines: make(chan readLine)}
+	go func() {
+		defer close(f.lines)
+		for {
+			text, err := reader.ReadString('\n')
+			select {
+			case f.lines <- readLine{text: text, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return f
+}
+
+// ReadString returns the next line of the input, waiting for it as long as the input is open.
+// The delimiter is always a new line.
+func (f *chunkFlusher) ReadString(_ byte) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+
+	line, ok := <-f.lines
+	if !ok {
+		f.err = io.EOF
+		return "", f.err
+	}
+	if line.err != nil {
+		f.err = line.err
+	}
+
+	return line.text, line.err
+}
+
+// readChunk reads the messages of the next chunk. The wait for the first message is not bounded,
+// since there's nothing to send until then. A cancelled context returns the messages read so far.
+func (f *chunkFlusher) readChunk(ctx context.Context, conf configuration) (messages []string, EOF bool, err error) {
+	if f.err != nil {
+		return nil, f.err == io.EOF, nil
+	}
+
+	minBatch := conf.minBatch
+	if minBatch > conf.chunkSize {
+		minBatch = conf.chunkSize
+	}
+
+	var deadline <-chan time.Time
+	waited := false
+	for len(messages) < conf.chunkSize {
+		if waited && len(messages) >= minBatch {
+			log.Printf("Flushing a chunk of %d messages after %v.", len(messages), conf.maxWait)
+			return messages, false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return messages, false, nil
+		case <-deadline:
+			waited = true
+			deadline = nil
+		case line, ok := <-f.lines:
+			if !ok {
+				f.err = io.EOF
+				return messages, true, nil
+			}
+			if line.err != nil && line.err != io.EOF {
+				f.err = line.err
+				return nil, false, line.err
+			}
+			if line.text != "" {
+				log.Printf("Processing message: %s", line.text)
+				messages = append(messages, line.text)
+			}
+			if line.err == io.EOF {
+				f.err = io.EOF
+				return messages, true, nil
+			}
+			if len(messages) == 1 {
+				timer := time.NewTimer(conf.maxWait)
+				defer timer.Stop()
+				deadline = timer.C
+			}
+		}
+	}
+
+	return messages, false, nil
+}
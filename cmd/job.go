@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jobManifest describes a notify run so that it can be resumed with identical settings:
+// its inputs, the snapshot of its flags, the checkpoint of the messages delivered so far
+// and the file holding their results.
+type jobManifest struct {
+	Inputs     []string            `json:"inputs"`
+	Flags      map[string][]string `json:"flags"`
+	Checkpoint jobCheckpoint       `json:"checkpoint"`
+	Results    string              `json:"results"`
+	Completed  bool                `json:"completed"`
+	StartedAt  time.Time           `json:"startedAt"`
+	UpdatedAt  time.Time           `json:"updatedAt"`
+}
+
+// jobCheckpoint tracks the messages delivered so far.
+// The offset is the amount of bytes holding these messages in the inputs, read one after the other.
+type jobCheckpoint struct {
+	Messages int   `json:"messages"`
+	Offset   int64 `json:"offset"`
+}
+
+// jobResult is the result of a message, stored in the results file of a job and in the audit manifest.
+// The message is the position of the message in the whole job.
+type jobResult struct {
+	Message    int    `json:"message"`
+	Target     string `json:"target"`
+	StatusCode int    `json:"statusCode"`
+	Error      string `json:"error,omitempty"`
+}
+
+// jobTracker writes the manifest and the results of a job as the chunks are delivered.
+// A nil *jobTracker tracks nothing.
+type jobTracker struct {
+	path     string
+	manifest jobManifest
+	results  *os.File
+	encoder  *json.Encoder
+}
+
+// newJob creates the manifest of a new job at the given path with the snapshot of the given flags.
+// The results are written next to the manifest, e.g. job.results.jsonl for job.json.
+func newJob(path string, flags *flag.FlagSet, inputs []string) (*jobTracker, error) {
+	manifest := jobManifest{
+		Inputs:    inputs,
+		Flags:     snapshotFlags(flags),
+		Results:   strings.TrimSuffix(path, ".json") + ".results.jsonl",
+		StartedAt: time.Now(),
+	}
+
+	results, err := os.Create(manifest.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &jobTracker{path: path, manifest: manifest, results: results, encoder: json.NewEncoder(results)}
+	if err := job.save(); err != nil {
+		_ = results.Close()
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// resumeJob continues the job of the given manifest. The results written after the checkpoint,
+// i.e. the ones of a chunk interrupted before being checkpointed, are discarded as the chunk is sent again.
+func resumeJob(path string, manifest jobManifest) (*jobTracker, error) {
+	entries, err := readJobResults(manifest.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := os.Create(manifest.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &jobTracker{path: path, manifest: manifest, results: results, encoder: json.NewEncoder(results)}
+	for _, entry := range entries {
+		if entry.Message >= manifest.Checkpoint.Messages {
+			continue
+		}
+		if err := job.encoder.Encode(entry); err != nil {
+			_ = results.Close()
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+// readJobManifest reads the job manifest at the given path.
+func readJobManifest(path string) (jobManifest, error) {
+	var manifest jobManifest
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+
+	if err := json.Unmarshal(bs, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid job manifest: %v", err)
+	}
+
+	return manifest, nil
+}
+
+// readJobResults reads the results file of a job. A missing file has no results.
+func readJobResults(path string) ([]jobResult, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []jobResult
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var entry jobResult
+		if err := decoder.Decode(&entry); err != nil {
+			// The last entry may have been cut by the interruption of the job.
+			break
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// snapshotFlags returns the values of all the flags, set or not, so that a resumed job
+// doesn't depend on the defaults of the binary resuming it.
+func snapshotFlags(flags *flag.FlagSet) map[string][]string {
+	snapshot := make(map[string][]string)
+	flags.VisitAll(func(f *flag.Flag) {
+		if values, ok := f.Value.(*stringsFlag); ok {
+			if len(*values) > 0 {
+				snapshot[f.Name] = append([]string{}, *values...)
+			}
+			return
+		}
+		snapshot[f.Name] = []string{f.Value.String()}
+	})
+
+	return snapshot
+}
+
+// arguments returns the command-line arguments restoring the flags of the job.
+func (m jobManifest) arguments() []string {
+	var names []string
+	for name := range m.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		for _, value := range m.Flags[name] {
+			args = append(args, fmt.Sprintf("-%s=%s", name, value))
+		}
+	}
+
+	return args
+}
+
+// offset returns the amount of bytes of the inputs already delivered.
+func (j *jobTracker) offset() int64 {
+	if j == nil {
+		return 0
+	}
+
+	return j.manifest.Checkpoint.Offset
+}
+
+// checkpoint stores the results of a delivered chunk and moves the checkpoint after its messages.
+// A chunk interrupted by a cancellation or aborted after too many failures is not checkpointed,
+// so that it is sent again on resume.
+func (j *jobTracker) checkpoint(messages []string, res result) error {
+	if j == nil {
+		return nil
+	}
+
+	for _, err := range res.errors {
+		if err == interr.ErrIgnored || err == interr.ErrAborted {
+			return nil
+		}
+	}
+
+	for _, entry := range messageResults(j.manifest.Checkpoint.Messages, res) {
+		if err := j.encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	j.manifest.Checkpoint.Messages += len(messages)
+	for _, message := range messages {
+		j.manifest.Checkpoint.Offset += int64(len(message))
+	}
+
+	return j.save()
+}
+
+// messageResults returns the result of each message of the given result, numbered from the given first message.
+func messageResults(first int, res result) []jobResult {
+	var entries []jobResult
+	for i := range res.errors {
+		entry := jobResult{Message: first + i}
+		if i < len(res.targets) {
+			entry.Target = res.targets[i]
+		}
+		if res.responses[i] != nil {
+			entry.StatusCode = res.responses[i].StatusCode
+		}
+		if res.errors[i] != nil {
+			entry.Error = res.errors[i].Error()
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// messages returns the amount of messages delivered before the checkpoint.
+func (j *jobTracker) messages() int {
+	if j == nil {
+		return 0
+	}
+
+	return j.manifest.Checkpoint.Messages
+}
+
+// complete marks the job as completed.
+func (j *jobTracker) complete() error {
+	if j == nil {
+		return nil
+	}
+
+	j.manifest.Completed = true
+	return j.save()
+}
+
+// close closes the results file.
+func (j *jobTracker) close() error {
+	if j == nil {
+		return nil
+	}
+
+	return j.results.Close()
+}
+
+// save writes the manifest. It is written to a temporary file first, so that an interruption
+// never leaves a truncated manifest behind.
+func (j *jobTracker) save() error {
+	j.manifest.UpdatedAt = time.Now()
+	bs, err := json.MarshalIndent(j.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(j.path+".tmp", bs, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(j.path+".tmp", j.path)
+}
+
+// inputReader reads the input files one after the other.
+type inputReader struct {
+	io.Reader
+	files []*os.File
+}
+
+// openInputs returns a reader of the given input files, read one after the other,
+// starting at the given offset. Without input files, it reads STDIN.
+// The watch function, if any, is given every input file and the amount of its bytes skipped by the offset,
+// and returns the reader to read the rest of the file from.
+func openInputs(paths []string, offset int64, watch func(file *os.File, skipped int64) (io.Reader, error)) (io.ReadCloser, error) {
+	if len(paths) == 0 {
+		return os.Stdin, nil
+	}
+
+	input := &inputReader{}
+	var readers []io.Reader
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			_ = input.Close()
+			return nil, err
+		}
+		input.files = append(input.files, file)
+
+		info, err := file.Stat()
+		if err != nil {
+			_ = input.Close()
+			return nil, err
+		}
+		skipped := offset
+		if skipped > info.Size() {
+			skipped = info.Size()
+		}
+		var reader io.Reader = file
+		if watch != nil {
+			if reader, err = watch(file, skipped); err != nil {
+				_ = input.Close()
+				return nil, err
+			}
+		}
+		if offset >= info.Size() {
+			offset -= info.Size()
+			continue
+		}
+
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			_ = input.Close()
+			return nil, err
+		}
+		offset = 0
+		readers = append(readers, reader)
+	}
+	input.Reader = io.MultiReader(readers...)
+
+	return input, nil
+}
+
+// Close closes the input files.
+func (i *inputReader) Close() error {
+	for _, file := range i.files {
+		_ = file.Close()
+	}
+
+	return nil
+}
+
+// newResumeCommand returns the command that continues an interrupted notify job.
+func newResumeCommand() *command {
+	cmd := newCommand(
+		"resume",
+		"Continue an interrupted notify job.",
+		"Continues the job started with notify --job from its last checkpoint, with the settings of the original run.\n"+
+			"The chunk interrupted before being checkpointed is sent again.",
+	)
+	cmd.args = []string{"<job>"}
+
+	cmd.run = func(args []string) error {
+		if len(args) != 1 {
+			return usageError("You must specify the job manifest to resume.")
+		}
+
+		manifest, err := readJobManifest(args[0])
+		if err != nil {
+			return err
+		}
+		if manifest.Completed {
+			return fmt.Errorf("the job %s is already completed", args[0])
+		}
+		if len(manifest.Inputs) == 0 {
+			return fmt.Errorf("the job %s read its messages from STDIN and can't be resumed", args[0])
+		}
+
+		job, err := resumeJob(args[0], manifest)
+		if err != nil {
+			return fmt.Errorf("unable to resume the job: %v", err)
+		}
+		log.Printf("Resuming the job %s after %d messages.", args[0], manifest.Checkpoint.Messages)
+
+		return newNotifyCommandFor(job).execute(manifest.arguments())
+	}
+
+	return cmd
+}
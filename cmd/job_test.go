@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+// parseableCommand returns the notify command with a flag set returning its parsing errors instead of exiting.
+func parseableCommand() *command {
+	cmd := newNotifyCommand()
+	cmd.flags.Init(cmd.name, flag.ContinueOnError)
+	cmd.flags.SetOutput(ioutil.Discard)
+
+	return cmd
+}
+
+func TestTheSnapshotOfTheSuccessStatusesIsRestored(t *testing.T) {
+	for name, args := range map[string][]string{
+		"unset": nil,
+		"set":   {"-successStatus=409", "-successStatus=304,410"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			original := parseableCommand()
+			require.NoError(t, original.flags.Parse(args), "no errors")
+			manifest := jobManifest{Flags: snapshotFlags(original.flags)}
+
+			resumed := parseableCommand()
+			require.NoError(t, resumed.flags.Parse(manifest.arguments()), "no errors")
+			assert.Equal(t, original.flags.Lookup("successStatus").Value.String(), resumed.flags.Lookup("successStatus").Value.String())
+		})
+	}
+}
+
+func TestTheSnapshotOfEveryNotifyFlagIsRestored(t *testing.T) {
+	var names []string
+	parseableCommand().flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	require.NotEmpty(t, names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			original := parseableCommand()
+			snapshot := snapshotFlags(original.flags)
+			manifest := jobManifest{Flags: map[string][]string{}}
+			if values, ok := snapshot[name]; ok {
+				manifest.Flags[name] = values
+			}
+
+			resumed := parseableCommand()
+			require.NoError(t, resumed.flags.Parse(manifest.arguments()), "no errors")
+			assert.Empty(t, resumed.flags.Args())
+			assert.Equal(t, original.flags.Lookup(name).Value.String(), resumed.flags.Lookup(name).Value.String())
+		})
+	}
+}
@@ -2,86 +2,566 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"flag"
 	"fmt"
 	"github.com/pigeonlab/notifier/pkg"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 )
 
 // configuration handle this program's configuration
 type configuration struct {
-	targetUrl      string
-	chunkSize      int
-	interval       time.Duration
-	requestTimeout time.Duration
+	targetUrl        string
+	chunkSize        int
+	interval         time.Duration
+	pace             bool
+	batchHeaders     bool
+	successStatuses  statusCodesFlag
+	expectedHeaders  stringsFlag
+	maxWait          time.Duration
+	shuffle          bool
+	pingMethod       string
+	monitorURL       string
+	connectionStats  bool
+	shuffleSeed      int64
+	shuffleWindow    int
+	minBatch         int
+	maxFailures      int
+	maxFailureRate   float64
+	timestamps       bool
+	requestTimeout   time.Duration
+	record           string
+	shadowURL        string
+	shadowCompare    string
+	canaryURL        string
+	canaryPercent    int
+	mirrorURLs       stringsFlag
+	mirrorWorkers    int
+	dispatchWorkers  int
+	processWorkers   int
+	responseBuffer   int
+	autoTune         bool
+	adaptiveChunk    bool
+	maxChunkSize     int
+	prewarm          int
+	keepAlivePing    time.Duration
+	ipPreference     string
+	fallbackDelay    time.Duration
+	maxIdlePerHost   int
+	maxConnsPerHost  int
+	idleConnTimeout  time.Duration
+	tcpKeepAlive     time.Duration
+	disableHTTP2     bool
+	multiplex        bool
+	dohResolver      string
+	dnsCache         time.Duration
+	connectTimeout   time.Duration
+	headerTimeout    time.Duration
+	errorBudget      float64
+	budgetWindow     int
+	asyncPolls       int
+	asyncInterval    time.Duration
+	maxMemory        int
+	maxResponseBytes int64
+	inputFormat      string
+	contentType      string
+	queryParams      stringsFlag
+	maxAttempts      int
+	retryDelay       time.Duration
+	retryJitter      float64
+	maxRetryAfter    time.Duration
+	maintenanceFile  string
+	maintenanceDelay time.Duration
+	ttl              time.Duration
+	throttleOnRetry  bool
+	maxRetries       int
+	retryBudget      float64
+	tenantField      string
+	rateLimit        float64
+	rateBurst        int
+	hedgeDelay       time.Duration
+	maxConcurrency   int
+	latencyTarget    time.Duration
+	cacheEntries     int
+	inputFiles       stringsFlag
+	jobFile          string
+	digestTo         stringsFlag
+	smtpAddr         string
+	smtpFrom         string
+	smtpUser         string
+	alertFailureRate float64
+	alertChunks      int
+	auditManifest    string
+	signingKey       string
+	crypto           string
+	auditLog         string
+	notBefore        timeFlag
+	notAfter         timeFlag
+	expiredFile      string
+	maxInFlight      int64
+}
+
+// session holds the collaborators shared by every chunk of a notify run.
+type session struct {
+	HTTPClient  *pkg.BulkHTTPClient
+	recorder    *tapeRecorder
+	mirror      *mirror
+	pinger      *pinger
+	budget      *errorBudget
+	job         *jobTracker
+	digest      *digest
+	audit       *auditTrail
+	auditLog    *auditLog
+	maintenance *maintenance
+	schedule    *runSchedule
+	connStats   *connStats
+	monitor     *monitor
 }
 
 // result represents the program's output
 type result struct {
-	responses []*http.Response
-	errors    []error
+	responses   []*http.Response
+	errors      []error
+	targets     []string
+	shadowDiffs []string
+	timestamps  []timestamps
+	pingURLs    []string
+}
+
+// add appends the other result to this result.
+func (r *result) add(other result) {
+	r.responses = append(r.responses, other.responses...)
+	r.errors = append(r.errors, other.errors...)
+	r.targets = append(r.targets, other.targets...)
+	r.shadowDiffs = append(r.shadowDiffs, other.shadowDiffs...)
+	r.timestamps = append(r.timestamps, other.timestamps...)
+	r.pingURLs = append(r.pingURLs, other.pingURLs...)
 }
 
 func main() {
-	mainCommand := flag.NewFlagSet("notify", flag.ExitOnError)
-	targetURL := mainCommand.String("url", "", "The target URL that will receive the notifications.")
-	chunkSize := mainCommand.Int("chunkSize", 1, "The amount of messages to process in bulk.")
-	interval := mainCommand.Duration("interval", 1*time.Second, "The interval between each operation.")
-	requestTimeout := mainCommand.Duration("requestTimeout", 1*time.Second, "The timeout for each HTTP request.")
+	cmds := commands()
 
 	// Enforce the right number of command and flags.
 	if len(os.Args) < 2 {
-		log.Println(`You must specify a command. Commands available: "notify"`)
+		log.Printf("You must specify a command. Commands available: %s", commandNames(cmds))
 		os.Exit(1)
 	}
 
 	// Make sure the command exists.
-	switch os.Args[1] {
-	case "notify":
-		err := mainCommand.Parse(os.Args[2:])
-		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+	cmd := findCommand(cmds, os.Args[1])
+	if cmd == nil {
+		printUsage(os.Stderr, cmds)
+		os.Exit(1)
+	}
+
+	err := cmd.execute(os.Args[2:])
+	if err != nil {
+		log.Println(err)
+		if _, ok := err.(usageError); ok {
+			cmd.flags.PrintDefaults()
 		}
-	default:
-		flag.PrintDefaults()
 		os.Exit(1)
 	}
+}
+
+// newNotifyCommand returns the command that sends the messages read from STDIN.
+func newNotifyCommand() *command {
+	return newNotifyCommandFor(nil)
+}
+
+// newNotifyCommandFor returns the notify command continuing the given job, if any, instead of starting a new one.
+func newNotifyCommandFor(resumed *jobTracker) *command {
+	cmd := newCommand(
+		"notify",
+		"Send the messages read from STDIN to the target URL.",
+		"Reads the messages from STDIN, or from the --inputFile files. Each line is considered a new message.",
+	)
+
+	var conf configuration
+	cmd.flags.StringVar(&conf.targetUrl, "url", "", "The target URL that will receive the notifications. (Mandatory)")
+	cmd.flags.IntVar(&conf.chunkSize, "chunkSize", 1, "The amount of messages to process in bulk.")
+	cmd.flags.DurationVar(&conf.interval, "interval", 1*time.Second, "The interval between each operation.")
+	cmd.flags.DurationVar(&conf.maxWait, "maxWait", 0, "Send a partially filled chunk once the given duration elapsed since its first message, instead of waiting for --chunkSize messages. Zero disables it.")
+	cmd.flags.IntVar(&conf.minBatch, "minBatch", 0, "The minimum amount of messages of a chunk sent after --maxWait: a smaller chunk waits for more messages, or for the end of the input.")
+	cmd.flags.BoolVar(&conf.shuffle, "shuffle", false, "Randomize the order of the messages within windows of --shuffleWindow messages, e.g. so that an input sorted by tenant doesn't send long bursts of a single tenant. The line numbers of the results follow the sending order.")
+	cmd.flags.Int64Var(&conf.shuffleSeed, "shuffleSeed", 0, "The seed of --shuffle, to reproduce the order of a previous run. Zero picks a random one, which is logged.")
+	cmd.flags.IntVar(&conf.shuffleWindow, "shuffleWindow", 10000, "The amount of messages read ahead and shuffled by --shuffle. The messages wait for the window to fill up, or for the end of the input.")
+	cmd.flags.BoolVar(&conf.pace, "pace", false, "Spread the notifications of each chunk evenly over --interval instead of sending them all at once.")
+	cmd.flags.BoolVar(&conf.batchHeaders, "batchHeaders", false, "Stamp the notifications with the X-Batch-Id, X-Batch-Size and X-Batch-Index headers of their chunk, so that the receiver can detect partially delivered chunks.")
+	cmd.flags.DurationVar(&conf.requestTimeout, "requestTimeout", 1*time.Second, "The timeout for each HTTP request.")
+	cmd.flags.BoolVar(&conf.connectionStats, "connectionStats", false, "Print the statistics of the connections to the targets on shutdown: the connections opened and reused, the responses received over HTTP/2, the DNS lookups and the TLS handshakes and resumptions.")
+	cmd.flags.DurationVar(&conf.connectTimeout, "connectTimeout", 30*time.Second, "The timeout for establishing a connection with a target.")
+	cmd.flags.DurationVar(&conf.headerTimeout, "responseHeaderTimeout", 0, "The timeout for receiving the response headers once the request is sent. Zero means no timeout.")
+	cmd.flags.Var(&conf.inputFiles, "inputFile", "Read the messages from the given file instead of STDIN. It can be repeated: the files are read one after the other.")
+	cmd.flags.StringVar(&conf.jobFile, "job", "", "Write the manifest of the run to the given file, so that an interrupted run can be continued with notifier resume. It requires --inputFile.")
+	cmd.flags.StringVar(&conf.inputFormat, "input", inputLines, `The input format: "lines", where each line is a message body, "jsonl", where each line is a {"body": ..., "contentType": ...} envelope, or "urls", where each line is a URL, or a path resolved against --url or put in place of its {message} placeholder, pinged with --pingMethod and without body.`)
+	cmd.flags.StringVar(&conf.pingMethod, "pingMethod", http.MethodGet, `The method of the pings of the "urls" input format: GET or HEAD.`)
+	cmd.flags.StringVar(&conf.contentType, "contentType", contentTypeAuto, `The Content-Type of the notifications. "auto" detects JSON, XML and plain text bodies.`)
+	cmd.flags.Var(&conf.queryParams, "queryParam", "Append the value of a JSON message field to the target URL as a query parameter, e.g. user_id=user.id. It can be repeated.")
+	cmd.flags.StringVar(&conf.tenantField, "tenantField", "", "The JSON message field holding the tenant. The notifications of a chunk are sent in round-robin across the tenants.")
+	cmd.flags.BoolVar(&conf.timestamps, "timestamps", false, "Print when each notification was queued, started and finished, with its queueing delay and its service time.")
+	cmd.flags.StringVar(&conf.record, "record", "", "Record the messages and their timings to the given tape file.")
+	cmd.flags.StringVar(&conf.shadowURL, "shadowUrl", "", "A shadow target URL that receives a copy of every notification. Its responses are compared with the target's ones.")
+	cmd.flags.StringVar(&conf.shadowCompare, "shadowCompare", "status", `The comparison rules between the target and the shadow responses: "status", "body" or "status,body".`)
+	cmd.flags.StringVar(&conf.canaryURL, "canaryUrl", "", "A canary target URL that receives a percentage of the notifications instead of the target.")
+	cmd.flags.IntVar(&conf.canaryPercent, "canaryPercent", 0, "The percentage of notifications sent to the canary target.")
+	cmd.flags.BoolVar(&conf.adaptiveChunk, "adaptiveChunkSize", false, "Adapt the chunk size to the observed latency and error rate, starting from --chunkSize.")
+	cmd.flags.IntVar(&conf.maxChunkSize, "maxChunkSize", 1000, "The maximum chunk size reached by --adaptiveChunkSize.")
+	cmd.flags.IntVar(&conf.asyncPolls, "asyncPollAttempts", 0, "Follow the 202 Accepted responses by polling their Location URL up to the given amount of times. Zero disables it.")
+	cmd.flags.DurationVar(&conf.asyncInterval, "asyncPollInterval", 1*time.Second, "The interval between each status poll of an asynchronous acknowledgement.")
+	cmd.flags.IntVar(&conf.cacheEntries, "cacheEntries", 0, "Cache up to the given amount of responses to the GET requests, e.g. the status polls, honoring their Cache-Control and ETag headers. Zero disables it.")
+	cmd.flags.Var(&conf.successStatuses, "successStatus", "Consider the given status code, e.g. 409 for a receiver answering that it already has the notification, as a success rather than a failure: it is not retried nor reported as failed. It can be repeated or hold comma-separated codes.")
+	cmd.flags.Var(&conf.expectedHeaders, "expectHeader", `Fail the successful notifications whose response lacks the given header, e.g. "X-Processed: true", or "X-Request-Id" for any value, since some receivers signal their soft failures with a header. It can be repeated.`)
+	cmd.flags.IntVar(&conf.maxAttempts, "maxAttempts", 1, "The maximum amount of attempts for each notification. The transport errors, except the unknown hosts and the invalid certificates, and the 429, 502, 503 and 504 responses are retried.")
+	cmd.flags.DurationVar(&conf.retryDelay, "retryDelay", 100*time.Millisecond, "The delay before the first retry, doubled after each attempt.")
+	cmd.flags.Float64Var(&conf.retryJitter, "retryJitter", 0.2, "The maximum fraction, between 0 and 1, of the retry delay randomly removed from it.")
+	cmd.flags.DurationVar(&conf.maxRetryAfter, "maxRetryAfter", 0, "Wait for the Retry-After delay of the retried 429 and 503 responses, up to the given duration. Longer delays aren't retried. Zero ignores the header.")
+	cmd.flags.StringVar(&conf.maintenanceFile, "maintenanceFile", "", "Park the notifications answered with a 503 and a Retry-After delay of at least --maintenanceDelay in the given file, and deliver them again once the delay elapsed.")
+	cmd.flags.DurationVar(&conf.maintenanceDelay, "maintenanceDelay", time.Minute, "The minimum Retry-After delay of a 503 response telling that the target is under maintenance, see --maintenanceFile.")
+	cmd.flags.BoolVar(&conf.throttleOnRetry, "retryAfterThrottle", false, "Pause all the notifications, not only the retried one, for the Retry-After delay honored by --maxRetryAfter.")
+	cmd.flags.IntVar(&conf.maxFailures, "maxFailures", 0, "Abort the run once the given amount of notifications failed, cancelling the ones in flight, and print the partial results. Zero disables it.")
+	cmd.flags.Float64Var(&conf.maxFailureRate, "maxFailureRate", 0, "Abort the run once the given share, between 0 and 1, of the notifications of the run, or of a chunk, failed, like --maxFailures. Zero disables it.")
+	cmd.flags.IntVar(&conf.maxRetries, "maxRetries", 0, "The maximum amount of retries for each chunk, across all its notifications. Zero disables it.")
+	cmd.flags.Float64Var(&conf.retryBudget, "retryBudget", 0, "The maximum amount of retries for each chunk, as a fraction of its notifications, e.g. 0.1 for one retry per ten notifications. Zero disables it.")
+	cmd.flags.Float64Var(&conf.rateLimit, "rateLimit", 0, "The maximum amount of requests per second sent to the targets, retries included. Zero disables it.")
+	cmd.flags.IntVar(&conf.rateBurst, "rateBurst", 1, "The amount of requests that can be sent at once above --rateLimit.")
+	cmd.flags.DurationVar(&conf.hedgeDelay, "hedgeDelay", 0, "Send a duplicate of the notifications that haven't returned after the given delay and keep the first success. Zero disables it.")
+	cmd.flags.IntVar(&conf.maxConcurrency, "maxConcurrency", 0, "Adapt the amount of requests in flight to the latency and the failures of the targets, starting from --dispatchWorkers and up to the given amount. Zero disables it.")
+	cmd.flags.DurationVar(&conf.latencyTarget, "latencyTarget", 500*time.Millisecond, "The response time under which --maxConcurrency lets more requests in flight.")
+	cmd.flags.Int64Var(&conf.maxInFlight, "maxInFlightBytes", 0, "The maximum amount of request body bytes sent at once to the targets, so that a few huge notifications don't saturate the uplink. Zero disables it.")
+	cmd.flags.IntVar(&conf.maxMemory, "maxMemory", 0, "The maximum amount of megabytes of request and response bodies held in memory. Zero disables it.")
+	cmd.flags.Int64Var(&conf.maxResponseBytes, "maxResponseBytes", 0, "The maximum amount of bytes read from each response body, the rest being skipped, so that huge error pages are not buffered. Zero disables it.")
+	cmd.flags.Float64Var(&conf.errorBudget, "errorBudget", 0, "The rolling failure rate of a target, between 0 and 1, above which the sending rate is halved. Zero disables it.")
+	cmd.flags.IntVar(&conf.budgetWindow, "errorBudgetWindow", 100, "The amount of recent notifications per target used to compute the rolling failure rate.")
+	cmd.flags.IntVar(&conf.prewarm, "prewarm", 0, "The amount of connections to establish with each target before sending the notifications.")
+	cmd.flags.DurationVar(&conf.keepAlivePing, "keepAlivePing", 0, "Ping the targets with a HEAD request when no notification has been sent for the given duration.")
+	cmd.flags.StringVar(&conf.ipPreference, "ipPreference", ipAuto, `The IP version used to connect to the targets: "auto", "ipv4", "ipv6", "ipv4only" or "ipv6only".`)
+	cmd.flags.DurationVar(&conf.fallbackDelay, "fallbackDelay", 300*time.Millisecond, "The time to wait for a connection with the preferred IP version before falling back to the other one.")
+	cmd.flags.IntVar(&conf.maxIdlePerHost, "maxIdleConnsPerHost", 100, "The amount of idle connections kept per target for the next notifications. It should be at least --dispatchWorkers.")
+	cmd.flags.IntVar(&conf.maxConnsPerHost, "maxConnsPerHost", 0, "The maximum amount of connections per target, the notifications waiting for a connection beyond it. Zero means no limit.")
+	cmd.flags.DurationVar(&conf.idleConnTimeout, "idleConnTimeout", 90*time.Second, "How long an idle connection is kept before being closed. Zero means no limit.")
+	cmd.flags.DurationVar(&conf.tcpKeepAlive, "tcpKeepAlive", 30*time.Second, "The interval of the TCP keep-alive probes of the connections. A negative value disables them.")
+	cmd.flags.DurationVar(&conf.dnsCache, "dnsCache", 0, "Cache the addresses of the targets for the TTL of their DNS records, or for the given duration when it is unknown, and keep using them while they are refreshed. A SIGHUP flushes the cache. Zero disables it.")
+	cmd.flags.BoolVar(&conf.disableHTTP2, "disableHttp2", false, "Send the notifications with HTTP/1.1 only, even to the targets supporting HTTP/2.")
+	cmd.flags.BoolVar(&conf.multiplex, "multiplex", false, "Wait for the first response of each target before sending it the other notifications, so that they share its connection when it negotiated HTTP/2 instead of each dispatch worker opening its own one.")
+	cmd.flags.StringVar(&conf.dohResolver, "dohResolver", "", "Resolve the targets with the given DNS over HTTPS resolver URL, falling back to the system resolver when it fails.")
+	cmd.flags.IntVar(&conf.dispatchWorkers, "dispatchWorkers", 0, "The amount of workers sending the requests. (default derived from GOMAXPROCS and the amount of targets)")
+	cmd.flags.IntVar(&conf.processWorkers, "processWorkers", 0, "The amount of workers processing the responses. (default derived from GOMAXPROCS)")
+	cmd.flags.IntVar(&conf.responseBuffer, "responseBuffer", 0, "The amount of responses waiting for a --processWorkers worker while the dispatch workers send the next notifications. Zero makes the dispatch workers wait for the processing.")
+	cmd.flags.BoolVar(&conf.autoTune, "autoTune", false, "Run a short calibration burst against the target to choose the amount of dispatch workers.")
+	cmd.flags.Var(&conf.mirrorURLs, "mirrorUrl", "A mirror target URL that receives a best-effort copy of every notification. It can be repeated.")
+	cmd.flags.IntVar(&conf.mirrorWorkers, "mirrorWorkers", 2, "The amount of workers delivering the notifications to the mirror targets.")
+	cmd.flags.StringVar(&conf.monitorURL, "monitorUrl", "", "Signal the start of the run to the /start endpoint of the given healthchecks.io-style ping URL, and its outcome, with its summary, to the URL itself or to its /fail endpoint when notifications failed or the run stopped.")
+	cmd.flags.Var(&conf.digestTo, "digestTo", "Email a summary of the run to the given address once it completes. It can be repeated.")
+	cmd.flags.StringVar(&conf.smtpAddr, "smtpAddr", "localhost:25", "The host:port address of the SMTP server sending the digest.")
+	cmd.flags.StringVar(&conf.smtpFrom, "smtpFrom", "", "The sender address of the digest. (Mandatory with --digestTo)")
+	cmd.flags.StringVar(&conf.smtpUser, "smtpUser", "", "The SMTP user. The password is read from the "+smtpPasswordEnv+" environment variable.")
+	cmd.flags.Float64Var(&conf.alertFailureRate, "alertFailureRate", 0, "Email an alert to the --digestTo addresses when the failure rate, between 0 and 1, exceeds the given value for --alertChunks chunks in a row. Zero disables it.")
+	cmd.flags.IntVar(&conf.alertChunks, "alertChunks", 3, "The amount of chunks in a row above --alertFailureRate that trigger an alert.")
+	cmd.flags.StringVar(&conf.auditManifest, "auditManifest", "", "Write the audit manifest of the run, with the hashes of its inputs and the result of every message, to the given file once it completes.")
+	cmd.flags.StringVar(&conf.signingKey, "signingKey", "", "Sign the audit manifest with the ed25519, ECDSA or RSA private key of the given PKCS #8 PEM file. It requires --auditManifest.")
+	cmd.flags.StringVar(&conf.auditLog, "auditLog", "", `Append a record per final delivery outcome, with the hash of the payload rather than its content, to the given file, or to syslog with "syslog" or "syslog://host:port".`)
+	cmd.flags.StringVar(&conf.crypto, "crypto", defaultCrypto, `The implementation of the hashing and signing primitives of the audit manifest: "standard" or "fips", which only signs with ECDSA and RSA keys.`)
+	cmd.flags.Var(&conf.notBefore, "notBefore", "Wait until the given RFC 3339 time, e.g. 2021-01-31T09:00:00Z, to send the notifications.")
+	cmd.flags.Var(&conf.notAfter, "notAfter", "Send no notification after the given RFC 3339 time. The run stops at that time.")
+	cmd.flags.DurationVar(&conf.ttl, "ttl", 0, `Drop the notifications still unsent the given duration after they were read, e.g. time-sensitive alerts sitting in a backlog, rather than delivering them late. The jsonl envelopes can set their own "expiresAt" RFC 3339 time or "ttl" duration. Zero disables it.`)
+	cmd.flags.StringVar(&conf.expiredFile, "expiredFile", "", "Write the messages left unsent at the --notAfter time, and the ones dropped once expired, to the given file.")
+
+	cmd.run = func(args []string) error {
+		err := validateTargetURL(conf.targetUrl)
+		if err != nil {
+			return err
+		}
+
+		err = validateMessageFormat(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateQueryParams(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateShadow(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateCanary(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateMirror(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateDigest(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateSchedule(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateFailFast(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateFlush(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateShuffle(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateExpectedHeaders(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validatePingMethod(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateMonitor(conf)
+		if err != nil {
+			return err
+		}
+
+		if conf.dispatchWorkers < 0 || conf.processWorkers < 0 || conf.responseBuffer < 0 {
+			return usageError("The amount of workers can't be negative.")
+		}
+
+		err = validateIPPreference(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateTransport(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateDoHResolver(conf)
+		if err != nil {
+			return err
+		}
+
+		if conf.connectTimeout < 0 || conf.headerTimeout < 0 || conf.hedgeDelay < 0 {
+			return usageError("The timeouts and the --hedgeDelay value can't be negative.")
+		}
+
+		if conf.errorBudget < 0 || conf.errorBudget > 1 || conf.budgetWindow < 1 {
+			return usageError("The --errorBudget value must be between 0 and 1 and the --errorBudgetWindow value greater than zero.")
+		}
+
+		if conf.asyncPolls < 0 || conf.cacheEntries < 0 {
+			return usageError("The --asyncPollAttempts and --cacheEntries values can't be negative.")
+		}
+
+		if conf.maxAttempts < 1 || conf.retryDelay < 0 || conf.retryJitter < 0 || conf.retryJitter > 1 {
+			return usageError("The --maxAttempts value must be greater than zero, the --retryDelay value can't be negative and the --retryJitter value must be between 0 and 1.")
+		}
+
+		if conf.maxRetryAfter < 0 {
+			return usageError("The --maxRetryAfter value can't be negative.")
+		}
+
+		if conf.maintenanceDelay <= 0 {
+			return usageError("The --maintenanceDelay value must be positive.")
+		}
+
+		if conf.ttl < 0 {
+			return usageError("The --ttl value can't be negative.")
+		}
+
+		if conf.maxRetries < 0 || conf.retryBudget < 0 {
+			return usageError("The --maxRetries and --retryBudget values can't be negative.")
+		}
+
+		if conf.rateLimit < 0 || conf.rateBurst < 1 {
+			return usageError("The --rateLimit value can't be negative and the --rateBurst value must be greater than zero.")
+		}
+
+		if conf.maxConcurrency < 0 || conf.latencyTarget <= 0 {
+			return usageError("The --maxConcurrency value can't be negative and the --latencyTarget value must be greater than zero.")
+		}
+
+		if conf.maxMemory < 0 || conf.maxInFlight < 0 || conf.maxResponseBytes < 0 {
+			return usageError("The --maxMemory, --maxInFlightBytes and --maxResponseBytes values can't be negative.")
+		}
+
+		if conf.prewarm < 0 {
+			return usageError("The --prewarm value can't be negative.")
+		}
+
+		if conf.adaptiveChunk && conf.maxChunkSize < conf.chunkSize {
+			return usageError("The --maxChunkSize value must be greater than or equal to --chunkSize.")
+		}
+
+		if conf.jobFile != "" && len(conf.inputFiles) == 0 {
+			return usageError("The --job flag requires --inputFile: the messages read from STDIN can't be read again on resume.")
+		}
+
+		if conf.signingKey != "" && conf.auditManifest == "" {
+			return usageError("The --signingKey flag requires --auditManifest.")
+		}
+
+		err = validateCrypto(conf.crypto)
+		if err != nil {
+			return err
+		}
+
+		for i, path := range conf.inputFiles {
+			conf.inputFiles[i], err = filepath.Abs(path)
+			if err != nil {
+				return usageError(fmt.Sprintf("The --inputFile value %q is invalid.", path))
+			}
+		}
+
+		job := resumed
+		if job == nil && conf.jobFile != "" {
+			job, err = newJob(conf.jobFile, cmd.flags, conf.inputFiles)
+			if err != nil {
+				return fmt.Errorf("unable to create the job manifest: %v", err)
+			}
+		}
+		defer job.close()
+
+		sess := &session{job: job}
+		sess.audit, err = newAuditTrail(conf, cmd.flags, job.messages())
+		if err != nil {
+			return err
+		}
+
+		sess.auditLog, err = newAuditLog(conf, job.messages())
+		if err != nil {
+			return fmt.Errorf("unable to open the audit log: %v", err)
+		}
+		defer sess.auditLog.close()
+
+		sess.maintenance, err = newMaintenance(conf, job.messages())
+		if err != nil {
+			return fmt.Errorf("unable to read the maintenance file: %v", err)
+		}
+
+		sess.schedule, err = newRunSchedule(conf)
+		if err != nil {
+			return fmt.Errorf("unable to create the expired messages file: %v", err)
+		}
+		defer sess.schedule.close()
 
-	// Mandatory flags to check.
-	if mainCommand.Parsed() {
-		if *targetURL == "" {
-			log.Println("The --url flag is mandatory.")
-			mainCommand.PrintDefaults()
-			os.Exit(1)
+		if conf.record != "" {
+			sess.recorder, err = newTapeRecorder(conf.record)
+			if err != nil {
+				return fmt.Errorf("unable to create the tape: %v", err)
+			}
+			defer sess.recorder.close()
 		}
+
+		runNotify(conf, sess)
+		return nil
+	}
+
+	return cmd
+}
+
+// validateTargetURL makes sure the mandatory --url flag is set and valid.
+func validateTargetURL(targetURL string) error {
+	if targetURL == "" {
+		return usageError("The --url flag is mandatory.")
 	}
 
-	// Validate URL.
-	_, err := url.ParseRequestURI(*targetURL)
+	_, err := url.ParseRequestURI(targetURL)
 	if err != nil {
-		log.Println("The --url value is invalid.")
-		mainCommand.PrintDefaults()
-		os.Exit(1)
+		return usageError("The --url value is invalid.")
 	}
 
-	// Setup configuration
-	conf := configuration{
-		targetUrl:      *targetURL,
-		chunkSize:      *chunkSize,
-		interval:       *interval,
-		requestTimeout: *requestTimeout,
+	return nil
+}
+
+// clientOptions returns the bulk client options matching the configuration.
+func clientOptions(conf configuration) []pkg.Option {
+	var opts []pkg.Option
+	if conf.asyncPolls > 0 {
+		opts = append(opts, pkg.WithAsyncPolling(conf.asyncPolls, conf.asyncInterval))
+	}
+	if conf.cacheEntries > 0 {
+		opts = append(opts, pkg.WithResponseCache(conf.cacheEntries))
+	}
+	if conf.batchHeaders {
+		opts = append(opts, pkg.WithBatchHeaders())
+	}
+	if len(conf.successStatuses) > 0 {
+		opts = append(opts, pkg.WithSuccessStatuses(conf.successStatuses...))
+	}
+	opts = append(opts, expectedHeaderOptions(conf)...)
+	if conf.maxFailures > 0 || conf.maxFailureRate > 0 {
+		opts = append(opts, pkg.WithFailFast(conf.maxFailures, conf.maxFailureRate))
+	}
+	if conf.maxAttempts > 1 {
+		var policy pkg.RetryPolicy = pkg.ExponentialBackoff{MaxAttempts: conf.maxAttempts, BaseDelay: conf.retryDelay, Jitter: conf.retryJitter}
+		if conf.maintenanceFile != "" {
+			policy = maintenancePolicy{policy: policy, minDelay: conf.maintenanceDelay}
+		}
+		opts = append(opts, pkg.WithRetryPolicy(policy))
+	}
+	if conf.maxRetryAfter > 0 {
+		opts = append(opts, pkg.WithRetryAfter(conf.maxRetryAfter, conf.throttleOnRetry))
+	}
+	if conf.maxRetries > 0 || conf.retryBudget > 0 {
+		opts = append(opts, pkg.WithRetryBudget(conf.maxRetries, conf.retryBudget))
+	}
+	if conf.rateLimit > 0 {
+		opts = append(opts, pkg.WithRateLimit(conf.rateLimit, conf.rateBurst))
+	}
+	if conf.hedgeDelay > 0 {
+		opts = append(opts, pkg.WithHedging(conf.hedgeDelay))
+	}
+	if conf.maxConcurrency > 0 {
+		opts = append(opts, pkg.WithAdaptiveConcurrency(conf.maxConcurrency, conf.latencyTarget))
+	}
+	if conf.maxMemory > 0 {
+		opts = append(opts, pkg.WithMemoryLimit(int64(conf.maxMemory)<<20))
+	}
+	if conf.maxInFlight > 0 {
+		opts = append(opts, pkg.WithMaxInFlightBytes(conf.maxInFlight))
+	}
+	if conf.maxResponseBytes > 0 {
+		opts = append(opts, pkg.WithMaxResponseSize(conf.maxResponseBytes, true))
+	}
+	if conf.responseBuffer > 0 {
+		opts = append(opts, pkg.WithResponseBuffer(conf.responseBuffer))
+	}
+	if conf.multiplex {
+		opts = append(opts, pkg.WithMultiplexing())
 	}
 
+	return opts
+}
+
+// runNotify sends the notifications until the end of input is reached
+// or the program receives an interrupt signal.
+// The session comes with the collaborators backed by files: the job, the tape recorder, the audit trail,
+// the audit log, the maintenance file and the schedule. The other ones are created here.
+func runNotify(conf configuration, sess *session) {
 	// Listen for OS interrupt signals.
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
@@ -97,110 +577,337 @@ func main() {
 		cancel()
 	}()
 
-	// Prepare HTTP client and inject the cancellable context.
-	HTTPClient := &http.Client{Timeout: *requestTimeout}
-	bulkHTTPClient := pkg.NewBulkHTTPClient(ctx, HTTPClient)
+	// Prepare the HTTP client. The cancellable context is passed to each bulk request.
+	sess.connStats = newConnStats(conf)
+	dnsCache := newDNSCache(conf)
+	go flushOnHangup(ctx, dnsCache)
+	HTTPClient := &http.Client{Timeout: conf.requestTimeout, Transport: sess.connStats.wrap(newTransport(conf, dnsCache))}
+	bulkHTTPClient := pkg.NewClient(HTTPClient, clientOptions(conf)...)
+
+	if conf.prewarm > 0 {
+		prewarm(HTTPClient, []string{conf.targetUrl, conf.canaryURL, conf.shadowURL}, conf.prewarm)
+	}
+
+	if conf.autoTune {
+		conf.dispatchWorkers = autoTune(ctx, bulkHTTPClient, conf.targetUrl)
+	}
+
+	sess.HTTPClient = bulkHTTPClient
+	sess.mirror = newMirror(conf, &http.Client{Timeout: conf.requestTimeout})
+	sess.pinger = newPinger(HTTPClient, []string{conf.targetUrl, conf.canaryURL, conf.shadowURL}, conf.keepAlivePing)
+	sess.budget = newErrorBudget(conf.errorBudget, conf.budgetWindow)
+	sess.digest = newDigest(conf)
+	sess.monitor = newMonitor(conf)
+	sess.monitor.start()
+	go sess.pinger.run(ctx)
 
 	// Start the program has child process.
-	ticker := time.NewTicker(*interval)
-	go startProgram(conf, ticker, bulkHTTPClient, cancel)
+	ticker := time.NewTicker(conf.interval)
+	go startProgram(ctx, conf, ticker, sess, cancel)
 
 	log.Println("Sending notifications...")
 	<-ctx.Done()
+	sess.monitor.fail("The run was interrupted before it completed.")
+	sess.mirror.close()
+	sess.connStats.print(os.Stdout)
 	log.Println("The program terminated gracefully.")
 }
 
-// startProgram starts to process the messages in STDIN.
+// startProgram starts to process the messages in STDIN or in the input files,
+// after the checkpoint of the job, if any. No message is read while the target is under maintenance,
+// and the end of input waits for the parked messages to be delivered.
 // It cancels the context as soon as the end of input is reached
 // or a fatal error is thrown.
 func startProgram(
+	ctx context.Context,
 	conf configuration,
 	ticker *time.Ticker,
-	HTTPClient *pkg.BulkHTTPClient,
+	sess *session,
 	cancel context.CancelFunc,
 ) {
+	input, err := openInputs(conf.inputFiles, sess.job.offset(), sess.audit.watchFile)
+	if err != nil {
+		log.Printf("A fatal error occurred: %v", err)
+		sess.monitor.fail(fmt.Sprintf("A fatal error occurred: %v", err))
+		cancel()
+		return
+	}
+	defer input.Close()
+
+	if !sess.schedule.waitStart(ctx) {
+		return
+	}
+
 	var finalResult result
-	stdioReader := bufio.NewReader(os.Stdin)
+	stdioReader := newChunkReader(ctx, conf, newShuffledReader(conf, bufio.NewReader(sess.audit.watch(input))))
 	for range ticker.C {
-		EOF, res, err := processLines(conf, stdioReader, HTTPClient)
+		if sess.schedule.isOver() {
+			expireRun(ctx, conf, stdioReader, finalResult, sess)
+			cancel()
+			return
+		}
+
+		if err := sess.maintenance.resume(ctx, conf, sess, &finalResult); err != nil {
+			log.Printf("A fatal error occurred: %v", err)
+			sess.monitor.fail(fmt.Sprintf("A fatal error occurred: %v", err))
+			cancel()
+			return
+		}
+		if sess.maintenance.inMaintenance(conf.targetUrl) {
+			// The next messages stay in the input until the end of the maintenance window.
+			continue
+		}
+
+		start := time.Now()
+		EOF, res, err := processLines(ctx, conf, stdioReader, sess)
 		if err != nil {
 			log.Printf("A fatal error occurred: %v", err)
+			sess.monitor.fail(fmt.Sprintf("A fatal error occurred: %v", err))
+			cancel()
+			return
+		}
+		finalResult.add(res)
+		sess.digest.record(res)
+
+		if reason := abortReason(conf, finalResult, res); reason != "" {
+			log.Printf("Aborting the run: %s.", reason)
+			printResult(conf, finalResult)
+			if err := sess.audit.write(finalResult); err != nil {
+				log.Printf("Unable to write the audit manifest: %v", err)
+			}
+			sess.digest.report(finalResult)
+			sess.monitor.report(finalResult)
+			cancel()
+			return
+		}
+
+		if conf.adaptiveChunk {
+			conf.chunkSize = nextChunkSize(conf, res, time.Since(start))
+		}
+
+		if sess.budget != nil {
+			sess.budget.record(res)
+			ticker.Reset(sess.budget.interval(conf.interval))
+		}
+
+		if sess.schedule.isOver() {
+			expireRun(ctx, conf, stdioReader, finalResult, sess)
 			cancel()
 			return
 		}
-		finalResult.responses = append(finalResult.responses, res.responses...)
-		finalResult.errors = append(finalResult.errors, res.errors...)
 
 		if EOF {
-			printResult(finalResult)
+			for sess.maintenance.pending() {
+				if !sess.maintenance.wait(ctx) {
+					return
+				}
+				if err := sess.maintenance.resume(ctx, conf, sess, &finalResult); err != nil {
+					log.Printf("A fatal error occurred: %v", err)
+					sess.monitor.fail(fmt.Sprintf("A fatal error occurred: %v", err))
+					cancel()
+					return
+				}
+			}
+			if err := sess.job.complete(); err != nil {
+				log.Printf("Unable to complete the job manifest: %v", err)
+			}
+			printResult(conf, finalResult)
+			if err := sess.audit.write(finalResult); err != nil {
+				log.Printf("Unable to write the audit manifest: %v", err)
+			}
+			sess.digest.report(finalResult)
+			sess.monitor.report(finalResult)
 			cancel()
 			return
 		}
 	}
 }
 
+// expireRun writes the messages left unsent at the --notAfter time to the expired messages and prints the result.
+// The input is read until it ends or stays idle, see runSchedule.flush.
+func expireRun(ctx context.Context, conf configuration, reader lineReader, finalResult result, sess *session) {
+	if err := sess.schedule.flush(ctx, reader); err != nil {
+		log.Printf("Unable to write the expired messages: %v", err)
+	}
+
+	log.Printf("The --notAfter time passed: %d messages were not sent.", sess.schedule.count)
+	printResult(conf, finalResult)
+	sess.monitor.report(finalResult)
+}
+
 // processLines processes multiple notifications at a time according to the limit.
 func processLines(
+	ctx context.Context,
 	conf configuration,
-	reader *bufio.Reader,
-	HTTPClient *pkg.BulkHTTPClient,
+	reader chunkReader,
+	sess *session,
 ) (EOF bool, res result, err error) {
-	var messages []string
-	var errs []error
-	var responses []*http.Response
-
-	for i := 0; i < conf.chunkSize; i++ {
-		text, err := reader.ReadString('\n')
-		switch err {
-		case nil:
-			log.Printf("Processing message: %s", text)
-		case io.EOF:
-			log.Printf("Processing message: %s", text)
-			EOF = true
-			break
-		default:
+	messages, EOF, err := reader.readChunk(ctx, conf)
+	if err != nil {
+		return false, result{}, err
+	}
+	messages = withoutEmptyMessages(conf, messages)
+
+	if len(messages) > 0 {
+		if err := sess.recorder.record(messages); err != nil {
+			return false, result{}, err
+		}
+		sess.mirror.send(messages)
+		deliveryCtx, cancelDelivery := sess.schedule.deliveryContext(ctx)
+		res = deliver(deliveryCtx, conf, sess.HTTPClient, messages)
+		cancelDelivery()
+		sess.pinger.touch()
+		if err := sess.schedule.keep(messages, res); err != nil {
 			return false, result{}, err
 		}
+		if err := sess.maintenance.park(messages, res); err != nil {
+			return false, result{}, err
+		}
+		if err := sess.job.checkpoint(messages, res); err != nil {
+			return false, result{}, err
+		}
+		if err := sess.auditLog.record(messages, res); err != nil {
+			return false, result{}, err
+		}
+	}
 
-		messages = append(messages, text)
+	return EOF, res, nil
+}
+
+// deliver sends the messages to the target and, when configured, to the shadow target.
+// When a canary target is set, each message is sent either to the target or to the canary.
+// The shadow delivery runs concurrently and never affects the target's result.
+// The timestamps of the notifications are kept with --timestamps.
+func deliver(ctx context.Context, conf configuration, HTTPClient *pkg.BulkHTTPClient, messages []string) result {
+	var res result
+	var shadowResult pkg.BulkResult
+	var shadowWg sync.WaitGroup
+	if conf.shadowURL != "" {
+		shadowWg.Add(1)
+		go func() {
+			defer shadowWg.Done()
+			shadowResult = sendNotifications(ctx, conf, HTTPClient, conf.shadowURL, messages)
+		}()
 	}
 
-	if len(messages) > 0 {
-		responses, errs = sendNotifications(HTTPClient, conf.targetUrl, messages)
+	res.targets = chooseTargets(conf, len(messages))
+	sent := sendNotificationsTo(ctx, conf, HTTPClient, res.targets, messages)
+	res.responses, res.errors = sent.Responses(), sent.Errors()
+	res.pingURLs = pingURLs(conf, res.targets, messages)
+	if conf.timestamps {
+		res.timestamps = entryTimestamps(sent.Entries)
 	}
+	shadowWg.Wait()
+
+	shadowResponses, shadowErrors := shadowResult.Responses(), shadowResult.Errors()
+
+	for i := range shadowResponses {
+		diff := compareShadow(conf.shadowCompare, res.responses[i], res.errors[i], shadowResponses[i], shadowErrors[i])
+		res.shadowDiffs = append(res.shadowDiffs, diff)
+	}
+
+	// Only the status codes are reported: release the bodies.
+	closeResponses(res.responses)
+	closeResponses(shadowResponses)
 
-	return EOF, result{
-		responses: responses,
-		errors:    errs,
-	}, nil
+	return res
+}
+
+// closeResponses closes the response bodies.
+func closeResponses(responses []*http.Response) {
+	for _, res := range responses {
+		if res != nil {
+			_ = res.Body.Close()
+		}
+	}
 }
 
 // sendNotifications sends a bulk request.
 // It gathers all the request bodies in a single bulk request.
-func sendNotifications(HTTPClient *pkg.BulkHTTPClient, URL string, bodies []string) ([]*http.Response, []error) {
-	var requests []*http.Request
-	for _, body := range bodies {
-		req, _ := http.NewRequest(http.MethodPost, URL, bytes.NewBuffer([]byte(body)))
-		requests = append(requests, req)
+func sendNotifications(
+	ctx context.Context,
+	conf configuration,
+	HTTPClient *pkg.BulkHTTPClient,
+	URL string,
+	bodies []string,
+) pkg.BulkResult {
+	URLs := make([]string, len(bodies))
+	for i := range URLs {
+		URLs[i] = URL
+	}
+
+	return sendNotificationsTo(ctx, conf, HTTPClient, URLs, bodies)
+}
+
+// sendNotificationsTo sends a bulk request where each body is sent to the URL at the same index.
+func sendNotificationsTo(
+	ctx context.Context,
+	conf configuration,
+	HTTPClient *pkg.BulkHTTPClient,
+	URLs []string,
+	bodies []string,
+) pkg.BulkResult {
+	dispatchWorkers, processWorkers := workers(conf, countTargets(URLs))
+	builder := pkg.NewBulkRequestBuilder().Workers(dispatchWorkers, processWorkers)
+	for i, body := range bodies {
+		addNotification(conf, builder, URLs[i], body)
+	}
+
+	bulkRequest, err := builder.Build()
+	if err != nil {
+		return failedResult(len(bodies), err)
+	}
+	if conf.pace {
+		bulkRequest.Pace(conf.interval)
 	}
 
-	// Send request with a default amount of workers set to 20
-	bulkRequest := pkg.NewBulkRequest(requests, 20, 20)
-	return HTTPClient.Do(bulkRequest)
+	return HTTPClient.Send(ctx, bulkRequest)
+}
+
+// failedResult returns the result of a bulk request that couldn't be sent: each notification fails with the given error.
+func failedResult(count int, err error) pkg.BulkResult {
+	result := pkg.BulkResult{Entries: make([]pkg.Result, count)}
+	for i := range result.Entries {
+		result.Entries[i] = pkg.Result{Index: i, Err: err}
+	}
+
+	return result
 }
 
 // printResult pretty prints the output before exiting.
-func printResult(finalResult result) {
+func printResult(conf configuration, finalResult result) {
 	fmt.Print("\nRESULTS ...\n")
 	for i := 0; i < len(finalResult.responses); i++ {
 		statusCode := 0
 		if finalResult.responses[i] != nil {
 			statusCode = finalResult.responses[i].StatusCode
 		}
-		if finalResult.errors[i] != nil {
-			fmt.Printf("Message at line %d - Returned status code %d - Error: %v\n", i, statusCode, finalResult.errors[i])
-		} else {
-			fmt.Printf("Message at line %d - Returned status code %d\n", i, statusCode)
+		reason := failureReason(conf, finalResult.responses[i], finalResult.errors[i])
+		var stamps timestamps
+		if i < len(finalResult.timestamps) {
+			stamps = finalResult.timestamps[i]
+		}
+		label := fmt.Sprintf("Message at line %d", i)
+		if i < len(finalResult.pingURLs) {
+			label = fmt.Sprintf("Ping of %s at line %d", finalResult.pingURLs[i], i)
 		}
+		switch {
+		case finalResult.errors[i] != nil:
+			fmt.Printf("%s - Returned status code %d - Error: %v - Reason: %s%s\n", label, statusCode, finalResult.errors[i], reason, stamps)
+		case reason != "":
+			fmt.Printf("%s - Returned status code %d - Reason: %s%s\n", label, statusCode, reason, stamps)
+		default:
+			fmt.Printf("%s - Returned status code %d%s\n", label, statusCode, stamps)
+		}
+	}
+
+	printFailureReasons(os.Stdout, conf, finalResult)
+
+	if hasMultipleTargets(finalResult) {
+		printTargetBreakdown(os.Stdout, conf, finalResult)
+	}
+
+	if len(finalResult.shadowDiffs) > 0 {
+		printShadowMismatches(finalResult)
 	}
 }
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pigeonlab/notifier/pkg"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// errParked is the error of the notifications parked until the end of the maintenance window of their target.
+var errParked = errors.New("parked until the end of the maintenance window of the target")
+
+// parkedMessage is a message parked in the maintenance file until the end of the maintenance window of its target.
+// The message number counts from the first message of the job, if any.
+type parkedMessage struct {
+	Message  int       `json:"message"`
+	Target   string    `json:"target"`
+	Body     string    `json:"body"`
+	Until    time.Time `json:"until"`
+	previous bool
+}
+
+// maintenance parks the notifications answered with a 503 Service Unavailable and a Retry-After delay
+// of at least --maintenanceDelay, i.e. by a target under maintenance, in the maintenance file.
+// They are delivered again once the delay elapsed. The messages parked by a previous run are delivered
+// again too. A nil *maintenance parks nothing.
+type maintenance struct {
+	path     string
+	minDelay time.Duration
+	first    int
+	next     int
+	windows  map[string]time.Time
+	parked   []parkedMessage
+}
+
+// newMaintenance returns a new instance of maintenance, with the messages parked in the maintenance file, if any.
+// It returns nil when no maintenance file is set. The messages are numbered from the given first message.
+func newMaintenance(conf configuration, first int) (*maintenance, error) {
+	if conf.maintenanceFile == "" {
+		return nil, nil
+	}
+
+	m := &maintenance{
+		path:     conf.maintenanceFile,
+		minDelay: conf.maintenanceDelay,
+		first:    first,
+		windows:  make(map[string]time.Time),
+	}
+
+	file, err := os.Open(conf.maintenanceFile)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var parked parkedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &parked); err != nil {
+			return nil, fmt.Errorf("invalid maintenance file: %v", err)
+		}
+		parked.previous = true
+		m.extend(parked.Target, parked.Until)
+		m.parked = append(m.parked, parked)
+	}
+
+	return m, scanner.Err()
+}
+
+// isMaintenance reports whether the response tells that the target is under maintenance for at least the given delay,
+// and until when.
+func isMaintenance(res *http.Response, minDelay time.Duration) (time.Time, bool) {
+	if res == nil || res.StatusCode != http.StatusServiceUnavailable {
+		return time.Time{}, false
+	}
+
+	delay, ok := pkg.RetryAfter(res)
+	if !ok || delay < minDelay {
+		return time.Time{}, false
+	}
+
+	return time.Now().Add(delay), true
+}
+
+// maintenancePolicy doesn't retry the responses of the targets under maintenance, since they are parked instead.
+// The other responses are retried by the wrapped policy.
+type maintenancePolicy struct {
+	policy   pkg.RetryPolicy
+	minDelay time.Duration
+}
+
+// ShouldRetry implements the pkg.RetryPolicy interface.
+func (p maintenancePolicy) ShouldRetry(res *http.Response, err error, attempt int) (bool, time.Duration) {
+	if _, ok := isMaintenance(res, p.minDelay); ok {
+		return false, 0
+	}
+
+	return p.policy.ShouldRetry(res, err, attempt)
+}
+
+// park parks the messages of the chunk answered by a target under maintenance: they fail with errParked
+// until they are delivered again by resume.
+func (m *maintenance) park(messages []string, res result) error {
+	if m == nil {
+		return nil
+	}
+
+	first := m.next
+	m.next += len(messages)
+
+	parked := false
+	for i := range res.errors {
+		until, ok := isMaintenance(res.responses[i], m.minDelay)
+		if !ok || i >= len(messages) || i >= len(res.targets) {
+			continue
+		}
+
+		target := res.targets[i]
+		if m.extend(target, until) {
+			log.Printf("The target %s is under maintenance until %s: its notifications are parked.", target, until.Format(time.RFC3339))
+		}
+		m.parked = append(m.parked, parkedMessage{Message: m.first + first + i, Target: target, Body: messages[i], Until: until})
+		res.errors[i] = errParked
+		parked = true
+	}
+
+	if !parked {
+		return nil
+	}
+
+	return m.save()
+}
+
+// extend extends the maintenance window of the target until the given time and reports whether it was not under maintenance.
+func (m *maintenance) extend(target string, until time.Time) bool {
+	current, ok := m.windows[target]
+	if !ok || until.After(current) {
+		m.windows[target] = until
+	}
+
+	return !ok || !current.After(time.Now())
+}
+
+// inMaintenance reports whether the target is under maintenance. A nil *maintenance never is.
+func (m *maintenance) inMaintenance(target string) bool {
+	if m == nil {
+		return false
+	}
+
+	until, ok := m.windows[target]
+	return ok && time.Now().Before(until)
+}
+
+// pending reports whether messages are still parked.
+func (m *maintenance) pending() bool {
+	return m != nil && len(m.parked) > 0
+}
+
+// resume delivers again the messages parked for the targets whose maintenance window elapsed.
+// Their outcome replaces the parked one in the final result, or is logged for the messages of a previous run.
+// The messages answered by a target still under maintenance are parked again.
+func (m *maintenance) resume(ctx context.Context, conf configuration, sess *session, finalResult *result) error {
+	if m == nil || len(m.parked) == 0 {
+		return nil
+	}
+
+	var due, kept []parkedMessage
+	for _, parked := range m.parked {
+		if m.inMaintenance(parked.Target) {
+			kept = append(kept, parked)
+		} else {
+			due = append(due, parked)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	targets, bodies := make([]string, len(due)), make([]string, len(due))
+	for i, parked := range due {
+		targets[i], bodies[i] = parked.Target, parked.Body
+	}
+	log.Printf("Delivering %d parked notifications again.", len(due))
+	sent := sendNotificationsTo(ctx, conf, sess.HTTPClient, targets, bodies)
+	res := result{responses: sent.Responses(), errors: sent.Errors(), targets: targets}
+	closeResponses(res.responses)
+
+	for i, parked := range due {
+		if until, ok := isMaintenance(res.responses[i], m.minDelay); ok {
+			m.extend(parked.Target, until)
+			parked.Until = until
+			kept = append(kept, parked)
+			res.errors[i] = errParked
+		}
+
+		index := parked.Message - m.first
+		switch {
+		case !parked.previous && index >= 0 && index < len(finalResult.errors):
+			finalResult.responses[index], finalResult.errors[index] = res.responses[i], res.errors[i]
+		case res.errors[i] != nil:
+			log.Printf("Parked message %d - Error: %v", parked.Message, res.errors[i])
+		default:
+			log.Printf("Parked message %d - Returned status code %d", parked.Message, res.responses[i].StatusCode)
+		}
+
+		single := result{responses: res.responses[i : i+1], errors: res.errors[i : i+1], targets: targets[i : i+1]}
+		if err := sess.auditLog.recordFrom(parked.Message, bodies[i:i+1], single); err != nil {
+			return err
+		}
+	}
+
+	m.parked = kept
+	return m.save()
+}
+
+// wait waits until the end of the first maintenance window of the parked messages
+// and reports whether it elapsed before the context was done.
+func (m *maintenance) wait(ctx context.Context) bool {
+	if !m.pending() {
+		return true
+	}
+
+	var first time.Time
+	for _, parked := range m.parked {
+		if until := m.windows[parked.Target]; first.IsZero() || until.Before(first) {
+			first = until
+		}
+	}
+
+	timer := time.NewTimer(time.Until(first))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// save writes the parked messages to the maintenance file, replacing it atomically.
+func (m *maintenance) save() error {
+	tmp := m.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, parked := range m.parked {
+		if err := encoder.Encode(parked); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.path)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// mirrorQueueSize is the maximum amount of mirror deliveries waiting for a worker.
+// Further deliveries are dropped so that mirroring never slows down the main target.
+const mirrorQueueSize = 100
+
+// mirrorDelivery represents a single message to deliver to a mirror target.
+type mirrorDelivery struct {
+	URL     string
+	message string
+}
+
+// mirror delivers copies of the notifications to the mirror targets on a best-effort basis.
+// Its failures never affect the results. A nil *mirror mirrors nothing.
+type mirror struct {
+	conf       configuration
+	HTTPClient *http.Client
+	targets    []string
+	queue      chan mirrorDelivery
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	closed     bool
+	dropped    int
+	failed     int64
+}
+
+// validateMirror makes sure the mirror flags are valid.
+func validateMirror(conf configuration) error {
+	for _, URL := range conf.mirrorURLs {
+		if validateTargetURL(URL) != nil {
+			return usageError("The --mirrorUrl value is invalid.")
+		}
+	}
+
+	if len(conf.mirrorURLs) > 0 && conf.mirrorWorkers < 1 {
+		return usageError("The --mirrorWorkers value must be greater than zero.")
+	}
+
+	return nil
+}
+
+// newMirror returns a new instance of mirror and starts its workers.
+// It returns nil when there are no mirror targets.
+func newMirror(conf configuration, HTTPClient *http.Client) *mirror {
+	if len(conf.mirrorURLs) == 0 {
+		return nil
+	}
+
+	m := &mirror{
+		conf:       conf,
+		HTTPClient: HTTPClient,
+		targets:    conf.mirrorURLs,
+		queue:      make(chan mirrorDelivery, mirrorQueueSize),
+	}
+
+	for i := 0; i < conf.mirrorWorkers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+
+	return m
+}
+
+// send queues the messages for every mirror target without blocking.
+func (m *mirror) send(messages []string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+
+	for _, message := range messages {
+		for _, URL := range m.targets {
+			select {
+			case m.queue <- mirrorDelivery{URL: URL, message: message}:
+			default:
+				m.dropped++
+			}
+		}
+	}
+}
+
+// work delivers the queued messages until the queue is closed.
+func (m *mirror) work() {
+	defer m.wg.Done()
+
+	for delivery := range m.queue {
+		req, err := newNotificationRequest(m.conf, delivery.URL, delivery.message)
+		if err != nil {
+			atomic.AddInt64(&m.failed, 1)
+			continue
+		}
+
+		res, err := m.HTTPClient.Do(req)
+		if err != nil {
+			atomic.AddInt64(&m.failed, 1)
+			continue
+		}
+
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			atomic.AddInt64(&m.failed, 1)
+		}
+	}
+}
+
+// close waits for the queued deliveries and logs the mirror failures, if any.
+func (m *mirror) close() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.closed = true
+	close(m.queue)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	if m.dropped > 0 || m.failed > 0 {
+		log.Printf("Mirror deliveries: %d failed, %d dropped.", m.failed, m.dropped)
+	}
+}
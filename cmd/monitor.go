@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// monitorTimeout is the timeout of the pings of the run monitor.
+const monitorTimeout = 10 * time.Second
+
+// monitor signals the start and the outcome of the run to a healthchecks.io-style cron monitor:
+// the start to the /start endpoint of --monitorUrl, the success to the URL itself and the failure to /fail,
+// with the summary of the run, so that the scheduled runs are monitored without wrapper scripts.
+// The failures of the monitor are logged: it never fails the run. A nil *monitor signals nothing.
+type monitor struct {
+	conf       configuration
+	HTTPClient *http.Client
+	finished   sync.Once
+}
+
+// validateMonitor makes sure the --monitorUrl value is valid.
+func validateMonitor(conf configuration) error {
+	if conf.monitorURL == "" {
+		return nil
+	}
+
+	if err := validateTargetURL(conf.monitorURL); err != nil {
+		return usageError("The --monitorUrl value is invalid.")
+	}
+
+	return nil
+}
+
+// newMonitor returns a new instance of monitor. It returns nil without --monitorUrl.
+func newMonitor(conf configuration) *monitor {
+	if conf.monitorURL == "" {
+		return nil
+	}
+
+	return &monitor{conf: conf, HTTPClient: &http.Client{Timeout: monitorTimeout}}
+}
+
+// start signals the start of the run.
+func (m *monitor) start() {
+	if m == nil {
+		return
+	}
+
+	m.signal("start", "")
+}
+
+// report signals the outcome of the completed run: a success when no notification failed, a failure otherwise.
+func (m *monitor) report(finalResult result) {
+	if m == nil {
+		return
+	}
+
+	failed := countFailures(m.conf, finalResult)
+	var body bytes.Buffer
+	_, _ = fmt.Fprintf(&body, "Target: %s\n", m.conf.targetUrl)
+	_, _ = fmt.Fprintf(&body, "Notifications: %d\nSucceeded: %d\nFailed: %d\n",
+		len(finalResult.errors), len(finalResult.errors)-failed, failed)
+	printFailureReasons(&body, m.conf, finalResult)
+
+	endpoint := ""
+	if failed > 0 {
+		endpoint = "fail"
+	}
+	m.finish(endpoint, body.String())
+}
+
+// fail signals that the run stopped because of the given reason.
+func (m *monitor) fail(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.finish("fail", reason+"\n")
+}
+
+// finish signals the outcome of the run, once: the first outcome wins, e.g. over the interruption of the run.
+func (m *monitor) finish(endpoint string, body string) {
+	m.finished.Do(func() {
+		m.signal(endpoint, body)
+	})
+}
+
+// signal pings the given endpoint of the monitor, the monitor URL itself when empty, with the given body, if any.
+func (m *monitor) signal(endpoint string, body string) {
+	URL, err := monitorEndpoint(m.conf.monitorURL, endpoint)
+	if err != nil {
+		log.Printf("Unable to signal the run to the monitor: %v", err)
+		return
+	}
+
+	res, err := m.HTTPClient.Post(URL, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		log.Printf("Unable to signal the run to the monitor: %v", err)
+		return
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		log.Printf("Unable to signal the run to the monitor: returned status code %d", res.StatusCode)
+	}
+}
+
+// monitorEndpoint returns the URL of the given endpoint of the monitor, e.g. https://hc-ping.com/<uuid>/start.
+func monitorEndpoint(monitorURL string, endpoint string) (string, error) {
+	u, err := url.Parse(monitorURL)
+	if err != nil {
+		return "", err
+	}
+	if endpoint != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + endpoint
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// degradedLatencyFactor is the ratio to the first ping's latency above which a target is considered degraded.
+const degradedLatencyFactor = 3
+
+// pinger keeps the connections to the targets warm during idle periods.
+// It sends a HEAD request to every target when no notification has been sent for a whole interval,
+// and logs the targets that fail or respond much slower than before. A nil *pinger pings nothing.
+type pinger struct {
+	HTTPClient   *http.Client
+	targets      []string
+	interval     time.Duration
+	mu           sync.Mutex
+	lastActivity time.Time
+	baselines    map[string]time.Duration
+	degraded     map[string]bool
+}
+
+// newPinger returns a new instance of pinger. It returns nil when the interval is zero.
+func newPinger(HTTPClient *http.Client, URLs []string, interval time.Duration) *pinger {
+	if interval <= 0 {
+		return nil
+	}
+
+	var targets []string
+	seen := make(map[string]bool)
+	for _, URL := range URLs {
+		if URL != "" && !seen[URL] {
+			seen[URL] = true
+			targets = append(targets, URL)
+		}
+	}
+
+	return &pinger{
+		HTTPClient:   HTTPClient,
+		targets:      targets,
+		interval:     interval,
+		lastActivity: time.Now(),
+		baselines:    make(map[string]time.Duration),
+		degraded:     make(map[string]bool),
+	}
+}
+
+// touch records that notifications have just been sent.
+func (p *pinger) touch() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.lastActivity = time.Now()
+	p.mu.Unlock()
+}
+
+// idle reports whether no notification has been sent for a whole interval.
+func (p *pinger) idle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Since(p.lastActivity) >= p.interval
+}
+
+// run pings the targets during idle periods until the context is cancelled.
+func (p *pinger) run(ctx context.Context) {
+	if p == nil {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if p.idle() {
+				for _, target := range p.targets {
+					p.ping(ctx, target)
+				}
+			}
+		}
+	}
+}
+
+// ping sends a HEAD request to the target and logs whether its health changed.
+func (p *pinger) ping(ctx context.Context, target string) {
+	req, err := http.NewRequest(http.MethodHead, target, nil)
+	if err != nil {
+		return
+	}
+
+	start := time.Now()
+	res, err := p.HTTPClient.Do(req.WithContext(ctx))
+	latency := time.Since(start)
+	if ctx.Err() != nil {
+		return
+	}
+
+	reason := ""
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case res.StatusCode >= 500:
+		reason = res.Status
+	case p.baselines[target] > 0 && latency > p.baselines[target]*degradedLatencyFactor:
+		reason = "latency " + latency.String()
+	}
+	if res != nil {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}
+	if p.baselines[target] == 0 && reason == "" {
+		p.baselines[target] = latency
+	}
+
+	if reason != "" && !p.degraded[target] {
+		log.Printf("The target %s looks degraded: %s.", target, reason)
+	} else if reason == "" && p.degraded[target] {
+		log.Printf("The target %s recovered.", target)
+	}
+	p.degraded[target] = reason != ""
+}
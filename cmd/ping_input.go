@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pigeonlab/notifier/pkg"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// urlPlaceholder is replaced by the message in a target URL template, see pingURL.
+const urlPlaceholder = "{message}"
+
+// validatePingMethod makes sure the --pingMethod value is GET or HEAD.
+func validatePingMethod(conf configuration) error {
+	if conf.pingMethod != http.MethodGet && conf.pingMethod != http.MethodHead {
+		return usageError(fmt.Sprintf("The --pingMethod value %q is invalid, it must be GET or HEAD.", conf.pingMethod))
+	}
+
+	return nil
+}
+
+// addPing adds the request pinging the URL of the message, without body, to the bulk request builder,
+// with the tenant and the expiry of the message, see pingURL.
+func addPing(conf configuration, builder *pkg.BulkRequestBuilder, target string, message string) {
+	opts := []pkg.BodyOption{pkg.BodyURL(pingURL(target, message)), pkg.BodyMethod(conf.pingMethod)}
+	if conf.tenantField != "" {
+		opts = append(opts, pkg.BodyTenant(tenantOf(conf, message)))
+	}
+	if expiresAt := messageExpiry(conf, message); !expiresAt.IsZero() {
+		opts = append(opts, pkg.BodyExpiry(expiresAt))
+	}
+
+	builder.AddBody(nil, opts...)
+}
+
+// pingURL returns the URL pinged for the message read in the urls input format: the target URL with the message
+// in place of its {message} placeholder, if any, otherwise the message resolved against the target URL,
+// e.g. a check ID appended to https://hc-ping.com/, or the message itself when it is an absolute URL.
+func pingURL(target string, message string) string {
+	message = strings.TrimSpace(message)
+	if strings.Contains(target, urlPlaceholder) {
+		return strings.ReplaceAll(target, urlPlaceholder, message)
+	}
+
+	base, err := url.Parse(target)
+	if err != nil {
+		return message
+	}
+	ref, err := url.Parse(message)
+	if err != nil {
+		return message
+	}
+
+	return base.ResolveReference(ref).String()
+}
+
+// pingURLs returns the URL pinged for each message, see pingURL. It returns nil unless the input format is urls.
+func pingURLs(conf configuration, targets []string, messages []string) []string {
+	if conf.inputFormat != inputURLs {
+		return nil
+	}
+
+	URLs := make([]string, len(messages))
+	for i, message := range messages {
+		URLs[i] = pingURL(targets[i], message)
+	}
+
+	return URLs
+}
+
+// withoutEmptyMessages drops the empty messages, e.g. the ones read at the end of the input, from the messages
+// of the urls input format, since they would ping the target URL itself. The blank lines still ping it.
+func withoutEmptyMessages(conf configuration, messages []string) []string {
+	if conf.inputFormat != inputURLs {
+		return messages
+	}
+
+	var kept []string
+	for _, message := range messages {
+		if message != "" {
+			kept = append(kept, message)
+		}
+	}
+
+	return kept
+}
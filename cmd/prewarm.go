@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// prewarmTimeout is the maximum time spent establishing the connections with a target.
+const prewarmTimeout = 10 * time.Second
+
+// prewarm establishes the given amount of connections with each target URL.
+// Every request holds its connection until all of them are connected,
+// which forces the transport to open distinct connections and keep them idle afterwards.
+func prewarm(HTTPClient *http.Client, URLs []string, connections int) {
+	seen := make(map[string]bool)
+	for _, URL := range URLs {
+		if URL == "" || seen[URL] {
+			continue
+		}
+		seen[URL] = true
+
+		start := time.Now()
+		opened := prewarmTarget(HTTPClient, URL, connections)
+		log.Printf("Pre-warmed %d connections to %s in %v.", opened, URL, time.Since(start))
+	}
+}
+
+// prewarmTarget establishes the given amount of connections with the target and returns how many were opened.
+func prewarmTarget(HTTPClient *http.Client, URL string, connections int) int {
+	var connected, done sync.WaitGroup
+	var mu sync.Mutex
+	release := make(chan struct{})
+	opened := 0
+
+	connected.Add(connections)
+	done.Add(connections)
+	for i := 0; i < connections; i++ {
+		go func() {
+			defer done.Done()
+
+			var once sync.Once
+			trace := &httptrace.ClientTrace{
+				GotConn: func(httptrace.GotConnInfo) {
+					once.Do(connected.Done)
+					<-release
+				},
+			}
+
+			req, err := http.NewRequest(http.MethodOptions, URL, nil)
+			if err != nil {
+				once.Do(connected.Done)
+				return
+			}
+
+			res, err := HTTPClient.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+			once.Do(connected.Done)
+			if err != nil {
+				return
+			}
+
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+
+			mu.Lock()
+			opened++
+			mu.Unlock()
+		}()
+	}
+
+	allConnected := make(chan struct{})
+	go func() {
+		connected.Wait()
+		close(allConnected)
+	}()
+
+	select {
+	case <-allConnected:
+	case <-time.After(prewarmTimeout):
+	}
+	close(release)
+	done.Wait()
+
+	return opened
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxBodySizeHeaders lists the headers some receivers use to advertise the maximum accepted body size.
+var maxBodySizeHeaders = []string{"X-Max-Body-Size", "Max-Body-Size", "X-Max-Content-Length"}
+
+// probeResult collects the capabilities of a target endpoint.
+// The keep-alive behaviour is only known with more than one sample, see keepAliveKnown.
+type probeResult struct {
+	protocol            string
+	allow               string
+	maxBodySize         string
+	acceptsCompression  bool
+	compressesResponses bool
+	keepAlive           bool
+	latencies           []time.Duration
+}
+
+// newProbeCommand returns the command that inspects the capabilities of a target endpoint.
+func newProbeCommand() *command {
+	cmd := newCommand(
+		"probe",
+		"Inspect a target endpoint and suggest client settings.",
+		"Sends a few OPTIONS requests to the target URL to detect the HTTP version, the compression support, "+
+			"the keep-alive behaviour and the response time, then suggests the client settings for it.",
+	)
+
+	targetURL := cmd.flags.String("url", "", "The target URL to probe. (Mandatory)")
+	samples := cmd.flags.Int("samples", 5, "The amount of requests used to measure the response time.")
+	requestTimeout := cmd.flags.Duration("requestTimeout", 5*time.Second, "The timeout for each HTTP request.")
+
+	cmd.run = func(args []string) error {
+		err := validateTargetURL(*targetURL)
+		if err != nil {
+			return err
+		}
+		if *samples < 1 {
+			return usageError("The --samples value must be greater than zero.")
+		}
+
+		HTTPClient := &http.Client{Timeout: *requestTimeout}
+		result, err := probeTarget(HTTPClient, *targetURL, *samples)
+		if err != nil {
+			return fmt.Errorf("unable to probe the target: %v", err)
+		}
+
+		result.print(os.Stdout)
+		return nil
+	}
+
+	return cmd
+}
+
+// probeTarget sends the given amount of OPTIONS requests to the target and collects its capabilities.
+func probeTarget(HTTPClient *http.Client, targetURL string, samples int) (probeResult, error) {
+	var result probeResult
+	for i := 0; i < samples; i++ {
+		req, err := http.NewRequest(http.MethodOptions, targetURL, nil)
+		if err != nil {
+			return result, err
+		}
+		// Setting the header explicitly disables the transparent decompression of the transport.
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		reused := false
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+		}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+		start := time.Now()
+		res, err := HTTPClient.Do(req)
+		if err != nil {
+			return result, err
+		}
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+		result.latencies = append(result.latencies, time.Since(start))
+
+		if i == 0 {
+			result.protocol = res.Proto
+			result.allow = res.Header.Get("Allow")
+			result.acceptsCompression = strings.Contains(res.Header.Get("Accept-Encoding"), "gzip")
+			result.compressesResponses = res.Header.Get("Content-Encoding") == "gzip"
+			for _, header := range maxBodySizeHeaders {
+				if value := res.Header.Get(header); value != "" {
+					result.maxBodySize = value
+					break
+				}
+			}
+		} else if reused {
+			result.keepAlive = true
+		}
+	}
+
+	return result, nil
+}
+
+// keepAliveKnown reports whether the keep-alive behaviour was measured: it takes a second request
+// to tell whether the connection of the first one was reused.
+func (r probeResult) keepAliveKnown() bool {
+	return len(r.latencies) > 1
+}
+
+// averageLatency returns the mean of the measured response times.
+func (r probeResult) averageLatency() time.Duration {
+	var total time.Duration
+	for _, latency := range r.latencies {
+		total += latency
+	}
+
+	return total / time.Duration(len(r.latencies))
+}
+
+// suggestedWorkers returns the amount of workers needed to keep
+// one request in flight for every 10ms of response time.
+func (r probeResult) suggestedWorkers() int {
+	workers := int(r.averageLatency() / (10 * time.Millisecond))
+	if workers < 1 {
+		return 1
+	}
+	if workers > 100 {
+		return 100
+	}
+
+	return workers
+}
+
+// print pretty prints the probe result and the suggested settings.
+func (r probeResult) print(w io.Writer) {
+	orUnknown := func(s string) string {
+		if s == "" {
+			return "not advertised"
+		}
+		return s
+	}
+
+	_, _ = fmt.Fprint(w, "\nPROBE RESULT ...\n")
+	_, _ = fmt.Fprintf(w, "Protocol:                 %s\n", r.protocol)
+	_, _ = fmt.Fprintf(w, "Allowed methods:          %s\n", orUnknown(r.allow))
+	_, _ = fmt.Fprintf(w, "Max body size:            %s\n", orUnknown(r.maxBodySize))
+	_, _ = fmt.Fprintf(w, "Accepts gzip requests:    %t\n", r.acceptsCompression)
+	_, _ = fmt.Fprintf(w, "Sends gzip responses:     %t\n", r.compressesResponses)
+	if r.keepAliveKnown() {
+		_, _ = fmt.Fprintf(w, "Keeps connections alive:  %t\n", r.keepAlive)
+	} else {
+		_, _ = fmt.Fprint(w, "Keeps connections alive:  unknown with a single sample\n")
+	}
+	_, _ = fmt.Fprintf(w, "Average response time:    %v (%d samples)\n", r.averageLatency(), len(r.latencies))
+
+	_, _ = fmt.Fprint(w, "\nSUGGESTED SETTINGS ...\n")
+	_, _ = fmt.Fprintf(w, "Workers:                  %d\n", r.suggestedWorkers())
+	switch {
+	case strings.HasPrefix(r.protocol, "HTTP/2"):
+		_, _ = fmt.Fprint(w, "Keep-alive:               requests are multiplexed over a single connection\n")
+	case !r.keepAliveKnown():
+		_, _ = fmt.Fprint(w, "Keep-alive:               probe with more samples to detect it\n")
+	case r.keepAlive:
+		_, _ = fmt.Fprint(w, "Keep-alive:               enabled, allow as many idle connections as workers\n")
+	default:
+		_, _ = fmt.Fprint(w, "Keep-alive:               the target closes the connections, prefer fewer workers\n")
+	}
+	if r.acceptsCompression {
+		_, _ = fmt.Fprint(w, "Compression:              gzip the request bodies\n")
+	} else {
+		_, _ = fmt.Fprint(w, "Compression:              send uncompressed request bodies\n")
+	}
+}
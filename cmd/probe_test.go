@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTheKeepAliveIsUnknownWithASingleSample(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	for samples, expected := range map[int]string{
+		1: "Keeps connections alive:  unknown with a single sample\n",
+		2: "Keeps connections alive:  true\n",
+	} {
+		result, err := probeTarget(server.Client(), server.URL, samples)
+		require.NoError(t, err, "no errors")
+
+		var out bytes.Buffer
+		result.print(&out)
+		assert.Contains(t, out.String(), expected)
+	}
+}
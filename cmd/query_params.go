@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// validateQueryParams makes sure each --queryParam value maps a parameter name to a message field.
+func validateQueryParams(conf configuration) error {
+	for _, mapping := range conf.queryParams {
+		name, field := splitQueryParam(mapping)
+		if name == "" || field == "" {
+			return usageError(fmt.Sprintf("The --queryParam value %q is invalid, it must be name=field.", mapping))
+		}
+	}
+
+	return nil
+}
+
+// splitQueryParam splits a name=field mapping.
+func splitQueryParam(mapping string) (string, string) {
+	parts := strings.SplitN(mapping, "=", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// queryParams adds to the given query the parameters mapped to the fields of the JSON body and returns it.
+// The nested fields are separated by dots, e.g. "user.id". The missing fields are skipped.
+func queryParams(conf configuration, body string, query url.Values) url.Values {
+	if len(conf.queryParams) == 0 {
+		return query
+	}
+
+	fields, ok := decodeFields(body)
+	if !ok {
+		return query
+	}
+
+	for _, mapping := range conf.queryParams {
+		name, field := splitQueryParam(mapping)
+		if value, ok := lookupField(fields, field); ok {
+			query.Add(name, value)
+		}
+	}
+
+	return query
+}
+
+// decodeFields decodes the fields of a JSON object body.
+func decodeFields(body string) (map[string]interface{}, bool) {
+	// Keep the numbers as they are written, large identifiers don't fit in a float64.
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, false
+	}
+
+	return fields, true
+}
+
+// lookupField returns the value of the dot-separated field path as a query parameter value.
+// The objects and arrays are encoded as JSON.
+func lookupField(fields map[string]interface{}, path string) (string, bool) {
+	var value interface{} = fields
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	default:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err == nil
+	}
+}
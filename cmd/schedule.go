@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/pigeonlab/notifier/interr"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// timeFlag is a flag value holding an RFC 3339 timestamp. An empty value means no timestamp.
+type timeFlag struct {
+	time.Time
+}
+
+// String implements the flag.Value interface.
+func (t *timeFlag) String() string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// Set implements the flag.Value interface.
+func (t *timeFlag) Set(value string) error {
+	if value == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+
+	return nil
+}
+
+// runSchedule holds the window of a notify run: it starts at --notBefore and sends nothing after --notAfter.
+// The messages left unsent at --notAfter, and the ones dropped once expired, see --ttl, are written
+// to the --expiredFile file, if any. A nil *runSchedule has no window and writes no expired message.
+type runSchedule struct {
+	notBefore time.Time
+	notAfter  time.Time
+	expired   *os.File
+	count     int
+}
+
+// validateSchedule makes sure the schedule flags are valid.
+func validateSchedule(conf configuration) error {
+	if !conf.notAfter.IsZero() && !conf.notAfter.After(conf.notBefore.Time) {
+		return usageError("The --notAfter time must be after the --notBefore one.")
+	}
+
+	if !conf.notAfter.IsZero() && time.Now().After(conf.notAfter.Time) {
+		return usageError("The --notAfter time has already passed.")
+	}
+
+	if conf.expiredFile != "" && conf.notAfter.IsZero() && conf.ttl == 0 && conf.inputFormat != inputJSONL {
+		return usageError("The --expiredFile flag requires --notAfter, --ttl or the jsonl input format.")
+	}
+
+	return nil
+}
+
+// newRunSchedule returns a new instance of runSchedule.
+// It returns nil when the run has no window and no --expiredFile file.
+func newRunSchedule(conf configuration) (*runSchedule, error) {
+	if conf.notBefore.IsZero() && conf.notAfter.IsZero() && conf.expiredFile == "" {
+		return nil, nil
+	}
+
+	s := &runSchedule{notBefore: conf.notBefore.Time, notAfter: conf.notAfter.Time}
+	if conf.expiredFile != "" {
+		file, err := os.Create(conf.expiredFile)
+		if err != nil {
+			return nil, err
+		}
+		s.expired = file
+	}
+
+	return s, nil
+}
+
+// waitStart waits until --notBefore. It returns false when the context is done first.
+func (s *runSchedule) waitStart(ctx context.Context) bool {
+	if s == nil {
+		return true
+	}
+
+	wait := time.Until(s.notBefore)
+	if wait <= 0 {
+		return true
+	}
+
+	log.Printf("Waiting until %s to send the notifications...", s.notBefore.Format(time.RFC3339))
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
+
+// isOver reports whether --notAfter has passed.
+func (s *runSchedule) isOver() bool {
+	return s != nil && !s.notAfter.IsZero() && !time.Now().Before(s.notAfter)
+}
+
+// deliveryContext returns the context of a delivery: the requests still unsent at --notAfter are cancelled.
+func (s *runSchedule) deliveryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s == nil || s.notAfter.IsZero() {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, s.notAfter)
+}
+
+// keep writes the messages of a delivery cancelled by --notAfter, and the ones dropped once expired,
+// to the expired messages. Only the former are counted as left unsent at --notAfter.
+func (s *runSchedule) keep(messages []string, res result) error {
+	if s == nil {
+		return nil
+	}
+
+	over := s.isOver()
+	for i, err := range res.errors {
+		if i >= len(messages) {
+			break
+		}
+		switch {
+		case over && err == interr.ErrIgnored:
+			s.count++
+		case errors.Is(err, interr.ErrExpired):
+		default:
+			continue
+		}
+		if err := s.write(messages[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushIdleTimeout is the time flush waits for the next message of the input before leaving the rest of it,
+// e.g. when the input is a STDIN pipe that stays open.
+const flushIdleTimeout = time.Second
+
+// flush writes the messages left in the input to the expired messages. It reads the input until its end,
+// until no message arrives within flushIdleTimeout or until the context is done, so that an input that
+// stays open doesn't hold the run forever. The messages arriving later are neither written nor counted.
+func (s *runSchedule) flush(ctx context.Context, reader lineReader) error {
+	lines := make(chan readLine)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			text, err := reader.ReadString('\n')
+			select {
+			case lines <- readLine{text: text, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		idle := time.NewTimer(flushIdleTimeout)
+		select {
+		case <-ctx.Done():
+			idle.Stop()
+			return nil
+		case <-idle.C:
+			log.Printf("No message received for %v: the rest of the input is left unread.", flushIdleTimeout)
+			return nil
+		case line := <-lines:
+			idle.Stop()
+			if line.text != "" {
+				s.count++
+				if err := s.write(line.text); err != nil {
+					return err
+				}
+			}
+			if line.err == io.EOF {
+				return nil
+			}
+			if line.err != nil {
+				return line.err
+			}
+		}
+	}
+}
+
+// write writes the expired message to the --expiredFile file, if any.
+func (s *runSchedule) write(message string) error {
+	if s.expired == nil {
+		return nil
+	}
+
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	_, err := s.expired.WriteString(message)
+
+	return err
+}
+
+// close closes the --expiredFile file.
+func (s *runSchedule) close() error {
+	if s == nil || s.expired == nil {
+		return nil
+	}
+
+	return s.expired.Close()
+}
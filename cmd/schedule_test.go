@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTheFlushOfAnOpenInputIsBounded(t *testing.T) {
+	input, writer := io.Pipe()
+	defer writer.Close()
+	go func() {
+		_, _ = writer.Write([]byte("first\nsecond\n"))
+	}()
+	schedule := &runSchedule{}
+
+	start := time.Now()
+	require.NoError(t, schedule.flush(context.Background(), bufio.NewReader(input)), "no errors")
+
+	assert.Equal(t, 2, schedule.count)
+	assert.True(t, time.Since(start) < flushIdleTimeout+time.Second, "the flush stops once the input is idle")
+}
+
+func TestTheFlushStopsWithTheContext(t *testing.T) {
+	input, writer := io.Pipe()
+	defer writer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	schedule := &runSchedule{}
+
+	start := time.Now()
+	require.NoError(t, schedule.flush(ctx, bufio.NewReader(input)), "no errors")
+
+	assert.Equal(t, 0, schedule.count)
+	assert.True(t, time.Since(start) < flushIdleTimeout, "the flush stops once the context is done")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// validateShadow makes sure the shadow flags are valid.
+func validateShadow(conf configuration) error {
+	if conf.shadowURL == "" {
+		return nil
+	}
+
+	err := validateTargetURL(conf.shadowURL)
+	if err != nil {
+		return usageError("The --shadowUrl value is invalid.")
+	}
+
+	for _, rule := range strings.Split(conf.shadowCompare, ",") {
+		if rule != "status" && rule != "body" {
+			return usageError(fmt.Sprintf("The --shadowCompare rule %q is invalid.", rule))
+		}
+	}
+
+	return nil
+}
+
+// compareShadow compares a target response with its shadow according to the given rules.
+// It returns a description of the differences or an empty string if the responses match.
+func compareShadow(rules string, res *http.Response, err error, shadowRes *http.Response, shadowErr error) string {
+	if (err != nil) != (shadowErr != nil) {
+		return fmt.Sprintf("Target error: %v - Shadow error: %v", err, shadowErr)
+	}
+	if err != nil {
+		return ""
+	}
+
+	var diffs []string
+	if strings.Contains(rules, "status") && res.StatusCode != shadowRes.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("Target status code %d - Shadow status code %d", res.StatusCode, shadowRes.StatusCode))
+	}
+
+	if strings.Contains(rules, "body") {
+		body, _ := readBody(res)
+		shadowBody, _ := readBody(shadowRes)
+		if !bytes.Equal(body, shadowBody) {
+			diffs = append(diffs, fmt.Sprintf("Target body %q - Shadow body %q", truncate(body), truncate(shadowBody)))
+		}
+	}
+
+	return strings.Join(diffs, " - ")
+}
+
+// maxDiffBodyLength is the maximum amount of body bytes printed in a mismatch description.
+const maxDiffBodyLength = 64
+
+// truncate shortens the body to maxDiffBodyLength bytes.
+func truncate(body []byte) string {
+	if len(body) > maxDiffBodyLength {
+		return string(body[:maxDiffBodyLength]) + "..."
+	}
+
+	return string(body)
+}
+
+// readBody reads the response body and restores it so that it can be read again.
+// Closing the restored body closes the original one.
+func readBody(res *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(body), res.Body}
+	return body, err
+}
+
+// printShadowMismatches pretty prints the messages for which the shadow target responded differently.
+func printShadowMismatches(finalResult result) {
+	fmt.Print("\nSHADOW MISMATCHES ...\n")
+	mismatches := 0
+	for i, diff := range finalResult.shadowDiffs {
+		if diff != "" {
+			mismatches++
+			fmt.Printf("Message at line %d - %s\n", i, diff)
+		}
+	}
+
+	fmt.Printf("Shadow mismatches: %d of %d\n", mismatches, len(finalResult.shadowDiffs))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"time"
+)
+
+// validateShuffle makes sure the --shuffle flags are valid.
+func validateShuffle(conf configuration) error {
+	if !conf.shuffle {
+		return nil
+	}
+
+	if conf.shuffleWindow < 1 {
+		return usageError("The --shuffleWindow value must be greater than zero.")
+	}
+
+	if conf.jobFile != "" {
+		return usageError("The --shuffle flag can't be combined with --job: a resumed job continues from the position of the last message sent.")
+	}
+
+	return nil
+}
+
+// shuffledReader randomizes the order of the messages read from the input, within windows of --shuffleWindow messages,
+// so that an input sorted by tenant doesn't send long bursts of notifications of a single tenant.
+type shuffledReader struct {
+	reader lineReader
+	window int
+	random *rand.Rand
+	buffer []string
+	err    error
+}
+
+// newShuffledReader returns the given input shuffled with --shuffle, or the input as is.
+// The seed is logged, so that the order of a run can be reproduced with --shuffleSeed.
+func newShuffledReader(conf configuration, reader lineReader) lineReader {
+	if !conf.shuffle {
+		return reader
+	}
+
+	seed := conf.shuffleSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("Shuffling the messages with the seed %d.", seed)
+
+	return &shuffledReader{
+		reader: reader,
+		window: conf.shuffleWindow,
+		random: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// ReadString returns a random message of the window, filled up from the input first.
+// The error that ended the input is returned with the last message. The delimiter is always a new line.
+func (s *shuffledReader) ReadString(_ byte) (string, error) {
+	for s.err == nil && len(s.buffer) < s.window {
+		text, err := s.reader.ReadString('\n')
+		if text != "" {
+			s.buffer = append(s.buffer, text)
+		}
+		s.err = err
+	}
+
+	if len(s.buffer) == 0 {
+		return "", s.err
+	}
+
+	i := s.random.Intn(len(s.buffer))
+	text := s.buffer[i]
+	last := len(s.buffer) - 1
+	s.buffer[i] = s.buffer[last]
+	s.buffer = s.buffer[:last]
+	if last == 0 {
+		return text, s.err
+	}
+
+	return text, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// statusCodesFlag is a flag value that collects the HTTP status codes of a repeated flag.
+// Each value holds a status code or comma-separated ones.
+type statusCodesFlag []int
+
+// String implements the flag.Value interface.
+func (s *statusCodesFlag) String() string {
+	codes := make([]string, len(*s))
+	for i, code := range *s {
+		codes[i] = strconv.Itoa(code)
+	}
+
+	return strings.Join(codes, ",")
+}
+
+// Set implements the flag.Value interface. An empty value resets the status codes,
+// so that the snapshot of an unset flag restores it, see snapshotFlags.
+func (s *statusCodesFlag) Set(value string) error {
+	if value == "" {
+		*s = nil
+		return nil
+	}
+
+	for _, field := range strings.Split(value, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("invalid status code %q", field)
+		}
+		*s = append(*s, code)
+	}
+
+	return nil
+}
+
+// contains reports whether the status code is one of the flag.
+func (s statusCodesFlag) contains(code int) bool {
+	for _, c := range s {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
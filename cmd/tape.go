@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pigeonlab/notifier/pkg"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// tapeEntry represents a single message recorded on a tape.
+// The offset is the time elapsed between the start of the run and the moment the message was sent.
+type tapeEntry struct {
+	Offset  time.Duration `json:"offset"`
+	Message string        `json:"message"`
+}
+
+// tapeRecorder records the messages sent by the notify command along with their timings.
+// A nil *tapeRecorder records nothing.
+type tapeRecorder struct {
+	file    *os.File
+	encoder *json.Encoder
+	start   time.Time
+}
+
+// newTapeRecorder creates the tape at the given path and returns a new instance of tapeRecorder.
+func newTapeRecorder(path string) (*tapeRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tapeRecorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+		start:   time.Now(),
+	}, nil
+}
+
+// record appends the given messages to the tape. They share the same offset as they are sent in bulk.
+func (t *tapeRecorder) record(messages []string) error {
+	if t == nil {
+		return nil
+	}
+
+	offset := time.Since(t.start)
+	for _, message := range messages {
+		if err := t.encoder.Encode(tapeEntry{Offset: offset, Message: message}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close closes the tape file.
+func (t *tapeRecorder) close() error {
+	if t == nil {
+		return nil
+	}
+
+	return t.file.Close()
+}
+
+// readTape reads all the entries of the tape at the given path.
+func readTape(path string) ([]tapeEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []tapeEntry
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var entry tapeEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("invalid tape entry %d: %v", len(entries), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// parseSpeed parses a replay speed such as "2x", "0.5x" or "3".
+func parseSpeed(value string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid speed %q", value)
+	}
+
+	return speed, nil
+}
+
+// newReplayTapeCommand returns the command that replays a recorded tape against a target.
+func newReplayTapeCommand() *command {
+	cmd := newCommand(
+		"replay-tape",
+		"Replay a recorded run against a target URL.",
+		"Sends the messages recorded with notify --record to the target URL, reproducing the original timings.",
+	)
+	cmd.args = []string{"<tape>"}
+
+	var conf configuration
+	cmd.flags.StringVar(&conf.targetUrl, "url", "", "The target URL that will receive the notifications. (Mandatory)")
+	cmd.flags.DurationVar(&conf.requestTimeout, "requestTimeout", 1*time.Second, "The timeout for each HTTP request.")
+	cmd.flags.StringVar(&conf.inputFormat, "input", inputLines, `The format of the recorded messages: "lines", "jsonl" or "urls".`)
+	cmd.flags.StringVar(&conf.pingMethod, "pingMethod", http.MethodGet, `The method of the pings of the "urls" input format: GET or HEAD.`)
+	cmd.flags.StringVar(&conf.contentType, "contentType", contentTypeAuto, `The Content-Type of the notifications. "auto" detects JSON, XML and plain text bodies.`)
+	cmd.flags.Var(&conf.queryParams, "queryParam", "Append the value of a JSON message field to the target URL as a query parameter, e.g. user_id=user.id. It can be repeated.")
+	speedFlag := cmd.flags.String("speed", "1x", "The replay speed, e.g. 2x replays the tape twice as fast.")
+
+	cmd.run = func(args []string) error {
+		if len(args) != 1 {
+			return usageError("You must specify the tape to replay.")
+		}
+
+		err := validateTargetURL(conf.targetUrl)
+		if err != nil {
+			return err
+		}
+
+		err = validateMessageFormat(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validatePingMethod(conf)
+		if err != nil {
+			return err
+		}
+
+		err = validateQueryParams(conf)
+		if err != nil {
+			return err
+		}
+
+		speed, err := parseSpeed(*speedFlag)
+		if err != nil {
+			return usageError(fmt.Sprintf("The --speed value is invalid: %v.", err))
+		}
+
+		entries, err := readTape(args[0])
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		HTTPClient := &http.Client{Timeout: conf.requestTimeout}
+		bulkHTTPClient := pkg.NewClient(HTTPClient)
+
+		log.Printf("Replaying %d messages at %gx...", len(entries), speed)
+		printResult(conf, replayTape(ctx, conf, bulkHTTPClient, entries, speed))
+		return nil
+	}
+
+	return cmd
+}
+
+// replayTape sends the entries in the original chunks, waiting for each chunk's offset divided by the speed.
+func replayTape(
+	ctx context.Context,
+	conf configuration,
+	HTTPClient *pkg.BulkHTTPClient,
+	entries []tapeEntry,
+	speed float64,
+) result {
+	var finalResult result
+	start := time.Now()
+	for i := 0; i < len(entries); {
+		offset := entries[i].Offset
+		var messages []string
+		for ; i < len(entries) && entries[i].Offset == offset; i++ {
+			messages = append(messages, entries[i].Message)
+		}
+
+		wait := time.Until(start.Add(time.Duration(float64(offset) / speed)))
+		select {
+		case <-ctx.Done():
+			return finalResult
+		case <-time.After(wait):
+		}
+
+		finalResult.add(deliver(ctx, conf, HTTPClient, messages))
+	}
+
+	return finalResult
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pigeonlab/notifier/pkg"
+	"time"
+)
+
+// timestamps holds when a notification was queued for a dispatch worker, started and finished, see pkg.Result.
+// The time between the queued and the started timestamps is the queueing delay, the one between the started
+// and the finished timestamps the service time.
+type timestamps struct {
+	queued   time.Time
+	started  time.Time
+	finished time.Time
+}
+
+// entryTimestamps returns the timestamps of each entry of a bulk result.
+func entryTimestamps(entries []pkg.Result) []timestamps {
+	stamps := make([]timestamps, len(entries))
+	for i, entry := range entries {
+		stamps[i] = timestamps{queued: entry.QueuedAt, started: entry.StartedAt, finished: entry.FinishedAt}
+	}
+
+	return stamps
+}
+
+// String returns the timestamps as printed in the result, or an empty string for a notification never sent.
+func (t timestamps) String() string {
+	if t.started.IsZero() {
+		return ""
+	}
+
+	return fmt.Sprintf(" - Queued at %s - Started at %s (+%s) - Finished at %s (+%s)",
+		t.queued.Format(time.RFC3339Nano),
+		t.started.Format(time.RFC3339Nano), t.started.Sub(t.queued),
+		t.finished.Format(time.RFC3339Nano), t.finished.Sub(t.started),
+	)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/pigeonlab/notifier/pkg"
+	"net"
+	"net/http"
+	"time"
+)
+
+// The IP version preferences.
+const (
+	ipAuto   = "auto"
+	ipv4     = "ipv4"
+	ipv6     = "ipv6"
+	ipv4Only = "ipv4only"
+	ipv6Only = "ipv6only"
+)
+
+// dialContext is the signature of net.Dialer.DialContext.
+type dialContext func(ctx context.Context, network, address string) (net.Conn, error)
+
+// validateIPPreference makes sure the IP preference flags are valid.
+func validateIPPreference(conf configuration) error {
+	switch conf.ipPreference {
+	case ipAuto, ipv4, ipv6, ipv4Only, ipv6Only:
+	default:
+		return usageError(fmt.Sprintf("The --ipPreference value %q is invalid.", conf.ipPreference))
+	}
+
+	if conf.fallbackDelay < 0 {
+		return usageError("The --fallbackDelay value can't be negative.")
+	}
+
+	return nil
+}
+
+// validateTransport makes sure the connection pool flags are valid.
+func validateTransport(conf configuration) error {
+	if conf.maxIdlePerHost < 0 || conf.maxConnsPerHost < 0 || conf.idleConnTimeout < 0 {
+		return usageError("The --maxIdleConnsPerHost, --maxConnsPerHost and --idleConnTimeout values can't be negative.")
+	}
+	if conf.dnsCache < 0 {
+		return usageError("The --dnsCache value can't be negative.")
+	}
+	if conf.dnsCache > 0 && conf.dohResolver != "" {
+		return usageError("The --dnsCache and --dohResolver flags can't be combined: the DoH resolver caches its answers already.")
+	}
+
+	return nil
+}
+
+// newTransport returns the HTTP transport used by the notify command.
+// It keeps enough idle connections per host to hold the pre-warmed connections,
+// connects using the preferred IP version, resolves the targets with either the DoH resolver or the DNS cache, if any,
+// applies the per-phase timeouts and disables HTTP/2 with --disableHttp2.
+func newTransport(conf configuration, dnsCache *pkg.DNSCache) *http.Transport {
+	maxIdleConnsPerHost := conf.maxIdlePerHost
+	if conf.prewarm > maxIdleConnsPerHost {
+		maxIdleConnsPerHost = conf.prewarm
+	}
+	transport := pkg.NewTransport(
+		pkg.TransportMaxIdleConnsPerHost(maxIdleConnsPerHost),
+		pkg.TransportMaxConnsPerHost(conf.maxConnsPerHost),
+		pkg.TransportIdleConnTimeout(conf.idleConnTimeout),
+		pkg.TransportHTTP2(!conf.disableHTTP2),
+	)
+	transport.ResponseHeaderTimeout = conf.headerTimeout
+
+	dialer := &net.Dialer{
+		Timeout:       conf.connectTimeout,
+		KeepAlive:     conf.tcpKeepAlive,
+		FallbackDelay: conf.fallbackDelay,
+	}
+	dial := dialContext(dialer.DialContext)
+	if dnsCache != nil {
+		dial = dnsCache.Dial(dial)
+	}
+	transport.DialContext = preferIPVersion(newDoHResolver(conf).dial(dial), conf.ipPreference, conf.fallbackDelay)
+
+	return transport
+}
+
+// preferIPVersion wraps the dial function according to the IP version preference.
+// With "auto" the dialer races both versions (Happy Eyeballs). With "ipv4" or "ipv6"
+// the preferred version gets fallbackDelay to connect before the other one is tried.
+// With "ipv4only" or "ipv6only" the other version is never used.
+func preferIPVersion(dial dialContext, preference string, fallbackDelay time.Duration) dialContext {
+	var preferred, fallback string
+	switch preference {
+	case ipv4, ipv4Only:
+		preferred, fallback = "tcp4", "tcp6"
+	case ipv6, ipv6Only:
+		preferred, fallback = "tcp6", "tcp4"
+	default:
+		return dial
+	}
+
+	if preference == ipv4Only || preference == ipv6Only {
+		fallback = ""
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if network != "tcp" {
+			return dial(ctx, network, address)
+		}
+		if fallback == "" {
+			return dial(ctx, preferred, address)
+		}
+
+		preferredCtx := ctx
+		if fallbackDelay > 0 {
+			var cancel context.CancelFunc
+			preferredCtx, cancel = context.WithTimeout(ctx, fallbackDelay)
+			defer cancel()
+		}
+
+		conn, err := dial(preferredCtx, preferred, address)
+		if err == nil || ctx.Err() != nil {
+			return conn, err
+		}
+
+		return dial(ctx, fallback, address)
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTheDNSCacheCantBeCombinedWithTheDoHResolver(t *testing.T) {
+	assert.NoError(t, validateTransport(configuration{dnsCache: time.Minute}))
+	assert.NoError(t, validateTransport(configuration{dohResolver: "https://1.1.1.1/dns-query"}))
+	assert.Error(t, validateTransport(configuration{dnsCache: time.Minute, dohResolver: "https://1.1.1.1/dns-query"}))
+}
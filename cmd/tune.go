@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/pkg"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+const (
+	// maxCalibrationWorkers is the highest amount of dispatch workers tried by the calibration burst.
+	maxCalibrationWorkers = 64
+	// calibrationRequestsPerWorker is the amount of requests each worker sends at every calibration step.
+	calibrationRequestsPerWorker = 4
+	// minCalibrationGain is the throughput improvement needed to keep doubling the workers.
+	minCalibrationGain = 1.1
+)
+
+// workers returns the amount of dispatch and process workers for a bulk request to the given amount of targets.
+// The configured values take precedence. Otherwise they are derived from GOMAXPROCS:
+// dispatch workers mostly wait on the network, so several of them run per CPU and per target.
+func workers(conf configuration, targets int) (dispatch int, process int) {
+	procs := runtime.GOMAXPROCS(0)
+
+	dispatch = conf.dispatchWorkers
+	if dispatch == 0 {
+		dispatch = procs * 4 * targets
+	}
+
+	process = conf.processWorkers
+	if process == 0 {
+		process = procs * 2
+	}
+
+	return dispatch, process
+}
+
+// countTargets returns the amount of distinct URLs.
+func countTargets(URLs []string) int {
+	targets := make(map[string]struct{})
+	for _, URL := range URLs {
+		targets[URL] = struct{}{}
+	}
+
+	return len(targets)
+}
+
+// autoTune sends bursts of OPTIONS requests to the target, doubling the amount of workers at every step.
+// It returns the amount of workers beyond which the throughput stops improving.
+func autoTune(ctx context.Context, HTTPClient *pkg.BulkHTTPClient, targetURL string) int {
+	log.Println("Calibrating the amount of workers...")
+
+	best, bestThroughput := 1, 0.0
+	for workers := 1; workers <= maxCalibrationWorkers; workers *= 2 {
+		builder := pkg.NewBulkRequestBuilder().BaseURL(targetURL).Method(http.MethodOptions).Workers(workers, workers)
+		for i := 0; i < workers*calibrationRequestsPerWorker; i++ {
+			builder.AddBody(nil)
+		}
+		bulkRequest, err := builder.Build()
+		if err != nil {
+			log.Printf("Calibration failed: %v", err)
+			break
+		}
+
+		start := time.Now()
+		errs := HTTPClient.Send(ctx, bulkRequest).Errors()
+		throughput := float64(len(errs)) / time.Since(start).Seconds()
+		log.Printf("Calibration: %d workers - %.0f requests/s", workers, throughput)
+
+		if failures(errs) > len(errs)/2 || throughput < bestThroughput*minCalibrationGain {
+			break
+		}
+		best, bestThroughput = workers, throughput
+	}
+
+	log.Printf("Calibration done: using %d dispatch workers.", best)
+	return best
+}
+
+// failures returns the amount of non-nil errors.
+func failures(errs []error) int {
+	count := 0
+	for _, err := range errs {
+		if err != nil {
+			count++
+		}
+	}
+
+	return count
+}
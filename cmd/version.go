@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Build information. They are set at compile time by the linker, e.g.:
+// go build -ldflags "-X main.version=v1.0.0 -X main.commit=abc123 -X main.buildDate=2020-11-11T13:03:07Z"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// latestReleaseURL is the endpoint queried to discover the latest published release.
+const latestReleaseURL = "https://api.github.com/repos/pigeonlab/notifier/releases/latest"
+
+// newVersionCommand returns the command that prints the build information.
+func newVersionCommand() *command {
+	cmd := newCommand(
+		"version",
+		"Print the version and build information.",
+		"Prints the version, the git commit and the build date of this binary.",
+	)
+	checkUpdate := cmd.flags.Bool("checkUpdate", false, "Check whether a newer release is available.")
+
+	cmd.run = func(args []string) error {
+		rev, date := buildInfo()
+		fmt.Printf("notifier %s\n", version)
+		fmt.Printf("  commit:     %s\n", rev)
+		fmt.Printf("  build date: %s\n", date)
+		fmt.Printf("  go version: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+		if !*checkUpdate {
+			return nil
+		}
+
+		latest, err := latestRelease(&http.Client{Timeout: 5 * time.Second})
+		if err != nil {
+			return fmt.Errorf("unable to check for updates: %v", err)
+		}
+		if latest == version {
+			fmt.Println("You are running the latest release.")
+		} else {
+			fmt.Printf("The latest release is %s.\n", latest)
+		}
+
+		return nil
+	}
+
+	return cmd
+}
+
+// buildInfo returns the git commit and the build date of the binary.
+// It falls back to the VCS information embedded by the Go toolchain when
+// the values were not set at compile time.
+func buildInfo() (rev string, date string) {
+	rev, date = commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && rev == "":
+				rev = setting.Value
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+
+	if rev == "" {
+		rev = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+
+	return rev, date
+}
+
+// latestRelease returns the tag name of the latest published release.
+func latestRelease(HTTPClient *http.Client) (string, error) {
+	res, err := HTTPClient.Get(latestReleaseURL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return "", err
+	}
+
+	return release.TagName, nil
+}
@@ -0,0 +1,570 @@
+// Package notifier embeds the notification pipeline of the notifier command in Go services:
+// the messages are read from a source, transformed, routed to HTTP sinks and sent in chunks by the bulk client,
+// with retries, a dead letter queue for the failed messages and metrics.
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pigeonlab/notifier/pkg"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrDrop is returned by a Transform to drop a message without sending it.
+var ErrDrop = errors.New("message dropped")
+
+// ErrNoSink is the error of the deliveries routed to a sink that doesn't exist.
+var ErrNoSink = errors.New("no such sink")
+
+// Message is a notification flowing through the engine.
+// The header is added to the ones of the sink and the tenant, if any, makes the engine start the requests
+// of a chunk in round-robin across the tenants. The metadata is not sent: it is attached to the context
+// of the requests of the message, see MessageMetadata. The handle is set by the source to identify the message
+// when it is acknowledged, e.g. an SQS receipt handle or a Kafka offset, see Acknowledger: the engine never reads it.
+type Message struct {
+	Body        []byte
+	ContentType string
+	Header      http.Header
+	Tenant      string
+	Metadata    map[string]string
+	Handle      interface{}
+}
+
+// metadataKey is the context key of the metadata of a message.
+type metadataKey struct{}
+
+// MessageMetadata returns the metadata of the message sent by a request, given the request's context,
+// e.g. for a custom http.RoundTripper of the engine's HTTP client to authenticate or trace the message.
+func MessageMetadata(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
+}
+
+// Source provides the messages of the engine. Next returns io.EOF once there are no more messages.
+// The sources settling their messages once processed implement Acknowledger as well.
+type Source interface {
+	Next(ctx context.Context) (Message, error)
+}
+
+// SourceFunc adapts a function to the Source interface.
+type SourceFunc func(ctx context.Context) (Message, error)
+
+// Next implements the Source interface.
+func (f SourceFunc) Next(ctx context.Context) (Message, error) {
+	return f(ctx)
+}
+
+// LineSource returns a Source reading a message per line of the given reader, like the notifier command.
+// The empty lines are skipped.
+func LineSource(r io.Reader) Source {
+	scanner := bufio.NewScanner(r)
+	return SourceFunc(func(ctx context.Context) (Message, error) {
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				return Message{Body: append([]byte{}, line...)}, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return Message{}, err
+		}
+
+		return Message{}, io.EOF
+	})
+}
+
+// Transform transforms a message before it is routed. It returns ErrDrop to drop the message:
+// any other error fails the message, which goes to the dead letter queue.
+type Transform func(Message) (Message, error)
+
+// Router returns the names of the sinks a message is sent to. A message routed to no sink is dropped.
+type Router func(Message) []string
+
+// Sink is an HTTP target of the engine.
+// The transform, if any, is applied to the messages sent to the sink only, after the transforms of the engine,
+// e.g. to build the payload of an incident-management API, see OpsgenieSink and VictorOpsSink.
+// It returns ErrDrop to not send a message to the sink: any other error fails the delivery.
+// The check, if any, validates the responses of the sink: its error fails the delivery, e.g. of an API answering
+// some errors with a 2xx status code, or tells why a response failed, e.g. from the error in its body.
+// The endpoint, if any, returns the URL of each message, after the sink's transform, instead of the sink's URL,
+// e.g. with the device token in its path, see APNsSink.
+type Sink struct {
+	URL       string
+	Method    string
+	Header    http.Header
+	Transform Transform
+	Check     func(*http.Response) error
+	Endpoint  func(Message) string
+}
+
+// Delivery is the outcome of a message sent to a sink.
+// The message failed when Err is set or when the response status code is not a success.
+type Delivery struct {
+	Message  Message
+	Sink     string
+	Response *http.Response
+	Err      error
+	Latency  time.Duration
+	Attempts int
+
+	successCodes map[int]bool
+}
+
+// Succeeded reports whether the message was delivered with a 2xx status code, or one of the success statuses
+// of the client, see pkg.WithSuccessStatuses.
+func (d Delivery) Succeeded() bool {
+	return pkg.IsSuccess(d.Response, d.Err, d.successCodes)
+}
+
+// DeadLetterQueue receives the failed deliveries, once all their attempts are spent,
+// and the messages failed by a transform.
+type DeadLetterQueue interface {
+	Put(Delivery) error
+}
+
+// LineDeadLetterQueue returns a DeadLetterQueue writing the body of each failed message as a line of the given writer,
+// so that the failed messages can be sent again with LineSource.
+func LineDeadLetterQueue(w io.Writer) DeadLetterQueue {
+	return &lineDeadLetterQueue{w: w}
+}
+
+// lineDeadLetterQueue writes the bodies of the failed messages line by line.
+type lineDeadLetterQueue struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Put implements the DeadLetterQueue interface.
+func (q *lineDeadLetterQueue) Put(delivery Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	line := append(bytes.TrimRight(delivery.Message.Body, "\n"), '\n')
+	_, err := q.w.Write(line)
+	return err
+}
+
+// Metrics records the outcome of every delivery, e.g. to export them to a monitoring system.
+type Metrics interface {
+	Record(Delivery)
+}
+
+// Stats counts the messages processed by the engine.
+type Stats struct {
+	Received     int
+	Dropped      int
+	Delivered    int
+	Failed       int
+	DeadLettered int
+}
+
+// Engine runs the notification pipeline: it reads the messages from its source, applies the transforms,
+// routes them to the sinks and sends them in chunks with the bulk client.
+type Engine struct {
+	source          Source
+	transforms      []Transform
+	router          Router
+	sinks           map[string]Sink
+	sinkNames       []string
+	clientOptions   []pkg.Option
+	httpClient      pkg.HTTPClient
+	dlq             DeadLetterQueue
+	metrics         Metrics
+	chunkSize       int
+	interval        time.Duration
+	dispatchWorkers int
+	processWorkers  int
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Option configures the Engine.
+type Option func(*Engine)
+
+// NewEngine returns a new instance of Engine reading the messages from the given source.
+// By default, the messages are sent to every sink by chunks of 100, one chunk after the other,
+// with GOMAXPROCS dispatch and processor workers and an http.Client with a 30 seconds timeout.
+// The engine needs at least a sink, see WithSink.
+func NewEngine(source Source, opts ...Option) *Engine {
+	e := &Engine{
+		source:     source,
+		sinks:      map[string]Sink{},
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		chunkSize:  100,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// WithSink adds a sink with the given name. The sinks without method send the messages with POST.
+func WithSink(name string, sink Sink) Option {
+	return func(e *Engine) {
+		if _, ok := e.sinks[name]; !ok {
+			e.sinkNames = append(e.sinkNames, name)
+		}
+		e.sinks[name] = sink
+	}
+}
+
+// WithTransform appends a transform to the pipeline. The transforms are applied in the order they were added.
+func WithTransform(transform Transform) Option {
+	return func(e *Engine) {
+		e.transforms = append(e.transforms, transform)
+	}
+}
+
+// WithRouter sets the router choosing the sinks of each message, instead of sending every message to every sink.
+func WithRouter(router Router) Option {
+	return func(e *Engine) {
+		e.router = router
+	}
+}
+
+// WithRetry retries the failed deliveries, see pkg.WithRetry.
+func WithRetry(maxAttempts int, initialDelay time.Duration, jitter float64) Option {
+	return WithClientOptions(pkg.WithRetry(maxAttempts, initialDelay, jitter))
+}
+
+// WithClientOptions configures the bulk client sending the messages, e.g. with a rate limit or hooks.
+func WithClientOptions(opts ...pkg.Option) Option {
+	return func(e *Engine) {
+		e.clientOptions = append(e.clientOptions, opts...)
+	}
+}
+
+// WithHTTPClient sets the HTTP client sending the requests.
+func WithHTTPClient(client pkg.HTTPClient) Option {
+	return func(e *Engine) {
+		e.httpClient = client
+	}
+}
+
+// WithDeadLetterQueue sends the failed deliveries to the given dead letter queue.
+func WithDeadLetterQueue(dlq DeadLetterQueue) Option {
+	return func(e *Engine) {
+		e.dlq = dlq
+	}
+}
+
+// WithMetrics records the outcome of every delivery with the given metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(e *Engine) {
+		e.metrics = metrics
+	}
+}
+
+// WithChunks sends the messages by chunks of the given size, starting a chunk at most every interval.
+// A size lower than 1 is ignored.
+func WithChunks(size int, interval time.Duration) Option {
+	return func(e *Engine) {
+		if size > 0 {
+			e.chunkSize = size
+		}
+		e.interval = interval
+	}
+}
+
+// WithWorkers sets the amount of workers sending the requests and processing the responses of each chunk.
+func WithWorkers(dispatchWorkers, processWorkers int) Option {
+	return func(e *Engine) {
+		e.dispatchWorkers, e.processWorkers = dispatchWorkers, processWorkers
+	}
+}
+
+// Run runs the pipeline until the source is exhausted or the context is done and returns the stats of the run.
+// It returns the error of the source, if any, or of the context. The messages of a chunk interrupted
+// by the context fail with interr.ErrIgnored and go to the dead letter queue. Run returns the error
+// of the dead letter queue or of the acknowledgements of the source as well, see Acknowledger.
+func (e *Engine) Run(ctx context.Context) (Stats, error) {
+	if len(e.sinks) == 0 {
+		return Stats{}, errors.New("the engine has no sink")
+	}
+
+	client := pkg.NewClient(e.httpClient, e.clientOptions...)
+	var last time.Time
+	for {
+		messages, err := e.read(ctx)
+		if len(messages) > 0 {
+			if wait := e.interval - time.Since(last); !last.IsZero() && wait > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(wait):
+				}
+			}
+			last = time.Now()
+
+			if dlqErr := e.send(ctx, client, messages); dlqErr != nil {
+				return e.Stats(), dlqErr
+			}
+		}
+
+		if err == io.EOF {
+			return e.Stats(), nil
+		}
+		if err != nil {
+			return e.Stats(), err
+		}
+	}
+}
+
+// Stats returns the stats of the messages processed so far.
+func (e *Engine) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.stats
+}
+
+// read reads the messages of the next chunk and applies the transforms. The dropped messages are skipped.
+// The error is the one which stopped the reading, if any.
+func (e *Engine) read(ctx context.Context) ([]Message, error) {
+	var messages []Message
+	for len(messages) < e.chunkSize {
+		if err := ctx.Err(); err != nil {
+			return messages, err
+		}
+
+		received, err := e.source.Next(ctx)
+		if err != nil {
+			return messages, err
+		}
+		e.count(func(s *Stats) { s.Received++ })
+
+		message, err := e.transform(received)
+		switch {
+		case err == ErrDrop:
+			e.count(func(s *Stats) { s.Dropped++ })
+			if err := e.settle(ctx, received, nil); err != nil {
+				return messages, err
+			}
+		case err != nil:
+			delivery := Delivery{Message: message, Err: fmt.Errorf("transform failed: %v", err)}
+			if err := e.fail(delivery); err != nil {
+				return messages, err
+			}
+			if err := e.settle(ctx, received, []Delivery{delivery}); err != nil {
+				return messages, err
+			}
+		default:
+			message.Handle = received.Handle
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// transform applies the transforms to the message.
+func (e *Engine) transform(message Message) (Message, error) {
+	for _, transform := range e.transforms {
+		var err error
+		message, err = transform(message)
+		if err != nil {
+			return message, err
+		}
+	}
+
+	return message, nil
+}
+
+// route returns the names of the sinks of the message.
+func (e *Engine) route(message Message) []string {
+	if e.router == nil {
+		return e.sinkNames
+	}
+
+	return e.router(message)
+}
+
+// send sends the messages to their sinks in a single bulk request and reports the deliveries.
+// Each message is then settled with the source, see Acknowledger.
+// It returns the error of the dead letter queue or of the acknowledgements, if any.
+func (e *Engine) send(ctx context.Context, client *pkg.BulkHTTPClient, messages []Message) error {
+	builder := pkg.NewBulkRequestBuilder().Workers(e.dispatchWorkers, e.processWorkers)
+	var deliveries []Delivery
+	var owners []int
+	failures := make([][]Delivery, len(messages))
+	for m, message := range messages {
+		names := e.route(message)
+		if len(names) == 0 {
+			e.count(func(s *Stats) { s.Dropped++ })
+			continue
+		}
+
+		for _, name := range names {
+			sink, ok := e.sinks[name]
+			if !ok {
+				delivery := Delivery{Message: message, Sink: name, Err: ErrNoSink}
+				if err := e.fail(delivery); err != nil {
+					return err
+				}
+				failures[m] = append(failures[m], delivery)
+				continue
+			}
+
+			sent, err := sinkMessage(sink, message)
+			if err == ErrDrop {
+				continue
+			}
+			if err != nil {
+				delivery := Delivery{Message: message, Sink: name, Err: fmt.Errorf("sink transform failed: %v", err)}
+				if err := e.fail(delivery); err != nil {
+					return err
+				}
+				failures[m] = append(failures[m], delivery)
+				continue
+			}
+
+			deliveries = append(deliveries, Delivery{Message: message, Sink: name})
+			owners = append(owners, m)
+			builder.AddBody(bytes.NewReader(sent.Body), bodyOptions(sink, sent)...)
+		}
+	}
+
+	if err := e.deliver(ctx, client, builder, deliveries, owners, failures); err != nil {
+		return err
+	}
+
+	for m, message := range messages {
+		if err := e.settle(ctx, message, failures[m]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver sends the bulk request of the deliveries and reports them.
+// The failed deliveries are added to the failures of the message owning them.
+func (e *Engine) deliver(
+	ctx context.Context,
+	client *pkg.BulkHTTPClient,
+	builder *pkg.BulkRequestBuilder,
+	deliveries []Delivery,
+	owners []int,
+	failures [][]Delivery,
+) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	bulkRequest, err := builder.Build()
+	if err != nil {
+		for i, delivery := range deliveries {
+			delivery.Err = err
+			if err := e.fail(delivery); err != nil {
+				return err
+			}
+			failures[owners[i]] = append(failures[owners[i]], delivery)
+		}
+		return nil
+	}
+	result := client.Send(ctx, bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+	successCodes := client.SuccessStatuses()
+	for i, entry := range result.Entries {
+		delivery := deliveries[i]
+		delivery.Response, delivery.Err = entry.Response, entry.Err
+		delivery.successCodes = successCodes
+		delivery.Latency, delivery.Attempts = entry.Latency, entry.Attempts
+		if check := e.sinks[delivery.Sink].Check; check != nil && delivery.Err == nil && delivery.Response != nil {
+			delivery.Err = check(delivery.Response)
+		}
+		if delivery.Succeeded() {
+			e.count(func(s *Stats) { s.Delivered++ })
+			e.record(delivery)
+			continue
+		}
+		if err := e.fail(delivery); err != nil {
+			return err
+		}
+		failures[owners[i]] = append(failures[owners[i]], delivery)
+	}
+
+	return nil
+}
+
+// sinkMessage returns the message sent to the sink, transformed by the sink's transform, if any.
+// The deliveries keep the original message, so that the dead letter queue receives it as read from the source.
+func sinkMessage(sink Sink, message Message) (Message, error) {
+	if sink.Transform == nil {
+		return message, nil
+	}
+
+	return sink.Transform(message)
+}
+
+// bodyOptions returns the options of the request sending the message to the sink.
+func bodyOptions(sink Sink, message Message) []pkg.BodyOption {
+	target := sink.URL
+	if sink.Endpoint != nil {
+		target = sink.Endpoint(message)
+	}
+
+	opts := []pkg.BodyOption{pkg.BodyURL(target)}
+	if sink.Method != "" {
+		opts = append(opts, pkg.BodyMethod(sink.Method))
+	}
+	for key, values := range sink.Header {
+		for _, value := range values {
+			opts = append(opts, pkg.BodyHeader(key, value))
+		}
+	}
+	for key, values := range message.Header {
+		for _, value := range values {
+			opts = append(opts, pkg.BodyHeader(key, value))
+		}
+	}
+	if message.ContentType != "" {
+		opts = append(opts, pkg.BodyHeader("Content-Type", message.ContentType))
+	}
+	if message.Tenant != "" {
+		opts = append(opts, pkg.BodyTenant(message.Tenant))
+	}
+	if len(message.Metadata) > 0 {
+		opts = append(opts, pkg.BodyValue(metadataKey{}, message.Metadata))
+	}
+
+	return opts
+}
+
+// fail counts the failed delivery, records it and puts it in the dead letter queue, if any.
+func (e *Engine) fail(delivery Delivery) error {
+	e.count(func(s *Stats) { s.Failed++ })
+	e.record(delivery)
+	if e.dlq == nil {
+		return nil
+	}
+
+	if err := e.dlq.Put(delivery); err != nil {
+		return fmt.Errorf("unable to put the message in the dead letter queue: %v", err)
+	}
+	e.count(func(s *Stats) { s.DeadLettered++ })
+
+	return nil
+}
+
+// record records the delivery with the metrics, if any.
+func (e *Engine) record(delivery Delivery) {
+	if e.metrics != nil {
+		e.metrics.Record(delivery)
+	}
+}
+
+// count updates the stats.
+func (e *Engine) count(update func(*Stats)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	update(&e.stats)
+}
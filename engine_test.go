@@ -0,0 +1,228 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/pigeonlab/notifier/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collectedMetrics records the deliveries.
+type collectedMetrics struct {
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+// Record implements the Metrics interface.
+func (m *collectedMetrics) Record(delivery Delivery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = append(m.deliveries, delivery)
+}
+
+func TestTheEngineRunsThePipeline(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received[req.URL.Path] = append(received[req.URL.Path], req.Method+" "+string(body)+" "+req.Header.Get("X-Api-Key"))
+		if strings.Contains(string(body), "FAIL") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	var dlq bytes.Buffer
+	metrics := &collectedMetrics{}
+	engine := NewEngine(
+		LineSource(strings.NewReader("hello\nskip\nfail\nbroken\nurgent\n")),
+		WithSink("main", Sink{URL: server.URL + "/main", Header: http.Header{"X-Api-Key": {"secret"}}}),
+		WithSink("pager", Sink{URL: server.URL + "/pager", Method: http.MethodPut}),
+		WithTransform(func(message Message) (Message, error) {
+			switch string(message.Body) {
+			case "skip":
+				return message, ErrDrop
+			case "broken":
+				return message, errors.New("invalid message")
+			}
+			return message, nil
+		}),
+		WithTransform(func(message Message) (Message, error) {
+			message.Body = bytes.ToUpper(message.Body)
+			return message, nil
+		}),
+		WithRouter(func(message Message) []string {
+			if string(message.Body) == "URGENT" {
+				return []string{"main", "pager"}
+			}
+			return []string{"main"}
+		}),
+		WithChunks(2, 0),
+		WithDeadLetterQueue(LineDeadLetterQueue(&dlq)),
+		WithMetrics(metrics),
+	)
+
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Received: 5, Dropped: 1, Delivered: 3, Failed: 2, DeadLettered: 2}, stats)
+	assert.ElementsMatch(t, []string{"POST HELLO secret", "POST FAIL secret", "POST URGENT secret"}, received["/main"])
+	assert.Equal(t, []string{"PUT URGENT "}, received["/pager"])
+	assert.Equal(t, "FAIL\nbroken\n", dlq.String())
+	assert.Len(t, metrics.deliveries, 5)
+}
+
+func TestTheEngineRetriesTheFailedDeliveries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	engine := NewEngine(
+		LineSource(strings.NewReader("hello\n")),
+		WithSink("main", Sink{URL: server.URL}),
+		WithRetry(2, time.Millisecond, 0),
+	)
+
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered)
+	assert.Equal(t, 2, calls)
+}
+
+func TestTheEngineHonorsTheSuccessStatusesOfTheClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer server.Close()
+
+	var dlq bytes.Buffer
+	engine := NewEngine(
+		LineSource(strings.NewReader("hello\n")),
+		WithSink("main", Sink{URL: server.URL}),
+		WithClientOptions(pkg.WithSuccessStatuses(http.StatusConflict)),
+		WithDeadLetterQueue(LineDeadLetterQueue(&dlq)),
+	)
+
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered, "a 409 Conflict is a success")
+	assert.Empty(t, dlq.String())
+}
+
+func TestTheEngineDeadLettersTheUnknownSinksAndTheCancelledMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var failures []error
+	engine := NewEngine(
+		SourceFunc(func(context.Context) (Message, error) {
+			return Message{Body: []byte("hello")}, nil
+		}),
+		WithSink("main", Sink{URL: "http://localhost"}),
+		WithRouter(func(Message) []string { return []string{"missing"} }),
+	)
+	stats, err := engine.Run(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, stats.Received)
+
+	engine = NewEngine(
+		LineSource(strings.NewReader("hello\n")),
+		WithSink("main", Sink{URL: "http://localhost"}),
+		WithRouter(func(Message) []string { return []string{"missing"} }),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery.Err) })),
+	)
+	stats, err = engine.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.DeadLettered)
+	assert.Equal(t, []error{ErrNoSink}, failures)
+
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-blocked
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	failures = nil
+	engine = NewEngine(
+		LineSource(strings.NewReader("hello\n")),
+		WithSink("main", Sink{URL: server.URL}),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery.Err) })),
+	)
+	stats, err = engine.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []error{interr.ErrIgnored}, failures)
+}
+
+func TestTheEngineNeedsASink(t *testing.T) {
+	_, err := NewEngine(LineSource(strings.NewReader("hello\n"))).Run(context.Background())
+	assert.Error(t, err)
+}
+
+// deadLetters adapts a function to the DeadLetterQueue interface.
+type deadLetters func(Delivery)
+
+// Put implements the DeadLetterQueue interface.
+func (f deadLetters) Put(delivery Delivery) error {
+	f(delivery)
+	return nil
+}
+
+func TestTheMessageMetadataReachesTheRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var traces []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		traces = append(traces, MessageMetadata(req.Context())["trace"])
+		mu.Unlock()
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	engine := NewEngine(
+		LineSource(strings.NewReader("a\nb\n")),
+		WithSink("main", Sink{URL: server.URL}),
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithTransform(func(message Message) (Message, error) {
+			message.Metadata = map[string]string{"trace": "trace-" + string(message.Body)}
+			return message, nil
+		}),
+	)
+
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Delivered)
+	assert.ElementsMatch(t, []string{"trace-a", "trace-b"}, traces)
+}
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements the http.RoundTripper interface.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
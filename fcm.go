@@ -0,0 +1,285 @@
+package notifier
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fcmScope is the OAuth scope of the FCM HTTP v1 API.
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// fcmTokenKey is the metadata key holding the registration token of the messages sent by an FCM sink.
+const fcmTokenKey = "fcm.token"
+
+// fcmTokenMargin is how long before its expiry an OAuth access token is renewed.
+const fcmTokenMargin = 5 * time.Minute
+
+// ErrUnregisteredToken is the error of the push notifications sent to a registration token that is not valid anymore,
+// e.g. because the app was uninstalled. It is not retryable: the token must be removed, see FCM and APNs.
+var ErrUnregisteredToken = errors.New("the registration token is not registered anymore")
+
+// FCM configures a sink sending push notifications with the Firebase Cloud Messaging HTTP v1 API, see FCMSink.
+// The credentials are the JSON key of a service account allowed to send messages: the project ID defaults to
+// the one of the key. The registration token of a message is the one returned by Token, by default its "token"
+// metadata. The unregistered tokens are written line by line to the feedback writer, if any.
+// The URL of the API defaults to https://fcm.googleapis.com.
+type FCM struct {
+	Credentials []byte
+	ProjectID   string
+	Token       func(Message) string
+	Feedback    io.Writer
+	URL         string
+	HTTPClient  *http.Client
+}
+
+// FCMSink returns a sink sending each message as a push notification to a device with FCM, for mobile push fan-out:
+// the first line of the body is the title of the notification, the other lines its body, and the metadata
+// of the message, but the token, its data. FCM has no batch endpoint anymore: the messages of a chunk are sent
+// concurrently by the bulk client instead. The requests are authenticated with an OAuth access token
+// of the service account, renewed before it expires. The notifications sent to an unregistered token fail
+// with ErrUnregisteredToken and the token is written to the feedback writer, so that it can be removed.
+func FCMSink(config FCM) Sink {
+	account, accountErr := parseServiceAccount(config.Credentials)
+	projectID := config.ProjectID
+	if projectID == "" && account != nil {
+		projectID = account.ProjectID
+	}
+	apiURL := config.URL
+	if apiURL == "" {
+		apiURL = "https://fcm.googleapis.com"
+	}
+	tokens := &oauthTokens{account: account, client: config.HTTPClient}
+	if tokens.client == nil {
+		tokens.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	feedback := &fcmFeedback{w: config.Feedback}
+
+	return Sink{
+		URL:    strings.TrimRight(apiURL, "/") + "/v1/projects/" + url.PathEscape(projectID) + "/messages:send",
+		Method: http.MethodPost,
+		Transform: func(message Message) (Message, error) {
+			if accountErr != nil {
+				return message, accountErr
+			}
+
+			token := fcmToken(config, message)
+			if token == "" {
+				return message, errors.New("the message has no registration token")
+			}
+			accessToken, err := tokens.get()
+			if err != nil {
+				return message, err
+			}
+
+			return fcmMessage(message, token, accessToken)
+		},
+		Check: feedback.check,
+	}
+}
+
+// fcmToken returns the registration token of the message.
+func fcmToken(config FCM, message Message) string {
+	if config.Token != nil {
+		return config.Token(message)
+	}
+
+	return message.Metadata["token"]
+}
+
+// fcmMessage returns the message with the FCM request of the push notification as body
+// and the access token as authorization.
+func fcmMessage(message Message, token string, accessToken string) (Message, error) {
+	text := strings.TrimSpace(string(message.Body))
+	notification := map[string]string{"body": text}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		notification["title"] = strings.TrimSpace(text[:i])
+		notification["body"] = strings.TrimSpace(text[i+1:])
+	}
+	data := map[string]string{}
+	for key, value := range message.Metadata {
+		if key != "token" && key != fcmTokenKey {
+			data[key] = value
+		}
+	}
+
+	payload := map[string]interface{}{"token": token, "notification": notification}
+	if len(data) > 0 {
+		payload["data"] = data
+	}
+	message, err := jsonMessage(message, map[string]interface{}{"message": payload})
+	if err != nil {
+		return message, err
+	}
+
+	header := http.Header{}
+	for key, values := range message.Header {
+		header[key] = values
+	}
+	header.Set("Authorization", "Bearer "+accessToken)
+	message.Header = header
+	message.Metadata = map[string]string{fcmTokenKey: token}
+	for key, value := range data {
+		message.Metadata[key] = value
+	}
+	return message, nil
+}
+
+// fcmFeedback writes the unregistered tokens to the feedback writer, if any.
+type fcmFeedback struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// check fails the responses telling that the registration token is unregistered with ErrUnregisteredToken,
+// and writes the token to the feedback writer. The other failures keep their status code.
+func (f *fcmFeedback) check(res *http.Response) error {
+	if res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusBadRequest {
+		return nil
+	}
+
+	var failure struct {
+		Error struct {
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if json.Unmarshal(body, &failure) != nil {
+		return nil
+	}
+	unregistered := false
+	for _, detail := range failure.Error.Details {
+		unregistered = unregistered || detail.ErrorCode == "UNREGISTERED"
+	}
+	if !unregistered {
+		return nil
+	}
+
+	if token := MessageMetadata(res.Request.Context())[fcmTokenKey]; f.w != nil && token != "" {
+		f.mu.Lock()
+		_, _ = fmt.Fprintln(f.w, token)
+		f.mu.Unlock()
+	}
+
+	return ErrUnregisteredToken
+}
+
+// serviceAccount is the JSON key of a Google service account.
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	key         *rsa.PrivateKey
+}
+
+// parseServiceAccount parses the JSON key of a service account.
+func parseServiceAccount(credentials []byte) (*serviceAccount, error) {
+	var account serviceAccount
+	if err := json.Unmarshal(credentials, &account); err != nil {
+		return nil, fmt.Errorf("invalid service account credentials: %v", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid service account credentials: no PEM private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid service account private key: not an RSA key")
+	}
+	account.key = rsaKey
+
+	return &account, nil
+}
+
+// oauthTokens gets the OAuth access tokens of a service account with a signed JWT assertion,
+// and caches them until shortly before they expire.
+type oauthTokens struct {
+	mu        sync.Mutex
+	account   *serviceAccount
+	client    *http.Client
+	token     string
+	expiresAt time.Time
+}
+
+// get returns the cached access token, or a new one once it is about to expire.
+func (o *oauthTokens) get() (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token != "" && time.Until(o.expiresAt) > fcmTokenMargin {
+		return o.token, nil
+	}
+
+	assertion, err := o.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	res, err := o.client.PostForm(o.account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to get an OAuth access token: %v", err)
+	}
+	defer res.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to get an OAuth access token: status code %d", res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("unable to get an OAuth access token: invalid response")
+	}
+
+	o.token = token.AccessToken
+	o.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return o.token, nil
+}
+
+// assertion returns the JWT assertion of the service account, signed with its private key.
+func (o *oauthTokens) assertion(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   o.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   o.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, o.account.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign the OAuth assertion: %v", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,124 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newServiceAccount returns the JSON key of a service account getting its tokens from the given URI.
+func newServiceAccount(t *testing.T, tokenURI string) ([]byte, *rsa.PublicKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	encoded, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "my-app",
+		"client_email": "notifier@my-app.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded})),
+		"token_uri":    tokenURI,
+	})
+	return credentials, &key.PublicKey
+}
+
+func TestTheFCMSinkSendsPushNotifications(t *testing.T) {
+	var mu sync.Mutex
+	var publicKey *rsa.PublicKey
+	var assertions []map[string]interface{}
+	var pushes []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.URL.Path == "/token" {
+			parts := strings.Split(req.PostFormValue("assertion"), ".")
+			require.Len(t, parts, 3)
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			require.NoError(t, rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature), "valid signature")
+			claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			var assertion map[string]interface{}
+			_ = json.Unmarshal(claims, &assertion)
+			assertions = append(assertions, assertion)
+			_, _ = w.Write([]byte(`{"access_token": "access", "expires_in": 3600, "token_type": "Bearer"}`))
+			return
+		}
+
+		var push map[string]interface{}
+		_ = json.NewDecoder(req.Body).Decode(&push)
+		push["path"] = req.URL.Path
+		push["authorization"] = req.Header.Get("Authorization")
+		pushes = append(pushes, push)
+		if push["message"].(map[string]interface{})["token"] == "stale" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"code": 404, "status": "NOT_FOUND", "details": [{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": "UNREGISTERED"}]}}`))
+		}
+	}))
+	defer server.Close()
+	credentials, key := newServiceAccount(t, server.URL+"/token")
+	publicKey = key
+
+	var feedback bytes.Buffer
+	var failures []Delivery
+	engine := NewEngine(
+		SourceFunc(messages(
+			Message{Body: []byte("New message\nHello from Ada"), Metadata: map[string]string{"token": "device-1", "chat": "42"}},
+			Message{Body: []byte("Hello"), Metadata: map[string]string{"token": "stale"}},
+		)),
+		WithSink("fcm", FCMSink(FCM{Credentials: credentials, Feedback: &feedback, URL: server.URL})),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery) })),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered)
+	require.Len(t, assertions, 1, "the access token is cached")
+	assert.Equal(t, "notifier@my-app.iam.gserviceaccount.com", assertions[0]["iss"])
+	assert.Equal(t, fcmScope, assertions[0]["scope"])
+	assert.Equal(t, server.URL+"/token", assertions[0]["aud"])
+	require.Len(t, pushes, 2)
+	for _, push := range pushes {
+		assert.Equal(t, "/v1/projects/my-app/messages:send", push["path"])
+		assert.Equal(t, "Bearer access", push["authorization"])
+		if push["message"].(map[string]interface{})["token"] == "device-1" {
+			assert.Equal(t, map[string]interface{}{
+				"token":        "device-1",
+				"notification": map[string]interface{}{"title": "New message", "body": "Hello from Ada"},
+				"data":         map[string]interface{}{"chat": "42"},
+			}, push["message"])
+		}
+	}
+	assert.Equal(t, "stale\n", feedback.String())
+	require.Len(t, failures, 1)
+	assert.Equal(t, ErrUnregisteredToken, failures[0].Err)
+	assert.False(t, failures[0].Retryable())
+}
+
+func TestTheFCMSinkFailsWithInvalidCredentials(t *testing.T) {
+	var failures []error
+	engine := NewEngine(
+		SourceFunc(messages(Message{Body: []byte("Hello"), Metadata: map[string]string{"token": "device-1"}})),
+		WithSink("fcm", FCMSink(FCM{Credentials: []byte(`{"private_key": "none"}`)})),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery.Err) })),
+	)
+	_, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, failures, 1)
+	assert.Contains(t, failures[0].Error(), "no PEM private key")
+}
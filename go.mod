@@ -1,9 +1,11 @@
 module github.com/pigeonlab/notifier
 
-go 1.15
+go 1.18
+
+require github.com/stretchr/testify v1.6.1
 
 require (
-	github.com/stretchr/objx v0.3.0 // indirect
-	github.com/stretchr/testify v1.6.1
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
 )
@@ -0,0 +1,148 @@
+package notifier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The limits of the Opsgenie alert API, beyond which the fields are truncated.
+const (
+	opsgenieMaxMessage     = 130
+	opsgenieMaxAlias       = 512
+	opsgenieMaxDescription = 15000
+)
+
+// IncidentKey returns the deduplication key of a message: the messages with the same key update the same incident
+// instead of opening a new one. An empty key falls back to the default one, a hash of the message body.
+type IncidentKey func(Message) string
+
+// Opsgenie configures a sink creating Opsgenie alerts, see OpsgenieSink.
+// The URL defaults to the alert API of the US region, https://api.opsgenie.com/v2/alerts.
+// The alias deduplicates the alerts and the priority, if any, is one of P1 to P5.
+type Opsgenie struct {
+	APIKey   string
+	URL      string
+	Alias    IncidentKey
+	Priority string
+}
+
+// OpsgenieSink returns a sink creating an Opsgenie alert for each message. The first line of the body is the message
+// of the alert, the whole body its description and the metadata of the message its details. The alerts with the same
+// alias are deduplicated by Opsgenie while they are open.
+func OpsgenieSink(config Opsgenie) Sink {
+	apiURL := config.URL
+	if apiURL == "" {
+		apiURL = "https://api.opsgenie.com/v2/alerts"
+	}
+
+	return Sink{
+		URL:    apiURL,
+		Method: http.MethodPost,
+		Header: http.Header{"Authorization": {"GenieKey " + config.APIKey}},
+		Transform: func(message Message) (Message, error) {
+			body := strings.TrimSpace(string(message.Body))
+			alert := struct {
+				Message     string            `json:"message"`
+				Alias       string            `json:"alias"`
+				Description string            `json:"description,omitempty"`
+				Details     map[string]string `json:"details,omitempty"`
+				Priority    string            `json:"priority,omitempty"`
+			}{
+				Message:     truncate(firstLine(body), opsgenieMaxMessage),
+				Alias:       truncate(incidentKey(config.Alias, message), opsgenieMaxAlias),
+				Description: truncate(body, opsgenieMaxDescription),
+				Details:     message.Metadata,
+				Priority:    config.Priority,
+			}
+
+			return jsonMessage(message, alert)
+		},
+	}
+}
+
+// VictorOps configures a sink creating Splunk On-Call (VictorOps) incidents, see VictorOpsSink.
+// The URL is the one of the REST endpoint integration, API key included, e.g.
+// https://alert.victorops.com/integrations/generic/20131114/alert/<api-key>, and the routing key selects the team.
+// The message type defaults to CRITICAL: RECOVERY resolves the incidents of the same entity.
+type VictorOps struct {
+	URL         string
+	RoutingKey  string
+	MessageType string
+	EntityID    IncidentKey
+}
+
+// VictorOpsSink returns a sink creating a Splunk On-Call (VictorOps) incident for each message. The first line
+// of the body is the display name of the incident, the whole body its state message and the metadata of the message
+// are sent as additional fields. The messages with the same entity ID update the same incident.
+func VictorOpsSink(config VictorOps) Sink {
+	messageType := config.MessageType
+	if messageType == "" {
+		messageType = "CRITICAL"
+	}
+
+	return Sink{
+		URL:    strings.TrimRight(config.URL, "/") + "/" + url.PathEscape(config.RoutingKey),
+		Method: http.MethodPost,
+		Transform: func(message Message) (Message, error) {
+			body := strings.TrimSpace(string(message.Body))
+			incident := map[string]string{}
+			for key, value := range message.Metadata {
+				incident[key] = value
+			}
+			incident["message_type"] = messageType
+			incident["entity_id"] = incidentKey(config.EntityID, message)
+			incident["entity_display_name"] = firstLine(body)
+			incident["state_message"] = body
+
+			return jsonMessage(message, incident)
+		},
+	}
+}
+
+// incidentKey returns the deduplication key of the message: the one of the given function, if any and not empty,
+// otherwise the hex SHA-256 of the message body, so that the same message sent twice updates the same incident.
+func incidentKey(key IncidentKey, message Message) string {
+	if key != nil {
+		if k := key(message); k != "" {
+			return k
+		}
+	}
+
+	sum := sha256.Sum256(message.Body)
+	return hex.EncodeToString(sum[:])
+}
+
+// jsonMessage returns the message with the given payload as JSON body.
+func jsonMessage(message Message, payload interface{}) (Message, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return message, err
+	}
+
+	message.Body = body
+	message.ContentType = "application/json"
+	return message, nil
+}
+
+// firstLine returns the first line of the text.
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return strings.TrimSpace(text[:i])
+	}
+
+	return text
+}
+
+// truncate truncates the text to the given amount of runes.
+func truncate(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+
+	return string(runes[:maxRunes])
+}
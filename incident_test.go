@@ -0,0 +1,154 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// incidentRequest is a request received by an incident-management API.
+type incidentRequest struct {
+	path          string
+	authorization string
+	contentType   string
+	payload       map[string]interface{}
+}
+
+// newIncidentServer returns a server recording the requests it receives.
+func newIncidentServer(requests *[]incidentRequest) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		request := incidentRequest{
+			path:          req.URL.Path,
+			authorization: req.Header.Get("Authorization"),
+			contentType:   req.Header.Get("Content-Type"),
+		}
+		_ = json.Unmarshal(body, &request.payload)
+
+		mu.Lock()
+		defer mu.Unlock()
+		*requests = append(*requests, request)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+func TestTheOpsgenieSinkCreatesAlerts(t *testing.T) {
+	var requests []incidentRequest
+	server := newIncidentServer(&requests)
+	defer server.Close()
+
+	var dlq strings.Builder
+	engine := NewEngine(
+		SourceFunc(messages(
+			Message{Body: []byte("disk full\non db-1"), Metadata: map[string]string{"host": "db-1"}},
+			Message{Body: []byte("disk full"), Metadata: map[string]string{"host": "db-2"}},
+		)),
+		WithSink("opsgenie", OpsgenieSink(Opsgenie{
+			APIKey:   "key",
+			URL:      server.URL + "/v2/alerts",
+			Priority: "P2",
+			Alias: func(message Message) string {
+				return message.Metadata["host"]
+			},
+		})),
+		WithDeadLetterQueue(LineDeadLetterQueue(&dlq)),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Delivered)
+	require.Len(t, requests, 2)
+	for _, request := range requests {
+		assert.Equal(t, "/v2/alerts", request.path)
+		assert.Equal(t, "GenieKey key", request.authorization)
+		assert.Equal(t, "application/json", request.contentType)
+		assert.Equal(t, "disk full", request.payload["message"])
+		assert.Equal(t, "P2", request.payload["priority"])
+		host := request.payload["details"].(map[string]interface{})["host"]
+		assert.Equal(t, host, request.payload["alias"])
+	}
+	assert.Empty(t, dlq.String())
+}
+
+func TestTheVictorOpsSinkCreatesIncidents(t *testing.T) {
+	var requests []incidentRequest
+	server := newIncidentServer(&requests)
+	defer server.Close()
+
+	engine := NewEngine(
+		SourceFunc(messages(Message{Body: []byte("disk full"), Metadata: map[string]string{"host": "db-1"}})),
+		WithSink("victorops", VictorOpsSink(VictorOps{
+			URL:        server.URL + "/integrations/generic/20131114/alert/key/",
+			RoutingKey: "database team",
+		})),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/integrations/generic/20131114/alert/key/database team", requests[0].path)
+	assert.Equal(t, "CRITICAL", requests[0].payload["message_type"])
+	assert.Equal(t, "disk full", requests[0].payload["entity_display_name"])
+	assert.Equal(t, "disk full", requests[0].payload["state_message"])
+	assert.Equal(t, "db-1", requests[0].payload["host"])
+	assert.Len(t, requests[0].payload["entity_id"], 64)
+}
+
+func TestTheIncidentKeysDefaultToTheHashOfTheBody(t *testing.T) {
+	key := func(message Message) string { return message.Metadata["key"] }
+
+	assert.Equal(t, incidentKey(nil, Message{Body: []byte("a")}), incidentKey(key, Message{Body: []byte("a")}))
+	assert.NotEqual(t, incidentKey(nil, Message{Body: []byte("a")}), incidentKey(nil, Message{Body: []byte("b")}))
+	assert.Equal(t, "k", incidentKey(key, Message{Body: []byte("a"), Metadata: map[string]string{"key": "k"}}))
+}
+
+func TestTheSinkTransformsFailTheirDeliveriesOnly(t *testing.T) {
+	var requests []incidentRequest
+	server := newIncidentServer(&requests)
+	defer server.Close()
+
+	var dlq strings.Builder
+	engine := NewEngine(
+		LineSource(strings.NewReader("hello\nbroken\nskip\n")),
+		WithSink("main", Sink{URL: server.URL + "/main"}),
+		WithSink("transformed", Sink{URL: server.URL + "/transformed", Transform: func(message Message) (Message, error) {
+			switch string(message.Body) {
+			case "broken":
+				return message, assert.AnError
+			case "skip":
+				return message, ErrDrop
+			}
+			message.Body = []byte(`{"text": "hello"}`)
+			return message, nil
+		}}),
+		WithDeadLetterQueue(LineDeadLetterQueue(&dlq)),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Received: 3, Delivered: 4, Failed: 1, DeadLettered: 1}, stats)
+	assert.Len(t, requests, 4)
+	assert.Equal(t, "broken\n", dlq.String())
+}
+
+// messages returns a source function returning the given messages, then io.EOF.
+func messages(list ...Message) func(context.Context) (Message, error) {
+	return func(context.Context) (Message, error) {
+		if len(list) == 0 {
+			return Message{}, io.EOF
+		}
+		message := list[0]
+		list = list[1:]
+		return message, nil
+	}
+}
@@ -0,0 +1,33 @@
+// Package detached provides the contexts holding the values of another context without its deadline nor cancellation.
+package detached
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext is a context holding the values of its parent without its deadline nor cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+// Context returns a context without deadline nor cancellation holding the values of the given one,
+// e.g. for the work that must outlive it, like the acknowledgements of the messages interrupted by a shutdown.
+func Context(ctx context.Context) context.Context {
+	return detachedContext{Context: ctx}
+}
+
+// Deadline implements the context.Context interface.
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done implements the context.Context interface.
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err implements the context.Context interface.
+func (detachedContext) Err() error {
+	return nil
+}
@@ -0,0 +1,24 @@
+package detached
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// key is the context key of the test value.
+type key struct{}
+
+func TestTheDetachedContextKeepsTheValuesOnly(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, "message-1"), time.Minute)
+	cancel()
+
+	ctx := Context(parent)
+
+	assert.Equal(t, "message-1", ctx.Value(key{}))
+	assert.Nil(t, ctx.Err())
+	assert.Nil(t, ctx.Done())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+}
@@ -1,9 +1,292 @@
 package interr
 
-import "errors"
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Retryable is implemented by the errors telling whether the failed request can be sent again.
+// Temporary returns the same as Retryable, as net.Error does.
+type Retryable interface {
+	error
+	Retryable() bool
+	Temporary() bool
+}
+
+// IsRetryable reports whether the request failed with the given error can be sent again:
+// the first error of the chain implementing Retryable decides, the other errors are permanent.
+func IsRetryable(err error) bool {
+	var retryable Retryable
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	return false
+}
+
+// retryableError is a sentinel error of a request that can be sent again, e.g. because it was never sent.
+type retryableError struct {
+	message string
+}
+
+func (e *retryableError) Error() string {
+	return e.message
+}
+
+// Retryable reports that the request can be sent again.
+func (e *retryableError) Retryable() bool {
+	return true
+}
+
+// Temporary reports that the request can be sent again.
+func (e *retryableError) Temporary() bool {
+	return true
+}
 
 // ErrRequestsNotFound is fired when a request is not provided.
 var ErrRequestsNotFound = errors.New("no requests provided")
 
-// ErrIgnored is fired when a request has been ignored.
-var ErrIgnored = errors.New("request ignored")
+// ErrIgnored is fired when a request has been ignored. It is retryable: the request was not sent, or not completed,
+// because of the bulk request.
+var ErrIgnored error = &retryableError{"request ignored"}
+
+// ErrPollingExhausted is fired when an asynchronous acknowledgement is still pending after the last status poll.
+var ErrPollingExhausted = errors.New("async status polling exhausted")
+
+// ErrBarrierNotPassed is fired when a request has not been started because a request before its barrier failed.
+// It is retryable, since the request itself was not sent.
+var ErrBarrierNotPassed error = &retryableError{"request not started: a request before the barrier failed"}
+
+// ErrDependencyFailed is fired when a request has not been started because a request it depends on failed.
+// It is retryable, since the request itself was not sent.
+var ErrDependencyFailed error = &retryableError{"request not started: a request it depends on failed"}
+
+// ErrMemoryLimitExceeded is fired when the bodies held in memory by the client exceed its memory limit.
+var ErrMemoryLimitExceeded error = &retryableError{"memory limit exceeded"}
+
+// ErrRetryBudgetExhausted is fired when a request would be retried but the retry budget of its bulk request is spent.
+var ErrRetryBudgetExhausted error = &retryableError{"retry budget exhausted"}
+
+// ErrBulkDeadlineExceeded is fired when a request has not completed by the deadline of its bulk request.
+var ErrBulkDeadlineExceeded error = &retryableError{"bulk request deadline exceeded"}
+
+// ErrAborted is fired when a request has not completed because its bulk request was aborted after too many failures.
+var ErrAborted error = &retryableError{"request not completed: the bulk request was aborted after too many failures"}
+
+// ErrResponseTooLarge is fired when a response body exceeds the maximum response size of the client.
+// It is not retryable: the target would most likely return the same body again.
+var ErrResponseTooLarge = errors.New("response body exceeds the maximum size")
+
+// ErrExpired is fired when a request has not been sent because it expired first.
+// It is not retryable: the request is not worth sending anymore.
+var ErrExpired = errors.New("request expired before it was sent")
+
+// TimeoutError is fired when a request timed out, e.g. because of the client timeout or the deadline of the request.
+// Index is the position of the request in the bulk request, Attempts the amount of times it was sent
+// and Err the error returned by the HTTP client.
+type TimeoutError struct {
+	Index    int
+	Method   string
+	URL      string
+	Attempts int
+	Err      error
+}
+
+// Error returns the message of the error returned by the HTTP client.
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("http client error: %s", e.Err)
+}
+
+// Unwrap returns the error returned by the HTTP client.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports that the error is a timeout, as net.Error does.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Retryable reports that the request can be sent again.
+func (e *TimeoutError) Retryable() bool {
+	return true
+}
+
+// Temporary reports that the request can be sent again.
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+// ConnectionError is fired when a request failed without a response for another reason than a timeout,
+// e.g. a refused connection, a DNS or a TLS failure. Index is the position of the request in the bulk request,
+// Attempts the amount of times it was sent and Err the error returned by the HTTP client.
+type ConnectionError struct {
+	Index    int
+	Method   string
+	URL      string
+	Attempts int
+	Err      error
+}
+
+// Error returns the message of the error returned by the HTTP client.
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("http client error: %s", e.Err)
+}
+
+// Unwrap returns the error returned by the HTTP client.
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request can be sent again. The unknown hosts and the invalid certificates
+// are permanent failures, the other ones, e.g. a refused or reset connection, are transient.
+func (e *ConnectionError) Retryable() bool {
+	var dnsErr *net.DNSError
+	if errors.As(e.Err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	return !errors.As(e.Err, &authorityErr) && !errors.As(e.Err, &invalidErr) && !errors.As(e.Err, &hostnameErr)
+}
+
+// Temporary returns the same as Retryable.
+func (e *ConnectionError) Temporary() bool {
+	return e.Retryable()
+}
+
+// StatusError is fired when a request completed with a status code that is not successful,
+// see pkg.WithStatusErrors. Index is the position of the request in the bulk request
+// and Attempts the amount of times it was sent.
+type StatusError struct {
+	Index    int
+	Method   string
+	URL      string
+	Attempts int
+	Code     int
+}
+
+// Error returns the status code and the URL of the request.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s", e.Code, e.URL)
+}
+
+// Retryable reports whether the request can be sent again: the 429, 502, 503 and 504 status codes are transient,
+// the other ones are permanent.
+func (e *StatusError) Retryable() bool {
+	switch e.Code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Temporary returns the same as Retryable.
+func (e *StatusError) Temporary() bool {
+	return e.Retryable()
+}
+
+// HeaderError is fired when a request completed with a successful status code but without an expected header,
+// or without its expected value, see pkg.WithExpectedHeader. Index is the position of the request in the bulk request,
+// Attempts the amount of times it was sent, Expected the expected value, empty when any value is expected,
+// and Values the values of the header in the response.
+type HeaderError struct {
+	Index    int
+	Method   string
+	URL      string
+	Attempts int
+	Header   string
+	Expected string
+	Values   []string
+}
+
+// Error returns the expected header and the URL of the request.
+func (e *HeaderError) Error() string {
+	if len(e.Values) == 0 {
+		return fmt.Sprintf("missing response header %s from %s", e.Header, e.URL)
+	}
+
+	return fmt.Sprintf("unexpected response header %s: %q instead of %q from %s", e.Header, strings.Join(e.Values, ", "), e.Expected, e.URL)
+}
+
+// Retryable reports that the request can't be sent again: the receiver processed it and reported its failure.
+func (e *HeaderError) Retryable() bool {
+	return false
+}
+
+// Temporary returns the same as Retryable.
+func (e *HeaderError) Temporary() bool {
+	return e.Retryable()
+}
+
+// BulkError gathers the failures of the requests of a bulk request. Errors holds an error per request,
+// at the index of the request, nil for the ones that didn't fail. errors.Is and errors.As look through the failures,
+// e.g. errors.Is(err, ErrIgnored) reports whether a request was ignored.
+type BulkError struct {
+	Errors []error
+}
+
+// NewBulkError returns a *BulkError gathering the given errors of the requests of a bulk request,
+// or nil when none of them failed.
+func NewBulkError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &BulkError{Errors: errs}
+		}
+	}
+
+	return nil
+}
+
+// Error returns the amount of failed requests and the first failure.
+func (e *BulkError) Error() string {
+	failures := e.Unwrap()
+	if len(failures) == 0 {
+		return "no request failed"
+	}
+
+	return fmt.Sprintf("%d of %d requests failed, first: %v", len(failures), len(e.Errors), failures[0])
+}
+
+// Unwrap returns the failures, in the order of the requests.
+func (e *BulkError) Unwrap() []error {
+	var failures []error
+	for _, err := range e.Errors {
+		if err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	return failures
+}
+
+// Is reports whether one of the failures matches the target, see errors.Is.
+// It lets errors.Is look through the failures before Go 1.20, which ignores Unwrap() []error.
+func (e *BulkError) Is(target error) bool {
+	for _, err := range e.Unwrap() {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first failure matching the target and sets the target to it, see errors.As.
+// It lets errors.As look through the failures before Go 1.20, which ignores Unwrap() []error.
+func (e *BulkError) As(target interface{}) bool {
+	for _, err := range e.Unwrap() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"net/http"
+	"time"
+)
+
+// asyncPolling configures how the client follows the asynchronous acknowledgements.
+type asyncPolling struct {
+	maxAttempts int
+	interval    time.Duration
+}
+
+// WithAsyncPolling makes the client follow the asynchronous acknowledgements:
+// when a target responds with 202 Accepted and a Location header, the status URL is polled
+// with GET requests, at the given interval and up to maxAttempts times, until it returns another status.
+// The last status response is the delivery result. If the status URL still returns 202 after the
+// last attempt, the request fails with interr.ErrPollingExhausted.
+func WithAsyncPolling(maxAttempts int, interval time.Duration) Option {
+	return func(b *BulkHTTPClient) {
+		b.asyncPolling = &asyncPolling{
+			maxAttempts: maxAttempts,
+			interval:    interval,
+		}
+	}
+}
+
+// isAsyncAck reports whether the response is an asynchronous acknowledgement with a status URL.
+func isAsyncAck(res *http.Response) bool {
+	return res != nil && res.StatusCode == http.StatusAccepted && res.Header.Get("Location") != ""
+}
+
+// followAsyncAck polls the status URL of an asynchronous acknowledgement until the final outcome is known.
+// The given requestFlow is returned as is when it is not an asynchronous acknowledgement.
+func (b *BulkHTTPClient) followAsyncAck(ctx context.Context, flow requestFlow) requestFlow {
+	for attempt := 0; flow.err == nil && isAsyncAck(flow.response); attempt++ {
+		if attempt == b.asyncPolling.maxAttempts {
+			return requestFlow{err: interr.ErrPollingExhausted, index: flow.index}
+		}
+
+		statusURL, err := flow.response.Request.URL.Parse(flow.response.Header.Get("Location"))
+		if err != nil {
+			return requestFlow{err: fmt.Errorf("invalid status URL: %s", err), index: flow.index}
+		}
+
+		select {
+		case <-ctx.Done():
+			return requestFlow{err: interr.ErrIgnored, index: flow.index}
+		case <-time.After(b.asyncPolling.interval):
+		}
+
+		req, err := http.NewRequest(http.MethodGet, statusURL.String(), nil)
+		if err != nil {
+			return requestFlow{err: fmt.Errorf("invalid status URL: %s", err), index: flow.index}
+		}
+
+		req = req.WithContext(withRequestValues(ctx, flow.response.Request))
+		flow = b.parseResponse(ctx, b.performRequests(requestData{request: req, index: flow.index}))
+	}
+
+	return flow
+}
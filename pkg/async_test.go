@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsyncAcknowledgementIsFollowedUntilTheFinalOutcome(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/status" {
+			if atomic.AddInt32(&polls, 1) < 3 {
+				w.Header().Set("Location", "/status")
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			_, _ = w.Write([]byte("delivered"))
+			return
+		}
+
+		w.Header().Set("Location", "/status")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithAsyncPolling(5, time.Millisecond))
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, errs[0])
+	body, _ := ioutil.ReadAll(responses[0].Body)
+	assert.Equal(t, http.StatusOK, responses[0].StatusCode)
+	assert.Equal(t, "delivered", string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&polls))
+}
+
+func TestAsyncAcknowledgementFailsWhenPollingIsExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Location", "/status")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithAsyncPolling(2, time.Millisecond))
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	responses, errs := client.Do(NewBulkRequest([]*http.Request{req}, 1, 1))
+
+	assert.Nil(t, responses[0])
+	assert.Equal(t, interr.ErrPollingExhausted, errs[0])
+}
@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+)
+
+// The headers stamped on every request of a bulk request by WithBatchHeaders.
+const (
+	// BatchIDHeader holds the ID of the bulk request, see BulkRequest.BatchID.
+	BatchIDHeader = "X-Batch-Id"
+	// BatchSizeHeader holds the amount of requests of the bulk request.
+	BatchSizeHeader = "X-Batch-Size"
+	// BatchIndexHeader holds the index of the request in the bulk request, from 0.
+	BatchIndexHeader = "X-Batch-Index"
+)
+
+// WithBatchHeaders makes the client stamp every request of a bulk request with the ID of the bulk request,
+// its size and the index of the request, so that the receivers can detect and reconcile the partial deliveries
+// of a batch. The requests sent again in another bulk request get the headers of the new one.
+func WithBatchHeaders() Option {
+	return func(b *BulkHTTPClient) {
+		b.batchHeaders = true
+	}
+}
+
+// BatchID sets the ID of this BulkRequest stamped by WithBatchHeaders, e.g. one derived from the job it belongs to.
+// Otherwise a random ID is generated when the bulk request is first sent, and kept when it is sent again.
+func (b *BulkRequest) BatchID(id string) *BulkRequest {
+	b.batchID = id
+	return b
+}
+
+// stampBatchHeaders stamps the batch headers on the requests of the bulk request, if the client stamps them.
+// The dependent requests are stamped once they are built, see stampBatchHeader.
+func (b *BulkHTTPClient) stampBatchHeaders(bulkRequest *BulkRequest) {
+	if !b.batchHeaders {
+		return
+	}
+
+	if bulkRequest.batchID == "" {
+		bulkRequest.batchID = newBatchID()
+	}
+
+	for i, req := range bulkRequest.requests {
+		b.stampBatchHeader(bulkRequest, i, req)
+	}
+}
+
+// stampBatchHeader stamps the batch headers on the request at the given index of the bulk request,
+// if the client stamps them.
+func (b *BulkHTTPClient) stampBatchHeader(bulkRequest *BulkRequest, index int, req *http.Request) {
+	if !b.batchHeaders {
+		return
+	}
+
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set(BatchIDHeader, bulkRequest.batchID)
+	req.Header.Set(BatchSizeHeader, strconv.Itoa(len(bulkRequest.requests)))
+	req.Header.Set(BatchIndexHeader, strconv.Itoa(index))
+}
+
+// newBatchID returns a random batch ID of 32 hexadecimal characters.
+func newBatchID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestBatchHeaders(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[req.URL.Path] = req.Header.Clone()
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithBatchHeaders(), WithSubBatches(1, nil))
+
+	var requests []*http.Request
+	for _, path := range []string{"/first", "/second", "/third"} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	bulkRequest := NewBulkRequest(requests, 2, 2)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.BatchID, 32)
+	require.Len(t, received, 3)
+	for i, path := range []string{"/first", "/second", "/third"} {
+		assert.Equal(t, result.BatchID, received[path].Get(BatchIDHeader))
+		assert.Equal(t, "3", received[path].Get(BatchSizeHeader))
+		assert.Equal(t, strconv.Itoa(i), received[path].Get(BatchIndexHeader))
+	}
+
+	again := client.Send(context.Background(), bulkRequest)
+	assert.Equal(t, result.BatchID, again.BatchID, "the ID is kept when the bulk request is sent again")
+}
+
+func TestBatchIDCanBeSet(t *testing.T) {
+	var batchID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		batchID = req.Header.Get(BatchIDHeader)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1).BatchID("job-42-chunk-7")
+	result := NewClient(&http.Client{}, WithBatchHeaders()).Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, "job-42-chunk-7", batchID)
+	assert.Equal(t, "job-42-chunk-7", result.BatchID)
+}
+
+func TestNoBatchHeadersByDefault(t *testing.T) {
+	var stamped bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		stamped = req.Header.Get(BatchIDHeader) != ""
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1).BatchID("ignored")
+	result := NewClient(&http.Client{}).Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.False(t, stamped)
+	assert.Empty(t, result.BatchID)
+}
+
+func TestTheDependentRequestsAreStampedOnceBuilt(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[req.URL.Path] = req.Header.Clone()
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithBatchHeaders())
+
+	parent, err := http.NewRequest(http.MethodPost, server.URL+"/parent", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{parent}, 2, 2).
+		AddDependentRequest(func(parents []*http.Response) (*http.Request, error) {
+			return http.NewRequest(http.MethodPost, server.URL+"/child", nil)
+		}, 0)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, received, 2)
+	for i, path := range []string{"/parent", "/child"} {
+		assert.Equal(t, result.BatchID, received[path].Get(BatchIDHeader))
+		assert.Equal(t, "2", received[path].Get(BatchSizeHeader))
+		assert.Equal(t, strconv.Itoa(i), received[path].Get(BatchIndexHeader))
+	}
+}
@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBodySize is the capacity above which the buffer of a response body is not reused,
+// so that a few large responses don't keep their memory for good.
+const maxPooledBodySize = 64 << 10
+
+// bodyBuffers reuses the buffers of the response bodies across the requests of all the clients.
+var bodyBuffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// acquireBuffer returns an empty buffer from the pool.
+func acquireBuffer() *bytes.Buffer {
+	buffer := bodyBuffers.Get().(*bytes.Buffer)
+	buffer.Reset()
+	return buffer
+}
+
+// releaseBuffer gives the buffer back to the pool, unless it grew larger than maxPooledBodySize.
+func releaseBuffer(buffer *bytes.Buffer) {
+	if buffer.Cap() <= maxPooledBodySize {
+		bodyBuffers.Put(buffer)
+	}
+}
+
+// pooledBody is a response body read in a pooled buffer, given back to the pool when the body is closed.
+// It is accounted by the memory guard, if any, until then. Once closed, it reads as empty.
+type pooledBody struct {
+	bytes.Reader
+	buffer *bytes.Buffer
+	memory *memoryGuard
+	once   sync.Once
+}
+
+// newPooledBody returns the body reading the given buffer, accounted by the given memory guard, if any.
+func newPooledBody(buffer *bytes.Buffer, memory *memoryGuard) *pooledBody {
+	body := &pooledBody{buffer: buffer, memory: memory}
+	body.Reset(buffer.Bytes())
+	return body
+}
+
+// Close gives the buffer back to the pool and releases the body from the memory guard.
+func (p *pooledBody) Close() error {
+	p.once.Do(func() {
+		if p.memory != nil {
+			p.memory.unbuffer(int64(p.buffer.Len()))
+		}
+		p.Reset(nil)
+		releaseBuffer(p.buffer)
+	})
+
+	return nil
+}
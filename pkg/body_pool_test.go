@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newBodyFlow(t testing.TB, body string) requestFlow {
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	require.NoError(t, err, "no errors")
+
+	return requestFlow{
+		request: req,
+		response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		},
+	}
+}
+
+func TestPooledBodyReadsAsEmptyOnceClosed(t *testing.T) {
+	client := NewClient(&http.Client{})
+
+	flow := client.parseResponse(context.Background(), newBodyFlow(t, "pooled"))
+	require.NoError(t, flow.err, "no errors")
+	bs, err := ioutil.ReadAll(flow.response.Body)
+	require.NoError(t, err, "no errors")
+	assert.Equal(t, "pooled", string(bs))
+
+	require.NoError(t, flow.response.Body.Close(), "no errors")
+	require.NoError(t, flow.response.Body.Close(), "no errors")
+	bs, err = ioutil.ReadAll(flow.response.Body)
+	require.NoError(t, err, "no errors")
+	assert.Empty(t, bs)
+}
+
+func TestLargeBuffersAreNotPooled(t *testing.T) {
+	buffer := acquireBuffer()
+	buffer.Grow(2 * maxPooledBodySize)
+	releaseBuffer(buffer)
+
+	for i := 0; i < 10; i++ {
+		assert.LessOrEqual(t, acquireBuffer().Cap(), maxPooledBodySize)
+	}
+}
+
+func TestPooledBodiesAreReleasedFromTheMemoryGuard(t *testing.T) {
+	client := NewClient(&http.Client{}, WithMemoryLimit(10))
+
+	flow := client.parseResponse(context.Background(), newBodyFlow(t, "0123456789"))
+	require.NoError(t, flow.err, "no errors")
+	assert.Equal(t, int64(10), client.memory.buffered)
+
+	require.NoError(t, flow.response.Body.Close(), "no errors")
+	assert.Equal(t, int64(0), client.memory.buffered)
+}
+
+func BenchmarkParseResponse(b *testing.B) {
+	client := NewClient(&http.Client{})
+	body := string(bytes.Repeat([]byte("x"), 4<<10))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		flow := newBodyFlow(b, body)
+		b.StartTimer()
+
+		flow = client.parseResponse(context.Background(), flow)
+		_, _ = io.Copy(ioutil.Discard, flow.response.Body)
+		_ = flow.response.Body.Close()
+	}
+}
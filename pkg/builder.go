@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+)
+
+// BulkRequestBuilder builds a BulkRequest from request bodies and the defaults shared by all the requests:
+// the base URL, the method and the headers. The defaults apply to every added body, whether it is added
+// before or after they are set, since the requests are built by Build.
+type BulkRequestBuilder struct {
+	baseURL         string
+	method          string
+	header          http.Header
+	dispatchWorkers int
+	processWorkers  int
+	bodies          []bodyRequest
+}
+
+// bodyRequest holds a body added to a BulkRequestBuilder and its own settings.
+type bodyRequest struct {
+	body      io.Reader
+	ref       string
+	method    string
+	header    http.Header
+	query     url.Values
+	tenant    string
+	timeout   time.Duration
+	expiresAt time.Time
+	values    []bodyValue
+}
+
+// bodyValue is a value attached to the context of a request.
+type bodyValue struct {
+	key   interface{}
+	value interface{}
+}
+
+// BodyOption configures the request of a single body of a BulkRequestBuilder.
+type BodyOption func(*bodyRequest)
+
+// NewBulkRequestBuilder returns a new instance of BulkRequestBuilder.
+// The requests are sent with the POST method, by GOMAXPROCS dispatch and processor workers, unless set otherwise.
+func NewBulkRequestBuilder() *BulkRequestBuilder {
+	return &BulkRequestBuilder{
+		method: http.MethodPost,
+		header: http.Header{},
+	}
+}
+
+// BaseURL sets the URL the bodies are sent to. The URLs of the BodyURL option are resolved against it.
+func (b *BulkRequestBuilder) BaseURL(baseURL string) *BulkRequestBuilder {
+	b.baseURL = baseURL
+	return b
+}
+
+// Method sets the method of the requests.
+func (b *BulkRequestBuilder) Method(method string) *BulkRequestBuilder {
+	b.method = method
+	return b
+}
+
+// Header adds the given header to the requests. The BodyHeader option replaces it for a single request.
+func (b *BulkRequestBuilder) Header(key, value string) *BulkRequestBuilder {
+	b.header.Add(key, value)
+	return b
+}
+
+// Workers sets the amount of workers sending the requests and processing the responses, see NewBulkRequest.
+func (b *BulkRequestBuilder) Workers(dispatchRequestsWorkers, processResponseWorkers int) *BulkRequestBuilder {
+	b.dispatchWorkers, b.processWorkers = dispatchRequestsWorkers, processResponseWorkers
+	return b
+}
+
+// AddBody adds a request sending the given body, which can be nil, with the defaults and the given options.
+func (b *BulkRequestBuilder) AddBody(body io.Reader, opts ...BodyOption) *BulkRequestBuilder {
+	request := bodyRequest{body: body}
+	for _, opt := range opts {
+		opt(&request)
+	}
+
+	b.bodies = append(b.bodies, request)
+	return b
+}
+
+// BodyURL sends the body to the given URL instead of the base URL. A relative URL is resolved against the base URL.
+func BodyURL(ref string) BodyOption {
+	return func(r *bodyRequest) {
+		r.ref = ref
+	}
+}
+
+// BodyMethod sends the body with the given method instead of the one of the builder.
+func BodyMethod(method string) BodyOption {
+	return func(r *bodyRequest) {
+		r.method = method
+	}
+}
+
+// BodyHeader sets the given header of the request, replacing the default values of the header, if any.
+func BodyHeader(key, value string) BodyOption {
+	return func(r *bodyRequest) {
+		if r.header == nil {
+			r.header = http.Header{}
+		}
+		r.header.Add(key, value)
+	}
+}
+
+// BodyQuery adds the given query parameter to the URL of the request.
+func BodyQuery(key, value string) BodyOption {
+	return func(r *bodyRequest) {
+		if r.query == nil {
+			r.query = url.Values{}
+		}
+		r.query.Add(key, value)
+	}
+}
+
+// BodyTenant sets the tenant of the request: the bulk request built with tenants starts the requests
+// in round-robin across them, see BulkRequest.ScheduleByTenant.
+func BodyTenant(tenant string) BodyOption {
+	return func(r *bodyRequest) {
+		r.tenant = tenant
+	}
+}
+
+// BodyValue attaches the given value to the context of the request, e.g. the metadata of a message
+// read by a custom http.RoundTripper for authentication or tracing. The values survive the cancellation
+// of the request's context by the bulk request.
+func BodyValue(key, value interface{}) BodyOption {
+	return func(r *bodyRequest) {
+		r.values = append(r.values, bodyValue{key: key, value: value})
+	}
+}
+
+// BodyTimeout sets the deadline of the request, see RequestTimeout.
+func BodyTimeout(timeout time.Duration) BodyOption {
+	return func(r *bodyRequest) {
+		r.timeout = timeout
+	}
+}
+
+// Build returns the BulkRequest with a request per added body, in the order they were added.
+// It returns an error when a request can't be built, e.g. because of an invalid URL or method.
+func (b *BulkRequestBuilder) Build() (*BulkRequest, error) {
+	dispatchWorkers, processWorkers := b.dispatchWorkers, b.processWorkers
+	if dispatchWorkers <= 0 {
+		dispatchWorkers = runtime.GOMAXPROCS(0)
+	}
+	if processWorkers <= 0 {
+		processWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	var base *url.URL
+	if b.baseURL != "" {
+		var err error
+		base, err = url.Parse(b.baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL: %v", err)
+		}
+	}
+
+	bulkRequest := NewBulkRequest(nil, dispatchWorkers, processWorkers)
+	tenants := make(map[*http.Request]string)
+	for i, body := range b.bodies {
+		req, err := b.newRequest(base, body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to build the request %d: %v", i, err)
+		}
+
+		addBodyRequest(bulkRequest, req, body)
+		if body.tenant != "" {
+			tenants[req] = body.tenant
+		}
+	}
+
+	if len(tenants) > 0 {
+		bulkRequest.ScheduleByTenant(func(req *http.Request) string {
+			return tenants[req]
+		})
+	}
+
+	return bulkRequest, nil
+}
+
+// newRequest returns the request of the given body, with the defaults of the builder.
+func (b *BulkRequestBuilder) newRequest(base *url.URL, body bodyRequest) (*http.Request, error) {
+	target := base
+	if body.ref != "" {
+		ref, err := url.Parse(body.ref)
+		if err != nil {
+			return nil, err
+		}
+		if base != nil {
+			target = base.ResolveReference(ref)
+		} else {
+			target = ref
+		}
+	}
+	if target == nil || !target.IsAbs() {
+		return nil, errors.New("no absolute URL to send the request to")
+	}
+
+	method := b.method
+	if body.method != "" {
+		method = body.method
+	}
+
+	ctx := context.Background()
+	for _, v := range body.values {
+		ctx = context.WithValue(ctx, v.key, v.value)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body.body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range b.header {
+		req.Header[key] = append([]string{}, values...)
+	}
+	for key, values := range body.header {
+		req.Header[key] = append([]string{}, values...)
+	}
+
+	if len(body.query) > 0 {
+		query := req.URL.Query()
+		for key, values := range body.query {
+			for _, value := range values {
+				query.Add(key, value)
+			}
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+
+	return req, nil
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTheBuilderAppliesTheDefaultsToEveryRequest(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received[string(body)] = req.Method + " " + req.URL.RequestURI() + " " + req.Header.Get("X-Api-Key")
+	}))
+	defer server.Close()
+
+	builder := NewBulkRequestBuilder().AddBody(strings.NewReader("first"))
+	builder.BaseURL(server.URL+"/hooks/").Method(http.MethodPut).Header("X-Api-Key", "secret").
+		AddBody(strings.NewReader("second"), BodyURL("orders"), BodyQuery("id", "42")).
+		AddBody(strings.NewReader("third"), BodyHeader("X-Api-Key", "other"))
+	bulkRequest, err := builder.Build()
+	require.NoError(t, err, "no errors")
+
+	result := NewClient(&http.Client{}).Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Len(t, result.Succeeded(), 3)
+	assert.Equal(t, map[string]string{
+		"first":  "PUT /hooks/ secret",
+		"second": "PUT /hooks/orders?id=42 secret",
+		"third":  "PUT /hooks/ other",
+	}, received)
+}
+
+func TestTheBuilderSetsTheTenantsAndTheTimeouts(t *testing.T) {
+	builder := NewBulkRequestBuilder().BaseURL("http://localhost").
+		AddBody(nil, BodyTenant("a")).
+		AddBody(nil, BodyTenant("a"), BodyTimeout(time.Second)).
+		AddBody(nil, BodyTenant("b"))
+
+	bulkRequest, err := builder.Build()
+	require.NoError(t, err, "no errors")
+
+	assert.Len(t, bulkRequest.requests, 3)
+	assert.Equal(t, []int{0, 2, 1}, bulkRequest.fairOrder(allIndexes(3)))
+	assert.Equal(t, time.Second, bulkRequest.options[1].timeout)
+}
+
+func TestTheBuilderSendsAnAbsoluteBodyURLAsIs(t *testing.T) {
+	bulkRequest, err := NewBulkRequestBuilder().BaseURL("http://localhost/hooks").
+		AddBody(nil, BodyURL("https://example.com/canary"), BodyMethod(http.MethodPatch)).
+		Build()
+	require.NoError(t, err, "no errors")
+
+	assert.Equal(t, "https://example.com/canary", bulkRequest.requests[0].URL.String())
+	assert.Equal(t, http.MethodPatch, bulkRequest.requests[0].Method)
+}
+
+func TestTheBuilderFailsWithoutAnAbsoluteURL(t *testing.T) {
+	_, err := NewBulkRequestBuilder().AddBody(nil, BodyURL("/relative")).Build()
+	assert.Error(t, err)
+
+	_, err = NewBulkRequestBuilder().BaseURL("http://localhost").Method("BAD METHOD").AddBody(nil).Build()
+	assert.Error(t, err)
+}
@@ -1,15 +1,16 @@
 package pkg
 
 import (
-	"bytes"
 	"context"
 	"errors"
-	"fmt"
+	"github.com/pigeonlab/notifier/internal/detached"
 	"github.com/pigeonlab/notifier/interr"
+	"github.com/pigeonlab/notifier/pkg/pool"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // HTTPClient is an HTTP client interface for testing and abstraction purposes.
@@ -22,283 +23,443 @@ type HTTPClient interface {
 // BulkHTTPClient implements a classic HTTP client.
 // It represents a client that sends multiple requests in bulk.
 type BulkHTTPClient struct {
-	HTTPClient HTTPClient
-	ctx        context.Context
+	HTTPClient      HTTPClient
+	ctx             context.Context
+	asyncPolling    *asyncPolling
+	subBatching     *subBatching
+	memory          *memoryGuard
+	retention       *bodyRetention
+	retryPolicy     RetryPolicy
+	retryAfter      *retryAfter
+	retryBudget     *retryBudgetLimits
+	rateLimiter     *tokenBucket
+	keyedRateLimit  *keyedRateLimit
+	multiplexing    *multiplexing
+	concurrency     *adaptiveConcurrency
+	cache           *responseCache
+	hooks           *Hooks
+	middlewares     []Middleware
+	timeout         time.Duration
+	hedgeDelay      time.Duration
+	successCodes    map[int]bool
+	statusErrors    bool
+	failOnStatus    func(code int) bool
+	batchHeaders    bool
+	failFast        *failFastLimits
+	expectedHeaders []expectedHeader
+	maxResponseSize *maxResponseSize
+	responseBuffer  int
 }
 
-// NewBulkHTTPClient returns a new instance of BulkHTTPClient.
-func NewBulkHTTPClient(ctx context.Context, client HTTPClient) *BulkHTTPClient {
-	return &BulkHTTPClient{
+// NewClient returns a new instance of BulkHTTPClient configured with the given options.
+// The client can serve many bulk requests, each one cancelled by the context given to Send.
+func NewClient(client HTTPClient, opts ...Option) *BulkHTTPClient {
+	b := &BulkHTTPClient{
 		HTTPClient: client,
-		ctx:        ctx,
+		ctx:        context.Background(),
 	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// NewBulkHTTPClient returns a new instance of BulkHTTPClient configured with the given options.
+// The given context cancels the bulk requests executed with Do and DoWithDeadline.
+//
+// Deprecated: use NewClient and pass the context to Send instead.
+func NewBulkHTTPClient(ctx context.Context, client HTTPClient, opts ...Option) *BulkHTTPClient {
+	b := NewClient(client, opts...)
+	b.ctx = ctx
+
+	return b
 }
 
 // requestData wraps a single HTTP request.
 // It tracks the request's index (position).
 type requestData struct {
-	request *http.Request
-	index   int
+	request      *http.Request
+	index        int
+	budget       *retryBudget
+	timeout      time.Duration
+	expiresAt    time.Time
+	failOnStatus func(code int) bool
+	queuedAt     time.Time
 }
 
 // requestFlow represents a single bulk request flow.
 // A flow includes the requests, the responses, the error s(if any) and the requests' indexes.
+// The latency is the time spent sending the request, retries included, and the attempts the amount of times it was sent.
+// The timestamps track when the request was queued for a dispatch worker, started and finished, see Result.
 type requestFlow struct {
-	response *http.Response
-	request  *http.Request
-	err      error
-	index    int
+	response   *http.Response
+	request    *http.Request
+	err        error
+	index      int
+	latency    time.Duration
+	attempts   int
+	queuedAt   time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+
+	failOnStatus func(code int) bool
 }
 
-// workerChannels collects the operational channels for the HTTP client.
-// - requestList: collects the HTTP requests.
-// - receivedResponses: collects the HTTP RAW responses (no reading attempts yet).
-// - processedResponses: collects the parsed HTTP responses: after we attempt to read the header, body and status code.
-// - collectResponses: collects the responses channels.
-type workerChannels struct {
-	requestList        chan requestData
-	receivedResponses  chan requestFlow
-	processedResponses chan requestFlow
-	collectResponses   chan []requestFlow
+// Send executes all the requests concurrently, see NewBulkRequest for the amount of workers.
+// It adds the given context to each request before starting the process. The values of the request's own context
+// are kept, e.g. for a custom http.RoundTripper to read message-scoped data.
+// The context is useful to handle cancellation: the requests not completed once it is done fail with interr.ErrIgnored,
+// and the state of their entry tells whether they were never sent or in flight, see RequestState.
+// The requests separated by a barrier are executed in phases: a phase starts only
+// if all the requests of the previous phase succeeded, otherwise its requests fail
+// with interr.ErrBarrierNotPassed.
+// The dependent requests are started once the requests they depend on completed.
+// With sub-batching enabled, the requests are executed in sub-batches.
+// With a retry budget, the retries of all the requests share the same budget.
+// The result holds an entry per request, in the order the requests were added.
+func (b *BulkHTTPClient) Send(ctx context.Context, bulkRequest *BulkRequest) BulkResult {
+	return b.run(ctx, bulkRequest, time.Time{})
 }
 
-// newWorkerChannels returns a new instance of workerChannels.
-func newWorkerChannels() workerChannels {
-	return workerChannels{
-		requestList:        make(chan requestData),
-		receivedResponses:  make(chan requestFlow),
-		processedResponses: make(chan requestFlow),
-		collectResponses:   make(chan []requestFlow),
-	}
+// SendWithDeadline executes all the requests like Send, but stops at the given deadline.
+// The requests not completed by then fail with interr.ErrBulkDeadlineExceeded, the other results are returned as is.
+// The cancellation of the given context still fails the requests with interr.ErrIgnored.
+func (b *BulkHTTPClient) SendWithDeadline(ctx context.Context, bulkRequest *BulkRequest, deadline time.Time) BulkResult {
+	return b.run(ctx, bulkRequest, deadline)
 }
 
-// Do executes all the requests and tracks the behaviour in the workerChannels.
-// It adds the context to each request before starting the process.
-// The context is useful to handle cancellation
+// Do executes all the requests like Send with the client's context and returns the responses and the errors
+// at the index of their request. interr.NewBulkError gathers the errors in a single one.
+//
+// Deprecated: use Send, whose entries can't get out of step.
 func (b *BulkHTTPClient) Do(bulkRequest *BulkRequest) ([]*http.Response, []error) {
+	result := b.Send(b.ctx, bulkRequest)
+	return result.Responses(), result.Errors()
+}
+
+// DoWithDeadline executes all the requests like SendWithDeadline with the client's context and returns the responses
+// and the errors at the index of their request.
+//
+// Deprecated: use SendWithDeadline, whose entries can't get out of step.
+func (b *BulkHTTPClient) DoWithDeadline(bulkRequest *BulkRequest, deadline time.Time) ([]*http.Response, []error) {
+	result := b.SendWithDeadline(b.ctx, bulkRequest, deadline)
+	return result.Responses(), result.Errors()
+}
+
+// run executes all the requests with the given context, until the given deadline unless it is zero, and gathers their result.
+// The latency, the attempts and the timestamps of each request are collected through the bulk request's onResult function,
+// which also invokes the hooks, if any, as soon as each request completes. The hooks of the requests
+// that were never processed are invoked at the end. The requests ignored because of the deadline fail
+// with interr.ErrBulkDeadlineExceeded before the hooks are invoked, so that they see the errors of the result.
+func (b *BulkHTTPClient) run(parent context.Context, bulkRequest *BulkRequest, deadline time.Time) BulkResult {
+	result := BulkResult{successCodes: b.successCodes}
+	if len(bulkRequest.requests) == 0 {
+		result.Err = interr.ErrRequestsNotFound
+		return result
+	}
+
+	ctx := parent
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(parent, deadline)
+		defer cancel()
+	}
+	expire := func(err error) error {
+		if err == interr.ErrIgnored && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+			return interr.ErrBulkDeadlineExceeded
+		}
+		return err
+	}
+
+	result.Entries = make([]Result, len(bulkRequest.requests))
+	reported := make([]bool, len(bulkRequest.requests))
+	failFast, bulkCtx := b.failFast.newFailFast(ctx, len(bulkRequest.requests))
+	defer failFast.release()
+	onResult := bulkRequest.onResult
+	bulkRequest.onResult = func(flow requestFlow) {
+		flow.err = expire(flow.err)
+		result.Entries[flow.index] = flow.result(bulkRequest.requests[flow.index])
+		reported[flow.index] = true
+		failFast.record(flow.response, flow.err, b.successCodes)
+		b.hooks.complete(result.Entries[flow.index], b.successCodes)
+		if onResult != nil {
+			onResult(flow)
+		}
+	}
+	defer func() {
+		bulkRequest.onResult = onResult
+	}()
+
+	responses, errs := b.do(bulkCtx, bulkRequest)
+	for i, err := range errs {
+		errs[i] = expire(err)
+	}
+	if failFast.isAborted() && ctx.Err() == nil {
+		for i, err := range errs {
+			if err == interr.ErrIgnored || errors.Is(err, context.Canceled) {
+				errs[i] = interr.ErrAborted
+			}
+		}
+	}
+	if b.batchHeaders {
+		result.BatchID = bulkRequest.batchID
+	}
+	for i := range result.Entries {
+		result.Entries[i].Index = i
+		result.Entries[i].Request = bulkRequest.requests[i]
+		result.Entries[i].Response = responses[i]
+		result.Entries[i].Err = errs[i]
+		if i < len(bulkRequest.states) {
+			result.Entries[i].State = bulkRequest.states[i]
+		}
+		if !reported[i] {
+			b.hooks.complete(result.Entries[i], b.successCodes)
+		}
+	}
+
+	return result
+}
+
+// do executes all the requests with the given context, see Send.
+func (b *BulkHTTPClient) do(ctx context.Context, bulkRequest *BulkRequest) ([]*http.Response, []error) {
 	requestsCount := len(bulkRequest.requests)
 	if requestsCount == 0 {
 		return nil, []error{interr.ErrRequestsNotFound}
 	}
+	bulkRequest.ctx = ctx
+	b.stampBatchHeaders(bulkRequest)
+	bulkRequest.retryBudget = b.retryBudget.newBudget(requestsCount)
+	bulkRequest.gap = bulkRequest.paceGap()
+
+	phases := bulkRequest.phases()
+	if len(phases) == 1 && len(bulkRequest.dependencies) == 0 && b.subBatching == nil {
+		return b.doPhase(bulkRequest)
+	}
 
 	bulkRequest.responses = make([]*http.Response, requestsCount)
 	bulkRequest.errors = make([]error, requestsCount)
+	bulkRequest.states = make([]RequestState, requestsCount)
+	done := make([]bool, requestsCount)
+
+	passed := true
+	for _, phase := range phases {
+		if ctx.Err() != nil {
+			for i := range phase.requests {
+				bulkRequest.errors[phase.offset+i] = interr.ErrIgnored
+			}
+			continue
+		}
+		if !passed {
+			for i := range phase.requests {
+				bulkRequest.errors[phase.offset+i] = interr.ErrBarrierNotPassed
+			}
+			continue
+		}
 
-	workerChannels := newWorkerChannels()
-
-	stopProcessing := make(chan struct{})
-	defer close(stopProcessing)
-
-	for index, req := range bulkRequest.requests {
-		bulkRequest.requests[index] = req.WithContext(b.ctx)
+		b.doGraph(bulkRequest, phase, done)
+		for i := range phase.requests {
+			index := phase.offset + i
+			passed = passed && b.succeeded(bulkRequest.responses[index], bulkRequest.errors[index])
+		}
 	}
 
-	go b.collectProcessedResponses(
-		b.ctx,
-		bulkRequest,
-		workerChannels.processedResponses,
-		workerChannels.collectResponses,
-	)
-
-	go b.orchestrateProcesses(
-		b.ctx,
-		bulkRequest,
-		&workerChannels,
-		stopProcessing,
-	)
-
-	b.completionListener(bulkRequest, workerChannels.collectResponses)
-
 	return bulkRequest.responses, bulkRequest.errors
 }
 
-// completionListener listens for completed responses and updates the original request at the given index.
-func (b *BulkHTTPClient) completionListener(bulkRequest *BulkRequest, collectResponses chan []requestFlow) {
-	responses := <-collectResponses
-	for _, resParcel := range responses {
-		if resParcel.err != nil {
-			bulkRequest.replaceErrorAtIndex(resParcel.err, resParcel.index)
-		} else {
-			bulkRequest.replaceResponseAtIndex(resParcel.response, resParcel.index)
-		}
+// doPhase executes all the requests of the given bulk request concurrently:
+// a pool of dispatch workers sends the requests and passes the responses to a pool of processor workers reading them.
+// Each result is passed to the bulk request's onResult function, if any, as soon as it is processed.
+// The requests not completed once the context is done fail with interr.ErrIgnored: the ones started by a dispatch worker
+// are in flight, the other ones not started.
+func (b *BulkHTTPClient) doPhase(bulkRequest *BulkRequest) ([]*http.Response, []error) {
+	requestsCount := len(bulkRequest.requests)
+	bulkRequest.responses = make([]*http.Response, requestsCount)
+	bulkRequest.errors = make([]error, requestsCount)
+	bulkRequest.states = make([]RequestState, requestsCount)
+	started := make([]int32, requestsCount)
+
+	bulkRequest.publishOrder = bulkRequest.fairOrder(allIndexes(requestsCount))
+	for index, req := range bulkRequest.requests {
+		bulkRequest.requests[index] = req.WithContext(withRequestValues(bulkRequest.ctx, req))
 	}
 
-	close(collectResponses)
-	bulkRequest.addRequestIgnoredErrors()
-}
+	// A single pool of dispatch workers sends the requests and processes their responses,
+	// at most responseProcessorWorkers responses at a time. With a response buffer, the pool has extra workers
+	// waiting for a processor while the dispatch slots send the next requests, see WithResponseBuffer.
+	processors := bulkRequest.responseProcessorWorkers
+	if processors < 1 {
+		processors = 1
+	}
+	processing := make(chan struct{}, processors)
+	dispatching, poolWorkers := b.dispatchSlots(b.dispatchWorkers(bulkRequest))
+	work := func(ctx context.Context, reqParcel requestData) *requestFlow {
+		if !acquireSlot(ctx, dispatching) {
+			return nil
+		}
+		if ctx.Err() == nil {
+			atomic.StoreInt32(&started[reqParcel.index], 1)
+		}
+		flow := b.performRequests(reqParcel)
+		releaseSlot(dispatching)
 
-// collectProcessedResponses collects the processed responses by sending them to the final collectResponses channel.
-// The collection process stops as soon as the context gets cancelled.
-func (b *BulkHTTPClient) collectProcessedResponses(
-	ctx context.Context,
-	bulkRequest *BulkRequest,
-	processedResponses <-chan requestFlow,
-	collectResponses chan<- []requestFlow,
-) {
-	var responseList []requestFlow
-LOOP:
-	for done := 0; done < len(bulkRequest.requests); {
+		if ctx.Err() != nil {
+			discardFlow(flow)
+			return nil
+		}
 		select {
+		case processing <- struct{}{}:
 		case <-ctx.Done():
-			break LOOP
-
-		case resParcel, isOpen := <-processedResponses:
-			if isOpen {
-				responseList = append(responseList, resParcel)
-				done++
-			} else {
-				break LOOP
-			}
+			discardFlow(flow)
+			return nil
 		}
+		defer func() {
+			<-processing
+		}()
 
+		flow = b.processRequest(ctx, flow)
+		return &flow
+	}
+	workers := pool.New(bulkRequest.ctx, poolWorkers, work).
+		OnDiscard(func(flow *requestFlow) {
+			if flow != nil {
+				discardFlow(*flow)
+			}
+		})
+	if bulkRequest.onResult != nil {
+		workers.OnResult(func(_ int, flow *requestFlow) {
+			if flow != nil {
+				bulkRequest.onResult(*flow)
+			}
+		})
 	}
 
-	collectResponses <- responseList
-}
+	bulkRequest.publishAllRequests(workers)
+	for _, result := range workers.Wait() {
+		if !result.Done || result.Value == nil {
+			continue
+		}
+		flow := *result.Value
+		bulkRequest.states[flow.index] = flow.state()
+		if flow.err != nil && flow.response != nil {
+			bulkRequest.replaceResultAtIndex(flow.response, flow.err, flow.index)
+		} else if flow.err != nil {
+			bulkRequest.replaceErrorAtIndex(flow.err, flow.index)
+		} else {
+			bulkRequest.replaceResponseAtIndex(flow.response, flow.index)
+		}
+	}
+	for index := range bulkRequest.states {
+		collected := bulkRequest.responses[index] != nil || bulkRequest.errors[index] != nil
+		if !collected && atomic.LoadInt32(&started[index]) == 1 {
+			bulkRequest.states[index] = InFlight
+		}
+	}
+	bulkRequest.addRequestIgnoredErrors()
 
-// orchestrateProcesses manages the BulkHTTPClient's' work.
-// It fires and process all the requests and makes sure to wait until the whole process is completed.
-// It leverages a configurable number of workers for each sub-process.
-func (b *BulkHTTPClient) orchestrateProcesses(
-	ctx context.Context,
-	bulkRequest *BulkRequest,
-	workerChannels *workerChannels,
-	stopProcessing chan struct{},
-) {
-	var publishWg, dispatchingWg, processingWg sync.WaitGroup
-
-	publishWg.Add(1)
-	go bulkRequest.publishAllRequests(
-		workerChannels.requestList,
-		stopProcessing,
-		&publishWg,
-	)
-
-	b.dispatchRequestsWorkers(
-		bulkRequest.dispatchRequestsWorkers,
-		workerChannels.requestList,
-		workerChannels.receivedResponses,
-		stopProcessing,
-		&dispatchingWg,
-	)
-
-	b.dispatchRequestProcessorsWorkers(
-		ctx,
-		bulkRequest.responseProcessorWorkers,
-		workerChannels.receivedResponses,
-		workerChannels.processedResponses,
-		stopProcessing,
-		&processingWg,
-	)
-
-	publishWg.Wait()
-	close(workerChannels.requestList)
-
-	dispatchingWg.Wait()
-	close(workerChannels.receivedResponses)
-
-	processingWg.Wait()
-	close(workerChannels.processedResponses)
+	return bulkRequest.responses, bulkRequest.errors
 }
 
-// dispatchRequestsWorkers dispatches a new worker for each bulk request.
-// The max number of workers is specified in the client configuration.
-func (b *BulkHTTPClient) dispatchRequestsWorkers(
-	dispatchRequestsWorkers int,
-	requestList <-chan requestData,
-	receiveResponses chan<- requestFlow,
-	stopProcessing <-chan struct{},
-	dispatchingWg *sync.WaitGroup,
-) {
-
-	for nWorker := 0; nWorker < dispatchRequestsWorkers; nWorker++ {
-		dispatchingWg.Add(1)
-		go b.fireRequests(requestList, receiveResponses, stopProcessing, dispatchingWg)
+// discardFlow drains and closes the response body of a result which is not collected.
+func discardFlow(flow requestFlow) {
+	if flow.response != nil {
+		_, _ = io.Copy(ioutil.Discard, flow.response.Body)
+		_ = flow.response.Body.Close()
 	}
-
 }
 
-// dispatchRequestProcessorsWorkers dispatches a new worker to process each bulk request.
-// The max number of workers is specified in the client configuration.
-func (b *BulkHTTPClient) dispatchRequestProcessorsWorkers(
-	ctx context.Context,
-	responseProcessorWorkers int,
-	receiveResponses <-chan requestFlow,
-	processedResponses chan<- requestFlow,
-	stopProcessing <-chan struct{},
-	processingWg *sync.WaitGroup,
-) {
-
-	for mWorker := 0; mWorker < responseProcessorWorkers; mWorker++ {
-		processingWg.Add(1)
-		go b.processRequests(ctx, receiveResponses, processedResponses, stopProcessing, processingWg)
+// performRequests executes the given bulk request and returns a new requestFlow.
+// The 103 Early Hints received for the request are collected, see EarlyHints.
+// The deadline of the request, if any, lasts until its response body is closed.
+func (b *BulkHTTPClient) performRequests(reqParcel requestData) requestFlow {
+	req, cancel := b.withDeadline(traceEarlyHints(reqParcel.request), reqParcel.timeout)
+	reqParcel.request = req
+
+	start := time.Now()
+	flow := b.sendRequest(reqParcel)
+	flow.latency = time.Since(start)
+	flow.queuedAt, flow.startedAt = reqParcel.queuedAt, start
+	flow.failOnStatus = reqParcel.failOnStatus
+	if flow.response != nil {
+		flow.response.Body = cancelOnClose{ReadCloser: flow.response.Body, cancel: cancel}
+	} else {
+		cancel()
 	}
 
+	return flow
 }
 
-// fireRequests executes all the requests and accumulate the results in the receivedResponses channel.
-// The process stops as soon as it receives a stop signal.
-func (b *BulkHTTPClient) fireRequests(
-	reqList <-chan requestData,
-	receivedResponses chan<- requestFlow,
-	stopProcessing <-chan struct{},
-	fireWg *sync.WaitGroup,
-) {
-
-LOOP:
-	for reqParcel := range reqList {
-		result := b.performRequests(reqParcel)
-		select {
-		case receivedResponses <- result:
-		case <-stopProcessing:
-			if result.response != nil {
-				_, _ = io.Copy(ioutil.Discard, result.response.Body)
-				_ = result.response.Body.Close()
-			}
-			break LOOP
+// sendRequest sends the request of the given requestData.
+// The request waits for the memory guard and the rate limit, if any, before being sent,
+// is hedged if enabled and is retried according to the retry policy, if any.
+// It is not sent once expired, see RequestExpiry.
+func (b *BulkHTTPClient) sendRequest(reqParcel requestData) requestFlow {
+	if expired(reqParcel.expiresAt) {
+		return requestFlow{request: reqParcel.request, err: interr.ErrExpired, index: reqParcel.index}
+	}
+
+	if b.retryPolicy != nil || b.hedgeDelay > 0 {
+		var maxBytes int64
+		if b.memory != nil {
+			maxBytes = b.memory.limit
 		}
+		req, err := replayable(reqParcel.request, maxBytes)
+		if err != nil {
+			return requestFlow{request: reqParcel.request, err: err, index: reqParcel.index}
+		}
+		reqParcel.request = req
 	}
 
-	fireWg.Done()
-}
+	if b.memory != nil {
+		size := reqParcel.request.ContentLength
+		if size < 0 {
+			size = 0
+		}
+		if err := b.memory.acquire(reqParcel.request.Context(), size); err != nil {
+			return requestFlow{request: reqParcel.request, err: err, index: reqParcel.index}
+		}
+		defer b.memory.release(size)
+	}
 
-// performRequests executes the given bulk request and returns a new requestFlow.
-func (b *BulkHTTPClient) performRequests(reqParcel requestData) requestFlow {
-	resp, err := b.HTTPClient.Do(reqParcel.request)
+	var resp *http.Response
+	var err error
+	attempts := 1
+	if b.retryPolicy != nil {
+		resp, attempts, err = b.doWithRetry(reqParcel.request, reqParcel.budget, reqParcel.expiresAt)
+	} else {
+		resp, err = b.attempt(reqParcel.request)
+	}
 
 	return requestFlow{
 		request:  reqParcel.request,
 		response: resp,
 		err:      err,
 		index:    reqParcel.index,
+		attempts: attempts,
 	}
 }
 
-// processRequests process all the requests in the request list channel.
-// The process stops as soon as it receives a stop signal.
-func (b *BulkHTTPClient) processRequests(
-	ctx context.Context,
-	resList <-chan requestFlow,
-	processedResponses chan<- requestFlow,
-	stopProcessing <-chan struct{},
-	processWg *sync.WaitGroup,
-) {
-
-LOOP:
-	for resParcel := range resList {
-		result := b.parseResponse(ctx, resParcel)
-
-		select {
-		case processedResponses <- result:
-		case <-stopProcessing:
-			break LOOP
-		}
+// processRequest reads the response of the given requestFlow and follows its asynchronous acknowledgement, if any.
+func (b *BulkHTTPClient) processRequest(ctx context.Context, resParcel requestFlow) requestFlow {
+	result := b.parseResponse(ctx, resParcel)
+	if b.asyncPolling != nil {
+		result = b.followAsyncAck(ctx, result)
 	}
+	if err := b.statusError(result, resParcel.failOnStatus); err != nil {
+		result.err = err
+	}
+	if err := b.headerError(result); err != nil {
+		result.err = err
+	}
+	result.latency, result.attempts = resParcel.latency, resParcel.attempts
+	result.err = withAttempts(result.err, result.attempts)
+	result.queuedAt, result.startedAt, result.finishedAt = resParcel.queuedAt, resParcel.startedAt, time.Now()
 
-	processWg.Done()
+	return result
 }
 
-// parseResponse attempts to read the request parts such as body, header and status code.
+// parseResponse attempts to read the request parts such as body, header, trailer and status code.
 // It returns a Response object with a new Request object (without a timeout).
 // It closes the original response to prevent the reading from a cancelled request.
 func (b *BulkHTTPClient) parseResponse(ctx context.Context, res requestFlow) requestFlow {
@@ -310,27 +471,33 @@ func (b *BulkHTTPClient) parseResponse(ctx context.Context, res requestFlow) req
 		return requestFlow{err: interr.ErrIgnored, index: res.index}
 	}
 
+	if res.err == interr.ErrMemoryLimitExceeded || res.err == interr.ErrRetryBudgetExhausted || res.err == interr.ErrExpired {
+		return requestFlow{err: res.err, index: res.index}
+	}
+
 	if res.err != nil {
-		return requestFlow{err: fmt.Errorf("http client error: %s", res.err), index: res.index}
+		return requestFlow{err: clientError(res.index, res.request, res.err), index: res.index}
 	}
 
 	if res.response == nil {
 		return requestFlow{err: errors.New("no response received"), index: res.index}
 	}
 
-	bs, err := ioutil.ReadAll(res.response.Body)
+	body, err := b.responseBody(res.request, res.response)
 	if err != nil {
-		return requestFlow{err: fmt.Errorf("error while reading response body: %s", err), index: res.index}
+		return requestFlow{err: err, index: res.index}
 	}
 
-	body := ioutil.NopCloser(bytes.NewReader(bs))
-
 	newResponse := http.Response{
 		Body:       body,
 		StatusCode: res.response.StatusCode,
 		Status:     res.response.Status,
 		Header:     res.response.Header,
-		Request:    res.request.WithContext(context.Background()),
+		Trailer:    res.response.Trailer,
+		Proto:      res.response.Proto,
+		ProtoMajor: res.response.ProtoMajor,
+		ProtoMinor: res.response.ProtoMinor,
+		Request:    res.request.WithContext(detached.Context(res.request.Context())),
 	}
 
 	result := requestFlow{
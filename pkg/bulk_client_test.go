@@ -2,7 +2,9 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/pigeonlab/notifier/interr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
@@ -10,6 +12,8 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -109,11 +113,15 @@ func TestFailureDueToClientTimeout(t *testing.T) {
 	bulkRequest := NewBulkRequest([]*http.Request{reqOne, reqTwo}, 10, 10)
 	responses, errs := client.Do(bulkRequest)
 
-	expectedClientTimeoutError := fmt.Errorf("http client error: Get \"%s?kind=slow\": context deadline exceeded (Client.Timeout exceeded while awaiting headers)", server.URL)
+	expectedClientTimeoutError := fmt.Sprintf("http client error: Get \"%s?kind=slow\": context deadline exceeded (Client.Timeout exceeded while awaiting headers)", server.URL)
 
 	assert.Equal(t, []*http.Response{nil, nil}, responses)
-	for _, e := range errs {
-		assert.Equal(t, expectedClientTimeoutError, e)
+	for i, e := range errs {
+		assert.EqualError(t, e, expectedClientTimeoutError)
+		var timeoutErr *interr.TimeoutError
+		require.True(t, errors.As(e, &timeoutErr), "timeout error")
+		assert.Equal(t, i, timeoutErr.Index)
+		assert.Equal(t, server.URL+"?kind=slow", timeoutErr.URL)
 	}
 
 	bulkRequest.CloseAllResponses()
@@ -231,6 +239,91 @@ func TestBulkClientRequestFirerAndProcessorGoroutinesAreClosed(t *testing.T) {
 	assert.True(t, isLessThan50(runtime.NumGoroutine()))
 }
 
+func TestBarrierStartsRequestsAfterThePreviousPhaseCompleted(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		kind := req.URL.Query().Get("kind")
+		if kind == "slow" {
+			time.Sleep(ServerSleepingTime)
+		}
+
+		mu.Lock()
+		arrivals = append(arrivals, kind)
+		mu.Unlock()
+		_, _ = w.Write([]byte(kind))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Timeout: TimeoutBiggerThanServerTime})
+
+	queryFast := url.Values{}
+	queryFast.Set("kind", "fast")
+
+	querySlow := url.Values{}
+	querySlow.Set("kind", "slow")
+
+	reqOne, err := http.NewRequest(http.MethodGet, encodeURL(server.URL, "", querySlow), nil)
+	require.NoError(t, err, "no errors")
+
+	reqTwo, err := http.NewRequest(http.MethodGet, encodeURL(server.URL, "", queryFast), nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{reqOne}, 10, 10).Barrier().AddRequest(reqTwo)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, 2, len(responses))
+	assert.Equal(t, []string{"slow", "fast"}, arrivals)
+}
+
+func TestBarrierSkipsRequestsWhenThePreviousPhaseFailed(t *testing.T) {
+	server := StartMockServer()
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Timeout: TimeoutBiggerThanServerTime})
+
+	queryFast := url.Values{}
+	queryFast.Set("kind", "fast")
+
+	reqOne, err := http.NewRequest(http.MethodGet, encodeURL(server.URL, "", queryFast), nil)
+	require.NoError(t, err, "no errors")
+
+	reqTwo, err := http.NewRequest(http.MethodGet, encodeURL(server.URL, "", url.Values{}), nil) // service unavailable
+	require.NoError(t, err, "no errors")
+
+	reqThree, err := http.NewRequest(http.MethodGet, encodeURL(server.URL, "", queryFast), nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{reqOne, reqTwo}, 10, 10).Barrier().AddRequest(reqThree)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, http.StatusOK, responses[0].StatusCode)
+	assert.Equal(t, http.StatusServiceUnavailable, responses[1].StatusCode)
+	assert.Nil(t, responses[2])
+	assert.Equal(t, interr.ErrBarrierNotPassed, errs[2])
+}
+
+func TestTheLaterPhasesAreIgnoredOnceTheDeadlineIsExceeded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	first, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+	second, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{first}, 1, 1).Barrier().AddRequest(second)
+	result := client.SendWithDeadline(context.Background(), bulkRequest, time.Now().Add(50*time.Millisecond))
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, []error{interr.ErrBulkDeadlineExceeded, interr.ErrBulkDeadlineExceeded}, result.Errors())
+	assert.Equal(t, FailureTimeout, ClassifyError(result.Entries[1].Err))
+}
+
 func newClientWithNRequests(n int, serverURL string) *BulkRequest {
 	var requests []*http.Request
 	for i := 0; i < n; i++ {
@@ -266,3 +359,117 @@ func newServerHandler(w http.ResponseWriter, req *http.Request) {
 func encodeURL(baseURL string, endpoint string, queryParams url.Values) string {
 	return fmt.Sprintf("%s%s?%s", baseURL, endpoint, queryParams.Encode())
 }
+
+func TestDoWithDeadlineReturnsThePartialResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			time.Sleep(time.Second)
+		}
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{})
+
+	fast, err := http.NewRequest(http.MethodGet, server.URL+"/fast", nil)
+	require.NoError(t, err, "no errors")
+
+	slow, err := http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{fast, slow}, 2, 2)
+	start := time.Now()
+	responses, errs := client.DoWithDeadline(bulkRequest, time.Now().Add(200*time.Millisecond))
+	defer bulkRequest.CloseAllResponses()
+
+	assert.True(t, time.Since(start) < time.Second, "the bulk request lasted %s", time.Since(start))
+	require.Nil(t, errs[0])
+	assert.Equal(t, http.StatusOK, responses[0].StatusCode)
+	assert.Equal(t, interr.ErrBulkDeadlineExceeded, errs[1])
+}
+
+func TestTheHooksSeeTheBulkDeadlineErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer server.Close()
+	var mu sync.Mutex
+	var failures []error
+	client := NewClient(&http.Client{}, WithHooks(Hooks{OnFailure: func(result Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, result.Err)
+	}}))
+
+	bulkRequest := newClientWithNRequests(2, server.URL)
+	bulkRequest.dispatchRequestsWorkers = 1
+	result := client.SendWithDeadline(context.Background(), bulkRequest, time.Now().Add(100*time.Millisecond))
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, []error{interr.ErrBulkDeadlineExceeded, interr.ErrBulkDeadlineExceeded}, result.Errors())
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []error{interr.ErrBulkDeadlineExceeded, interr.ErrBulkDeadlineExceeded}, failures)
+}
+
+func TestSendCancelsOnlyTheBulkRequestOfItsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := newClientWithNRequests(3, server.URL)
+	completed := newClientWithNRequests(3, server.URL)
+	defer cancelled.CloseAllResponses()
+	defer completed.CloseAllResponses()
+
+	var wg sync.WaitGroup
+	var cancelledResult, completedResult BulkResult
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		cancelledResult = client.Send(ctx, cancelled)
+	}()
+	go func() {
+		defer wg.Done()
+		completedResult = client.Send(context.Background(), completed)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Len(t, cancelledResult.Failed(), 3)
+	for _, entry := range cancelledResult.Entries {
+		assert.Equal(t, interr.ErrIgnored, entry.Err)
+	}
+	assert.Len(t, completedResult.Succeeded(), 3)
+}
+
+func BenchmarkSend(b *testing.B) {
+	var peak int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if goroutines := int64(runtime.NumGoroutine()); goroutines > atomic.LoadInt64(&peak) {
+			atomic.StoreInt64(&peak, goroutines)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 20}})
+
+	baseline := int64(runtime.NumGoroutine())
+	start := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bulkRequest := newClientWithNRequests(100, server.URL)
+		bulkRequest.dispatchRequestsWorkers, bulkRequest.responseProcessorWorkers = 20, 20
+		result := client.Send(context.Background(), bulkRequest)
+		bulkRequest.CloseAllResponses()
+		if len(result.Succeeded()) != 100 {
+			b.Fatalf("%d requests of 100 succeeded", len(result.Succeeded()))
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(atomic.LoadInt64(&peak)-baseline), "peak-goroutines")
+	b.ReportMetric(float64(b.N*100)/time.Since(start).Seconds(), "requests/s")
+}
@@ -1,9 +1,11 @@
 package pkg
 
 import (
+	"context"
 	"github.com/pigeonlab/notifier/interr"
+	"github.com/pigeonlab/notifier/pkg/pool"
 	"net/http"
-	"sync"
+	"time"
 )
 
 // Request represents a collection type of http requests.
@@ -13,11 +15,30 @@ type Request interface {
 
 // BulkRequest represents multiple HTTP requests in bulk.
 type BulkRequest struct {
+	ctx                      context.Context
 	requests                 []*http.Request
 	responses                []*http.Response
 	errors                   []error
+	states                   []RequestState
 	responseProcessorWorkers int
 	dispatchRequestsWorkers  int
+	barriers                 []int
+	dependencies             map[int]dependency
+	tenantKey                TenantKey
+	publishOrder             []int
+	retryBudget              *retryBudget
+	options                  map[int]requestOptions
+	onResult                 func(flow requestFlow)
+	pacing                   time.Duration
+	gap                      time.Duration
+	batchID                  string
+}
+
+// bulkPhase represents the requests between two barriers.
+// The offset is the index of the phase's first request in the whole bulk request.
+type bulkPhase struct {
+	*BulkRequest
+	offset int
 }
 
 // NewBulkRequest returns a new BulkRequest instance.
@@ -36,6 +57,18 @@ func (b *BulkRequest) AddRequest(request *http.Request) *BulkRequest {
 	return b
 }
 
+// Barrier separates the requests added so far from the ones added afterwards.
+// The requests added after the barrier are started only when all the requests
+// added before it have completed successfully, i.e. without errors and with a 2xx status code.
+func (b *BulkRequest) Barrier() *BulkRequest {
+	position := len(b.requests)
+	if position > 0 && (len(b.barriers) == 0 || b.barriers[len(b.barriers)-1] != position) {
+		b.barriers = append(b.barriers, position)
+	}
+
+	return b
+}
+
 // CloseAllResponses closes all the requests' response bodies.
 func (b *BulkRequest) CloseAllResponses() {
 	for _, response := range b.responses {
@@ -45,29 +78,31 @@ func (b *BulkRequest) CloseAllResponses() {
 	}
 }
 
-// publishAllRequests publishes all the requests to the requestList channel.
+// publishAllRequests submits all the requests to the given pool of dispatch workers, in the publish order.
 // It is used by the HTTP client when it starts to process the requests.
-// It stops as soon as a stop signal is received.
-func (b *BulkRequest) publishAllRequests(
-	requestList chan<- requestData,
-	stopProcessing <-chan struct{},
-	publishWg *sync.WaitGroup,
-) {
-LOOP:
-	for index := range b.requests {
+// It stops as soon as the pool refuses a request, i.e. once the context is done.
+// The paced requests are submitted one after the other at the pace of the bulk request.
+func (b *BulkRequest) publishAllRequests(dispatching *pool.Bulk[requestData, *requestFlow]) {
+	start := time.Now()
+	for position, index := range b.publishOrder {
+		if !b.waitTurn(start, position) {
+			return
+		}
+
 		reqParcel := requestData{
-			request: b.requests[index],
-			index:   index,
+			request:      b.requests[index],
+			index:        index,
+			budget:       b.retryBudget,
+			timeout:      b.options[index].timeout,
+			expiresAt:    b.options[index].expiresAt,
+			failOnStatus: b.options[index].failOnStatus,
+			queuedAt:     time.Now(),
 		}
 
-		select {
-		case requestList <- reqParcel:
-		case <-stopProcessing:
-			break LOOP
+		if !dispatching.Submit(reqParcel) {
+			return
 		}
 	}
-
-	publishWg.Done()
 }
 
 // addRequestIgnoredErrors marks the responses' errors as ignored.
@@ -92,3 +127,37 @@ func (b *BulkRequest) replaceErrorAtIndex(err error, index int) *BulkRequest {
 	b.responses[index] = nil
 	return b
 }
+
+// replaceResultAtIndex replaces both the response and the error at the given index,
+// e.g. for a response failed by WithStatusErrors.
+func (b *BulkRequest) replaceResultAtIndex(response *http.Response, err error, index int) *BulkRequest {
+	b.responses[index] = response
+	b.errors[index] = err
+	return b
+}
+
+// phases splits the requests at the barriers.
+func (b *BulkRequest) phases() []bulkPhase {
+	var phases []bulkPhase
+	start := 0
+	ends := append(append([]int{}, b.barriers...), len(b.requests))
+	for _, end := range ends {
+		if end <= start || end > len(b.requests) {
+			continue
+		}
+
+		phases = append(phases, bulkPhase{
+			BulkRequest: &BulkRequest{
+				requests:                 b.requests[start:end],
+				dispatchRequestsWorkers:  b.dispatchRequestsWorkers,
+				responseProcessorWorkers: b.responseProcessorWorkers,
+				retryBudget:              b.retryBudget,
+				gap:                      b.gap,
+			},
+			offset: start,
+		})
+		start = end
+	}
+
+	return phases
+}
@@ -0,0 +1,133 @@
+package pkg
+
+import (
+	"github.com/pigeonlab/notifier/interr"
+	"net/http"
+	"time"
+)
+
+// Result is the result of a single request of a bulk request.
+// The index is the position of the request in the bulk request. The request of a dependent request never built,
+// e.g. because a request it depends on failed, is a placeholder: a GET request without URL.
+// The latency is the time spent sending the request, retries included, and the attempts
+// the amount of times it was sent. Both are zero for the requests that were never sent.
+// QueuedAt is when the request was ready to be sent, StartedAt when a dispatch worker started sending it
+// and FinishedAt when its response was processed: the time between QueuedAt and StartedAt is the queueing delay,
+// the one between StartedAt and FinishedAt the service time. They are zero for the requests that were never sent.
+// The state tells whether the request was never sent, was in flight when the context was done, or completed.
+// The protocol is the one negotiated with the target for the response, e.g. HTTP/1.1 or HTTP/2.0,
+// and is empty without response.
+type Result struct {
+	Index      int
+	Request    *http.Request
+	Response   *http.Response
+	Err        error
+	Latency    time.Duration
+	Attempts   int
+	QueuedAt   time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	State      RequestState
+	Protocol   string
+}
+
+// result returns the Result of the given request from its flow.
+func (flow requestFlow) result(request *http.Request) Result {
+	return Result{
+		Index:      flow.index,
+		Request:    request,
+		Response:   flow.response,
+		Err:        flow.err,
+		Latency:    flow.latency,
+		Attempts:   flow.attempts,
+		QueuedAt:   flow.queuedAt,
+		StartedAt:  flow.startedAt,
+		FinishedAt: flow.finishedAt,
+		State:      flow.state(),
+		Protocol:   flow.protocol(),
+	}
+}
+
+// protocol returns the protocol of the response of the flow, if any.
+func (flow requestFlow) protocol() string {
+	if flow.response == nil {
+		return ""
+	}
+
+	return flow.response.Proto
+}
+
+// BulkResult is the result of a bulk request, with an entry per request in the order they were added.
+// Err is set when the bulk request couldn't be executed at all, e.g. interr.ErrRequestsNotFound.
+// BatchID is the ID of the bulk request stamped on its requests by WithBatchHeaders, empty without them.
+type BulkResult struct {
+	Entries      []Result
+	Err          error
+	BatchID      string
+	successCodes map[int]bool
+}
+
+// Succeeded returns the entries completed without errors and with a successful status code,
+// including the ones configured with WithSuccessStatuses.
+func (r BulkResult) Succeeded() []Result {
+	var entries []Result
+	for _, entry := range r.Entries {
+		if IsSuccess(entry.Response, entry.Err, r.successCodes) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// Failed returns the entries completed with an error or without a successful status code.
+func (r BulkResult) Failed() []Result {
+	var entries []Result
+	for _, entry := range r.Entries {
+		if !IsSuccess(entry.Response, entry.Err, r.successCodes) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// Responses returns the responses at the index of their request.
+func (r BulkResult) Responses() []*http.Response {
+	if len(r.Entries) == 0 {
+		return nil
+	}
+
+	responses := make([]*http.Response, len(r.Entries))
+	for i, entry := range r.Entries {
+		responses[i] = entry.Response
+	}
+
+	return responses
+}
+
+// Errors returns the errors at the index of their request.
+// It returns the error of the bulk request alone when it couldn't be executed at all.
+func (r BulkResult) Errors() []error {
+	if r.Err != nil {
+		return []error{r.Err}
+	}
+
+	errs := make([]error, len(r.Entries))
+	for i, entry := range r.Entries {
+		errs[i] = entry.Err
+	}
+
+	return errs
+}
+
+// AsError returns the errors of the requests as a single *interr.BulkError, or nil when no request failed
+// with an error. It returns the error of the bulk request alone when it couldn't be executed at all.
+// The unsuccessful status codes are failures only with WithStatusErrors.
+func (r BulkResult) AsError() error {
+	if r.Err != nil {
+		return r.Err
+	}
+
+	return interr.NewBulkError(r.Errors())
+}
@@ -0,0 +1,142 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendReturnsAnEntryPerRequest(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/flaky":
+			if atomic.AddInt32(&attempts, 1) < 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithRetry(3, time.Millisecond, 0))
+
+	flaky, err := http.NewRequest(http.MethodGet, server.URL+"/flaky", nil)
+	require.NoError(t, err, "no errors")
+
+	missing, err := http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{flaky, missing}, 2, 2)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, result.Err)
+	require.Len(t, result.Entries, 2)
+	for i, entry := range result.Entries {
+		assert.Equal(t, i, entry.Index)
+		assert.Nil(t, entry.Err)
+		assert.True(t, entry.Latency > 0)
+	}
+	assert.Equal(t, "/flaky", result.Entries[0].Request.URL.Path)
+	assert.Equal(t, 2, result.Entries[0].Attempts)
+	assert.Equal(t, "/missing", result.Entries[1].Request.URL.Path)
+	assert.Equal(t, 1, result.Entries[1].Attempts)
+
+	require.Len(t, result.Succeeded(), 1)
+	assert.Equal(t, 0, result.Succeeded()[0].Index)
+	require.Len(t, result.Failed(), 1)
+	assert.Equal(t, http.StatusNotFound, result.Failed()[0].Response.StatusCode)
+}
+
+func TestBulkResultHonorsTheSuccessCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithSuccessStatuses(http.StatusNotFound))
+
+	bulkRequest := newClientWithNRequests(3, server.URL)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Len(t, result.Succeeded(), 3)
+	assert.Empty(t, result.Failed())
+}
+
+func TestDoMatchesTheEntriesOfSend(t *testing.T) {
+	server := StartMockServer()
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{})
+
+	bulkRequest := newClientWithNRequests(5, server.URL)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, responses, 5)
+	require.Len(t, errs, 5)
+	for i := range responses {
+		assert.Nil(t, errs[i])
+		assert.Equal(t, http.StatusServiceUnavailable, responses[i].StatusCode)
+	}
+
+	responses, errs = client.Do(NewBulkRequest(nil, 1, 1))
+	assert.Nil(t, responses)
+	assert.Equal(t, []error{interr.ErrRequestsNotFound}, errs)
+	assert.Equal(t, interr.ErrRequestsNotFound, client.Send(context.Background(), NewBulkRequest(nil, 1, 1)).Err)
+}
+
+func TestTheEntriesTrackTheQueueingDelayAndTheServiceTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	var requests []*http.Request
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	// A single dispatch worker: the second request waits for the first one.
+	bulkRequest := NewBulkRequest(requests, 1, 1)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Succeeded(), 2)
+	for _, entry := range result.Entries {
+		assert.False(t, entry.QueuedAt.IsZero())
+		assert.False(t, entry.StartedAt.Before(entry.QueuedAt))
+		assert.True(t, entry.FinishedAt.Sub(entry.StartedAt) >= 50*time.Millisecond)
+	}
+
+	first, second := result.Entries[0], result.Entries[1]
+	if second.StartedAt.Before(first.StartedAt) {
+		first, second = second, first
+	}
+	assert.True(t, second.StartedAt.Sub(second.QueuedAt) >= 40*time.Millisecond, "the second request was queued for %s", second.StartedAt.Sub(second.QueuedAt))
+	assert.True(t, first.StartedAt.Sub(first.QueuedAt) < 40*time.Millisecond)
+}
+
+func TestTheEntriesOfTheRequestsNeverSentHaveNoTimestamps(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	require.NoError(t, err, "no errors")
+
+	result := NewClient(&http.Client{}).Send(ctx, NewBulkRequest([]*http.Request{req}, 1, 1))
+
+	require.Len(t, result.Entries, 1)
+	assert.Equal(t, interr.ErrIgnored, result.Entries[0].Err)
+	assert.True(t, result.Entries[0].QueuedAt.IsZero())
+	assert.True(t, result.Entries[0].StartedAt.IsZero())
+	assert.True(t, result.Entries[0].FinishedAt.IsZero())
+}
@@ -0,0 +1,343 @@
+package pkg
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseCache is an in-memory cache of the responses to the GET requests, e.g. the status polls.
+// It honors the Cache-Control and Expires freshness of the responses and revalidates the stale ones
+// with their ETag or Last-Modified header. The least recently used entries are evicted first.
+// The entries are keyed by their URL and the values of the request headers named by the Vary header of their response.
+type responseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	recent     *list.List
+	urls       map[string]*cachedURL
+}
+
+// cachedURL holds the Vary header names of the last response cached for a URL, and its amount of entries.
+type cachedURL struct {
+	vary    []string
+	entries int
+}
+
+// maxCachedBodySize is the maximum size of a cached response body, unless the maximum response size is lower.
+const maxCachedBodySize = 1 << 20
+
+// cacheableStatusCodes are the status codes of the responses that can be cached by default, see RFC 9110.
+var cacheableStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	key        string
+	url        string
+	vary       []string
+	statusCode int
+	status     string
+	header     http.Header
+	body       []byte
+	expires    time.Time
+}
+
+// WithResponseCache makes the client cache the responses to the GET requests, up to maxEntries responses,
+// so that the requests to the same URLs during large bulk requests, e.g. to the same status endpoints,
+// don't reach the targets while the cached responses are fresh according to their Cache-Control or Expires
+// header. The stale responses with an ETag or a Last-Modified header are revalidated with a conditional request.
+// The responses with Cache-Control no-store or Vary: * are never cached, nor the responses to the requests
+// with an Authorization header unless they are public. The responses varying on request headers are cached
+// per value of these headers. Only the status codes cacheable by default are cached, e.g. 200, 301 or 404.
+// The bodies larger than 1 MiB, or than the maximum response size, see WithMaxResponseSize, are not cached.
+// A maxEntries lower than 1 disables the cache.
+func WithResponseCache(maxEntries int) Option {
+	return func(b *BulkHTTPClient) {
+		if maxEntries < 1 {
+			b.cache = nil
+			return
+		}
+
+		b.cache = &responseCache{
+			maxEntries: maxEntries,
+			entries:    make(map[string]*list.Element),
+			recent:     list.New(),
+			urls:       make(map[string]*cachedURL),
+		}
+	}
+}
+
+// maxCachedBody returns the maximum size of a cached response body: maxCachedBodySize, or the maximum response size
+// when it is lower.
+func (b *BulkHTTPClient) maxCachedBody() int64 {
+	if b.maxResponseSize != nil && b.maxResponseSize.maxBytes < maxCachedBodySize {
+		return b.maxResponseSize.maxBytes
+	}
+
+	return maxCachedBodySize
+}
+
+// do returns the cached response to the request when it is fresh and sends the request otherwise,
+// conditionally when the cached response can be revalidated. The responses whose body exceeds maxBytes
+// are returned without being cached, and their body is read no further than maxBytes.
+func (c *responseCache) do(req *http.Request, send func(*http.Request) (*http.Response, error), maxBytes int64) (*http.Response, error) {
+	if req.Method != http.MethodGet || hasDirective(req.Header.Get("Cache-Control"), "no-store") {
+		return send(req)
+	}
+
+	original := req
+	entry := c.get(cacheKey(req, c.vary(req.URL.String())))
+	now := time.Now()
+	if entry != nil && now.Before(entry.expires) && !hasDirective(req.Header.Get("Cache-Control"), "no-cache") {
+		return entry.response(req), nil
+	}
+
+	if entry != nil && (entry.header.Get("ETag") != "" || entry.header.Get("Last-Modified") != "") {
+		conditional := req.Clone(req.Context())
+		if etag := entry.header.Get("ETag"); etag != "" {
+			conditional.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.header.Get("Last-Modified"); modified != "" {
+			conditional.Header.Set("If-Modified-Since", modified)
+		}
+		req = conditional
+	}
+
+	res, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry != nil && res.StatusCode == http.StatusNotModified {
+		_ = res.Body.Close()
+		c.revalidate(entry, res.Header, now)
+		return entry.response(req), nil
+	}
+
+	if !cacheable(res) || (original.Header.Get("Authorization") != "" && !hasDirective(res.Header.Get("Cache-Control"), "public")) {
+		return res, nil
+	}
+	if res.ContentLength > maxBytes {
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+	if err != nil {
+		_ = res.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		return res, nil
+	}
+	_ = res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	vary := varyHeaders(res.Header)
+	c.put(&cacheEntry{
+		key:        cacheKey(original, vary),
+		url:        original.URL.String(),
+		vary:       vary,
+		statusCode: res.StatusCode,
+		status:     res.Status,
+		header:     res.Header.Clone(),
+		body:       body,
+		expires:    expiration(res.Header, now),
+	})
+
+	return res, nil
+}
+
+// vary returns the Vary header names of the last response cached for the URL, if any.
+func (c *responseCache) vary(url string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.urls[url]; ok {
+		return cached.vary
+	}
+
+	return nil
+}
+
+// cacheKey returns the key of the response to the request varying on the given request headers.
+func cacheKey(req *http.Request, vary []string) string {
+	key := req.URL.String()
+	for _, name := range vary {
+		key += "\n" + name + ": " + strings.Join(req.Header.Values(name), ", ")
+	}
+
+	return key
+}
+
+// varyHeaders returns the sorted canonical names of the request headers listed by the Vary header.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// get returns the cached entry of the given key, if any, and marks it as recently used.
+func (c *responseCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.recent.MoveToFront(element)
+
+	return element.Value.(*cacheEntry)
+}
+
+// put caches the entry, evicting the least recently used one when the cache is full.
+func (c *responseCache) put(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		c.urls[entry.url].vary = entry.vary
+		return
+	}
+
+	c.entries[entry.key] = c.recent.PushFront(entry)
+	cached, ok := c.urls[entry.url]
+	if !ok {
+		cached = &cachedURL{}
+		c.urls[entry.url] = cached
+	}
+	cached.vary = entry.vary
+	cached.entries++
+
+	if c.recent.Len() > c.maxEntries {
+		oldest := c.recent.Remove(c.recent.Back()).(*cacheEntry)
+		delete(c.entries, oldest.key)
+		if cached := c.urls[oldest.url]; cached.entries == 1 {
+			delete(c.urls, oldest.url)
+		} else {
+			cached.entries--
+		}
+	}
+}
+
+// revalidate updates the freshness of a cached entry with the headers of a 304 Not Modified response.
+func (c *responseCache) revalidate(entry *cacheEntry, header http.Header, now time.Time) {
+	refreshed := *entry
+	refreshed.header = entry.header.Clone()
+	for _, name := range []string{"Cache-Control", "Expires", "Date", "ETag", "Last-Modified"} {
+		if values, ok := header[name]; ok {
+			refreshed.header[name] = values
+		}
+	}
+	refreshed.expires = expiration(refreshed.header, now)
+
+	c.put(&refreshed)
+}
+
+// response returns a new response to the request from the cached entry.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		StatusCode:    e.statusCode,
+		Status:        e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// cacheable reports whether the response can be stored: its status code must be cacheable by default,
+// it must be fresh for a while or revalidable, and must not forbid the storage.
+func cacheable(res *http.Response) bool {
+	cacheControl := res.Header.Get("Cache-Control")
+	if hasDirective(cacheControl, "no-store") || !cacheableStatusCodes[res.StatusCode] {
+		return false
+	}
+	for _, name := range varyHeaders(res.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+
+	return expiration(res.Header, time.Now()).After(time.Now()) ||
+		res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""
+}
+
+// expiration returns the time until which the response with the given headers is fresh.
+// The max-age directive takes precedence over the Expires header. The responses with
+// the no-cache directive or without freshness information are stale at once.
+func expiration(header http.Header, now time.Time) time.Time {
+	cacheControl := header.Get("Cache-Control")
+	if hasDirective(cacheControl, "no-cache") {
+		return now
+	}
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(strings.ToLower(directive), "max-age=") {
+			seconds, err := strconv.Atoi(strings.Trim(directive[len("max-age="):], `"`))
+			if err != nil || seconds < 0 {
+				return now
+			}
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		date, err := http.ParseTime(expires)
+		if err != nil {
+			return now
+		}
+		return date
+	}
+
+	return now
+}
+
+// hasDirective reports whether the Cache-Control value contains the given directive.
+func hasDirective(cacheControl string, name string) bool {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == name || strings.HasPrefix(directive, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,195 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newSequentialBulkRequest returns a bulk request of n GET requests to the given URL sent one after the other.
+func newSequentialBulkRequest(n int, serverURL string) *BulkRequest {
+	var requests []*http.Request
+	for i := 0; i < n; i++ {
+		req, _ := http.NewRequest(http.MethodGet, serverURL, nil)
+		requests = append(requests, req)
+	}
+
+	return NewBulkRequest(requests, 1, 1)
+}
+
+func TestFreshResponsesAreServedFromTheCache(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("pending"))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseCache(10))
+
+	bulkRequest := newSequentialBulkRequest(5, server.URL)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for i := range responses {
+		require.Nil(t, errs[i])
+		body, _ := ioutil.ReadAll(responses[i].Body)
+		assert.Equal(t, "pending", string(body))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestStaleResponsesAreRevalidatedWithTheirETag(t *testing.T) {
+	var hits, revalidations int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("ETag", `"v1"`)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&revalidations, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("delivered"))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseCache(10))
+
+	bulkRequest := newSequentialBulkRequest(3, server.URL)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for i := range responses {
+		require.Nil(t, errs[i])
+		body, _ := ioutil.ReadAll(responses[i].Body)
+		assert.Equal(t, http.StatusOK, responses[i].StatusCode)
+		assert.Equal(t, "delivered", string(body))
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&revalidations))
+}
+
+func TestNoStoreResponsesAreNotCached(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "no-store, max-age=60")
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseCache(10))
+
+	bulkRequest := newSequentialBulkRequest(3, server.URL)
+	_, _ = client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+}
+
+func TestLeastRecentlyUsedEntriesAreEvicted(t *testing.T) {
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseCache(2))
+	expires := time.Now().Add(time.Minute)
+
+	client.cache.put(&cacheEntry{key: "a", expires: expires})
+	client.cache.put(&cacheEntry{key: "b", expires: expires})
+	assert.NotNil(t, client.cache.get("a"))
+	client.cache.put(&cacheEntry{key: "c", expires: expires})
+
+	assert.NotNil(t, client.cache.get("a"))
+	assert.Nil(t, client.cache.get("b"))
+	assert.NotNil(t, client.cache.get("c"))
+}
+
+func TestAuthorizedResponsesAreOnlyCachedWhenPublic(t *testing.T) {
+	for cacheControl, expectedHits := range map[string]int32{"max-age=60": 3, "public, max-age=60": 1} {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Header().Set("Cache-Control", cacheControl)
+		}))
+		client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseCache(10))
+
+		bulkRequest := newSequentialBulkRequest(3, server.URL)
+		for _, req := range bulkRequest.requests {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		_, _ = client.Do(bulkRequest)
+		bulkRequest.CloseAllResponses()
+		server.Close()
+
+		assert.Equal(t, expectedHits, atomic.LoadInt32(&hits), cacheControl)
+	}
+}
+
+func TestResponsesAreCachedPerValueOfTheirVaryHeaders(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte(req.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseCache(10))
+
+	bulkRequest := newSequentialBulkRequest(4, server.URL)
+	for i, language := range []string{"en", "fr", "en", "fr"} {
+		bulkRequest.requests[i].Header.Set("Accept-Language", language)
+	}
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for i, language := range []string{"en", "fr", "en", "fr"} {
+		require.Nil(t, errs[i])
+		body, _ := ioutil.ReadAll(responses[i].Body)
+		assert.Equal(t, language, string(body))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestOnlyTheResponsesCacheableByDefaultAreCached(t *testing.T) {
+	for statusCode, expectedHits := range map[int]int32{http.StatusNotFound: 1, http.StatusServiceUnavailable: 3, http.StatusCreated: 3} {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(statusCode)
+		}))
+		client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseCache(10))
+
+		bulkRequest := newSequentialBulkRequest(3, server.URL)
+		_, _ = client.Do(bulkRequest)
+		bulkRequest.CloseAllResponses()
+		server.Close()
+
+		assert.Equal(t, expectedHits, atomic.LoadInt32(&hits), "status code %d", statusCode)
+	}
+}
+
+func TestLargeResponsesAreNotCached(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseCache(10), WithMaxResponseSize(5, true))
+
+	bulkRequest := newSequentialBulkRequest(2, server.URL)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for i := range responses {
+		require.Nil(t, errs[i])
+		body, _ := ioutil.ReadAll(responses[i].Body)
+		assert.Equal(t, "01234", string(body), "truncated by the maximum response size only")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	assert.Empty(t, client.cache.entries)
+}
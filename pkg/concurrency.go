@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// adaptiveConcurrency limits the amount of requests in flight with an additive-increase/multiplicative-decrease
+// policy. The limit is shared by every call to Send, so that it keeps what it learnt about the targets.
+type adaptiveConcurrency struct {
+	mu           sync.Mutex
+	changed      chan struct{}
+	max          int
+	latency      time.Duration
+	limit        float64
+	inFlight     int
+	lastDecrease time.Time
+}
+
+// WithAdaptiveConcurrency replaces the fixed amount of dispatch workers of the bulk requests by an adaptive limit
+// of requests in flight, starting from the dispatch workers of the first bulk request and up to maxConcurrency.
+// The limit grows by one every limit requests answered within the latency target without failures,
+// and it is halved, at most once per latency target, when a request times out, fails or is answered with 429 or 5xx.
+// Each attempt counts, including the retries, the hedged duplicates and the status polls.
+// A maxConcurrency lower than 1 disables it.
+func WithAdaptiveConcurrency(maxConcurrency int, latencyTarget time.Duration) Option {
+	return func(b *BulkHTTPClient) {
+		if maxConcurrency < 1 {
+			b.concurrency = nil
+			return
+		}
+
+		b.concurrency = &adaptiveConcurrency{
+			changed: make(chan struct{}),
+			max:     maxConcurrency,
+			latency: latencyTarget,
+		}
+	}
+}
+
+// dispatchWorkers returns the amount of workers sending the requests of the given bulk request.
+// With the adaptive concurrency, there are enough workers to reach the maximum limit.
+func (b *BulkHTTPClient) dispatchWorkers(bulkRequest *BulkRequest) int {
+	if b.concurrency == nil {
+		return bulkRequest.dispatchRequestsWorkers
+	}
+
+	b.concurrency.start(bulkRequest.dispatchRequestsWorkers)
+	if len(bulkRequest.requests) < b.concurrency.max {
+		return len(bulkRequest.requests)
+	}
+	return b.concurrency.max
+}
+
+// start sets the initial limit, unless it is already set.
+func (a *adaptiveConcurrency) start(initial int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.limit > 0 {
+		return
+	}
+	a.limit = float64(initial)
+	if a.limit < 1 {
+		a.limit = 1
+	}
+	if a.limit > float64(a.max) {
+		a.limit = float64(a.max)
+	}
+}
+
+// acquire blocks until the request fits in the limit or its context is done.
+// A nil *adaptiveConcurrency never blocks.
+func (a *adaptiveConcurrency) acquire(req *http.Request) error {
+	if a == nil {
+		return nil
+	}
+
+	for {
+		a.mu.Lock()
+		if a.limit == 0 {
+			a.limit = 1
+		}
+		if float64(a.inFlight) < a.limit {
+			a.inFlight++
+			a.mu.Unlock()
+			return nil
+		}
+		changed := a.changed
+		a.mu.Unlock()
+
+		select {
+		case <-req.Context().Done():
+			return req.Context().Err()
+		case <-changed:
+		}
+	}
+}
+
+// release frees the slot of the request and adapts the limit to the outcome of the request.
+// The outcome of a cancelled request, e.g. the losing attempt of a hedged request, is ignored.
+func (a *adaptiveConcurrency) release(req *http.Request, res *http.Response, err error, latency time.Duration) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.inFlight--
+	switch {
+	case req.Context().Err() == context.Canceled:
+	case isOverloaded(res, err):
+		if time.Since(a.lastDecrease) >= a.latency {
+			a.limit /= 2
+			if a.limit < 1 {
+				a.limit = 1
+			}
+			a.lastDecrease = time.Now()
+		}
+	case latency <= a.latency:
+		a.limit += 1 / a.limit
+		if a.limit > float64(a.max) {
+			a.limit = float64(a.max)
+		}
+	}
+
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// isOverloaded reports whether the outcome of a request shows that the target can't keep up:
+// the request failed, e.g. timed out, or the target responded with 429 or 5xx.
+func isOverloaded(res *http.Response, err error) bool {
+	return err != nil || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
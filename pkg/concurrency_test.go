@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveConcurrencyNeverExceedsTheMaximum(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			observed := atomic.LoadInt32(&maxInFlight)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxInFlight, observed, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithAdaptiveConcurrency(4, time.Second))
+
+	bulkRequest := newClientWithNRequests(100, server.URL)
+	_, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+	assert.True(t, atomic.LoadInt32(&maxInFlight) <= 4, "%d requests in flight", maxInFlight)
+	assert.Equal(t, float64(4), client.concurrency.limit)
+}
+
+func TestAdaptiveConcurrencyIncreasesAdditivelyAndDecreasesMultiplicatively(t *testing.T) {
+	limiter := &adaptiveConcurrency{changed: make(chan struct{}), max: 100, latency: 100 * time.Millisecond}
+	limiter.start(4)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	ok := &http.Response{StatusCode: http.StatusOK}
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, limiter.acquire(req))
+		limiter.release(req, ok, nil, time.Millisecond)
+	}
+	assert.InDelta(t, 5, limiter.limit, 0.1)
+
+	assert.NoError(t, limiter.acquire(req))
+	limiter.release(req, ok, nil, time.Second)
+	assert.InDelta(t, 5, limiter.limit, 0.1, "the slow responses don't increase the limit")
+
+	assert.NoError(t, limiter.acquire(req))
+	limiter.release(req, &http.Response{StatusCode: http.StatusServiceUnavailable}, nil, time.Millisecond)
+	assert.InDelta(t, 2.5, limiter.limit, 0.1)
+
+	assert.NoError(t, limiter.acquire(req))
+	limiter.release(req, nil, errors.New("timeout"), time.Second)
+	assert.InDelta(t, 2.5, limiter.limit, 0.1, "the limit is halved at most once per latency target")
+}
+
+func TestAdaptiveConcurrencyWaitsForAFreeSlot(t *testing.T) {
+	limiter := &adaptiveConcurrency{changed: make(chan struct{}), max: 1, latency: time.Second}
+	limiter.start(1)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	assert.NoError(t, limiter.acquire(req))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.acquire(req.WithContext(ctx)))
+
+	go limiter.release(req, &http.Response{StatusCode: http.StatusOK}, nil, time.Millisecond)
+	assert.NoError(t, limiter.acquire(req))
+}
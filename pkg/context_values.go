@@ -0,0 +1,33 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+)
+
+// valuesContext is a context cancelled like its parent and holding the values of another context as well,
+// so that the values attached to a request survive its cancellation by the bulk request.
+// The values of the other context take precedence.
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+// Value implements the context.Context interface.
+func (c valuesContext) Value(key interface{}) interface{} {
+	if value := c.values.Value(key); value != nil {
+		return value
+	}
+
+	return c.Context.Value(key)
+}
+
+// withRequestValues returns the given context holding the values of the request's context as well,
+// e.g. the message-scoped data read by a custom http.RoundTripper for authentication or tracing.
+func withRequestValues(ctx context.Context, req *http.Request) context.Context {
+	if req.Context() == context.Background() {
+		return ctx
+	}
+
+	return valuesContext{Context: ctx, values: req.Context()}
+}
@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tenantKey is the context key of the tenant read by the test round tripper.
+type tenantKey struct{}
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements the http.RoundTripper interface.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTheRoundTripperReadsTheValuesOfTheRequestContext(t *testing.T) {
+	polled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/status" {
+			polled = true
+			return
+		}
+		if req.Header.Get("X-Tenant") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Location", "/status")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var seen []interface{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		tenant := req.Context().Value(tenantKey{})
+		mu.Lock()
+		seen = append(seen, tenant)
+		mu.Unlock()
+		if tenant != nil {
+			req = req.Clone(req.Context())
+			req.Header.Set("X-Tenant", tenant.(string))
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := NewClient(&http.Client{Transport: transport}, WithAsyncPolling(2, time.Millisecond))
+
+	req, err := http.NewRequestWithContext(context.WithValue(context.Background(), tenantKey{}, "acme"), http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Succeeded(), 1)
+	assert.True(t, polled)
+	assert.Equal(t, []interface{}{"acme", "acme"}, seen)
+	assert.Equal(t, "acme", result.Entries[0].Response.Request.Context().Value(tenantKey{}))
+}
+
+func TestTheBuilderAttachesTheValuesToTheRequests(t *testing.T) {
+	bulkRequest, err := NewBulkRequestBuilder().BaseURL("http://localhost").
+		AddBody(nil, BodyValue(tenantKey{}, "acme")).
+		Build()
+	require.NoError(t, err, "no errors")
+
+	assert.Equal(t, "acme", bulkRequest.requests[0].Context().Value(tenantKey{}))
+}
+
+func TestTheRequestsWithValuesAreStillCancelledByTheBulkRequest(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	req, err := http.NewRequestWithContext(context.WithValue(context.Background(), tenantKey{}, "acme"), http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result := NewClient(&http.Client{}).Send(ctx, NewBulkRequest([]*http.Request{req}, 1, 1))
+
+	assert.Equal(t, []error{interr.ErrIgnored}, result.Errors())
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecodeResponses unmarshals the JSON body of each response of the result into a T, e.g. the acknowledgement
+// returned by the targets, at the index of its request. The error at the same index is the one of the request,
+// if it failed, or the decoding one. The responses are decoded whatever their status code, still available
+// in the entries of the result, and an empty body decodes to the zero value. The bodies are consumed.
+// When the bulk request couldn't be executed at all, a single error, the one of the result, is returned.
+func DecodeResponses[T any](result *BulkResult) ([]T, []error) {
+	if result.Err != nil {
+		return nil, []error{result.Err}
+	}
+
+	values := make([]T, len(result.Entries))
+	errs := make([]error, len(result.Entries))
+	for i, entry := range result.Entries {
+		switch {
+		case entry.Err != nil:
+			errs[i] = entry.Err
+		case entry.Response == nil:
+			errs[i] = errors.New("no response received")
+		default:
+			errs[i] = decodeBody(entry.Response.Body, &values[i])
+		}
+	}
+
+	return values, errs
+}
+
+// decodeBody unmarshals the JSON body into the given value. An empty body leaves the value as is.
+func decodeBody(body io.Reader, value interface{}) error {
+	err := json.NewDecoder(body).Decode(value)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error while decoding the response body: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// acknowledgement is the JSON body returned by the test target.
+type acknowledgement struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+func TestDecodeResponsesUnmarshalsEachBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/ack":
+			_, _ = w.Write([]byte(`{"id":"42","status":"queued"}`))
+		case "/rejected":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"invalid"}`))
+		case "/html":
+			_, _ = w.Write([]byte(`<html></html>`))
+		}
+	}))
+	defer server.Close()
+
+	var requests []*http.Request
+	for _, path := range []string{"/ack", "/rejected", "/html", "/empty"} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	result := NewClient(&http.Client{}).Send(context.Background(), NewBulkRequest(requests, 2, 2))
+	acks, errs := DecodeResponses[acknowledgement](&result)
+
+	require.Len(t, acks, 4)
+	require.Len(t, errs, 4)
+	assert.Equal(t, acknowledgement{ID: "42", Status: "queued"}, acks[0])
+	assert.NoError(t, errs[0])
+	assert.Equal(t, acknowledgement{Status: "invalid"}, acks[1])
+	assert.NoError(t, errs[1])
+	assert.Error(t, errs[2])
+	assert.Equal(t, acknowledgement{}, acks[3])
+	assert.NoError(t, errs[3])
+}
+
+func TestDecodeResponsesKeepsTheRequestErrors(t *testing.T) {
+	failure := errors.New("connection refused")
+	result := BulkResult{Entries: []Result{{Index: 0, Err: failure}}}
+
+	acks, errs := DecodeResponses[acknowledgement](&result)
+
+	assert.Equal(t, []acknowledgement{{}}, acks)
+	assert.Equal(t, []error{failure}, errs)
+
+	result = BulkResult{Err: interr.ErrRequestsNotFound}
+	acks, errs = DecodeResponses[acknowledgement](&result)
+
+	assert.Nil(t, acks)
+	assert.Equal(t, []error{interr.ErrRequestsNotFound}, errs)
+}
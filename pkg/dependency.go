@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// RequestTemplate builds a dependent request from the responses of the requests it depends on.
+// The responses are given in the same order as the dependencies were declared.
+type RequestTemplate func(parents []*http.Response) (*http.Request, error)
+
+// dependency represents a request built from the responses of other requests of the same bulk request.
+type dependency struct {
+	template RequestTemplate
+	parents  []int
+}
+
+// AddDependentRequest adds a request that depends on the requests at the given indexes.
+// The request is built by the template and started only when all the requests it depends on
+// have completed successfully, otherwise it fails with interr.ErrDependencyFailed.
+// A request can only depend on the requests added before it.
+// Until it is built, the request is a placeholder, see unbuiltRequest.
+func (b *BulkRequest) AddDependentRequest(template RequestTemplate, parents ...int) *BulkRequest {
+	if b.dependencies == nil {
+		b.dependencies = map[int]dependency{}
+	}
+
+	b.dependencies[len(b.requests)] = dependency{template: template, parents: parents}
+	b.requests = append(b.requests, unbuiltRequest())
+	return b
+}
+
+// unbuiltRequest returns the placeholder of a dependent request not built yet: a GET request without URL.
+// It remains the request of the results of the dependent requests that are never built.
+func unbuiltRequest() *http.Request {
+	return &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+}
+
+// doGraph executes the requests of the given phase. The independent requests are executed first
+// and concurrently, then the dependent requests are built and executed as soon as their parents completed.
+func (b *BulkHTTPClient) doGraph(bulkRequest *BulkRequest, phase bulkPhase, done []bool) {
+	var pending []int
+	for i := range phase.requests {
+		pending = append(pending, phase.offset+i)
+	}
+
+	for len(pending) > 0 {
+		var ready, waiting []int
+		for _, index := range pending {
+			dep, ok := bulkRequest.dependencies[index]
+			if !ok {
+				ready = append(ready, index)
+				continue
+			}
+
+			if waitsForParents(index, dep, done) {
+				waiting = append(waiting, index)
+				continue
+			}
+
+			req, err := b.buildDependentRequest(bulkRequest, index, dep)
+			if err != nil {
+				bulkRequest.errors[index] = err
+				done[index] = true
+				continue
+			}
+
+			b.stampBatchHeader(bulkRequest, index, req)
+			bulkRequest.requests[index] = req
+			ready = append(ready, index)
+		}
+
+		b.doRequests(bulkRequest, ready)
+		for _, index := range ready {
+			done[index] = true
+		}
+
+		pending = waiting
+	}
+}
+
+// waitsForParents reports whether some of the requests the request at the given index depends on
+// are not completed yet. The invalid parents are reported by buildDependentRequest.
+func waitsForParents(index int, dep dependency, done []bool) bool {
+	for _, parent := range dep.parents {
+		if parent >= 0 && parent < index && !done[parent] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// buildDependentRequest builds the request at the given index from the responses of its parents.
+func (b *BulkHTTPClient) buildDependentRequest(bulkRequest *BulkRequest, index int, dep dependency) (*http.Request, error) {
+	var parents []*http.Response
+	for _, parent := range dep.parents {
+		if parent < 0 || parent >= index {
+			return nil, fmt.Errorf("invalid dependency on request %d", parent)
+		}
+
+		if !b.succeeded(bulkRequest.responses[parent], bulkRequest.errors[parent]) {
+			return nil, interr.ErrDependencyFailed
+		}
+
+		response, err := copyResponse(bulkRequest.responses[parent])
+		if err != nil {
+			return nil, fmt.Errorf("error while reading the response of request %d: %s", parent, err)
+		}
+		parents = append(parents, response)
+	}
+
+	req, err := dep.template(parents)
+	if err != nil {
+		return nil, fmt.Errorf("request template error: %s", err)
+	}
+	if req == nil {
+		return nil, fmt.Errorf("request template error: no request built")
+	}
+
+	return req, nil
+}
+
+// copyResponse returns a copy of the response with its own body,
+// so that reading it does not consume the original body.
+func copyResponse(res *http.Response) (*http.Response, error) {
+	bs, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(bs), res.Body}
+
+	response := *res
+	response.Body = ioutil.NopCloser(bytes.NewReader(bs))
+	return &response, nil
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDependentRequestIsBuiltFromItsParentResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/resources" {
+			_, _ = w.Write([]byte("42"))
+			return
+		}
+
+		_, _ = w.Write([]byte("child of " + req.URL.Query().Get("parent")))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Timeout: TimeoutBiggerThanServerTime})
+
+	parent, err := http.NewRequest(http.MethodPost, server.URL+"/resources", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{parent}, 10, 10).
+		AddDependentRequest(func(parents []*http.Response) (*http.Request, error) {
+			id, err := ioutil.ReadAll(parents[0].Body)
+			if err != nil {
+				return nil, err
+			}
+			return http.NewRequest(http.MethodPost, server.URL+"/children?parent="+string(id), nil)
+		}, 0)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, []error{nil, nil}, errs)
+	parentBody, _ := ioutil.ReadAll(responses[0].Body)
+	childBody, _ := ioutil.ReadAll(responses[1].Body)
+	assert.Equal(t, "42", string(parentBody))
+	assert.Equal(t, "child of 42", string(childBody))
+}
+
+func TestDependentRequestIsNotStartedWhenItsParentFailed(t *testing.T) {
+	server := StartMockServer()
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Timeout: TimeoutBiggerThanServerTime})
+
+	queryFast := url.Values{}
+	queryFast.Set("kind", "fast")
+
+	reqOne, err := http.NewRequest(http.MethodGet, encodeURL(server.URL, "", url.Values{}), nil) // service unavailable
+	require.NoError(t, err, "no errors")
+
+	reqTwo, err := http.NewRequest(http.MethodGet, encodeURL(server.URL, "", queryFast), nil)
+	require.NoError(t, err, "no errors")
+
+	templateCalls := 0
+	template := func(parents []*http.Response) (*http.Request, error) {
+		templateCalls++
+		return http.NewRequest(http.MethodGet, encodeURL(server.URL, "", queryFast), nil)
+	}
+
+	bulkRequest := NewBulkRequest([]*http.Request{reqOne, reqTwo}, 10, 10).
+		AddDependentRequest(template, 0).
+		AddDependentRequest(template, 1)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, http.StatusServiceUnavailable, responses[0].StatusCode)
+	assert.Nil(t, responses[2])
+	assert.Equal(t, interr.ErrDependencyFailed, errs[2])
+	assert.Nil(t, errs[3])
+	assert.Equal(t, http.StatusOK, responses[3].StatusCode)
+	assert.Equal(t, 1, templateCalls)
+}
+
+func TestUnbuiltDependentRequestHasAPlaceholderRequest(t *testing.T) {
+	server := StartMockServer()
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Timeout: TimeoutBiggerThanServerTime})
+
+	reqOne, err := http.NewRequest(http.MethodGet, encodeURL(server.URL, "", url.Values{}), nil) // service unavailable
+	require.NoError(t, err, "no errors")
+
+	template := func(parents []*http.Response) (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, server.URL, nil)
+	}
+
+	bulkRequest := NewBulkRequest([]*http.Request{reqOne}, 10, 10).AddDependentRequest(template, 0)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, interr.ErrDependencyFailed, result.Entries[1].Err)
+	require.NotNil(t, result.Entries[1].Request)
+	assert.Equal(t, http.MethodGet, result.Entries[1].Request.Method)
+	assert.Equal(t, "", result.Entries[1].Request.URL.String())
+}
+
+func TestDependencyOnALaterRequestIsInvalid(t *testing.T) {
+	server := StartMockServer()
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Timeout: TimeoutBiggerThanServerTime})
+
+	bulkRequest := NewBulkRequest(nil, 1, 1).
+		AddDependentRequest(func(parents []*http.Response) (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, server.URL, nil)
+		}, 1).
+		AddDependentRequest(func(parents []*http.Response) (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, server.URL, nil)
+		}, 1)
+	_, errs := client.Do(bulkRequest)
+
+	assert.EqualError(t, errs[0], "invalid dependency on request 1")
+	assert.EqualError(t, errs[1], "invalid dependency on request 1")
+}
@@ -0,0 +1,301 @@
+package pkg
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// The bounds of the DNS cache.
+const (
+	// minDNSTTL is the minimum time the addresses of a host are cached, even with a lower TTL.
+	minDNSTTL = time.Second
+	// dnsRetryDelay is the time the stale addresses of a host are still used once its lookup failed.
+	dnsRetryDelay = 5 * time.Second
+	// dnsLookupTimeout is the timeout of each lookup, detached from the requests waiting for it.
+	dnsLookupTimeout = 10 * time.Second
+)
+
+// DNSCache is a caching resolver for the hosts of the bulk requests: a bulk request of thousands of requests
+// to the same host resolves it once instead of once per connection. The addresses are cached for the TTL
+// of their DNS records, at least a second, or for the default TTL when it is unknown, e.g. for the hosts file.
+// The concurrent lookups of a host share a single DNS query. Once expired, the addresses are still used
+// while they are refreshed in the background, so that the requests don't stall on a slow resolver, and
+// for a few seconds more when the refresh fails. Flush forgets them all, e.g. after a DNS change.
+// Use it with TransportDNSCache.
+type DNSCache struct {
+	defaultTTL time.Duration
+	resolver   *net.Resolver
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// dnsEntry is the cached lookup of a host. Ready is closed once its first lookup completed.
+type dnsEntry struct {
+	ready      chan struct{}
+	addrs      []net.IPAddr
+	err        error
+	expires    time.Time
+	refreshing bool
+}
+
+// NewDNSCache returns a new DNSCache resolving the hosts with the Go resolver, caching the addresses
+// whose TTL is unknown for the given default TTL.
+func NewDNSCache(defaultTTL time.Duration) *DNSCache {
+	c := &DNSCache{
+		defaultTTL: defaultTTL,
+		entries:    map[string]*dnsEntry{},
+	}
+	c.resolver = &net.Resolver{PreferGo: true, Dial: c.dialDNS}
+
+	return c
+}
+
+// TransportDNSCache makes the transport resolve the hosts with the given DNS cache. The resolved addresses
+// of a host are dialed one after the other, until a connection is established. A nil cache is ignored.
+func TransportDNSCache(cache *DNSCache) TransportOption {
+	return func(s *transportSettings) {
+		if cache != nil {
+			s.transport.DialContext = cache.Dial(s.dialer.DialContext)
+		}
+	}
+}
+
+// Flush forgets all the cached addresses: the next requests resolve their host again.
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]*dnsEntry{}
+}
+
+// LookupIPAddr returns the addresses of the host, from the cache when it holds them.
+func (c *DNSCache) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	switch {
+	case !ok:
+		entry = &dnsEntry{ready: make(chan struct{}), refreshing: true}
+		c.entries[host] = entry
+		go c.refresh(host, entry)
+	case !entry.refreshing && entry.addrs != nil && time.Now().After(entry.expires):
+		entry.refreshing = true
+		go c.refresh(host, entry)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return entry.addrs, entry.err
+}
+
+// Dial wraps the dial function to connect to the cached addresses of the host, one after the other.
+// The addresses which are IP addresses are dialed as they are.
+func (c *DNSCache) Dial(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+
+		addrs, err := c.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, addr := range addrs {
+			if !matchesNetwork(network, addr.IP) {
+				continue
+			}
+			conn, err := dial(ctx, network, net.JoinHostPort(addr.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if lastErr == nil {
+			lastErr = &net.DNSError{Err: "no suitable address found", Name: host}
+		}
+
+		return nil, lastErr
+	}
+}
+
+// matchesNetwork reports whether the IP address can be dialed with the network: tcp4 and tcp6 only take
+// the addresses of their IP version.
+func matchesNetwork(network string, ip net.IP) bool {
+	switch network {
+	case "tcp4", "udp4":
+		return ip.To4() != nil
+	case "tcp6", "udp6":
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+// refresh looks the host up and updates its entry. A failed lookup keeps the previous addresses, if any,
+// for dnsRetryDelay. The entry of a host without addresses is forgotten, so that the next requests look it up again.
+func (c *DNSCache) refresh(host string, entry *dnsEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+
+	recorder := &ttlRecorder{}
+	addrs, err := c.resolver.LookupIPAddr(context.WithValue(ctx, ttlRecorderKey{}, recorder), host)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.refreshing = false
+	switch {
+	case err == nil:
+		entry.addrs, entry.err = addrs, nil
+		entry.expires = time.Now().Add(recorder.ttlOr(c.defaultTTL))
+	case entry.addrs != nil:
+		entry.expires = time.Now().Add(dnsRetryDelay)
+	default:
+		entry.err = err
+		if c.entries[host] == entry {
+			delete(c.entries, host)
+		}
+	}
+
+	select {
+	case <-entry.ready:
+	default:
+		close(entry.ready)
+	}
+}
+
+// ttlRecorderKey is the context key of the ttlRecorder of a lookup.
+type ttlRecorderKey struct{}
+
+// ttlRecorder records the lowest TTL of the addresses received by a lookup.
+type ttlRecorder struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	found bool
+}
+
+// record records the TTL of an address.
+func (r *ttlRecorder) record(ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.found || ttl < r.ttl {
+		r.ttl, r.found = ttl, true
+	}
+}
+
+// ttlOr returns the recorded TTL, at least minDNSTTL, or the given default TTL when none was recorded.
+func (r *ttlRecorder) ttlOr(defaultTTL time.Duration) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case !r.found:
+		return defaultTTL
+	case r.ttl < minDNSTTL:
+		return minDNSTTL
+	default:
+		return r.ttl
+	}
+}
+
+// dialDNS connects to a DNS server for the Go resolver. The answers received over UDP are inspected to record
+// the TTL of their addresses: the ones received over TCP, for the truncated answers, are not.
+func (c *DNSCache) dialDNS(ctx context.Context, network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder, ok := ctx.Value(ttlRecorderKey{}).(*ttlRecorder)
+	udp, isUDP := conn.(*net.UDPConn)
+	if !ok || !isUDP {
+		return conn, nil
+	}
+
+	return &ttlConn{UDPConn: udp, recorder: recorder}, nil
+}
+
+// ttlConn is a DNS connection over UDP recording the TTL of the addresses of the answers it receives.
+// It remains a net.PacketConn, so that the Go resolver exchanges a DNS message per packet with it.
+type ttlConn struct {
+	*net.UDPConn
+	recorder *ttlRecorder
+}
+
+// Read reads a DNS message and records the TTL of its addresses.
+func (c *ttlConn) Read(b []byte) (int, error) {
+	n, err := c.UDPConn.Read(b)
+	if ttl, ok := addressTTL(b[:n]); ok {
+		c.recorder.record(ttl)
+	}
+
+	return n, err
+}
+
+// addressTTL returns the lowest TTL of the A and AAAA records of the answer section of the DNS message, if any.
+func addressTTL(message []byte) (time.Duration, bool) {
+	const typeA, typeAAAA = 1, 28
+	if len(message) < 12 || message[2]&0x80 == 0 || message[3]&0x0f != 0 {
+		return 0, false
+	}
+
+	questions := int(binary.BigEndian.Uint16(message[4:6]))
+	answers := int(binary.BigEndian.Uint16(message[6:8]))
+	offset := 12
+	for i := 0; i < questions; i++ {
+		offset = skipName(message, offset) + 4
+	}
+
+	var ttl uint32
+	found := false
+	for i := 0; i < answers; i++ {
+		offset = skipName(message, offset)
+		if offset+10 > len(message) {
+			return 0, false
+		}
+		rtype := binary.BigEndian.Uint16(message[offset : offset+2])
+		rttl := binary.BigEndian.Uint32(message[offset+4 : offset+8])
+		offset += 10 + int(binary.BigEndian.Uint16(message[offset+8:offset+10]))
+		if (rtype == typeA || rtype == typeAAAA) && (!found || rttl < ttl) {
+			ttl, found = rttl, true
+		}
+	}
+
+	return time.Duration(ttl) * time.Second, found
+}
+
+// skipName returns the offset following the domain name at the given offset of the DNS message.
+// The name ends with an empty label or a compression pointer.
+func skipName(message []byte, offset int) int {
+	for offset < len(message) {
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			return offset + 1
+		case length&0xc0 == 0xc0:
+			return offset + 2
+		default:
+			offset += 1 + length
+		}
+	}
+
+	return len(message) + 1
+}
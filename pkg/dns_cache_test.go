@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dnsServer is a DNS server answering the A queries with 127.0.0.1 and the given TTL, and the other ones without address,
+// after the given delay.
+type dnsServer struct {
+	conn    net.PacketConn
+	ttl     uint32
+	delay   int64
+	queries int32
+}
+
+// newDNSServer starts a DNS server on a local UDP port.
+func newDNSServer(t *testing.T, ttl uint32) *dnsServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "no errors")
+	server := &dnsServer{conn: conn, ttl: ttl}
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			if n < 12 {
+				continue
+			}
+			atomic.AddInt32(&server.queries, 1)
+			answer := server.answer(buffer[:n])
+			go func() {
+				time.Sleep(time.Duration(atomic.LoadInt64(&server.delay)))
+				_, _ = conn.WriteTo(answer, addr)
+			}()
+		}
+	}()
+
+	return server
+}
+
+// answer returns the answer to the query.
+func (s *dnsServer) answer(query []byte) []byte {
+	end := skipName(query, 12)
+	qtype := binary.BigEndian.Uint16(query[end : end+2])
+
+	answer := append([]byte{}, query[:end+4]...)
+	answer[2], answer[3] = 0x81, 0x80
+	answer[6], answer[7] = 0, 0
+	answer[8], answer[9], answer[10], answer[11] = 0, 0, 0, 0
+	if qtype == 1 {
+		answer[7] = 1
+		record := []byte{0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4, 127, 0, 0, 1}
+		binary.BigEndian.PutUint32(record[6:10], atomic.LoadUint32(&s.ttl))
+		answer = append(answer, record...)
+	}
+
+	return answer
+}
+
+// newTestDNSCache returns a DNS cache resolving the hosts with the given DNS server.
+func newTestDNSCache(server *dnsServer, defaultTTL time.Duration) *DNSCache {
+	cache := NewDNSCache(defaultTTL)
+	cache.resolver = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		return cache.dialDNS(ctx, "udp", server.conn.LocalAddr().String())
+	}}
+
+	return cache
+}
+
+func TestTheDNSCacheResolvesTheHostOnce(t *testing.T) {
+	dns := newDNSServer(t, 300)
+	defer dns.conn.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer server.Close()
+	cache := newTestDNSCache(dns, time.Minute)
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Transport: NewTransport(
+		TransportDNSCache(cache),
+		TransportDisableKeepAlives(),
+	)})
+	url := strings.Replace(server.URL, "127.0.0.1", "receiver.notifier.test", 1)
+
+	bulkRequest := newClientWithNRequests(20, url)
+	_, errs := client.Do(bulkRequest)
+	bulkRequest.CloseAllResponses()
+	for _, err := range errs {
+		require.NoError(t, err, "no errors")
+	}
+	queries := atomic.LoadInt32(&dns.queries)
+	assert.True(t, queries > 0 && queries <= 2, "a single lookup of the A and AAAA records: %d queries", queries)
+
+	bulkRequest = newClientWithNRequests(20, url)
+	_, errs = client.Do(bulkRequest)
+	bulkRequest.CloseAllResponses()
+	for _, err := range errs {
+		require.NoError(t, err, "no errors")
+	}
+	assert.Equal(t, queries, atomic.LoadInt32(&dns.queries), "the addresses are cached")
+}
+
+func TestTheDNSCacheRespectsTheTTL(t *testing.T) {
+	dns := newDNSServer(t, 3600)
+	defer dns.conn.Close()
+	cache := newTestDNSCache(dns, time.Minute)
+
+	addrs, err := cache.LookupIPAddr(context.Background(), "receiver.notifier.test")
+	require.NoError(t, err, "no errors")
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "127.0.0.1", addrs[0].IP.String())
+	assert.True(t, time.Until(cache.entries["receiver.notifier.test"].expires) > 59*time.Minute, "the TTL of the record")
+
+	atomic.StoreUint32(&dns.ttl, 0)
+	cache.Flush()
+	queries := atomic.LoadInt32(&dns.queries)
+	_, err = cache.LookupIPAddr(context.Background(), "receiver.notifier.test")
+	require.NoError(t, err, "no errors")
+	assert.True(t, atomic.LoadInt32(&dns.queries) > queries, "resolved again once flushed")
+	assert.True(t, time.Until(cache.entries["receiver.notifier.test"].expires) <= minDNSTTL, "at least a second")
+
+	time.Sleep(minDNSTTL + 10*time.Millisecond)
+	atomic.StoreInt64(&dns.delay, int64(200*time.Millisecond))
+	queries = atomic.LoadInt32(&dns.queries)
+	start := time.Now()
+	addrs, err = cache.LookupIPAddr(context.Background(), "receiver.notifier.test")
+	require.NoError(t, err, "no errors")
+	assert.Len(t, addrs, 1, "the expired addresses are used")
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "while they are refreshed")
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&dns.queries) > queries }, time.Second, 5*time.Millisecond)
+}
+
+func TestTheDNSCacheForgetsTheFailedLookups(t *testing.T) {
+	cache := NewDNSCache(time.Minute)
+	cache.resolver = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError("unreachable")}
+	}}
+
+	_, err := cache.LookupIPAddr(context.Background(), "receiver.notifier.test")
+	assert.Error(t, err)
+	assert.Empty(t, cache.entries, "looked up again by the next requests")
+}
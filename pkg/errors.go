@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"github.com/pigeonlab/notifier/interr"
+	"net"
+	"net/http"
+)
+
+// WithStatusErrors makes the client fail the requests completed with a status code that is not successful
+// with an *interr.StatusError, so that they can be told apart with errors.As. The response is kept in the result.
+// The status codes of WithSuccessStatuses are successful.
+func WithStatusErrors() Option {
+	return func(b *BulkHTTPClient) {
+		b.statusErrors = true
+	}
+}
+
+// WithFailOnStatus makes the client fail the requests completed with a status code for which the given function
+// returns true with an *interr.StatusError, e.g. the 5xx ones, so that they are reported in the errors
+// rather than as successful responses that the callers must inspect themselves. The response is kept in the result.
+// The retry policy, if any, still decides which responses are retried, see isTransient.
+// It replaces WithStatusErrors, and is replaced by the RequestFailOnStatus option of a request.
+func WithFailOnStatus(fail func(code int) bool) Option {
+	return func(b *BulkHTTPClient) {
+		b.failOnStatus = fail
+	}
+}
+
+// RequestFailOnStatus fails the request when it completes with a status code for which the given function
+// returns true, overriding WithFailOnStatus and WithStatusErrors for this request.
+func RequestFailOnStatus(fail func(code int) bool) RequestOption {
+	return func(o *requestOptions) {
+		o.failOnStatus = fail
+	}
+}
+
+// clientError wraps the error returned by the HTTP client for the request at the given index
+// in an *interr.TimeoutError or an *interr.ConnectionError. The attempts are set by withAttempts.
+func clientError(index int, req *http.Request, err error) error {
+	method, url := requestTarget(req)
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &interr.TimeoutError{Index: index, Method: method, URL: url, Err: err}
+	}
+
+	return &interr.ConnectionError{Index: index, Method: method, URL: url, Err: err}
+}
+
+// statusError returns an *interr.StatusError when the given flow completed with a status code that fails its request,
+// nil otherwise. The given function, the one of the request, decides which status codes fail, otherwise the one
+// of the client, otherwise the unsuccessful status codes fail if the client fails them, see WithStatusErrors.
+func (b *BulkHTTPClient) statusError(flow requestFlow, fail func(code int) bool) error {
+	if flow.err != nil || flow.response == nil {
+		return nil
+	}
+
+	if fail == nil {
+		fail = b.failOnStatus
+	}
+	switch {
+	case fail != nil && !fail(flow.response.StatusCode):
+		return nil
+	case fail == nil && (!b.statusErrors || b.succeeded(flow.response, nil)):
+		return nil
+	}
+
+	method, url := requestTarget(flow.response.Request)
+	return &interr.StatusError{Index: flow.index, Method: method, URL: url, Code: flow.response.StatusCode}
+}
+
+// withAttempts sets the amount of attempts of the typed error of a request, if any, and returns it.
+func withAttempts(err error, attempts int) error {
+	var timeoutErr *interr.TimeoutError
+	var connErr *interr.ConnectionError
+	var statusErr *interr.StatusError
+	var headerErr *interr.HeaderError
+	switch {
+	case errors.As(err, &timeoutErr):
+		timeoutErr.Attempts = attempts
+	case errors.As(err, &connErr):
+		connErr.Attempts = attempts
+	case errors.As(err, &statusErr):
+		statusErr.Attempts = attempts
+	case errors.As(err, &headerErr):
+		headerErr.Attempts = attempts
+	}
+
+	return err
+}
+
+// requestTarget returns the method and the URL of the request, empty when they are unknown.
+func requestTarget(req *http.Request) (string, string) {
+	if req == nil {
+		return "", ""
+	}
+
+	var url string
+	if req.URL != nil {
+		url = req.URL.String()
+	}
+
+	return req.Method, url
+}
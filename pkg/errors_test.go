@@ -0,0 +1,250 @@
+package pkg
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestConnectionErrorWrapsTheClientError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "no errors")
+	target := "http://" + listener.Addr().String()
+	require.NoError(t, listener.Close(), "no errors")
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	require.NoError(t, err, "no errors")
+
+	client := NewClient(http.DefaultClient)
+	result := client.Send(context.Background(), NewBulkRequest([]*http.Request{req}, 1, 1))
+	require.Len(t, result.Entries, 1)
+
+	var connErr *interr.ConnectionError
+	require.True(t, errors.As(result.Entries[0].Err, &connErr), "connection error")
+	assert.Equal(t, 0, connErr.Index)
+	assert.Equal(t, target, connErr.URL)
+	assert.True(t, errors.Is(result.Entries[0].Err, syscall.ECONNREFUSED), "refused connection")
+}
+
+func TestErrorsCarryTheRequestMetadata(t *testing.T) {
+	HTTPClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, syscall.ECONNRESET
+	})}
+
+	var requests []*http.Request
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		req, err := http.NewRequest(method, "http://example.com/"+method, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	client := NewClient(HTTPClient, WithRetry(3, time.Millisecond, 0))
+	result := client.Send(context.Background(), NewBulkRequest(requests, 2, 2))
+
+	require.Len(t, result.Entries, 2)
+	for i, method := range []string{http.MethodPost, http.MethodPut} {
+		var connErr *interr.ConnectionError
+		require.True(t, errors.As(result.Entries[i].Err, &connErr), "connection error")
+		assert.Equal(t, i, connErr.Index)
+		assert.Equal(t, method, connErr.Method)
+		assert.Equal(t, "http://example.com/"+method, connErr.URL)
+		assert.Equal(t, 3, connErr.Attempts)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/unchanged":
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+
+	var requests []*http.Request
+	for _, path := range []string{"/ok", "/missing", "/unchanged"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	client := NewClient(http.DefaultClient, WithStatusErrors(), WithSuccessStatuses(http.StatusNotModified))
+	bulkRequest := NewBulkRequest(requests, 2, 2)
+	defer bulkRequest.CloseAllResponses()
+	result := client.Send(context.Background(), bulkRequest)
+
+	require.Len(t, result.Entries, 3)
+	assert.NoError(t, result.Entries[0].Err)
+	assert.NoError(t, result.Entries[2].Err)
+
+	var statusErr *interr.StatusError
+	require.True(t, errors.As(result.Entries[1].Err, &statusErr), "status error")
+	assert.Equal(t, &interr.StatusError{Index: 1, Method: http.MethodGet, URL: server.URL + "/missing", Attempts: 1, Code: http.StatusNotFound}, statusErr)
+	require.NotNil(t, result.Entries[1].Response, "the response is kept")
+	assert.Equal(t, http.StatusNotFound, result.Entries[1].Response.StatusCode)
+	assert.Len(t, result.Failed(), 1)
+}
+
+func TestFailOnStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken", "/important":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	var requests []*http.Request
+	for _, path := range []string{"/ok", "/missing", "/broken"} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+	important, err := http.NewRequest(http.MethodPost, server.URL+"/important", nil)
+	require.NoError(t, err, "no errors")
+	notFound, err := http.NewRequest(http.MethodPost, server.URL+"/missing", nil)
+	require.NoError(t, err, "no errors")
+
+	client := NewClient(http.DefaultClient, WithFailOnStatus(func(code int) bool { return code >= 500 }))
+	bulkRequest := NewBulkRequest(requests, 2, 2).
+		AddRequestWithOptions(important, RequestFailOnStatus(func(code int) bool { return false })).
+		AddRequestWithOptions(notFound, RequestFailOnStatus(func(code int) bool { return code != http.StatusOK }))
+	defer bulkRequest.CloseAllResponses()
+	result := client.Send(context.Background(), bulkRequest)
+
+	require.Len(t, result.Entries, 5)
+	assert.NoError(t, result.Entries[0].Err)
+	assert.NoError(t, result.Entries[1].Err, "the 4xx responses don't fail")
+	assert.NoError(t, result.Entries[3].Err, "the request option overrides the client one")
+
+	var statusErr *interr.StatusError
+	require.True(t, errors.As(result.Entries[2].Err, &statusErr), "status error")
+	assert.Equal(t, http.StatusInternalServerError, statusErr.Code)
+	require.NotNil(t, result.Entries[2].Response, "the response is kept")
+	require.True(t, errors.As(result.Entries[4].Err, &statusErr), "status error")
+	assert.Equal(t, http.StatusNotFound, statusErr.Code)
+}
+
+func TestWithoutStatusErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1)
+	defer bulkRequest.CloseAllResponses()
+	result := NewClient(http.DefaultClient).Send(context.Background(), bulkRequest)
+
+	require.Len(t, result.Entries, 1)
+	assert.NoError(t, result.Entries[0].Err)
+	assert.Equal(t, http.StatusInternalServerError, result.Entries[0].Response.StatusCode)
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := map[string]struct {
+		err       error
+		retryable bool
+	}{
+		"timeout":            {&interr.TimeoutError{Err: context.DeadlineExceeded}, true},
+		"refused connection": {&interr.ConnectionError{Err: syscall.ECONNREFUSED}, true},
+		"unknown host":       {&interr.ConnectionError{Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, false},
+		"DNS failure":        {&interr.ConnectionError{Err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}, true},
+		"invalid cert":       {&interr.ConnectionError{Err: x509.UnknownAuthorityError{}}, false},
+		"unavailable":        {&interr.StatusError{Code: http.StatusServiceUnavailable}, true},
+		"bad request":        {&interr.StatusError{Code: http.StatusBadRequest}, false},
+		"ignored":            {interr.ErrIgnored, true},
+		"barrier":            {interr.ErrBarrierNotPassed, true},
+		"retry budget":       {interr.ErrRetryBudgetExhausted, true},
+		"polling exhausted":  {interr.ErrPollingExhausted, false},
+		"wrapped":            {fmt.Errorf("sending: %w", &interr.TimeoutError{}), true},
+		"other":              {errors.New("boom"), false},
+	}
+
+	for name, test := range tests {
+		assert.Equal(t, test.retryable, interr.IsRetryable(test.err), name)
+	}
+}
+
+func TestUnknownHostsAreNotRetried(t *testing.T) {
+	var attempts int32
+	HTTPClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&attempts, 1)
+		return nil, &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: req.URL.Host, IsNotFound: true}}
+	})}
+
+	req, err := http.NewRequest(http.MethodGet, "http://unknown.invalid", nil)
+	require.NoError(t, err, "no errors")
+
+	client := NewClient(HTTPClient, WithRetry(3, time.Millisecond, 0))
+	result := client.Send(context.Background(), NewBulkRequest([]*http.Request{req}, 1, 1))
+
+	require.Len(t, result.Entries, 1)
+	assert.False(t, interr.IsRetryable(result.Entries[0].Err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestBulkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var requests []*http.Request
+	for _, target := range []string{server.URL, "http://127.0.0.1:1"} {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bulkRequest := NewBulkRequest(requests, 1, 1)
+	result := NewClient(http.DefaultClient).Send(ctx, bulkRequest)
+
+	err := result.AsError()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, interr.ErrIgnored), "ignored requests")
+	assert.EqualError(t, err, "2 of 2 requests failed, first: request ignored")
+
+	var bulkErr *interr.BulkError
+	require.True(t, errors.As(err, &bulkErr), "bulk error")
+	assert.Equal(t, result.Errors(), bulkErr.Errors)
+
+	bulkRequest = NewBulkRequest(requests, 1, 1)
+	defer bulkRequest.CloseAllResponses()
+	err = NewClient(http.DefaultClient).Send(context.Background(), bulkRequest).AsError()
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, interr.ErrIgnored), "no ignored requests")
+
+	var connErr *interr.ConnectionError
+	require.True(t, errors.As(err, &connErr), "connection error")
+	assert.Equal(t, 1, connErr.Index)
+	assert.Len(t, err.(*interr.BulkError).Unwrap(), 1)
+
+	connErr = nil
+	assert.True(t, err.(*interr.BulkError).As(&connErr), "without the Unwrap() []error walk of Go 1.20")
+	assert.Equal(t, 1, connErr.Index)
+	assert.False(t, err.(*interr.BulkError).Is(interr.ErrIgnored))
+}
+
+func TestNoBulkErrorWithoutFailures(t *testing.T) {
+	assert.NoError(t, interr.NewBulkError([]error{nil, nil}))
+	assert.NoError(t, interr.NewBulkError(nil))
+	assert.Equal(t, interr.ErrRequestsNotFound, BulkResult{Err: interr.ErrRequestsNotFound}.AsError())
+}
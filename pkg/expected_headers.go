@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"github.com/pigeonlab/notifier/interr"
+)
+
+// expectedHeader is a response header that the successful responses must carry.
+// An empty value only requires the header to be present.
+type expectedHeader struct {
+	name  string
+	value string
+}
+
+// WithExpectedHeader fails the successful responses without the given header, or without the given value
+// among the values of the header, with an *interr.HeaderError, since some receivers signal their soft failures
+// with a header of a 2xx response, e.g. X-Processed: false. An empty value only requires the header to be present.
+// It can be given several times: every header is expected. The response is kept in the result.
+func WithExpectedHeader(name string, value string) Option {
+	return func(b *BulkHTTPClient) {
+		b.expectedHeaders = append(b.expectedHeaders, expectedHeader{name: name, value: value})
+	}
+}
+
+// headerError returns an *interr.HeaderError when the given flow completed successfully
+// without one of the expected headers, nil otherwise.
+func (b *BulkHTTPClient) headerError(flow requestFlow) error {
+	if len(b.expectedHeaders) == 0 || !b.succeeded(flow.response, flow.err) {
+		return nil
+	}
+
+	for _, expected := range b.expectedHeaders {
+		values := flow.response.Header.Values(expected.name)
+		if hasHeaderValue(values, expected.value) {
+			continue
+		}
+
+		method, url := requestTarget(flow.response.Request)
+		return &interr.HeaderError{
+			Index:    flow.index,
+			Method:   method,
+			URL:      url,
+			Header:   expected.name,
+			Expected: expected.value,
+			Values:   values,
+		}
+	}
+
+	return nil
+}
+
+// hasHeaderValue reports whether the given values of a header hold the expected value.
+// An empty expected value only requires a value.
+func hasHeaderValue(values []string, expected string) bool {
+	if expected == "" {
+		return len(values) > 0
+	}
+
+	for _, value := range values {
+		if value == expected {
+			return true
+		}
+	}
+
+	return false
+}
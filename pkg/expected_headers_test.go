@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpectedHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/processed":
+			w.Header().Set("X-Processed", "true")
+			w.Header().Set("X-Request-Id", "42")
+		case "/soft-failure":
+			w.Header().Set("X-Processed", "false")
+			w.Header().Set("X-Request-Id", "43")
+		case "/anonymous":
+			w.Header().Set("X-Processed", "true")
+		case "/error":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithExpectedHeader("X-Processed", "true"), WithExpectedHeader("x-request-id", ""))
+
+	var requests []*http.Request
+	for _, path := range []string{"/processed", "/soft-failure", "/anonymous", "/error"} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	bulkRequest := NewBulkRequest(requests, 2, 2)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Entries, 4)
+	assert.Nil(t, result.Entries[0].Err)
+
+	var headerErr *interr.HeaderError
+	require.True(t, errors.As(result.Entries[1].Err, &headerErr))
+	assert.Equal(t, 1, headerErr.Index)
+	assert.Equal(t, "X-Processed", headerErr.Header)
+	assert.Equal(t, []string{"false"}, headerErr.Values)
+	assert.Equal(t, 1, headerErr.Attempts)
+	assert.False(t, interr.IsRetryable(headerErr))
+	assert.Equal(t, http.StatusOK, result.Entries[1].Response.StatusCode)
+
+	require.True(t, errors.As(result.Entries[2].Err, &headerErr))
+	assert.Equal(t, "x-request-id", headerErr.Header)
+	assert.Contains(t, headerErr.Error(), "missing response header")
+
+	assert.Nil(t, result.Entries[3].Err)
+	assert.Equal(t, http.StatusBadRequest, result.Entries[3].Response.StatusCode)
+	assert.Equal(t, FailureCounts{FailureHeader: 2, FailureClient: 1}, result.FailureCounts())
+}
@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestExpiry sets the time after which the request is not worth sending anymore, e.g. for a time-sensitive alert
+// sitting in a backlog: a request still unsent at that time fails with interr.ErrExpired instead of being delivered late.
+// The request is not retried either once the delay before its next attempt would end after that time.
+func RequestExpiry(expiresAt time.Time) RequestOption {
+	return func(o *requestOptions) {
+		o.expiresAt = expiresAt
+	}
+}
+
+// RequestTTL sets how long the request is worth sending, from the time it is added to its bulk request,
+// see RequestExpiry.
+func RequestTTL(ttl time.Duration) RequestOption {
+	return RequestExpiry(time.Now().Add(ttl))
+}
+
+// BodyExpiry sets the time after which the request is not worth sending anymore, see RequestExpiry.
+func BodyExpiry(expiresAt time.Time) BodyOption {
+	return func(r *bodyRequest) {
+		r.expiresAt = expiresAt
+	}
+}
+
+// expired reports whether the request expiring at the given time, if any, is not worth sending anymore.
+func expired(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+}
+
+// expiresBefore reports whether the request expiring at the given time, if any, expires before the given delay elapses.
+func expiresBefore(expiresAt time.Time, delay time.Duration) bool {
+	return !expiresAt.IsZero() && !time.Now().Add(delay).Before(expiresAt)
+}
+
+// requestOptionsOf returns the request options of the settings of the body.
+func requestOptionsOf(body bodyRequest) []RequestOption {
+	var opts []RequestOption
+	if body.timeout > 0 {
+		opts = append(opts, RequestTimeout(body.timeout))
+	}
+	if !body.expiresAt.IsZero() {
+		opts = append(opts, RequestExpiry(body.expiresAt))
+	}
+
+	return opts
+}
+
+// addBodyRequest adds the request of the body to the bulk request, with the settings of the body, if any.
+func addBodyRequest(bulkRequest *BulkRequest, req *http.Request, body bodyRequest) {
+	if opts := requestOptionsOf(body); len(opts) > 0 {
+		bulkRequest.AddRequestWithOptions(req, opts...)
+	} else {
+		bulkRequest.AddRequest(req)
+	}
+}
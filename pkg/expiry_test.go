@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExpiredRequestsAreNotSent(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	stale, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+	fresh, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest(nil, 2, 2).
+		AddRequestWithOptions(stale, RequestExpiry(time.Now().Add(-time.Minute))).
+		AddRequestWithOptions(fresh, RequestTTL(time.Minute))
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Entries, 2)
+	assert.Equal(t, interr.ErrExpired, result.Entries[0].Err)
+	assert.Nil(t, result.Entries[0].Response)
+	assert.Equal(t, NotStarted, result.Entries[0].State)
+	assert.False(t, interr.IsRetryable(result.Entries[0].Err))
+	assert.Nil(t, result.Entries[1].Err)
+	assert.Equal(t, Completed, result.Entries[1].State)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestRequestsAreNotRetriedAfterTheirExpiry(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithRetry(5, 100*time.Millisecond, 0))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest(nil, 1, 1).AddRequestWithOptions(req, RequestTTL(250*time.Millisecond))
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, result.Entries[0].Err)
+	assert.Equal(t, http.StatusServiceUnavailable, result.Entries[0].Response.StatusCode)
+	assert.Equal(t, 2, result.Entries[0].Attempts)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestBodyExpiry(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	bulkRequest, err := NewBulkRequestBuilder().BaseURL(server.URL).
+		AddBody(strings.NewReader("stale"), BodyExpiry(time.Now().Add(-time.Second))).
+		AddBody(strings.NewReader("fresh"), BodyExpiry(time.Now().Add(time.Minute))).
+		Build()
+	require.NoError(t, err, "no errors")
+
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, interr.ErrExpired, result.Entries[0].Err)
+	assert.Nil(t, result.Entries[1].Err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
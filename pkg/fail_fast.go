@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"net/http"
+	"sync/atomic"
+)
+
+// failFastLimits configures the amount of failures after which a bulk request is aborted.
+type failFastLimits struct {
+	maxFailures int
+	maxRatio    float64
+}
+
+// failFast counts the failures left before a bulk request is aborted, across all its workers.
+type failFast struct {
+	remaining int64
+	aborted   int32
+	cancel    context.CancelFunc
+}
+
+// WithFailFast aborts each call to Send once the amount of failed requests reaches the lowest of maxFailures
+// and of maxRatio times the amount of requests, e.g. 0.2 aborts once a fifth of the requests failed, so that
+// a target that is clearly down doesn't make the whole bulk request wait for the timeouts and the retries.
+// A limit lower than or equal to 0 is ignored and both disable it. The failed requests are the completed ones
+// that didn't succeed, see WithSuccessStatuses, except the expired ones.
+// Once aborted, the requests not completed are cancelled and fail with interr.ErrAborted, and the other results
+// are returned as is.
+func WithFailFast(maxFailures int, maxRatio float64) Option {
+	return func(b *BulkHTTPClient) {
+		if maxFailures <= 0 && maxRatio <= 0 {
+			b.failFast = nil
+			return
+		}
+
+		b.failFast = &failFastLimits{
+			maxFailures: maxFailures,
+			maxRatio:    maxRatio,
+		}
+	}
+}
+
+// newFailFast returns the fail-fast tracker of a bulk request with the given amount of requests,
+// and the context cancelled when the bulk request is aborted.
+// A nil *failFastLimits returns a nil tracker, which never aborts, and the given context.
+func (l *failFastLimits) newFailFast(ctx context.Context, requestsCount int) (*failFast, context.Context) {
+	if l == nil {
+		return nil, ctx
+	}
+
+	remaining := -1
+	if l.maxFailures > 0 {
+		remaining = l.maxFailures
+	}
+	if l.maxRatio > 0 {
+		ratio := int(l.maxRatio * float64(requestsCount))
+		if ratio < 1 {
+			ratio = 1
+		}
+		if remaining < 0 || ratio < remaining {
+			remaining = ratio
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &failFast{remaining: int64(remaining), cancel: cancel}, ctx
+}
+
+// record counts the outcome of a completed request and aborts the bulk request when the failures reach the limit.
+// A nil *failFast does nothing.
+func (f *failFast) record(res *http.Response, err error, successCodes map[int]bool) {
+	if f == nil || err == interr.ErrIgnored || err == interr.ErrExpired || IsSuccess(res, err, successCodes) {
+		return
+	}
+
+	if atomic.AddInt64(&f.remaining, -1) == 0 {
+		atomic.StoreInt32(&f.aborted, 1)
+		f.cancel()
+	}
+}
+
+// isAborted reports whether the bulk request was aborted. A nil *failFast never is.
+func (f *failFast) isAborted() bool {
+	return f != nil && atomic.LoadInt32(&f.aborted) == 1
+}
+
+// release releases the context of the bulk request. A nil *failFast does nothing.
+func (f *failFast) release() {
+	if f != nil {
+		f.cancel()
+	}
+}
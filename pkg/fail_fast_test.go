@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func failFastBulkRequest(t *testing.T, url string, count int) *BulkRequest {
+	bulkRequest := NewBulkRequest(nil, 1, 1)
+	for i := 0; i < count; i++ {
+		req, err := http.NewRequest(http.MethodPost, url, nil)
+		require.NoError(t, err, "no errors")
+		bulkRequest.AddRequest(req)
+	}
+
+	return bulkRequest
+}
+
+func TestFailFastAbortsAfterMaxFailures(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithFailFast(2, 0))
+
+	bulkRequest := failFastBulkRequest(t, server.URL, 20)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Entries, 20)
+	failed, aborted := 0, 0
+	for _, entry := range result.Entries {
+		switch {
+		case entry.Err == nil:
+			assert.Equal(t, http.StatusServiceUnavailable, entry.Response.StatusCode)
+			failed++
+		default:
+			assert.Equal(t, interr.ErrAborted, entry.Err)
+			assert.True(t, interr.IsRetryable(entry.Err))
+			aborted++
+		}
+	}
+	assert.GreaterOrEqual(t, failed, 2)
+	assert.Equal(t, 20, failed+aborted)
+	assert.Less(t, int(atomic.LoadInt32(&hits)), 20)
+}
+
+func TestFailFastAbortsAfterMaxRatio(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithFailFast(0, 0.1))
+
+	bulkRequest := failFastBulkRequest(t, server.URL, 30)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Entries, 30)
+	assert.Equal(t, interr.ErrAborted, result.Entries[29].Err)
+	assert.Less(t, int(atomic.LoadInt32(&hits)), 30)
+}
+
+func TestFailFastIgnoresSuccesses(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&hits, 1)%2 == 0 {
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithFailFast(10, 0), WithSuccessStatuses(http.StatusConflict))
+
+	bulkRequest := failFastBulkRequest(t, server.URL, 10)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for _, entry := range result.Entries {
+		assert.Nil(t, entry.Err)
+	}
+	assert.Equal(t, int32(10), atomic.LoadInt32(&hits))
+}
+
+func TestWithoutFailFast(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithFailFast(0, 0))
+
+	bulkRequest := failFastBulkRequest(t, server.URL, 10)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for _, entry := range result.Entries {
+		assert.Nil(t, entry.Err)
+	}
+	assert.Equal(t, int32(10), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,159 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/pigeonlab/notifier/interr"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// FailureClass is the reason why a request failed, e.g. to tell at a glance why a bulk request failed.
+type FailureClass string
+
+// The failure classes, in the order they are reported by FailureClasses.
+const (
+	FailureTimeout    FailureClass = "timeout"
+	FailureRefused    FailureClass = "refused"
+	FailureDNS        FailureClass = "dns"
+	FailureTLS        FailureClass = "tls"
+	FailureConnection FailureClass = "connection"
+	FailureClient     FailureClass = "4xx"
+	FailureServer     FailureClass = "5xx"
+	FailureHeader     FailureClass = "header"
+	FailureCancelled  FailureClass = "cancelled"
+	FailureAborted    FailureClass = "aborted"
+	FailureSkipped    FailureClass = "skipped"
+	FailureExpired    FailureClass = "expired"
+	FailureOther      FailureClass = "other"
+)
+
+// FailureClasses lists the failure classes in the order they are reported.
+var FailureClasses = []FailureClass{
+	FailureTimeout,
+	FailureRefused,
+	FailureDNS,
+	FailureTLS,
+	FailureConnection,
+	FailureClient,
+	FailureServer,
+	FailureHeader,
+	FailureCancelled,
+	FailureAborted,
+	FailureSkipped,
+	FailureExpired,
+	FailureOther,
+}
+
+// FailureCounts holds the amount of failed requests of each failure class.
+type FailureCounts map[FailureClass]int
+
+// Total returns the amount of failed requests.
+func (c FailureCounts) Total() int {
+	total := 0
+	for _, count := range c {
+		total += count
+	}
+
+	return total
+}
+
+// ClassifyError returns the failure class of a request that failed with the given error.
+// The requests that were never started because of a barrier or a dependency are skipped,
+// the ones ignored when the context was cancelled are cancelled, see WithFailFast for the aborted ones.
+func ClassifyError(err error) FailureClass {
+	var statusErr *interr.StatusError
+	var headerErr *interr.HeaderError
+	var timeoutErr *interr.TimeoutError
+	var dnsErr *net.DNSError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	var connectionErr *interr.ConnectionError
+	switch {
+	case errors.Is(err, interr.ErrIgnored), errors.Is(err, context.Canceled):
+		return FailureCancelled
+	case errors.Is(err, interr.ErrAborted):
+		return FailureAborted
+	case errors.Is(err, interr.ErrBarrierNotPassed), errors.Is(err, interr.ErrDependencyFailed):
+		return FailureSkipped
+	case errors.Is(err, interr.ErrExpired):
+		return FailureExpired
+	case errors.As(err, &statusErr):
+		return ClassifyStatus(statusErr.Code)
+	case errors.As(err, &headerErr):
+		return FailureHeader
+	case errors.As(err, &timeoutErr), errors.Is(err, interr.ErrBulkDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return FailureTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return FailureRefused
+	case errors.As(err, &dnsErr):
+		return FailureDNS
+	case errors.As(err, &authorityErr), errors.As(err, &invalidErr), errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		return FailureTLS
+	case errors.As(err, &connectionErr):
+		return FailureConnection
+	default:
+		return FailureOther
+	}
+}
+
+// ClassifyStatus returns the failure class of a request that completed with the given unsuccessful status code.
+func ClassifyStatus(code int) FailureClass {
+	switch {
+	case code >= 500:
+		return FailureServer
+	case code >= 400:
+		return FailureClient
+	default:
+		return FailureOther
+	}
+}
+
+// classifyFailure returns the failure class of a request completed with the given response and error,
+// or an empty class when it succeeded.
+func classifyFailure(res *http.Response, err error, successCodes map[int]bool) FailureClass {
+	switch {
+	case err != nil:
+		return ClassifyError(err)
+	case res == nil:
+		return FailureOther
+	case IsSuccess(res, nil, successCodes):
+		return ""
+	default:
+		return ClassifyStatus(res.StatusCode)
+	}
+}
+
+// FailureCounts returns the amount of failed entries of each failure class, see Failed.
+func (r BulkResult) FailureCounts() FailureCounts {
+	counts := make(FailureCounts)
+	for _, entry := range r.Entries {
+		if class := classifyFailure(entry.Response, entry.Err, r.successCodes); class != "" {
+			counts[class]++
+		}
+	}
+
+	return counts
+}
+
+// FailureCounts returns the amount of failed requests of each failure class from the responses and the errors
+// returned by Do, honoring WithSuccessStatuses.
+func (b *BulkHTTPClient) FailureCounts(responses []*http.Response, errs []error) FailureCounts {
+	counts := make(FailureCounts)
+	for i, err := range errs {
+		var res *http.Response
+		if i < len(responses) {
+			res = responses[i]
+		}
+		if class := classifyFailure(res, err, b.successCodes); class != "" {
+			counts[class]++
+		}
+	}
+
+	return counts
+}
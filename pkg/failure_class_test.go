@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := map[string]struct {
+		err   error
+		class FailureClass
+	}{
+		"timeout":          {&interr.TimeoutError{Err: context.DeadlineExceeded}, FailureTimeout},
+		"bulk deadline":    {interr.ErrBulkDeadlineExceeded, FailureTimeout},
+		"refused":          {&interr.ConnectionError{Err: &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}}, FailureRefused},
+		"unknown host":     {&interr.ConnectionError{Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, FailureDNS},
+		"invalid cert":     {&interr.ConnectionError{Err: x509.UnknownAuthorityError{}}, FailureTLS},
+		"reset connection": {&interr.ConnectionError{Err: syscall.ECONNRESET}, FailureConnection},
+		"bad request":      {&interr.StatusError{Code: http.StatusBadRequest}, FailureClient},
+		"unavailable":      {fmt.Errorf("sending: %w", &interr.StatusError{Code: http.StatusServiceUnavailable}), FailureServer},
+		"ignored":          {interr.ErrIgnored, FailureCancelled},
+		"canceled":         {context.Canceled, FailureCancelled},
+		"aborted":          {interr.ErrAborted, FailureAborted},
+		"barrier":          {interr.ErrBarrierNotPassed, FailureSkipped},
+		"dependency":       {interr.ErrDependencyFailed, FailureSkipped},
+		"expired":          {interr.ErrExpired, FailureExpired},
+		"retry budget":     {interr.ErrRetryBudgetExhausted, FailureOther},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.class, ClassifyError(test.err))
+		})
+	}
+}
+
+func TestFailureCounts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/down":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/conflict":
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "no errors")
+	closedURL := "http://" + listener.Addr().String()
+	require.NoError(t, listener.Close(), "no errors")
+	client := NewClient(&http.Client{}, WithSuccessStatuses(http.StatusConflict))
+
+	var requests []*http.Request
+	for _, URL := range []string{server.URL, server.URL + "/missing", server.URL + "/down", server.URL + "/down", server.URL + "/conflict", closedURL} {
+		req, err := http.NewRequest(http.MethodGet, URL, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	bulkRequest := NewBulkRequest(requests, 2, 2)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	counts := result.FailureCounts()
+	assert.Equal(t, FailureCounts{FailureClient: 1, FailureServer: 2, FailureRefused: 1}, counts)
+	assert.Equal(t, 4, counts.Total())
+	assert.Equal(t, counts, client.FailureCounts(result.Responses(), result.Errors()))
+}
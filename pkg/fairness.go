@@ -0,0 +1,55 @@
+package pkg
+
+import "net/http"
+
+// TenantKey returns the tenant of a request, e.g. a customer identifier or the target host.
+type TenantKey func(*http.Request) string
+
+// ScheduleByTenant makes the client start the requests in round-robin across the tenants returned by the key,
+// in the order the tenants first appear, instead of in the order the requests were added.
+// This way a tenant with a flood of requests doesn't delay the requests of the other tenants.
+// The responses are still returned in the order the requests were added.
+func (b *BulkRequest) ScheduleByTenant(key TenantKey) *BulkRequest {
+	b.tenantKey = key
+	return b
+}
+
+// fairOrder returns the given request indexes in round-robin across the tenants.
+// The indexes are returned as is when the requests are not scheduled by tenant.
+func (b *BulkRequest) fairOrder(indexes []int) []int {
+	if b.tenantKey == nil {
+		return indexes
+	}
+
+	var tenants []string
+	queues := make(map[string][]int)
+	for _, index := range indexes {
+		tenant := b.tenantKey(b.requests[index])
+		if _, ok := queues[tenant]; !ok {
+			tenants = append(tenants, tenant)
+		}
+		queues[tenant] = append(queues[tenant], index)
+	}
+
+	order := make([]int, 0, len(indexes))
+	for len(order) < len(indexes) {
+		for _, tenant := range tenants {
+			if queue := queues[tenant]; len(queue) > 0 {
+				order = append(order, queue[0])
+				queues[tenant] = queue[1:]
+			}
+		}
+	}
+
+	return order
+}
+
+// allIndexes returns the indexes of the given amount of requests.
+func allIndexes(count int) []int {
+	indexes := make([]int, count)
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	return indexes
+}
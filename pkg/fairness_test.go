@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRequestsAreStartedInRoundRobinAcrossTenants(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, req.URL.Query().Get("id"))
+		mu.Unlock()
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{})
+
+	var requests []*http.Request
+	for _, id := range []string{"a1", "a2", "a3", "b1", "c1", "b2"} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"?id="+id, nil)
+		require.NoError(t, err, "no errors")
+		req.Header.Set("X-Tenant", id[:1])
+		requests = append(requests, req)
+	}
+
+	bulkRequest := NewBulkRequest(requests, 1, 1).ScheduleByTenant(func(req *http.Request) string {
+		return req.Header.Get("X-Tenant")
+	})
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, []string{"a1", "b1", "c1", "a2", "b2", "a3"}, arrivals)
+	assert.Equal(t, []error{nil, nil, nil, nil, nil, nil}, errs)
+	assert.Equal(t, "id=b2", responses[5].Request.URL.RawQuery)
+}
@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// WithHedging makes the client fire a duplicate of each request that hasn't returned after the given delay.
+// The first successful attempt is kept and the other one is cancelled. When both fail, the last error is returned.
+// The body of the duplicate is recreated the same way as for the retries, see WithRetryPolicy.
+// A delay lower than or equal to 0 disables the hedging.
+func WithHedging(delay time.Duration) Option {
+	return func(b *BulkHTTPClient) {
+		b.hedgeDelay = delay
+	}
+}
+
+// hedgeAttempt represents the outcome of an attempt of a hedged request.
+type hedgeAttempt struct {
+	res     *http.Response
+	err     error
+	attempt int
+}
+
+// cancelOnClose is a response body cancelling the context of its request once closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the request's context.
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// attempt sends the request once, hedging it if enabled.
+func (b *BulkHTTPClient) attempt(req *http.Request) (*http.Response, error) {
+	if b.hedgeDelay <= 0 {
+		return b.send(req)
+	}
+
+	return b.hedge(req)
+}
+
+// hedge sends the request and, if it hasn't returned after the hedging delay, a duplicate.
+// It returns the first successful attempt and cancels the other one.
+func (b *BulkHTTPClient) hedge(req *http.Request) (*http.Response, error) {
+	attempts := make(chan hedgeAttempt, 2)
+	var cancels []context.CancelFunc
+	fire := func(r *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels = append(cancels, cancel)
+		attempt := len(cancels) - 1
+		go func() {
+			res, err := b.send(r.WithContext(ctx))
+			attempts <- hedgeAttempt{res: res, err: err, attempt: attempt}
+		}()
+	}
+
+	fire(req)
+	timer := time.NewTimer(b.hedgeDelay)
+	defer timer.Stop()
+
+	var last hedgeAttempt
+	for received := 0; received < len(cancels); {
+		select {
+		case <-timer.C:
+			if duplicate, err := cloneRequest(req); err == nil {
+				fire(duplicate)
+			}
+
+		case outcome := <-attempts:
+			received++
+			if outcome.err != nil {
+				cancels[outcome.attempt]()
+				last = outcome
+				continue
+			}
+
+			for attempt, cancel := range cancels {
+				if attempt != outcome.attempt {
+					cancel()
+				}
+			}
+			go discardAttempts(attempts, len(cancels)-received)
+
+			outcome.res.Body = cancelOnClose{ReadCloser: outcome.res.Body, cancel: cancels[outcome.attempt]}
+			return outcome.res, nil
+		}
+	}
+
+	return last.res, last.err
+}
+
+// discardAttempts waits for the given amount of cancelled attempts and releases their responses.
+func discardAttempts(attempts <-chan hedgeAttempt, count int) {
+	for i := 0; i < count; i++ {
+		outcome := <-attempts
+		if outcome.res != nil {
+			_, _ = io.Copy(ioutil.Discard, outcome.res.Body)
+			_ = outcome.res.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSlowRequestIsHedged(t *testing.T) {
+	var attempts int32
+	cancelled := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			select {
+			case <-req.Context().Done():
+				cancelled <- struct{}{}
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		_, _ = w.Write(append([]byte("hedged "), body...))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithHedging(20*time.Millisecond))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString("body"))
+	require.NoError(t, err, "no errors")
+
+	start := time.Now()
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, errs[0])
+	body, _ := ioutil.ReadAll(responses[0].Body)
+	assert.Equal(t, "hedged body", string(body))
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	select {
+	case <-cancelled:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("the slow attempt has not been cancelled")
+	}
+}
+
+func TestFastRequestIsNotHedged(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithHedging(100*time.Millisecond))
+
+	bulkRequest := newClientWithNRequests(3, server.URL)
+	_, errs := client.Do(bulkRequest)
+	bulkRequest.CloseAllResponses()
+	time.Sleep(150 * time.Millisecond)
+
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import "net/http"
+
+// Hooks are the callbacks invoked as the requests of the bulk requests progress, e.g. to update metrics
+// or to log the failures live from a long-running process. They are invoked from the workers, concurrently,
+// so they must be safe for concurrent use and return quickly. They must not read nor close the response bodies,
+// which are returned by Send as usual. The nil hooks are skipped.
+type Hooks struct {
+	// OnSuccess is invoked with the result of each request completed successfully, as soon as it completes.
+	OnSuccess func(result Result)
+	// OnFailure is invoked with the result of each failed request, as soon as it fails. The requests never sent,
+	// e.g. because of a barrier or of the cancellation of the context, are reported once the bulk request completes.
+	OnFailure func(result Result)
+	// OnRetry is invoked before each retry with the request and the outcome of the attempt being retried,
+	// numbered from 1.
+	OnRetry func(req *http.Request, attempt int, res *http.Response, err error)
+}
+
+// WithHooks makes the client invoke the given hooks for every request of the bulk requests.
+// The success of a request honors WithSuccessStatuses.
+func WithHooks(hooks Hooks) Option {
+	return func(b *BulkHTTPClient) {
+		b.hooks = &hooks
+	}
+}
+
+// complete invokes the OnSuccess or the OnFailure hook with the result of a request.
+func (h *Hooks) complete(result Result, successCodes map[int]bool) {
+	if h == nil {
+		return
+	}
+
+	if IsSuccess(result.Response, result.Err, successCodes) {
+		if h.OnSuccess != nil {
+			h.OnSuccess(result)
+		}
+		return
+	}
+
+	if h.OnFailure != nil {
+		h.OnFailure(result)
+	}
+}
+
+// retry invokes the OnRetry hook before the retry of a request.
+func (h *Hooks) retry(req *http.Request, attempt int, res *http.Response, err error) {
+	if h == nil || h.OnRetry == nil {
+		return
+	}
+
+	h.OnRetry(req, attempt, res, err)
+}
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHooksAreInvokedForEveryRequest(t *testing.T) {
+	var flakyAttempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/flaky":
+			if atomic.AddInt32(&flakyAttempts, 1) < 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var succeeded, failed []int
+	var retried []int
+	client := NewClient(&http.Client{}, WithRetry(3, time.Millisecond, 0), WithHooks(Hooks{
+		OnSuccess: func(result Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			succeeded = append(succeeded, result.Index)
+		},
+		OnFailure: func(result Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, result.Index)
+		},
+		OnRetry: func(req *http.Request, attempt int, res *http.Response, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, "/flaky", req.URL.Path)
+			assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+			retried = append(retried, attempt)
+		},
+	}))
+
+	flaky, err := http.NewRequest(http.MethodGet, server.URL+"/flaky", nil)
+	require.NoError(t, err, "no errors")
+
+	missing, err := http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	require.NoError(t, err, "no errors")
+
+	notSent, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{flaky, missing}, 2, 2).Barrier().AddRequest(notSent)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, interr.ErrBarrierNotPassed, result.Entries[2].Err)
+	assert.Equal(t, []int{0}, succeeded)
+	assert.ElementsMatch(t, []int{1, 2}, failed)
+	assert.Equal(t, []int{1}, retried)
+}
+
+func TestHooksHonorTheSuccessStatuses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	var succeeded int32
+	client := NewClient(&http.Client{}, WithSuccessStatuses(http.StatusNotModified), WithHooks(Hooks{
+		OnSuccess: func(result Result) {
+			atomic.AddInt32(&succeeded, 1)
+		},
+	}))
+
+	bulkRequest := newClientWithNRequests(4, server.URL)
+	client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, int32(4), atomic.LoadInt32(&succeeded))
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+)
+
+// TransportHTTP2 forces or disables HTTP/2. Enabled, HTTP/2 is negotiated with ALPN over TLS even when the transport
+// has a custom dialer or TLS configuration, see http.Transport.ForceAttemptHTTP2. Disabled, the requests are sent
+// with HTTP/1.1 only. By default, NewTransport attempts HTTP/2 like http.DefaultTransport.
+func TransportHTTP2(enabled bool) TransportOption {
+	return func(s *transportSettings) {
+		s.transport.ForceAttemptHTTP2 = enabled
+		if enabled {
+			s.transport.TLSNextProto = nil
+			return
+		}
+
+		s.transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+}
+
+// multiplexing sends a single request to each host until the protocol negotiated with the host is known.
+type multiplexing struct {
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// WithMultiplexing makes the client wait for the response to the first request sent to each host before sending
+// the other ones. Without it, the workers starting together each dial their own connection to the host, even when
+// a single HTTP/2 connection could multiplex all their requests: with it, once the host negotiated HTTP/2, the requests
+// in flight share its connection instead. The hosts speaking HTTP/1.1 get a connection per request in flight as usual,
+// after their first response. The negotiated protocol of each request is reported by Result.Protocol.
+func WithMultiplexing() Option {
+	return func(b *BulkHTTPClient) {
+		b.multiplexing = &multiplexing{hosts: map[string]chan struct{}{}}
+	}
+}
+
+// wait blocks until the protocol of the host of the request is known or the request's context is done.
+// It reports whether the request is the first one sent to its host, which must then be completed with done.
+// A nil *multiplexing never blocks.
+func (m *multiplexing) wait(req *http.Request) (bool, error) {
+	if m == nil {
+		return false, nil
+	}
+
+	key := req.URL.Scheme + "://" + req.URL.Host
+	m.mu.Lock()
+	known, ok := m.hosts[key]
+	if !ok {
+		m.hosts[key] = make(chan struct{})
+		m.mu.Unlock()
+		return true, nil
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-known:
+		return false, nil
+	case <-req.Context().Done():
+		return false, req.Context().Err()
+	}
+}
+
+// done releases the requests waiting for the first request sent to its host, once it completed.
+// They are released even when it failed: the protocol of the host is then unknown, and its requests are not held back.
+func (m *multiplexing) done(req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	close(m.hosts[req.URL.Scheme+"://"+req.URL.Host])
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newHTTP2Server returns a TLS server negotiating HTTP/2, which counts its connections.
+func newHTTP2Server(connections *int32) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	server.EnableHTTP2 = true
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(connections, 1)
+		}
+	}
+	server.StartTLS()
+
+	return server
+}
+
+// newHTTP2Transport returns a transport trusting the server, with HTTP/2 enabled or not.
+func newHTTP2Transport(server *httptest.Server, enabled bool) *http.Transport {
+	transport := NewTransport(TransportHTTP2(enabled))
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+
+	return transport
+}
+
+func TestTheRequestsAreMultiplexedOverHTTP2(t *testing.T) {
+	var connections int32
+	server := newHTTP2Server(&connections)
+	defer server.Close()
+	client := NewClient(&http.Client{Transport: newHTTP2Transport(server, true)}, WithMultiplexing())
+
+	bulkRequest := newClientWithNRequests(20, server.URL)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, result.Err)
+	require.Len(t, result.Entries, 20)
+	for _, entry := range result.Entries {
+		require.NoError(t, entry.Err, "no errors")
+		assert.Equal(t, "HTTP/2.0", entry.Protocol)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections), "a single connection")
+}
+
+func TestHTTP2CanBeDisabled(t *testing.T) {
+	var connections int32
+	server := newHTTP2Server(&connections)
+	defer server.Close()
+	client := NewClient(&http.Client{Transport: newHTTP2Transport(server, false)}, WithMultiplexing())
+
+	bulkRequest := newClientWithNRequests(5, server.URL)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Entries, 5)
+	for _, entry := range result.Entries {
+		require.NoError(t, entry.Err, "no errors")
+		assert.Equal(t, "HTTP/1.1", entry.Protocol)
+	}
+	assert.True(t, atomic.LoadInt32(&connections) > 1, "a connection per request in flight")
+}
+
+func TestTheOtherRequestsWaitForTheFirstResponseOfTheirHost(t *testing.T) {
+	multiplexer := &multiplexing{hosts: map[string]chan struct{}{}}
+	probe, _ := http.NewRequest(http.MethodGet, "https://example.com/a", nil)
+	isFirst, err := multiplexer.wait(probe)
+	require.NoError(t, err, "no errors")
+	assert.True(t, isFirst)
+
+	other, _ := http.NewRequest(http.MethodGet, "https://example.org/a", nil)
+	isFirst, err = multiplexer.wait(other)
+	require.NoError(t, err, "no errors")
+	assert.True(t, isFirst, "another host")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	waiting, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/b", nil)
+	_, err = multiplexer.wait(waiting)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	multiplexer.done(waiting)
+	released, _ := http.NewRequest(http.MethodGet, "https://example.com/c", nil)
+	isFirst, err = multiplexer.wait(released)
+	require.NoError(t, err, "no errors")
+	assert.False(t, isFirst)
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"sync"
+)
+
+// earlyHintsKey is the context key of the 103 Early Hints received for a request.
+type earlyHintsKey struct{}
+
+// earlyHints collects the headers of the 103 Early Hints responses received for a request.
+type earlyHints struct {
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+// EarlyHints returns the headers of the 103 Early Hints interim responses received before the given response,
+// in the order they were received. With retries or hedging, it includes the ones of every attempt.
+// It returns nil for the responses without early hints and for the ones not returned by a BulkHTTPClient.
+func EarlyHints(res *http.Response) []http.Header {
+	if res == nil || res.Request == nil {
+		return nil
+	}
+
+	hints, ok := res.Request.Context().Value(earlyHintsKey{}).(*earlyHints)
+	if !ok {
+		return nil
+	}
+
+	hints.mu.Lock()
+	defer hints.mu.Unlock()
+	return append([]http.Header(nil), hints.headers...)
+}
+
+// traceEarlyHints returns the request with a trace collecting the 103 Early Hints received for it.
+// The other interim responses, e.g. 100 Continue, are left to the HTTP client.
+func traceEarlyHints(req *http.Request) *http.Request {
+	hints := &earlyHints{}
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				hints.mu.Lock()
+				hints.headers = append(hints.headers, http.Header(header).Clone())
+				hints.mu.Unlock()
+			}
+			return nil
+		},
+	}
+
+	ctx := context.WithValue(req.Context(), earlyHintsKey{}, hints)
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace))
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEarlyHintsAndTrailersAreSurfaced(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("delivered"))
+		w.Header().Set("X-Checksum", "abc")
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{})
+
+	bulkRequest := newClientWithNRequests(1, server.URL)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, errs[0])
+	body, _ := ioutil.ReadAll(responses[0].Body)
+	assert.Equal(t, http.StatusOK, responses[0].StatusCode)
+	assert.Equal(t, "delivered", string(body))
+	assert.Equal(t, "abc", responses[0].Trailer.Get("X-Checksum"))
+
+	hints := EarlyHints(responses[0])
+	require.Len(t, hints, 1)
+	assert.Equal(t, "</style.css>; rel=preload", hints[0].Get("Link"))
+}
+
+// switchingProtocolsClient is an HTTP client returning a 101 Switching Protocols response
+// whose body, the upgraded connection, never ends.
+type switchingProtocolsClient struct{}
+
+func (switchingProtocolsClient) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusSwitchingProtocols,
+		Status:     "101 Switching Protocols",
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(infiniteReader{}),
+		Request:    req,
+	}, nil
+}
+
+// infiniteReader is a reader that never reaches the end.
+type infiniteReader struct{}
+
+func (infiniteReader) Read(p []byte) (int, error) {
+	return copy(p, strings.Repeat("x", len(p))), nil
+}
+
+func TestInformationalFinalResponseIsNotRead(t *testing.T) {
+	client := NewBulkHTTPClient(context.Background(), switchingProtocolsClient{})
+
+	bulkRequest := newClientWithNRequests(1, "http://example.com")
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, errs[0])
+	body, _ := ioutil.ReadAll(responses[0].Body)
+	assert.Equal(t, http.StatusSwitchingProtocols, responses[0].StatusCode)
+	assert.Empty(t, body)
+	assert.Nil(t, EarlyHints(responses[0]))
+}
@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"io"
+	"sync"
+)
+
+// memoryGuard accounts the request and response bodies held in memory by the client.
+// The request bodies are accounted while the requests are in flight and the response bodies
+// until they are closed, e.g. with BulkRequest.CloseAllResponses. It enforces two budgets:
+// the memory limit, over both, and the in-flight limit, over the request bodies only.
+// A zero limit disables its budget.
+type memoryGuard struct {
+	mu          sync.Mutex
+	changed     chan struct{}
+	limit       int64
+	maxInFlight int64
+	inFlight    int64
+	buffered    int64
+}
+
+// WithMemoryLimit limits the amount of bytes of request and response bodies held in memory by the client.
+// The requests wait for the in-flight requests to complete as long as their bodies would exceed the limit.
+// When a response body does not fit in the limit because of the responses not closed yet,
+// the response is discarded and the request fails with interr.ErrMemoryLimitExceeded.
+// The requests whose body does not fit in the limit fail the same way without being sent.
+// A limit lower than 1 disables the guard.
+func WithMemoryLimit(maxBytes int64) Option {
+	return func(b *BulkHTTPClient) {
+		if maxBytes < 1 {
+			maxBytes = 0
+		}
+		b.memoryGuard().limit = maxBytes
+	}
+}
+
+// WithMaxInFlightBytes limits the amount of request body bytes in flight, across all the workers and the bulk requests,
+// so that a few huge requests don't saturate the uplink while the request count stays low. It is a budget of
+// the memory guard, see WithMemoryLimit: a request waits for the in-flight ones to complete as long as its body
+// would exceed the limit, or until its context is done. A body larger than the limit is sent alone. The bodies
+// of unknown length are not accounted. The attempts of the retried and the hedged requests are accounted once.
+// See InFlightBytes to monitor the bytes in flight. A limit lower than 1 disables it.
+func WithMaxInFlightBytes(maxBytes int64) Option {
+	return func(b *BulkHTTPClient) {
+		if maxBytes < 1 {
+			maxBytes = 0
+		}
+		b.memoryGuard().maxInFlight = maxBytes
+	}
+}
+
+// InFlightBytes returns the amount of request body bytes in flight, e.g. to export it as a metric.
+// It returns 0 without WithMaxInFlightBytes or WithMemoryLimit.
+func (b *BulkHTTPClient) InFlightBytes() int64 {
+	if b.memory == nil {
+		return 0
+	}
+
+	b.memory.mu.Lock()
+	defer b.memory.mu.Unlock()
+	return b.memory.inFlight
+}
+
+// memoryGuard returns the memory guard of the client, created on first use.
+func (b *BulkHTTPClient) memoryGuard() *memoryGuard {
+	if b.memory == nil {
+		b.memory = &memoryGuard{changed: make(chan struct{})}
+	}
+
+	return b.memory
+}
+
+// acquire accounts the body of a request about to be sent. It blocks while the body does not fit because of
+// the in-flight requests, until the context is done, and fails if it does not fit because of the buffered responses.
+func (m *memoryGuard) acquire(ctx context.Context, size int64) error {
+	for {
+		m.mu.Lock()
+		if m.limit > 0 && m.buffered+size > m.limit && (m.buffered > 0 || m.inFlight == 0) {
+			m.mu.Unlock()
+			return interr.ErrMemoryLimitExceeded
+		}
+		fitsMemory := m.limit == 0 || m.buffered+m.inFlight+size <= m.limit
+		fitsInFlight := m.maxInFlight == 0 || m.inFlight+size <= m.maxInFlight
+		if m.inFlight == 0 || (fitsMemory && fitsInFlight) {
+			m.inFlight += size
+			m.mu.Unlock()
+			return nil
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release releases the body of a completed request.
+func (m *memoryGuard) release(size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight -= size
+	m.notify()
+}
+
+// buffer accounts a response body read in memory. It fails if the body exceeds the memory limit.
+func (m *memoryGuard) buffer(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.limit > 0 && m.buffered+size > m.limit {
+		return interr.ErrMemoryLimitExceeded
+	}
+
+	m.buffered += size
+	return nil
+}
+
+// unbuffer releases a closed response body.
+func (m *memoryGuard) unbuffer(size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.buffered -= size
+	m.notify()
+}
+
+// notify wakes up the requests waiting for the guard. It must be called with the lock held.
+func (m *memoryGuard) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// guardedWriter accounts the bytes written to a response buffer with the memory guard before writing them,
+// so that a response body exceeding the limit fails without being read in memory first.
+type guardedWriter struct {
+	w      io.Writer
+	memory *memoryGuard
+}
+
+// Write implements the io.Writer interface. It fails with interr.ErrMemoryLimitExceeded when the bytes don't fit.
+func (g guardedWriter) Write(p []byte) (int, error) {
+	if err := g.memory.buffer(int64(len(p))); err != nil {
+		return 0, err
+	}
+
+	return g.w.Write(p)
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResponsesExceedingTheMemoryLimitAreDiscarded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithMemoryLimit(25))
+
+	bulkRequest := newClientWithNRequests(3, server.URL)
+	bulkRequest.dispatchRequestsWorkers, bulkRequest.responseProcessorWorkers = 1, 1
+	responses, errs := client.Do(bulkRequest)
+
+	assert.Equal(t, []error{nil, nil, interr.ErrMemoryLimitExceeded}, errs)
+	assert.Nil(t, responses[2])
+
+	bulkRequest.CloseAllResponses()
+	responses, errs = client.Do(newClientWithNRequests(2, server.URL))
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, 2, len(responses))
+}
+
+func TestRequestBodiesExceedingTheMemoryLimitAreNotSent(t *testing.T) {
+	sent := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sent++
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithMemoryLimit(5))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString("0123456789"))
+	require.NoError(t, err, "no errors")
+
+	_, errs := client.Do(NewBulkRequest([]*http.Request{req}, 1, 1))
+
+	assert.Equal(t, []error{interr.ErrMemoryLimitExceeded}, errs)
+	assert.Equal(t, 0, sent)
+}
+
+// countingReader is an endless body counting the bytes read from it.
+type countingReader struct {
+	read int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestLargeResponsesAreRejectedWhileRead(t *testing.T) {
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithMemoryLimit(1000))
+	body := &countingReader{}
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	res := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(body), ContentLength: -1}
+
+	_, err := client.responseBody(req, res)
+
+	assert.Equal(t, interr.ErrMemoryLimitExceeded, err)
+	assert.True(t, body.read < 64*1024, "the body is not read beyond the limit: %d bytes read", body.read)
+	assert.Equal(t, int64(0), client.memory.buffered)
+}
+
+func TestReplayableBodiesExceedingTheMemoryLimitAreNotRead(t *testing.T) {
+	body := &countingReader{}
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", ioutil.NopCloser(body))
+	require.NoError(t, err, "no errors")
+
+	_, err = replayable(req, 1000)
+
+	assert.Equal(t, interr.ErrMemoryLimitExceeded, err)
+	assert.True(t, body.read < 64*1024, "the body is not read beyond the limit: %d bytes read", body.read)
+}
+
+func TestTheBytesInFlightAreLimited(t *testing.T) {
+	var current, peak int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		size := atomic.AddInt64(&current, int64(len(body)))
+		for {
+			max := atomic.LoadInt64(&peak)
+			if size <= max || atomic.CompareAndSwapInt64(&peak, max, size) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt64(&current, -int64(len(body)))
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithMaxInFlightBytes(250))
+
+	var requests []*http.Request
+	for i := 0; i < 6; i++ {
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString(strings.Repeat("x", 100)))
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	bulkRequest := NewBulkRequest(requests, 6, 6)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Len(t, result.Succeeded(), 6)
+	assert.True(t, atomic.LoadInt64(&peak) <= 250, "%d bytes were in flight", atomic.LoadInt64(&peak))
+	assert.Equal(t, int64(0), client.InFlightBytes())
+}
+
+func TestABodyLargerThanTheInFlightLimitIsSentAlone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithMaxInFlightBytes(10))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString(strings.Repeat("x", 100)))
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, result.Entries[0].Err)
+	assert.Equal(t, http.StatusOK, result.Entries[0].Response.StatusCode)
+}
+
+func TestTheMemoryLimitAndTheInFlightLimitShareTheGuard(t *testing.T) {
+	client := NewClient(&http.Client{}, WithMaxInFlightBytes(100), WithMemoryLimit(1000))
+	require.NotNil(t, client.memory)
+	assert.Equal(t, int64(1000), client.memory.limit)
+	assert.Equal(t, int64(100), client.memory.maxInFlight)
+
+	require.NoError(t, client.memory.acquire(context.Background(), 80), "no errors")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, client.memory.acquire(ctx, 80), "the wait stops with the context")
+	assert.Equal(t, int64(80), client.InFlightBytes())
+
+	client.memory.release(80)
+	assert.Equal(t, int64(0), client.InFlightBytes())
+}
@@ -0,0 +1,36 @@
+package pkg
+
+import "net/http"
+
+// Doer sends a single HTTP request. It is the HTTPClient interface, wrapped by the middlewares.
+type Doer = HTTPClient
+
+// DoerFunc is a function sending a single HTTP request. It implements the Doer interface.
+type DoerFunc func(*http.Request) (*http.Response, error)
+
+// Do implements the Doer interface.
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the Doer sending the requests, e.g. to inject an authentication header,
+// to log the requests or to sign them.
+type Middleware func(next Doer) Doer
+
+// Use adds the given middlewares to the client. They wrap every attempt of every request, retries and hedged
+// duplicates included, right before it is sent by the HTTPClient: the rate limit, the adaptive concurrency
+// and the response cache apply first. The first middleware added is the outermost one.
+// Use must be called before the client sends requests.
+func (b *BulkHTTPClient) Use(middlewares ...Middleware) {
+	b.middlewares = append(b.middlewares, middlewares...)
+}
+
+// doer returns the HTTPClient wrapped by the middlewares.
+func (b *BulkHTTPClient) doer() Doer {
+	doer := Doer(b.HTTPClient)
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		doer = b.middlewares[i](doer)
+	}
+
+	return doer
+}
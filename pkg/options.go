@@ -0,0 +1,4 @@
+package pkg
+
+// Option configures a BulkHTTPClient.
+type Option func(*BulkHTTPClient)
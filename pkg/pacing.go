@@ -0,0 +1,43 @@
+package pkg
+
+import "time"
+
+// Pace spreads the starts of the requests evenly over the given duration instead of starting them all at once,
+// smoothing the load seen by the targets: the requests are started every duration divided by the amount of requests.
+// With barriers, dependencies or sub-batches, the requests of each step are started at the same pace.
+// A request still waits for a free dispatch worker. A duration lower than or equal to 0 disables it.
+func (b *BulkRequest) Pace(over time.Duration) *BulkRequest {
+	b.pacing = over
+	return b
+}
+
+// paceGap returns the time between the starts of two requests of the bulk request, 0 when it isn't paced.
+func (b *BulkRequest) paceGap() time.Duration {
+	if b.pacing <= 0 || len(b.requests) == 0 {
+		return 0
+	}
+
+	return b.pacing / time.Duration(len(b.requests))
+}
+
+// waitTurn waits until the start time of the request at the given position, counted from the given start,
+// and reports whether it was reached before the context was done.
+func (b *BulkRequest) waitTurn(start time.Time, position int) bool {
+	if b.gap <= 0 || position == 0 {
+		return true
+	}
+
+	wait := time.Until(start.Add(time.Duration(position) * b.gap))
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-b.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThePacedRequestsAreSpreadOverTheDuration(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		arrivals = append(arrivals, time.Now())
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	var requests []*http.Request
+	for i := 0; i < 4; i++ {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	bulkRequest := NewBulkRequest(requests, 4, 4).Pace(200 * time.Millisecond)
+	start := time.Now()
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Len(t, result.Succeeded(), 4)
+	require.Len(t, arrivals, 4)
+	assert.True(t, arrivals[3].Sub(start) >= 150*time.Millisecond, "the last request started after %s", arrivals[3].Sub(start))
+	for i := 1; i < len(arrivals); i++ {
+		assert.True(t, arrivals[i].Sub(arrivals[i-1]) >= 30*time.Millisecond, "the requests %d and %d started %s apart", i-1, i, arrivals[i].Sub(arrivals[i-1]))
+	}
+}
+
+func TestThePacedRequestsNotStartedOnCancellationAreIgnored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	var requests []*http.Request
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	bulkRequest := NewBulkRequest(requests, 3, 3).Pace(3 * time.Second)
+	start := time.Now()
+	result := client.Send(ctx, bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Len(t, result.Succeeded(), 1)
+	assert.Equal(t, []error{nil, interr.ErrIgnored, interr.ErrIgnored}, result.Errors())
+}
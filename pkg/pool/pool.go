@@ -0,0 +1,178 @@
+// Package pool executes jobs in bulk with a bounded amount of workers.
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Result is the result of a submitted job.
+// Done is false when the job didn't complete before the context was done.
+type Result[R any] struct {
+	Value R
+	Done  bool
+}
+
+// Bulk executes the submitted jobs of type T with a bounded amount of workers
+// and returns their results of type R in the order the jobs were submitted.
+// Once its context is done, no more jobs are started and Wait returns without waiting for the running ones.
+type Bulk[T, R any] struct {
+	ctx      context.Context
+	workers  int
+	work     func(ctx context.Context, job T) R
+	onResult func(index int, result R)
+	discard  func(result R)
+
+	start   sync.Once
+	jobs    chan job[T]
+	running sync.WaitGroup
+
+	// collect serializes the calls to onResult, as if the results were collected by a single goroutine.
+	collect sync.Mutex
+	mu      sync.Mutex
+	results []Result[R]
+	stopped bool
+}
+
+// job is a submitted job and its submission index.
+type job[T any] struct {
+	value T
+	index int
+}
+
+// New returns a new instance of Bulk executing the jobs with the given work function and at most the given amount
+// of workers, at least one. The context is passed to the work function.
+func New[T, R any](ctx context.Context, workers int, work func(ctx context.Context, job T) R) *Bulk[T, R] {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Bulk[T, R]{
+		ctx:     ctx,
+		workers: workers,
+		work:    work,
+		jobs:    make(chan job[T]),
+	}
+}
+
+// OnResult sets the function receiving each result as soon as its job completes,
+// together with the submission index of the job. The calls never overlap.
+// It must be set before submitting the first job.
+func (b *Bulk[T, R]) OnResult(onResult func(index int, result R)) *Bulk[T, R] {
+	b.onResult = onResult
+	return b
+}
+
+// OnDiscard sets the function receiving the results of the jobs completed after Wait returned
+// because the context was done, e.g. to release their resources.
+// It must be set before submitting the first job.
+func (b *Bulk[T, R]) OnDiscard(discard func(result R)) *Bulk[T, R] {
+	b.discard = discard
+	return b
+}
+
+// Submit submits the given job. It blocks until a worker is free to execute it or the context is done,
+// in which case the job is not executed and Submit returns false.
+// It must not be called after Wait.
+func (b *Bulk[T, R]) Submit(value T) bool {
+	b.start.Do(b.startWorkers)
+
+	b.mu.Lock()
+	index := len(b.results)
+	b.results = append(b.results, Result[R]{})
+	b.mu.Unlock()
+
+	if b.ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case b.jobs <- job[T]{value: value, index: index}:
+		return true
+	case <-b.ctx.Done():
+		return false
+	}
+}
+
+// Wait waits until all the submitted jobs complete or the context is done and returns their results
+// in the order the jobs were submitted.
+func (b *Bulk[T, R]) Wait() []Result[R] {
+	b.start.Do(b.startWorkers)
+	close(b.jobs)
+
+	completed := make(chan struct{})
+	go func() {
+		b.running.Wait()
+		close(completed)
+	}()
+
+	select {
+	case <-completed:
+	case <-b.ctx.Done():
+	}
+
+	b.mu.Lock()
+	b.stopped = true
+	results := b.results
+	b.mu.Unlock()
+
+	// Waits for the result being collected, if any.
+	b.collect.Lock()
+	b.collect.Unlock()
+
+	return results
+}
+
+// Do submits all the given jobs, waits for them and returns their results in the same order.
+func (b *Bulk[T, R]) Do(values []T) []Result[R] {
+	for _, value := range values {
+		if !b.Submit(value) {
+			break
+		}
+	}
+
+	results := b.Wait()
+	for len(results) < len(values) {
+		results = append(results, Result[R]{})
+	}
+
+	return results
+}
+
+// startWorkers starts the workers executing the submitted jobs.
+func (b *Bulk[T, R]) startWorkers() {
+	for i := 0; i < b.workers; i++ {
+		b.running.Add(1)
+		go func() {
+			defer b.running.Done()
+			for j := range b.jobs {
+				b.complete(j.index, b.work(b.ctx, j.value))
+			}
+		}()
+	}
+}
+
+// complete stores the result of the job at the given index and passes it to the result function, if any.
+// The results completed once Wait returned are discarded.
+func (b *Bulk[T, R]) complete(index int, result R) {
+	b.collect.Lock()
+	defer b.collect.Unlock()
+
+	b.mu.Lock()
+	stopped := b.stopped
+	if !stopped {
+		b.results[index] = Result[R]{Value: result, Done: true}
+	}
+	b.mu.Unlock()
+
+	if stopped {
+		if b.discard != nil {
+			b.discard(result)
+		}
+		return
+	}
+
+	if b.onResult != nil {
+		b.onResult(index, result)
+	}
+}
@@ -0,0 +1,106 @@
+package pool
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTheResultsAreInTheSubmissionOrder(t *testing.T) {
+	bulk := New(context.Background(), 4, func(_ context.Context, job int) int {
+		time.Sleep(time.Duration(10-job) * time.Millisecond)
+		return job * job
+	})
+
+	results := bulk.Do([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	assert.Len(t, results, 10)
+	for i, result := range results {
+		assert.True(t, result.Done)
+		assert.Equal(t, i*i, result.Value)
+	}
+}
+
+func TestTheWorkersAreBounded(t *testing.T) {
+	var current, peak int32
+	bulk := New(context.Background(), 3, func(_ context.Context, job int) int {
+		running := atomic.AddInt32(&current, 1)
+		for {
+			max := atomic.LoadInt32(&peak)
+			if running <= max || atomic.CompareAndSwapInt32(&peak, max, running) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+		return job
+	})
+
+	results := bulk.Do(make([]int, 12))
+
+	assert.Len(t, results, 12)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&peak))
+}
+
+func TestEachResultIsPassedToTheResultFunction(t *testing.T) {
+	var mu sync.Mutex
+	received := map[int]string{}
+	bulk := New(context.Background(), 2, func(_ context.Context, job string) string {
+		return job + "!"
+	}).OnResult(func(index int, result string) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[index] = result
+	})
+
+	bulk.Submit("a")
+	bulk.Submit("b")
+	bulk.Submit("c")
+	bulk.Wait()
+
+	assert.Equal(t, map[int]string{0: "a!", 1: "b!", 2: "c!"}, received)
+}
+
+func TestTheJobsAreNotStartedOnceTheContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var started int32
+	var discarded int32
+	release := make(chan struct{})
+	bulk := New(ctx, 1, func(_ context.Context, job int) int {
+		atomic.AddInt32(&started, 1)
+		<-release
+		return job
+	}).OnDiscard(func(int) {
+		atomic.AddInt32(&discarded, 1)
+	})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	results := bulk.Do([]int{1, 2, 3})
+	close(release)
+
+	assert.Len(t, results, 3)
+	for _, result := range results {
+		assert.False(t, result.Done)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&started))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&discarded) == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestSubmitRefusesTheJobsOnceTheContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bulk := New(ctx, 1, func(_ context.Context, job int) int {
+		return job
+	})
+
+	assert.False(t, bulk.Submit(1))
+	assert.Equal(t, []Result[int]{{}}, bulk.Wait())
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the rate of the requests sent by all the workers of a client.
+// The bucket holds up to burst tokens and is refilled at the given rate. Each request takes a token.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// WithRateLimit limits the client to the given amount of requests per second across all its workers,
+// allowing bursts of up to burst requests. Each attempt counts, including the retries and the status polls.
+// A rate lower than or equal to 0 disables the limit.
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(b *BulkHTTPClient) {
+		if requestsPerSecond <= 0 {
+			b.rateLimiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+
+		b.rateLimiter = &tokenBucket{
+			rate:   requestsPerSecond,
+			burst:  float64(burst),
+			tokens: float64(burst),
+			last:   time.Now(),
+		}
+	}
+}
+
+// reserve takes a token and returns the time to wait before it is available.
+func (t *tokenBucket) reserve() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+
+	t.tokens--
+	if t.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-t.tokens / t.rate * float64(time.Second))
+}
+
+// refund gives back a token reserved by a request which was not sent.
+func (t *tokenBucket) refund() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tokens++
+}
+
+// wait blocks until a token is available or the request's context is done.
+// The token of a request whose context is done while waiting is given back,
+// so that the later requests of the client don't wait for it. A nil *tokenBucket never blocks.
+func (t *tokenBucket) wait(req *http.Request) error {
+	if t == nil {
+		return nil
+	}
+
+	delay := t.reserve()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		t.refund()
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// send returns the cached response to the request, if any, or transmits it.
+func (b *BulkHTTPClient) send(req *http.Request) (*http.Response, error) {
+	if b.cache != nil {
+		return b.cache.do(req, b.transmit, b.maxCachedBody())
+	}
+
+	return b.transmit(req)
+}
+
+// transmit sends the request as soon as the multiplexing, the Retry-After pause, the rate limits
+// and the adaptive concurrency, if any, allow it. It is sent through the middlewares, if any.
+func (b *BulkHTTPClient) transmit(req *http.Request) (*http.Response, error) {
+	first, err := b.multiplexing.wait(req)
+	if err != nil {
+		return nil, err
+	}
+	if first {
+		defer b.multiplexing.done(req)
+	}
+
+	if err := b.retryAfter.wait(req); err != nil {
+		return nil, err
+	}
+	if err := b.rateLimiter.wait(req); err != nil {
+		return nil, err
+	}
+	if err := b.keyedRateLimit.wait(req); err != nil {
+		return nil, err
+	}
+	if err := b.concurrency.acquire(req); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := b.doer().Do(req)
+	b.concurrency.release(req, res, err, time.Since(start))
+	return res, err
+}
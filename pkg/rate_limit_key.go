@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets is the amount of token buckets above which the full buckets of a keyed rate limit are forgotten.
+const maxIdleBuckets = 1024
+
+// RateLimitKey returns the key of the rate limit bucket of a request, e.g. its destination.
+// The requests with an empty key are not limited.
+type RateLimitKey func(*http.Request) string
+
+// keyedRateLimit limits the rate of the requests sharing the same key, with a token bucket per key.
+type keyedRateLimit struct {
+	mu      sync.Mutex
+	key     RateLimitKey
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+// WithRateLimitBy limits the requests sharing the same key to the given amount of requests per second,
+// allowing bursts of up to burst requests, e.g. to not flood a single recipient. It applies on top of WithRateLimit.
+// Each attempt counts, including the retries. A rate lower than or equal to 0 disables the limit.
+func WithRateLimitBy(key RateLimitKey, requestsPerSecond float64, burst int) Option {
+	return func(b *BulkHTTPClient) {
+		if requestsPerSecond <= 0 || key == nil {
+			b.keyedRateLimit = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+
+		b.keyedRateLimit = &keyedRateLimit{
+			key:     key,
+			rate:    requestsPerSecond,
+			burst:   float64(burst),
+			buckets: map[string]*tokenBucket{},
+		}
+	}
+}
+
+// wait blocks until a token of the bucket of the request is available or the request's context is done.
+// A nil *keyedRateLimit never blocks.
+func (k *keyedRateLimit) wait(req *http.Request) error {
+	if k == nil {
+		return nil
+	}
+
+	key := k.key(req)
+	if key == "" {
+		return nil
+	}
+
+	return k.bucket(key).wait(req)
+}
+
+// bucket returns the token bucket of the key. Once there are too many buckets, the full ones are forgotten:
+// a new bucket is full as well.
+func (k *keyedRateLimit) bucket(key string) *tokenBucket {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	if bucket, ok := k.buckets[key]; ok {
+		return bucket
+	}
+
+	if len(k.buckets) >= maxIdleBuckets {
+		refill := time.Duration(k.burst / k.rate * float64(time.Second))
+		for existing, bucket := range k.buckets {
+			bucket.mu.Lock()
+			full := now.Sub(bucket.last) >= refill
+			bucket.mu.Unlock()
+			if full {
+				delete(k.buckets, existing)
+			}
+		}
+	}
+
+	bucket := &tokenBucket{rate: k.rate, burst: k.burst, tokens: k.burst, last: now}
+	k.buckets[key] = bucket
+	return bucket
+}
@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitIsEnforcedPerKey(t *testing.T) {
+	var mu sync.Mutex
+	arrivals := map[string][]time.Time{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := req.URL.Query().Get("to")
+		arrivals[key] = append(arrivals[key], time.Now())
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRateLimitBy(func(req *http.Request) string {
+		return req.URL.Query().Get("to")
+	}, 20, 1))
+
+	var requests []*http.Request
+	for _, to := range []string{"a", "b", "a", "b", "a", "", "", ""} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"?to="+to, nil)
+		requests = append(requests, req)
+	}
+	bulkRequest := NewBulkRequest(requests, 8, 8)
+	start := time.Now()
+	_, errs := client.Do(bulkRequest)
+	elapsed := time.Since(start)
+	bulkRequest.CloseAllResponses()
+
+	// The three requests to "a" wait 50ms each after the first one, the others less or not at all: a single limit would make them wait 350ms.
+	assert.True(t, elapsed >= 90*time.Millisecond, "elapsed %v", elapsed)
+	assert.True(t, elapsed < 250*time.Millisecond, "elapsed %v", elapsed)
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+	assert.Len(t, arrivals["a"], 3)
+	assert.Len(t, arrivals["b"], 2)
+	assert.Len(t, arrivals[""], 3)
+	assert.True(t, arrivals[""][2].Sub(start) < 45*time.Millisecond, "the requests without key are not limited")
+}
+
+func TestTheFullRateLimitBucketsAreForgotten(t *testing.T) {
+	limit := &keyedRateLimit{rate: 1000, burst: 1, buckets: map[string]*tokenBucket{}}
+	for i := 0; i < maxIdleBuckets; i++ {
+		limit.bucket(strconv.Itoa(i)).reserve()
+	}
+	assert.Len(t, limit.buckets, maxIdleBuckets)
+
+	time.Sleep(5 * time.Millisecond)
+	limit.bucket("new")
+
+	assert.Len(t, limit.buckets, 1)
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitIsEnforcedAcrossWorkers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRateLimit(20, 2))
+
+	bulkRequest := newClientWithNRequests(6, server.URL)
+	start := time.Now()
+	_, errs := client.Do(bulkRequest)
+	elapsed := time.Since(start)
+	bulkRequest.CloseAllResponses()
+
+	// The first two requests use the burst, the four others wait 50ms each.
+	assert.True(t, elapsed >= 190*time.Millisecond, "elapsed %v", elapsed)
+	assert.Equal(t, []error{nil, nil, nil, nil, nil, nil}, errs)
+}
+
+func TestRateLimitWaitStopsWhenTheContextIsCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := NewBulkHTTPClient(ctx, &http.Client{}, WithRateLimit(0.1, 1))
+
+	bulkRequest := newClientWithNRequests(2, server.URL)
+	start := time.Now()
+	client.Do(bulkRequest)
+	bulkRequest.CloseAllResponses()
+
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestTheTokensOfTheCancelledWaitsAreGivenBack(t *testing.T) {
+	bucket := &tokenBucket{rate: 1, burst: 1, tokens: 0, last: time.Now()}
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+		assert.Equal(t, context.DeadlineExceeded, bucket.wait(req))
+		cancel()
+	}
+
+	assert.True(t, bucket.reserve() <= time.Second, "no debt left by the cancelled waits")
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RequestOption configures a single request of a BulkRequest.
+type RequestOption func(*requestOptions)
+
+// requestOptions holds the settings of a single request.
+type requestOptions struct {
+	timeout      time.Duration
+	expiresAt    time.Time
+	failOnStatus func(code int) bool
+}
+
+// RequestTimeout sets the deadline of the request, overriding the one of the client, see WithRequestTimeout.
+// It covers all the attempts of the request, the retries included, and the reading of the response body.
+// The http.Client.Timeout of the client, if any, still applies to each attempt: leave it unset
+// and use WithRequestTimeout instead for the requests to get longer deadlines than the others.
+func RequestTimeout(timeout time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRequestTimeout sets the default deadline of the requests, the one of the requests
+// added without the RequestTimeout option, see it for the details.
+// A timeout lower than or equal to 0 disables it.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(b *BulkHTTPClient) {
+		b.timeout = timeout
+	}
+}
+
+// AddRequestWithOptions adds the given request to this BulkRequest with its own settings.
+func (b *BulkRequest) AddRequestWithOptions(request *http.Request, opts ...RequestOption) *BulkRequest {
+	var options requestOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if b.options == nil {
+		b.options = map[int]requestOptions{}
+	}
+	b.options[len(b.requests)] = options
+	b.requests = append(b.requests, request)
+	return b
+}
+
+// withDeadline returns the request with the deadline of the given timeout, or of the client's one
+// when it is 0, and the function releasing its context. The request is returned as is without a deadline.
+func (b *BulkHTTPClient) withDeadline(req *http.Request, timeout time.Duration) (*http.Request, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = b.timeout
+	}
+	if timeout <= 0 {
+		return req, func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	return req.WithContext(ctx), cancel
+}
@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeoutOverridesTheClientOne(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("slow"))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRequestTimeout(50*time.Millisecond))
+
+	regular, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	important, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{regular}, 2, 2).
+		AddRequestWithOptions(important, RequestTimeout(time.Second))
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Error(t, errs[0])
+	assert.True(t, strings.Contains(errs[0].Error(), "deadline exceeded"), errs[0].Error())
+
+	require.Nil(t, errs[1])
+	body, _ := ioutil.ReadAll(responses[1].Body)
+	assert.Equal(t, "slow", string(body))
+}
+
+func TestRequestTimeoutIsKeptAcrossSubBatches(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{},
+		WithRequestTimeout(20*time.Millisecond), WithSubBatches(1, nil))
+
+	fast, err := http.NewRequest(http.MethodGet, server.URL+"/fast", nil)
+	require.NoError(t, err, "no errors")
+
+	slow, err := http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{fast}, 1, 1).
+		AddRequestWithOptions(slow, RequestTimeout(time.Second))
+	_, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, []error{nil, nil}, errs)
+}
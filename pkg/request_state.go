@@ -0,0 +1,44 @@
+package pkg
+
+import "github.com/pigeonlab/notifier/interr"
+
+// RequestState tells how far a request of a bulk request went, e.g. to know which requests were delivered
+// before the context was done: the requests not completed all fail with interr.ErrIgnored.
+type RequestState int
+
+const (
+	// NotStarted is the state of the requests never sent, e.g. because the context was done before a dispatch worker
+	// started them, because of a barrier, because of a failed dependency or because they expired.
+	NotStarted RequestState = iota
+	// InFlight is the state of the requests being sent when the context was done: the target may have received them.
+	InFlight
+	// Completed is the state of the requests whose response, or error, is final.
+	Completed
+)
+
+// String returns the name of the state.
+func (s RequestState) String() string {
+	switch s {
+	case NotStarted:
+		return "not started"
+	case InFlight:
+		return "in flight"
+	case Completed:
+		return "completed"
+	default:
+		return "unknown"
+	}
+}
+
+// state returns the state of the request of a processed flow: the flows cancelled while the request
+// was being sent or followed are in flight and the expired requests were never sent.
+func (flow requestFlow) state() RequestState {
+	switch flow.err {
+	case interr.ErrIgnored:
+		return InFlight
+	case interr.ErrExpired:
+		return NotStarted
+	}
+
+	return Completed
+}
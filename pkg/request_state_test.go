@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendTellsWhichRequestsCompletedBeforeTheCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			cancel()
+			<-req.Context().Done()
+		}
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	var requests []*http.Request
+	for _, path := range []string{"/fast", "/slow", "/never"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err, "no errors")
+		requests = append(requests, req)
+	}
+
+	bulkRequest := NewBulkRequest(requests, 1, 1)
+	result := client.Send(ctx, bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Entries, 3)
+	assert.Equal(t, Completed, result.Entries[0].State)
+	assert.Nil(t, result.Entries[0].Err)
+	assert.Equal(t, http.StatusOK, result.Entries[0].Response.StatusCode)
+	assert.Equal(t, InFlight, result.Entries[1].State)
+	assert.Equal(t, interr.ErrIgnored, result.Entries[1].Err)
+	assert.Equal(t, NotStarted, result.Entries[2].State)
+	assert.Equal(t, interr.ErrIgnored, result.Entries[2].Err)
+}
+
+func TestSendMarksTheRequestsOfAFailedBarrierAsNotStarted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	first, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+	second, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{first}, 1, 1).Barrier().AddRequest(second)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Entries, 2)
+	assert.Equal(t, Completed, result.Entries[0].State)
+	assert.Equal(t, NotStarted, result.Entries[1].State)
+	assert.Equal(t, interr.ErrBarrierNotPassed, result.Entries[1].Err)
+}
+
+func TestRequestStateString(t *testing.T) {
+	assert.Equal(t, "not started", NotStarted.String())
+	assert.Equal(t, "in flight", InFlight.String())
+	assert.Equal(t, "completed", Completed.String())
+	assert.Equal(t, "unknown", RequestState(42).String())
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import "context"
+
+// WithResponseBuffer lets up to size responses wait for a response processor without holding a dispatch worker,
+// so that a slow response processing doesn't stall the dispatch of the next requests. The waiting responses
+// keep their connection busy, and their bodies unread, until they are processed. The default size, zero,
+// applies backpressure instead: a dispatch worker waits for a processor before sending its next request,
+// so that the amount of pending responses never exceeds the amount of dispatch workers.
+func WithResponseBuffer(size int) Option {
+	return func(b *BulkHTTPClient) {
+		if size < 0 {
+			size = 0
+		}
+		b.responseBuffer = size
+	}
+}
+
+// dispatchSlots returns the semaphore bounding the amount of requests being sent when the responses are buffered,
+// and the amount of workers of the pool sending the requests and processing the responses.
+// The semaphore is nil without buffer: the workers are the dispatch workers.
+func (b *BulkHTTPClient) dispatchSlots(dispatchers int) (chan struct{}, int) {
+	if dispatchers < 1 {
+		dispatchers = 1
+	}
+	if b.responseBuffer == 0 {
+		return nil, dispatchers
+	}
+
+	return make(chan struct{}, dispatchers), dispatchers + b.responseBuffer
+}
+
+// acquireSlot acquires a slot of the semaphore, if any. It returns false when the context is done first.
+func acquireSlot(ctx context.Context, slots chan struct{}) bool {
+	if slots == nil {
+		return true
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseSlot releases a slot of the semaphore, if any.
+func releaseSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
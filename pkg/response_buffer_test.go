@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newStalledBodyServer returns a server sending the headers right away and the body once released,
+// together with the amount of requests it received.
+func newStalledBodyServer(release chan struct{}) (*httptest.Server, *int32) {
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&received, 1)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("done"))
+	}))
+
+	return server, &received
+}
+
+func TestTheResponsesWaitForAProcessorWithoutStallingTheDispatch(t *testing.T) {
+	release := make(chan struct{})
+	server, received := newStalledBodyServer(release)
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithResponseBuffer(4))
+
+	bulkRequest := newClientWithNRequests(6, server.URL)
+	bulkRequest.dispatchRequestsWorkers, bulkRequest.responseProcessorWorkers = 2, 1
+	done := make(chan struct{})
+	var errs []error
+	go func() {
+		_, errs = client.Do(bulkRequest)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return atomic.LoadInt32(received) == 6 }, time.Second, time.Millisecond)
+	close(release)
+	<-done
+	defer bulkRequest.CloseAllResponses()
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+}
+
+func TestTheDispatchWaitsForTheProcessorsWithoutResponseBuffer(t *testing.T) {
+	release := make(chan struct{})
+	server, received := newStalledBodyServer(release)
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{})
+
+	bulkRequest := newClientWithNRequests(6, server.URL)
+	bulkRequest.dispatchRequestsWorkers, bulkRequest.responseProcessorWorkers = 2, 1
+	done := make(chan struct{})
+	go func() {
+		_, _ = client.Do(bulkRequest)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(received))
+	close(release)
+	<-done
+	bulkRequest.CloseAllResponses()
+}
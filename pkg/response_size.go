@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"github.com/pigeonlab/notifier/interr"
+	"io"
+	"net/http"
+)
+
+// maxResponseSize caps the amount of bytes read from each response body.
+type maxResponseSize struct {
+	maxBytes int64
+	truncate bool
+}
+
+// WithMaxResponseSize caps the amount of bytes read from each response body, so that a misconfigured target
+// returning huge error pages is not buffered request after request. Beyond maxBytes, the request fails with
+// interr.ErrResponseTooLarge or, when truncate is true, the response is returned with its body truncated to its
+// first maxBytes bytes. The rest of the body is never read: the connection is closed instead of being reused.
+// A maxBytes lower than 1 disables the cap.
+func WithMaxResponseSize(maxBytes int64, truncate bool) Option {
+	return func(b *BulkHTTPClient) {
+		if maxBytes < 1 {
+			b.maxResponseSize = nil
+			return
+		}
+
+		b.maxResponseSize = &maxResponseSize{
+			maxBytes: maxBytes,
+			truncate: truncate,
+		}
+	}
+}
+
+// limitBody returns the reader of the response body capped to the maximum response size, if any.
+// It fails right away when the announced content length exceeds it and the bodies are not truncated.
+func (b *BulkHTTPClient) limitBody(res *http.Response) (io.Reader, error) {
+	if b.maxResponseSize == nil {
+		return res.Body, nil
+	}
+
+	if !b.maxResponseSize.truncate && res.ContentLength > b.maxResponseSize.maxBytes {
+		return nil, interr.ErrResponseTooLarge
+	}
+
+	return &limitedBody{
+		reader:    res.Body,
+		remaining: b.maxResponseSize.maxBytes,
+		truncate:  b.maxResponseSize.truncate,
+	}, nil
+}
+
+// limitedBody reads a body up to a maximum amount of bytes. Beyond it, the body ends when it is truncated,
+// otherwise reading fails with interr.ErrResponseTooLarge.
+type limitedBody struct {
+	reader    io.Reader
+	remaining int64
+	truncate  bool
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		if l.truncate {
+			return 0, io.EOF
+		}
+
+		// The body may end exactly at the limit: a single byte tells whether there is more.
+		var probe [1]byte
+		n, err := l.reader.Read(probe[:])
+		if n > 0 {
+			return 0, interr.ErrResponseTooLarge
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newSizedResponseServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body := strings.Repeat("x", 10)
+		if req.URL.Query().Get("kind") == "huge" {
+			body = strings.Repeat("<html>", 1000)
+		}
+		if req.URL.Query().Get("kind") == "streamed" {
+			w.(http.Flusher).Flush()
+			body = strings.Repeat("<html>", 1000)
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func newSizedResponseRequests(serverURL string, kinds ...string) *BulkRequest {
+	var requests []*http.Request
+	for _, kind := range kinds {
+		req, _ := http.NewRequest(http.MethodGet, serverURL+"?kind="+kind, nil)
+		requests = append(requests, req)
+	}
+
+	return NewBulkRequest(requests, 10, 10)
+}
+
+func TestResponsesLargerThanTheMaxSizeFail(t *testing.T) {
+	server := newSizedResponseServer()
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithMaxResponseSize(10, false))
+
+	bulkRequest := newSizedResponseRequests(server.URL, "small", "huge", "streamed")
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.NoError(t, errs[0], "no errors")
+	body, _ := ioutil.ReadAll(responses[0].Body)
+	assert.Equal(t, strings.Repeat("x", 10), string(body))
+	assert.Equal(t, interr.ErrResponseTooLarge, errs[1])
+	assert.Nil(t, responses[1])
+	assert.Equal(t, interr.ErrResponseTooLarge, errs[2])
+	assert.False(t, interr.IsRetryable(errs[2]))
+}
+
+func TestResponsesLargerThanTheMaxSizeAreTruncated(t *testing.T) {
+	server := newSizedResponseServer()
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithMaxResponseSize(6, true))
+
+	bulkRequest := newSizedResponseRequests(server.URL, "huge", "streamed")
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for i := range responses {
+		require.NoError(t, errs[i], "no errors")
+		body, _ := ioutil.ReadAll(responses[i].Body)
+		assert.Equal(t, "<html>", string(body))
+	}
+}
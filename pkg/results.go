@@ -0,0 +1,31 @@
+//go:build go1.23
+
+package pkg
+
+import (
+	"context"
+	"iter"
+)
+
+// Results executes all the requests like DoStream and returns an iterator over their results, keyed by the index
+// of the request in the bulk request. The results are yielded in the order they complete, the requests that are
+// not sent, e.g. because of a barrier, last. Without requests, a single result with the index -1
+// and interr.ErrRequestsNotFound is yielded.
+// The requests are started when the iteration starts. Breaking out of the loop cancels the remaining requests:
+// their responses are still kept in the bulk request, BulkRequest.CloseAllResponses closes them.
+func (b *BulkHTTPClient) Results(ctx context.Context, bulkRequest *BulkRequest) iter.Seq2[int, Result] {
+	return func(yield func(int, Result) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		results := b.DoStream(ctx, bulkRequest)
+		for result := range results {
+			if !yield(result.Index, result) {
+				cancel()
+				for range results {
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+//go:build go1.23
+
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResultsYieldsEveryResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	found, err := http.NewRequest(http.MethodGet, server.URL+"/found", nil)
+	require.NoError(t, err, "no errors")
+	missing, err := http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{found, missing}, 2, 2)
+	defer bulkRequest.CloseAllResponses()
+
+	statuses := map[int]int{}
+	for index, result := range client.Results(context.Background(), bulkRequest) {
+		require.NoError(t, result.Err)
+		assert.Equal(t, index, result.Index)
+		statuses[index] = result.Response.StatusCode
+	}
+
+	assert.Equal(t, map[int]int{0: http.StatusOK, 1: http.StatusNotFound}, statuses)
+}
+
+func TestBreakingOutOfResultsCancelsTheRemainingRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			select {
+			case <-req.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	fast, err := http.NewRequest(http.MethodGet, server.URL+"/fast", nil)
+	require.NoError(t, err, "no errors")
+	slow, err := http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+	require.NoError(t, err, "no errors")
+	queued, err := http.NewRequest(http.MethodGet, server.URL+"/queued", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{fast, slow, queued}, 2, 2)
+	defer bulkRequest.CloseAllResponses()
+
+	start := time.Now()
+	var indexes []int
+	for index := range client.Results(context.Background(), bulkRequest) {
+		indexes = append(indexes, index)
+		break
+	}
+
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Len(t, indexes, 1)
+	assert.Contains(t, bulkRequest.errors, interr.ErrIgnored)
+}
+
+func TestResultsYieldsTheMissingRequestsError(t *testing.T) {
+	client := NewClient(&http.Client{})
+
+	var errs []error
+	for index, result := range client.Results(context.Background(), NewBulkRequest(nil, 1, 1)) {
+		assert.Equal(t, -1, index)
+		errs = append(errs, result.Err)
+	}
+
+	assert.Equal(t, []error{interr.ErrRequestsNotFound}, errs)
+}
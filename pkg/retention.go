@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// RetentionPolicy decides which response bodies are kept in the results.
+type RetentionPolicy int
+
+const (
+	// RetainAll keeps all the response bodies.
+	RetainAll RetentionPolicy = iota
+	// RetainFailures keeps only the bodies of the responses without a successful status code, see WithSuccessStatuses.
+	RetainFailures
+	// RetainNone discards all the response bodies.
+	RetainNone
+)
+
+// bodyRetention configures which response bodies the client keeps and how much of them.
+type bodyRetention struct {
+	policy   RetentionPolicy
+	maxBytes int64
+}
+
+// WithBodyRetention makes the client keep only the response bodies selected by the policy,
+// truncated to their first maxBytes bytes. A maxBytes lower than 1 keeps the whole bodies.
+// The discarded bodies are still read, so that the connections can be reused, and the
+// responses are returned with an empty body. The request templates of the dependent requests
+// receive the bodies as retained.
+func WithBodyRetention(policy RetentionPolicy, maxBytes int64) Option {
+	return func(b *BulkHTTPClient) {
+		b.retention = &bodyRetention{
+			policy:   policy,
+			maxBytes: maxBytes,
+		}
+	}
+}
+
+// retains reports whether the body of the given response is kept.
+func (b *BulkHTTPClient) retains(res *http.Response) bool {
+	switch b.retention.policy {
+	case RetainNone:
+		return false
+	case RetainFailures:
+		return !b.succeeded(res, nil)
+	default:
+		return true
+	}
+}
+
+// WithDiscardedBodies makes the client drain and close the response bodies without buffering them,
+// since most notification targets return tiny acknowledgements that are never read. The responses are returned
+// with their status code and headers, and an empty body. It is the same as WithBodyRetention(RetainNone, 0).
+func WithDiscardedBodies() Option {
+	return WithBodyRetention(RetainNone, 0)
+}
+
+// responseBody reads the response body, see readBody, and returns the body of the processed response,
+// accounted by the memory guard, if any. The bodies discarded with RetainNone are drained without a buffer.
+// The bodies exceeding the maximum response size, if any, fail with interr.ErrResponseTooLarge.
+func (b *BulkHTTPClient) responseBody(req *http.Request, res *http.Response) (io.ReadCloser, error) {
+	body, err := b.limitBody(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.retention != nil && b.retention.policy == RetainNone {
+		if _, err := io.Copy(ioutil.Discard, body); err == interr.ErrResponseTooLarge {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("error while reading response body: %s", err)
+		}
+		return http.NoBody, nil
+	}
+
+	buffer := acquireBuffer()
+	var kept io.Writer = buffer
+	if b.memory != nil {
+		kept = guardedWriter{w: buffer, memory: b.memory}
+	}
+	if err := b.readBody(req, res, body, kept); err != nil {
+		if b.memory != nil {
+			b.memory.unbuffer(int64(buffer.Len()))
+		}
+		releaseBuffer(buffer)
+		if err == interr.ErrResponseTooLarge || err == interr.ErrMemoryLimitExceeded {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error while reading response body: %s", err)
+	}
+
+	return newPooledBody(buffer, b.memory), nil
+}
+
+// readBody reads the response body from the given reader and writes the part kept according to the retention policy
+// to the given writer, chunk by chunk, so that the memory guard rejects a large body before it is read in memory.
+// The bodies of the responses that can't have one are not read.
+func (b *BulkHTTPClient) readBody(req *http.Request, res *http.Response, body io.Reader, kept io.Writer) error {
+	if hasNoBody(req, res) {
+		return nil
+	}
+
+	if b.retention == nil {
+		_, err := io.Copy(kept, body)
+		return err
+	}
+
+	if b.retains(res) {
+		reader := body
+		if b.retention.maxBytes > 0 {
+			reader = io.LimitReader(body, b.retention.maxBytes)
+		}
+
+		if _, err := io.Copy(kept, reader); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.Copy(ioutil.Discard, body)
+	return err
+}
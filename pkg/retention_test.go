@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOnlyTheFailureBodiesAreRetained(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("kind") == "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write([]byte("a rather long response body"))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithBodyRetention(RetainFailures, 8))
+
+	success, _ := http.NewRequest(http.MethodGet, server.URL+"?kind=fast", nil)
+	failure, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	bulkRequest := NewBulkRequest([]*http.Request{success, failure}, 1, 1)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, []error{nil, nil}, errs)
+	successBody, _ := ioutil.ReadAll(responses[0].Body)
+	failureBody, _ := ioutil.ReadAll(responses[1].Body)
+	assert.Equal(t, "", string(successBody))
+	assert.Equal(t, "a rather", string(failureBody))
+}
+
+func TestNoBodyIsRetained(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("invalid payload"))
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithBodyRetention(RetainNone, 0))
+
+	bulkRequest := newClientWithNRequests(1, server.URL)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Nil(t, errs[0])
+	body, _ := ioutil.ReadAll(responses[0].Body)
+	assert.Equal(t, http.StatusBadRequest, responses[0].StatusCode)
+	assert.Equal(t, "", string(body))
+}
+
+func TestBodiesAreDiscarded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Ack", "42")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("acknowledged"))
+	}))
+	defer server.Close()
+	// The acknowledgements would exceed the memory limit if they were buffered.
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithDiscardedBodies(), WithMemoryLimit(4))
+
+	bulkRequest := newClientWithNRequests(2, server.URL)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	for i := range responses {
+		require.NoError(t, errs[i], "no errors")
+		body, _ := ioutil.ReadAll(responses[i].Body)
+		assert.Equal(t, http.StatusAccepted, responses[i].StatusCode)
+		assert.Equal(t, "42", responses[i].Header.Get("X-Ack"))
+		assert.Equal(t, "", string(body))
+	}
+}
@@ -0,0 +1,224 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/pigeonlab/notifier/interr"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryPolicy decides whether a request is retried after an attempt.
+type RetryPolicy interface {
+	// ShouldRetry receives the outcome of the last attempt and the amount of attempts made so far,
+	// starting from 1. It returns whether the request is retried and the delay before the next attempt.
+	ShouldRetry(res *http.Response, err error, attempt int) (bool, time.Duration)
+}
+
+// ExponentialBackoff is the default retry policy. It retries the transient failures, i.e. the retryable errors
+// such as a connection reset and the 429, 502, 503 and 504 status codes, up to MaxAttempts attempts in total,
+// see interr.IsRetryable. The other status codes, the unknown hosts and the invalid certificates are permanent failures.
+// The delay before the first retry is BaseDelay and doubles after each attempt, up to MaxDelay,
+// or defaultMaxRetryDelay when it is zero. The Jitter, between 0 and 1, is the maximum fraction
+// of the delay randomly removed from it, so that the requests failed together are not retried together.
+type ExponentialBackoff struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+// defaultMaxRetryDelay is the maximum delay between two attempts of the ExponentialBackoff policy without MaxDelay.
+const defaultMaxRetryDelay = time.Hour
+
+// jitterRandom draws the jitter of the retry delays. It is seeded explicitly, since the global source of math/rand
+// is not seeded before Go 1.20: the processes would otherwise retry with the same delays.
+var jitterRandom = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// ShouldRetry implements the RetryPolicy interface.
+func (e ExponentialBackoff) ShouldRetry(res *http.Response, err error, attempt int) (bool, time.Duration) {
+	if attempt >= e.MaxAttempts || !isTransient(res, err) {
+		return false, 0
+	}
+
+	delay := e.delay(attempt)
+	if e.Jitter > 0 {
+		jitterRandom.Lock()
+		delay -= time.Duration(jitterRandom.Float64() * e.Jitter * float64(delay))
+		jitterRandom.Unlock()
+	}
+
+	return true, delay
+}
+
+// delay returns the delay following the given attempt: BaseDelay doubled after each attempt, up to the maximum delay.
+// It is doubled one step at a time, so that it never overflows.
+func (e ExponentialBackoff) delay(attempt int) time.Duration {
+	maxDelay := e.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxRetryDelay
+	}
+
+	delay := e.BaseDelay
+	for i := 1; i < attempt && delay > 0 && delay < maxDelay; i++ {
+		if delay > maxDelay/2 {
+			delay = maxDelay
+			break
+		}
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
+
+// isTransient reports whether the outcome of an attempt is a transient failure.
+// The errors of the HTTP client are classified as the client reports them, see clientError.
+func isTransient(res *http.Response, err error) bool {
+	if err != nil {
+		var retryable interr.Retryable
+		if !errors.As(err, &retryable) {
+			err = clientError(0, nil, err)
+		}
+		return interr.IsRetryable(err)
+	}
+
+	return (&interr.StatusError{Code: res.StatusCode}).Retryable()
+}
+
+// WithRetryPolicy makes the client consult the given policy after each attempt of a request.
+// Each attempt sends the whole request body again: it is recreated with http.Request.GetBody or,
+// when the request doesn't set it, read once and stored in memory before the first attempt.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(b *BulkHTTPClient) {
+		b.retryPolicy = policy
+	}
+}
+
+// WithRetry makes the client retry the requests with the ExponentialBackoff policy.
+func WithRetry(maxAttempts int, baseDelay time.Duration, jitter float64) Option {
+	return WithRetryPolicy(ExponentialBackoff{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		Jitter:      jitter,
+	})
+}
+
+// doWithRetry sends the request and retries it according to the retry policy
+// and, if enabled, to the Retry-After header of the responses.
+// It returns the outcome of the last attempt, or interr.ErrRetryBudgetExhausted
+// when a retry is needed but the given budget is spent, along with the amount of attempts.
+// The request is not retried when it would expire before its next attempt, see RequestExpiry,
+// nor when it completed with one of the status codes of WithSuccessStatuses.
+func (b *BulkHTTPClient) doWithRetry(req *http.Request, budget *retryBudget, expiresAt time.Time) (*http.Response, int, error) {
+	res, err := b.attempt(req)
+	attempt := 1
+	for ; req.Context().Err() == nil; attempt++ {
+		if err == nil && res != nil && b.successCodes[res.StatusCode] {
+			break
+		}
+
+		retry, delay := b.retryPolicy.ShouldRetry(res, err, attempt)
+		if retry {
+			delay, retry = b.retryAfter.delay(res, delay)
+		}
+		if !retry || expiresBefore(expiresAt, delay) {
+			break
+		}
+
+		next, cloneErr := cloneRequest(req)
+		if cloneErr != nil {
+			break
+		}
+
+		if !budget.take() {
+			if res != nil {
+				_, _ = io.Copy(ioutil.Discard, res.Body)
+				_ = res.Body.Close()
+			}
+			return nil, attempt, interr.ErrRetryBudgetExhausted
+		}
+
+		b.hooks.retry(req, attempt, res, err)
+		select {
+		case <-req.Context().Done():
+			return res, attempt, err
+		case <-time.After(delay):
+		}
+
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+		res, err = b.attempt(next)
+	}
+
+	return res, attempt, err
+}
+
+// replayable returns the request with a body that can be recreated for another attempt.
+// The bodies that can't be recreated with GetBody are read and stored in memory, up to maxBytes bytes
+// when maxBytes is positive, e.g. the limit of the memory guard: a larger body fails with
+// interr.ErrMemoryLimitExceeded without being read beyond the limit.
+func replayable(req *http.Request, maxBytes int64) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return req, nil
+	}
+
+	if maxBytes > 0 && req.ContentLength > maxBytes {
+		_ = req.Body.Close()
+		return nil, interr.ErrMemoryLimitExceeded
+	}
+
+	var body io.Reader = req.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(req.Body, maxBytes+1)
+	}
+	payload, err := ioutil.ReadAll(body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error while reading the request body: %s", err)
+	}
+	if maxBytes > 0 && int64(len(payload)) > maxBytes {
+		return nil, interr.ErrMemoryLimitExceeded
+	}
+
+	stored := req.WithContext(req.Context())
+	stored.ContentLength = int64(len(payload))
+	stored.Body = ioutil.NopCloser(bytes.NewReader(payload))
+	stored.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(payload)), nil
+	}
+
+	return stored, nil
+}
+
+// cloneRequest returns a copy of the request with a new body, so that it can be sent again.
+// It fails when the request has a body that can't be recreated, see http.Request.GetBody.
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("the request body can't be recreated")
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+
+	return clone, nil
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retryAfter honors the Retry-After header of the 429 and 503 responses.
+// With throttle set, the whole client pauses until the end of the delay.
+type retryAfter struct {
+	maxDelay time.Duration
+	throttle bool
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+// WithRetryAfter makes the retries of the 429 Too Many Requests and 503 Service Unavailable responses
+// wait for the delay of their Retry-After header, when it is longer than the one of the retry policy.
+// The requests asked to wait for more than maxDelay are not retried. With throttle set, no request
+// of the client is sent before the end of the delay, so that the whole pipeline slows down.
+// It only applies to the requests retried by the retry policy, see WithRetryPolicy.
+// A maxDelay lower than or equal to 0 disables it.
+func WithRetryAfter(maxDelay time.Duration, throttle bool) Option {
+	return func(b *BulkHTTPClient) {
+		if maxDelay <= 0 {
+			b.retryAfter = nil
+			return
+		}
+
+		b.retryAfter = &retryAfter{maxDelay: maxDelay, throttle: throttle}
+	}
+}
+
+// delay returns the delay before retrying the response and whether it can be retried.
+// The given delay is the one of the retry policy. A nil *retryAfter keeps it.
+func (r *retryAfter) delay(res *http.Response, delay time.Duration) (time.Duration, bool) {
+	if r == nil || res == nil {
+		return delay, true
+	}
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+		return delay, true
+	}
+
+	wait, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		return delay, true
+	}
+	if wait > r.maxDelay {
+		return 0, false
+	}
+
+	if r.throttle {
+		r.pause(wait)
+	}
+	if wait > delay {
+		return wait, true
+	}
+
+	return delay, true
+}
+
+// pause stops the sending of the requests for the given delay, unless it is already paused for longer.
+func (r *retryAfter) pause(delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until := time.Now().Add(delay)
+	if until.After(r.until) {
+		r.until = until
+	}
+}
+
+// wait blocks until the end of the pause, if any, or until the request's context is done.
+// A nil *retryAfter never blocks.
+func (r *retryAfter) wait(req *http.Request) error {
+	if r == nil || !r.throttle {
+		return nil
+	}
+
+	r.mu.Lock()
+	delay := time.Until(r.until)
+	r.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// RetryAfter returns the delay of the Retry-After header of a response and whether the response has a valid one.
+func RetryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+
+	return parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either an amount of seconds
+// or an HTTP date, and returns the delay from now. A date in the past is a zero delay.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if time.Duration(seconds) > math.MaxInt64/time.Second {
+			return math.MaxInt64, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if date.Before(now) {
+		return 0, true
+	}
+
+	return date.Sub(now), true
+}
@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterDelaysTheRetry(t *testing.T) {
+	var attempts int32
+	var first time.Time
+	var elapsed time.Duration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		elapsed = time.Since(first)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{},
+		WithRetry(2, time.Millisecond, 0), WithRetryAfter(5*time.Second, false))
+
+	bulkRequest := newClientWithNRequests(1, server.URL)
+	responses, _ := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, http.StatusOK, responses[0].StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	assert.True(t, elapsed >= time.Second, "the retry waited for %s", elapsed)
+}
+
+func TestRetryAfterLongerThanTheMaxDelayIsNotRetried(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{},
+		WithRetry(3, time.Millisecond, 0), WithRetryAfter(time.Minute, false))
+
+	bulkRequest := newClientWithNRequests(1, server.URL)
+	responses, _ := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, http.StatusServiceUnavailable, responses[0].StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestRetryAfterThrottlesTheWholeClient(t *testing.T) {
+	limiter := &retryAfter{maxDelay: time.Minute, throttle: true}
+	res := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"1"}}}
+
+	delay, retry := limiter.delay(res, time.Millisecond)
+	assert.True(t, retry)
+	assert.Equal(t, time.Second, delay)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	start := time.Now()
+	assert.NoError(t, limiter.wait(req))
+	assert.True(t, time.Since(start) >= 900*time.Millisecond, "the request waited for %s", time.Since(start))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+	for value, expected := range map[string]time.Duration{
+		"30":                            30 * time.Second,
+		" 0 ":                           0,
+		"Thu, 01 Oct 2020 12:00:10 GMT": 10 * time.Second,
+		"Thu, 01 Oct 2020 11:00:00 GMT": 0,
+	} {
+		delay, ok := parseRetryAfter(value, now)
+		assert.True(t, ok, value)
+		assert.Equal(t, expected, delay, value)
+	}
+
+	for _, value := range []string{"", "-1", "soon"} {
+		_, ok := parseRetryAfter(value, now)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestRetryAfterOfAResponse(t *testing.T) {
+	delay, ok := RetryAfter(&http.Response{Header: http.Header{"Retry-After": []string{"120"}}})
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	_, ok = RetryAfter(&http.Response{Header: http.Header{}})
+	assert.False(t, ok)
+
+	_, ok = RetryAfter(nil)
+	assert.False(t, ok)
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import "sync/atomic"
+
+// retryBudgetLimits configures the amount of retries allowed for each bulk request.
+type retryBudgetLimits struct {
+	maxRetries int
+	maxRatio   float64
+}
+
+// retryBudget counts the retries left for a bulk request, across all its workers.
+type retryBudget struct {
+	remaining int64
+}
+
+// WithRetryBudget limits the total amount of retries of each call to Send, so that the retries
+// can't amplify the load on a target during an outage. The budget is the lowest of maxRetries
+// and of maxRatio times the amount of requests, e.g. 0.1 allows one retry per ten requests.
+// A limit lower than or equal to 0 is ignored and both disable the budget.
+// Once the budget is spent, the requests that would be retried fail with interr.ErrRetryBudgetExhausted.
+// It only applies to the requests retried by the retry policy, see WithRetryPolicy.
+func WithRetryBudget(maxRetries int, maxRatio float64) Option {
+	return func(b *BulkHTTPClient) {
+		if maxRetries <= 0 && maxRatio <= 0 {
+			b.retryBudget = nil
+			return
+		}
+
+		b.retryBudget = &retryBudgetLimits{
+			maxRetries: maxRetries,
+			maxRatio:   maxRatio,
+		}
+	}
+}
+
+// newBudget returns the retry budget of a bulk request with the given amount of requests.
+// A nil *retryBudgetLimits returns a nil budget, which is never exhausted.
+func (l *retryBudgetLimits) newBudget(requestsCount int) *retryBudget {
+	if l == nil {
+		return nil
+	}
+
+	remaining := -1
+	if l.maxRetries > 0 {
+		remaining = l.maxRetries
+	}
+	if l.maxRatio > 0 {
+		ratio := int(l.maxRatio * float64(requestsCount))
+		if remaining < 0 || ratio < remaining {
+			remaining = ratio
+		}
+	}
+
+	return &retryBudget{remaining: int64(remaining)}
+}
+
+// take spends a retry and reports whether the budget allowed it.
+// A nil *retryBudget always allows it.
+func (r *retryBudget) take() bool {
+	if r == nil {
+		return true
+	}
+
+	return atomic.AddInt64(&r.remaining, -1) >= 0
+}
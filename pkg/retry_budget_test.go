@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetriesStopOnceTheBudgetIsSpent(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{},
+		WithRetry(3, time.Millisecond, 0), WithRetryBudget(2, 0))
+
+	bulkRequest := newClientWithNRequests(4, server.URL)
+	_, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	exhausted := 0
+	for _, err := range errs {
+		if err == interr.ErrRetryBudgetExhausted {
+			exhausted++
+		}
+	}
+	assert.True(t, exhausted >= 3, "%d requests exhausted the budget", exhausted)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&attempts))
+}
+
+func TestRetryBudgetIsTheLowestLimit(t *testing.T) {
+	assert.Equal(t, int64(10), (&retryBudgetLimits{maxRetries: 10}).newBudget(1000).remaining)
+	assert.Equal(t, int64(5), (&retryBudgetLimits{maxRatio: 0.05}).newBudget(100).remaining)
+	assert.Equal(t, int64(5), (&retryBudgetLimits{maxRetries: 10, maxRatio: 0.05}).newBudget(100).remaining)
+	assert.Equal(t, int64(3), (&retryBudgetLimits{maxRetries: 3, maxRatio: 0.05}).newBudget(100).remaining)
+
+	var unlimited *retryBudgetLimits
+	assert.True(t, unlimited.newBudget(100).take())
+}
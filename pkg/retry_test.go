@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransientFailuresAreRetriedWithTheSameBody(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRetry(3, time.Millisecond, 0.5))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString("the body"))
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, errs[0])
+	body, _ := ioutil.ReadAll(responses[0].Body)
+	assert.Equal(t, http.StatusOK, responses[0].StatusCode)
+	assert.Equal(t, "the body", string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
+
+func TestRetriesStopAfterTheMaxAttempts(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRetry(2, time.Millisecond, 0))
+
+	bulkRequest := newClientWithNRequests(1, server.URL)
+	responses, _ := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, http.StatusBadGateway, responses[0].StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestPermanentFailuresAreNotRetried(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRetry(3, time.Millisecond, 0))
+
+	bulkRequest := newClientWithNRequests(1, server.URL)
+	responses, _ := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, http.StatusBadRequest, responses[0].StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+// retryTooManyRequests is a retry policy retrying only the 429 responses, without delay.
+type retryTooManyRequests struct{}
+
+func (retryTooManyRequests) ShouldRetry(res *http.Response, err error, attempt int) (bool, time.Duration) {
+	return err == nil && res.StatusCode == http.StatusTooManyRequests && attempt < 5, 0
+}
+
+func TestCustomRetryPolicyIsConsulted(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRetryPolicy(retryTooManyRequests{}))
+
+	bulkRequest := newClientWithNRequests(1, server.URL)
+	responses, _ := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, http.StatusServiceUnavailable, responses[0].StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
+
+func TestExponentialBackoffDoublesTheDelay(t *testing.T) {
+	policy := ExponentialBackoff{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond}
+
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		retry, delay := policy.ShouldRetry(nil, errors.New("connection reset"), attempt+1)
+		assert.True(t, retry)
+		assert.Equal(t, expected, delay)
+	}
+
+	retry, _ := policy.ShouldRetry(nil, errors.New("connection reset"), 4)
+	assert.False(t, retry)
+}
+
+func TestExponentialBackoffCapsTheDelay(t *testing.T) {
+	policy := ExponentialBackoff{MaxAttempts: 1000, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	for _, attempt := range []int{7, 64, 100, 999} {
+		_, delay := policy.ShouldRetry(nil, errors.New("connection reset"), attempt)
+		assert.Equal(t, time.Minute, delay, "attempt %d", attempt)
+	}
+
+	policy.MaxDelay = 0
+	_, delay := policy.ShouldRetry(nil, errors.New("connection reset"), 999)
+	assert.Equal(t, defaultMaxRetryDelay, delay, "never overflowed")
+}
+
+func TestRequestBodyWithoutGetBodyIsStoredForTheRetries(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		attempt := len(bodies)
+		mu.Unlock()
+		if attempt < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRetry(3, time.Millisecond, 0))
+
+	// The anonymous struct hides the reader type, so http.NewRequest can't set GetBody.
+	req, err := http.NewRequest(http.MethodPost, server.URL, struct{ io.Reader }{strings.NewReader("payload")})
+	require.NoError(t, err, "no errors")
+	require.Nil(t, req.GetBody)
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, errs[0])
+	assert.Equal(t, http.StatusOK, responses[0].StatusCode)
+	assert.Equal(t, []string{"payload", "payload", "payload"}, bodies)
+}
+
+// failingReader is a request body that can't be read.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestUnreadableRequestBodyFailsWithoutBeingSent(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithRetry(3, time.Millisecond, 0))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, failingReader{})
+	require.NoError(t, err, "no errors")
+
+	_, errs := client.Do(NewBulkRequest([]*http.Request{req}, 1, 1))
+
+	assert.EqualError(t, errs[0], "http client error: error while reading the request body: broken pipe")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&attempts))
+}
@@ -0,0 +1,61 @@
+package pkg
+
+import "net/http"
+
+// WithSuccessStatuses makes the client consider the given status codes as successful in addition to the 2xx ones,
+// e.g. 304 Not Modified for a receiver answering that it already has the notification.
+// The successful responses pass the barriers, satisfy the dependencies, are not retried and are not retained by RetainFailures.
+func WithSuccessStatuses(codes ...int) Option {
+	return func(b *BulkHTTPClient) {
+		b.successCodes = make(map[int]bool)
+		for _, code := range codes {
+			b.successCodes[code] = true
+		}
+	}
+}
+
+// succeeded reports whether the request completed without errors and with a successful status code.
+func (b *BulkHTTPClient) succeeded(res *http.Response, err error) bool {
+	return IsSuccess(res, err, b.successCodes)
+}
+
+// SuccessStatuses returns the status codes the client considers as successful in addition to the 2xx ones,
+// see WithSuccessStatuses and IsSuccess.
+func (b *BulkHTTPClient) SuccessStatuses() map[int]bool {
+	codes := make(map[int]bool, len(b.successCodes))
+	for code := range b.successCodes {
+		codes[code] = true
+	}
+
+	return codes
+}
+
+// IsSuccess reports whether the request completed without errors and with a 2xx status code
+// or one of the given additional success codes.
+func IsSuccess(res *http.Response, err error, successCodes map[int]bool) bool {
+	if err != nil || res == nil {
+		return false
+	}
+
+	return (res.StatusCode >= 200 && res.StatusCode <= 299) || successCodes[res.StatusCode]
+}
+
+// hasNoBody reports whether the response can't have a body: the responses to HEAD requests,
+// the 1xx informational responses returned as final ones, e.g. 101 Switching Protocols,
+// and the 204 No Content, 205 Reset Content and 304 Not Modified responses.
+// Some receivers send no body at all, not even an empty one, so it is not read.
+func hasNoBody(req *http.Request, res *http.Response) bool {
+	if req != nil && req.Method == http.MethodHead {
+		return true
+	}
+	if res.StatusCode >= 100 && res.StatusCode <= 199 {
+		return true
+	}
+
+	switch res.StatusCode {
+	case http.StatusNoContent, http.StatusResetContent, http.StatusNotModified:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResetContentWithoutBodyIsNotRead(t *testing.T) {
+	// The receiver sends neither a body nor a Content-Length and keeps the connection open.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "no errors")
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = http.ReadRequest(bufio.NewReader(conn))
+		_, _ = conn.Write([]byte("HTTP/1.1 205 Reset Content\r\n\r\n"))
+		time.Sleep(time.Second)
+	}()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Timeout: 500 * time.Millisecond})
+
+	bulkRequest := newClientWithNRequests(1, "http://"+listener.Addr().String())
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Nil(t, errs[0])
+	body, _ := ioutil.ReadAll(responses[0].Body)
+	assert.Equal(t, http.StatusResetContent, responses[0].StatusCode)
+	assert.Empty(t, body)
+}
+
+func TestSuccessStatusesPassTheBarriers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/known" {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{}, WithSuccessStatuses(http.StatusNotModified))
+
+	known, err := http.NewRequest(http.MethodPost, server.URL+"/known", nil)
+	require.NoError(t, err, "no errors")
+
+	next, err := http.NewRequest(http.MethodPost, server.URL+"/next", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{known}, 1, 1).Barrier().AddRequest(next)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, http.StatusNotModified, responses[0].StatusCode)
+	assert.Equal(t, http.StatusOK, responses[1].StatusCode)
+}
+
+func TestSuccessStatusesAreNotRetried(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{}, WithRetry(3, time.Millisecond, 0), WithSuccessStatuses(http.StatusServiceUnavailable))
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{req}, 1, 1)
+	result := client.Send(context.Background(), bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	require.Len(t, result.Succeeded(), 1)
+	assert.Equal(t, 1, result.Entries[0].Attempts)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,37 @@
+package pkg
+
+import "context"
+
+// DoStream executes all the requests like Send, but returns their results one by one, as soon as each one
+// is processed, instead of all together at the end. The results are sent in the order they complete.
+// The requests that are not sent, e.g. because of a barrier or of the cancellation of the context,
+// are sent last. Without requests, a single result with the index -1 and interr.ErrRequestsNotFound is sent.
+// The channel is closed once every result has been sent, and it must be drained.
+// The responses are also kept in the bulk request: BulkRequest.CloseAllResponses still closes them.
+func (b *BulkHTTPClient) DoStream(ctx context.Context, bulkRequest *BulkRequest) <-chan Result {
+	results := make(chan Result)
+	emitted := make([]bool, len(bulkRequest.requests))
+	bulkRequest.onResult = func(flow requestFlow) {
+		emitted[flow.index] = true
+		results <- flow.result(bulkRequest.requests[flow.index])
+	}
+
+	go func() {
+		defer close(results)
+
+		result := b.Send(ctx, bulkRequest)
+		bulkRequest.onResult = nil
+		if result.Err != nil {
+			results <- Result{Index: -1, Err: result.Err}
+			return
+		}
+
+		for _, entry := range result.Entries {
+			if !emitted[entry.Index] {
+				results <- entry
+			}
+		}
+	}()
+
+	return results
+}
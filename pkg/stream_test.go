@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/interr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoStreamSendsTheResultsAsSoonAsTheyComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	slow, err := http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+	require.NoError(t, err, "no errors")
+
+	fast, err := http.NewRequest(http.MethodGet, server.URL+"/fast", nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{slow, fast}, 2, 2)
+	defer bulkRequest.CloseAllResponses()
+
+	var indexes []int
+	for result := range client.DoStream(context.Background(), bulkRequest) {
+		require.Nil(t, result.Err)
+		assert.Equal(t, http.StatusOK, result.Response.StatusCode)
+		indexes = append(indexes, result.Index)
+	}
+
+	assert.Equal(t, []int{1, 0}, indexes)
+}
+
+func TestDoStreamSendsTheRequestsNotStarted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := NewClient(&http.Client{})
+
+	first, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	second, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err, "no errors")
+
+	bulkRequest := NewBulkRequest([]*http.Request{first}, 1, 1).Barrier().AddRequest(second)
+	defer bulkRequest.CloseAllResponses()
+
+	var results []Result
+	for result := range client.DoStream(context.Background(), bulkRequest) {
+		results = append(results, result)
+	}
+
+	require.Len(t, results, 2)
+	assert.Equal(t, 0, results[0].Index)
+	assert.Equal(t, http.StatusInternalServerError, results[0].Response.StatusCode)
+	assert.Equal(t, 1, results[1].Index)
+	assert.Equal(t, interr.ErrBarrierNotPassed, results[1].Err)
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import "net/http"
+
+// SubBatchFlush receives the results of a sub-batch as soon as it completed.
+// The indexes are the positions of the requests in the whole bulk request.
+// The requests that are not started, e.g. because of a barrier, are not flushed.
+// The response bodies are shared with the results returned by Send: reading them here consumes them.
+type SubBatchFlush func(indexes []int, responses []*http.Response, errs []error)
+
+// subBatching configures how the client splits the bulk requests.
+type subBatching struct {
+	size  int
+	flush SubBatchFlush
+}
+
+// WithSubBatches makes the client execute the bulk requests in sub-batches of the given size,
+// one after the other, and pass the results of each sub-batch to the flush function,
+// e.g. to store them, so that they are not lost if the process stops before the end of the run.
+// A size lower than 1 disables the sub-batching.
+func WithSubBatches(size int, flush SubBatchFlush) Option {
+	return func(b *BulkHTTPClient) {
+		if size < 1 {
+			b.subBatching = nil
+			return
+		}
+
+		b.subBatching = &subBatching{
+			size:  size,
+			flush: flush,
+		}
+	}
+}
+
+// doRequests executes the requests at the given indexes of the bulk request and stores their results.
+// With sub-batching enabled, the requests are executed in sub-batches and the results of each one are flushed.
+// The requests are started in the fair order across the tenants, if any.
+func (b *BulkHTTPClient) doRequests(bulkRequest *BulkRequest, indexes []int) {
+	indexes = bulkRequest.fairOrder(indexes)
+	size := len(indexes)
+	if b.subBatching != nil {
+		size = b.subBatching.size
+	}
+
+	for start := 0; start < len(indexes); start += size {
+		end := start + size
+		if end > len(indexes) {
+			end = len(indexes)
+		}
+		batch := indexes[start:end]
+
+		subBatch := &BulkRequest{
+			ctx:                      bulkRequest.ctx,
+			dispatchRequestsWorkers:  bulkRequest.dispatchRequestsWorkers,
+			responseProcessorWorkers: bulkRequest.responseProcessorWorkers,
+			retryBudget:              bulkRequest.retryBudget,
+			gap:                      bulkRequest.gap,
+		}
+		if bulkRequest.onResult != nil {
+			subBatch.onResult = func(flow requestFlow) {
+				flow.index = batch[flow.index]
+				bulkRequest.onResult(flow)
+			}
+		}
+		for i, index := range batch {
+			subBatch.requests = append(subBatch.requests, bulkRequest.requests[index])
+			if options, ok := bulkRequest.options[index]; ok {
+				if subBatch.options == nil {
+					subBatch.options = map[int]requestOptions{}
+				}
+				subBatch.options[i] = options
+			}
+		}
+		b.doPhase(subBatch)
+
+		for i, index := range batch {
+			bulkRequest.responses[index] = subBatch.responses[i]
+			bulkRequest.errors[index] = subBatch.errors[i]
+			bulkRequest.states[index] = subBatch.states[i]
+		}
+
+		if b.subBatching != nil && b.subBatching.flush != nil {
+			b.subBatching.flush(batch, subBatch.responses, subBatch.errors)
+		}
+	}
+}
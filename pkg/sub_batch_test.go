@@ -0,0 +1,35 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestSubBatchesAreFlushedOneAfterTheOther(t *testing.T) {
+	server := StartMockServer()
+	defer server.Close()
+
+	var flushed [][]int
+	var flushedErrors int
+	flush := func(indexes []int, responses []*http.Response, errs []error) {
+		flushed = append(flushed, indexes)
+		for _, err := range errs {
+			if err != nil {
+				flushedErrors++
+			}
+		}
+	}
+
+	HTTPClient := &http.Client{Timeout: TimeoutBiggerThanServerTime}
+	client := NewBulkHTTPClient(context.Background(), HTTPClient, WithSubBatches(2, flush))
+	bulkRequest := newClientWithNRequests(5, server.URL)
+	responses, errs := client.Do(bulkRequest)
+	defer bulkRequest.CloseAllResponses()
+
+	assert.Equal(t, [][]int{{0, 1}, {2, 3}, {4}}, flushed)
+	assert.Equal(t, 0, flushedErrors)
+	assert.Equal(t, 5, len(responses))
+	assert.Equal(t, []error{nil, nil, nil, nil, nil}, errs)
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultMaxIdleConnsPerHost is the amount of idle connections kept per host by NewTransport, instead of the 2
+// of http.DefaultTransport which make most of the connections of a bulk request to the same host be closed
+// and established again.
+const defaultMaxIdleConnsPerHost = 100
+
+// TransportOption configures the transport returned by NewTransport.
+type TransportOption func(*transportSettings)
+
+// transportSettings holds the settings of the transport and of its dialer.
+type transportSettings struct {
+	transport *http.Transport
+	dialer    *net.Dialer
+}
+
+// NewTransport returns an HTTP transport tuned for bulk requests, to be used by the http.Client of the bulk client:
+// a clone of http.DefaultTransport keeping 100 idle connections per host, configured with the given options.
+func NewTransport(opts ...TransportOption) *http.Transport {
+	settings := transportSettings{
+		transport: http.DefaultTransport.(*http.Transport).Clone(),
+		dialer:    &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+	}
+	settings.transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	settings.transport.DialContext = settings.dialer.DialContext
+
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	if settings.transport.MaxIdleConns > 0 && settings.transport.MaxIdleConns < settings.transport.MaxIdleConnsPerHost {
+		settings.transport.MaxIdleConns = settings.transport.MaxIdleConnsPerHost
+	}
+
+	return settings.transport
+}
+
+// TransportMaxIdleConnsPerHost sets the amount of idle connections kept per host, see http.Transport.MaxIdleConnsPerHost.
+// It should be at least the amount of dispatch workers sending requests to a host, so that their connections are reused.
+// The amount of idle connections to all the hosts is raised accordingly when needed.
+func TransportMaxIdleConnsPerHost(n int) TransportOption {
+	return func(s *transportSettings) {
+		s.transport.MaxIdleConnsPerHost = n
+	}
+}
+
+// TransportMaxConnsPerHost limits the amount of connections per host, idle or not, see http.Transport.MaxConnsPerHost.
+// The requests wait for a connection beyond it. Zero, the default, means no limit.
+func TransportMaxConnsPerHost(n int) TransportOption {
+	return func(s *transportSettings) {
+		s.transport.MaxConnsPerHost = n
+	}
+}
+
+// TransportIdleConnTimeout sets how long an idle connection is kept before being closed,
+// see http.Transport.IdleConnTimeout. Zero means no limit.
+func TransportIdleConnTimeout(timeout time.Duration) TransportOption {
+	return func(s *transportSettings) {
+		s.transport.IdleConnTimeout = timeout
+	}
+}
+
+// TransportKeepAlive sets the interval of the TCP keep-alive probes of the connections, see net.Dialer.KeepAlive.
+// A negative interval disables the probes.
+func TransportKeepAlive(interval time.Duration) TransportOption {
+	return func(s *transportSettings) {
+		s.dialer.KeepAlive = interval
+	}
+}
+
+// TransportDisableKeepAlives closes the connections after each request instead of reusing them,
+// see http.Transport.DisableKeepAlives.
+func TransportDisableKeepAlives() TransportOption {
+	return func(s *transportSettings) {
+		s.transport.DisableKeepAlives = true
+	}
+}
@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTheTransportKeepsTheConnectionsOfTheBulkRequests(t *testing.T) {
+	var mu sync.Mutex
+	connections := map[string]bool{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			defer mu.Unlock()
+			connections[conn.RemoteAddr().String()] = true
+		}
+	}
+	server.Start()
+	defer server.Close()
+	client := NewBulkHTTPClient(context.Background(), &http.Client{Transport: NewTransport()})
+
+	for i := 0; i < 3; i++ {
+		bulkRequest := newClientWithNRequests(10, server.URL)
+		_, errs := client.Do(bulkRequest)
+		bulkRequest.CloseAllResponses()
+		for _, err := range errs {
+			require.NoError(t, err, "no errors")
+		}
+	}
+
+	assert.Len(t, connections, 10)
+}
+
+func TestTheTransportOptionsAreApplied(t *testing.T) {
+	transport := NewTransport(
+		TransportMaxIdleConnsPerHost(500),
+		TransportMaxConnsPerHost(50),
+		TransportIdleConnTimeout(time.Minute),
+		TransportDisableKeepAlives(),
+	)
+
+	assert.Equal(t, 500, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 500, transport.MaxIdleConns)
+	assert.Equal(t, 50, transport.MaxConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.True(t, transport.DisableKeepAlives)
+	assert.Zero(t, http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost, "the default transport is untouched")
+}
@@ -0,0 +1,180 @@
+package notifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// twilioDestinationKey is the metadata key holding the destination of the messages sent by a Twilio sink.
+const twilioDestinationKey = "twilio.to"
+
+// twilioSignatureHeader is the header holding the signature of the Twilio status callbacks.
+const twilioSignatureHeader = "X-Twilio-Signature"
+
+// errNoDestination is the error of the messages sent to a Twilio sink without destination.
+var errNoDestination = errors.New("the message has no destination phone number")
+
+// Twilio configures a sink sending SMS or WhatsApp messages with the Twilio Messages API, see TwilioSink.
+// The URL of the API defaults to https://api.twilio.com. The destination of a message is the one returned by To,
+// by default its "to" metadata, in the E.164 format, e.g. +14155550100. With WhatsApp, the numbers get
+// the "whatsapp:" prefix. The status callback, if any, is the URL Twilio posts the delivery statuses to,
+// see TwilioStatusHandler.
+type Twilio struct {
+	AccountSID     string
+	AuthToken      string
+	From           string
+	WhatsApp       bool
+	To             func(Message) string
+	StatusCallback string
+	URL            string
+}
+
+// TwilioSink returns a sink sending each message body as an SMS, or a WhatsApp message, with Twilio.
+// Twilio accepts the messages with a 201 status code and answers 429 when the account sends too many of them,
+// and 400 for the invalid destinations, which are not retried. It delivers the messages later, and posts their
+// delivery status to the status callback. Limit the rate of the messages sent to each destination with
+// pkg.WithRateLimitBy and TwilioDestination, e.g. so that a burst of alerts does not flood a single phone.
+func TwilioSink(config Twilio) Sink {
+	apiURL := config.URL
+	if apiURL == "" {
+		apiURL = "https://api.twilio.com"
+	}
+
+	credentials := base64.StdEncoding.EncodeToString([]byte(config.AccountSID + ":" + config.AuthToken))
+
+	return Sink{
+		URL:    strings.TrimRight(apiURL, "/") + "/2010-04-01/Accounts/" + url.PathEscape(config.AccountSID) + "/Messages.json",
+		Method: http.MethodPost,
+		Header: http.Header{"Authorization": {"Basic " + credentials}},
+		Transform: func(message Message) (Message, error) {
+			to := twilioDestination(config, message)
+			if to == "" {
+				return message, errNoDestination
+			}
+
+			form := url.Values{}
+			form.Set("To", twilioAddress(config, to))
+			form.Set("From", twilioAddress(config, config.From))
+			form.Set("Body", strings.TrimSpace(string(message.Body)))
+			if config.StatusCallback != "" {
+				form.Set("StatusCallback", config.StatusCallback)
+			}
+
+			metadata := map[string]string{twilioDestinationKey: to}
+			for key, value := range message.Metadata {
+				if key != twilioDestinationKey {
+					metadata[key] = value
+				}
+			}
+
+			message.Body = []byte(form.Encode())
+			message.ContentType = "application/x-www-form-urlencoded"
+			message.Metadata = metadata
+			return message, nil
+		},
+	}
+}
+
+// TwilioDestination returns the destination of a request sent by a Twilio sink, given the request,
+// and an empty string for the other requests. It is the rate limit key of pkg.WithRateLimitBy
+// limiting the messages sent to each destination:
+//
+//	notifier.WithClientOptions(pkg.WithRateLimitBy(notifier.TwilioDestination, 1.0/60, 3))
+func TwilioDestination(req *http.Request) string {
+	return MessageMetadata(req.Context())[twilioDestinationKey]
+}
+
+// twilioDestination returns the destination of the message.
+func twilioDestination(config Twilio, message Message) string {
+	if config.To != nil {
+		return config.To(message)
+	}
+
+	return message.Metadata["to"]
+}
+
+// twilioAddress returns the Twilio address of the phone number: the number itself for SMS,
+// and the number with the "whatsapp:" prefix for WhatsApp.
+func twilioAddress(config Twilio, number string) string {
+	if !config.WhatsApp || strings.HasPrefix(number, "whatsapp:") {
+		return number
+	}
+
+	return "whatsapp:" + number
+}
+
+// TwilioStatus is the delivery status of a message sent by a Twilio sink, posted by Twilio to the status callback:
+// queued, sent, delivered, undelivered, failed or, for WhatsApp, read. The error code, if any, tells why the message
+// was not delivered, e.g. 30003 for an unreachable destination.
+type TwilioStatus struct {
+	MessageSID string
+	Status     string
+	To         string
+	From       string
+	ErrorCode  string
+}
+
+// Delivered reports whether the message reached its destination.
+func (s TwilioStatus) Delivered() bool {
+	return s.Status == "delivered" || s.Status == "read"
+}
+
+// TwilioStatusHandler returns the handler of the Twilio status callbacks of the given sink configuration,
+// which feeds the delivery statuses to the report function, e.g. to store them with the results of the run
+// or to record them as metrics. The callbacks are authenticated with their X-Twilio-Signature header,
+// computed with the auth token over the status callback URL: those without a valid signature are rejected.
+func TwilioStatusHandler(config Twilio, report func(TwilioStatus)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := req.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		expected := twilioSignature(config.AuthToken, config.StatusCallback, req.PostForm)
+		if !hmac.Equal([]byte(expected), []byte(req.Header.Get(twilioSignatureHeader))) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		report(TwilioStatus{
+			MessageSID: req.PostForm.Get("MessageSid"),
+			Status:     req.PostForm.Get("MessageStatus"),
+			To:         req.PostForm.Get("To"),
+			From:       req.PostForm.Get("From"),
+			ErrorCode:  req.PostForm.Get("ErrorCode"),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// twilioSignature returns the signature of a Twilio request: the base64 HMAC-SHA1 of the URL followed by
+// the names and values of the POST parameters, sorted by name, keyed by the auth token.
+func twilioSignature(authToken string, callbackURL string, form url.Values) string {
+	var data strings.Builder
+	data.WriteString(callbackURL)
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range form[name] {
+			data.WriteString(name)
+			data.WriteString(value)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(data.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
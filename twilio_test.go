@@ -0,0 +1,115 @@
+package notifier
+
+import (
+	"context"
+	"github.com/pigeonlab/notifier/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTheTwilioSinkSendsWhatsAppMessages(t *testing.T) {
+	var mu sync.Mutex
+	var forms []url.Values
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, password, _ := req.BasicAuth()
+		body, _ := ioutil.ReadAll(req.Body)
+		form, _ := url.ParseQuery(string(body))
+		mu.Lock()
+		defer mu.Unlock()
+		forms = append(forms, form)
+		paths = append(paths, req.Method+" "+req.URL.Path+" "+user+":"+password+" "+req.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	var destinations []string
+	var failures []error
+	engine := NewEngine(
+		SourceFunc(messages(
+			Message{Body: []byte("Your code is 1234"), Metadata: map[string]string{"to": "+14155550100"}},
+			Message{Body: []byte("Your code is 5678")},
+		)),
+		WithSink("twilio", TwilioSink(Twilio{
+			AccountSID:     "AC123",
+			AuthToken:      "token",
+			From:           "+14155550199",
+			WhatsApp:       true,
+			StatusCallback: "https://example.com/twilio/status",
+			URL:            server.URL,
+		})),
+		WithClientOptions(pkg.WithRateLimitBy(func(req *http.Request) string {
+			mu.Lock()
+			defer mu.Unlock()
+			destinations = append(destinations, TwilioDestination(req))
+			return TwilioDestination(req)
+		}, 1, 1)),
+		WithDeadLetterQueue(deadLetters(func(delivery Delivery) { failures = append(failures, delivery.Err) })),
+	)
+	stats, err := engine.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Delivered)
+	assert.Equal(t, []string{"POST /2010-04-01/Accounts/AC123/Messages.json AC123:token application/x-www-form-urlencoded"}, paths)
+	assert.Equal(t, url.Values{
+		"To":             {"whatsapp:+14155550100"},
+		"From":           {"whatsapp:+14155550199"},
+		"Body":           {"Your code is 1234"},
+		"StatusCallback": {"https://example.com/twilio/status"},
+	}, forms[0])
+	assert.Equal(t, []string{"+14155550100"}, destinations)
+	require.Len(t, failures, 1)
+	assert.Contains(t, failures[0].Error(), errNoDestination.Error())
+}
+
+func TestTheTwilioStatusCallbacksAreReported(t *testing.T) {
+	config := Twilio{AuthToken: "token", StatusCallback: "https://example.com/twilio/status"}
+	var statuses []TwilioStatus
+	handler := TwilioStatusHandler(config, func(status TwilioStatus) { statuses = append(statuses, status) })
+	form := url.Values{
+		"MessageSid":    {"SM123"},
+		"MessageStatus": {"undelivered"},
+		"To":            {"+14155550100"},
+		"From":          {"+14155550199"},
+		"ErrorCode":     {"30003"},
+	}
+
+	signed := httptest.NewRequest(http.MethodPost, "/twilio/status", strings.NewReader(form.Encode()))
+	signed.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signed.Header.Set(twilioSignatureHeader, twilioSignature("token", config.StatusCallback, form))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, signed)
+
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, TwilioStatus{MessageSID: "SM123", Status: "undelivered", To: "+14155550100", From: "+14155550199", ErrorCode: "30003"}, statuses[0])
+	assert.False(t, statuses[0].Delivered())
+
+	forged := httptest.NewRequest(http.MethodPost, "/twilio/status", strings.NewReader(form.Encode()))
+	forged.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	forged.Header.Set(twilioSignatureHeader, twilioSignature("other", config.StatusCallback, form))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, forged)
+
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Len(t, statuses, 1)
+}
+
+func TestTheTwilioSignatureMatchesTheDocumentedOne(t *testing.T) {
+	form := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+
+	assert.Equal(t, "0/KCTR6DLpKmkAf8muzZqo1nDgQ=", twilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", form))
+}